@@ -100,6 +100,9 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	// 停止后台任务
+	server.Close()
+
 	// 关闭数据库连接
 	if sqlDB, err := db.DB(); err == nil {
 		sqlDB.Close()
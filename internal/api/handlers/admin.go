@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,15 +11,22 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	"github.com/liusCraft/orion/internal/services/ai"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
 	pkgErrors "github.com/liusCraft/orion/pkg/errors"
 )
 
 type AdminHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	models      *ai.Registry         // 修改 llm_profile 类型的配置后立即重新加载
+	sessions    *authSvc.Sessions    // 停用用户时撤销其全部会话
+	apiKeys     *authSvc.APIKeys     // 服务账号的 API Key；修改用户后清除其密钥的校验缓存
+	permissions *authSvc.Permissions // 只能授出自己具备的权限；修改角色后清除有效权限缓存
 }
 
-func NewAdminHandler(db *gorm.DB) *AdminHandler {
-	return &AdminHandler{db: db}
+func NewAdminHandler(db *gorm.DB, models *ai.Registry, sessions *authSvc.Sessions, apiKeys *authSvc.APIKeys, permissions *authSvc.Permissions) *AdminHandler {
+	return &AdminHandler{db: db, models: models, sessions: sessions, apiKeys: apiKeys, permissions: permissions}
 }
 
 type CreateUserRequest struct {
@@ -55,6 +63,7 @@ type UserManagementResponse struct {
 	Role        string     `json:"role"`
 	Department  string     `json:"department"`
 	Status      string     `json:"status"`
+	AccountType string     `json:"accountType"` // human, service
 	LastLoginAt *time.Time `json:"lastLoginAt"`
 	CreatedAt   time.Time  `json:"createdAt"`
 	UpdatedAt   time.Time  `json:"updatedAt"`
@@ -86,16 +95,6 @@ type SystemStatsResponse struct {
 
 // 用户管理
 func (h *AdminHandler) CreateUser(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40304,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	var req CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
@@ -106,6 +105,10 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	if !h.checkAssign(c, req.Role, req.Department) {
+		return
+	}
+
 	// 检查用户名和邮箱是否已存在
 	var count int64
 	if err := h.db.Model(&models.User{}).Where("username = ? OR email = ?", req.Username, req.Email).Count(&count).Error; err != nil {
@@ -142,7 +145,7 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 		user.Status = req.Status
 	}
 
-	if err := h.db.Create(&user).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50042,
 			"创建用户失败",
@@ -160,6 +163,7 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 		Role:        user.Role,
 		Department:  user.Department,
 		Status:      user.Status,
+		AccountType: user.AccountType,
 		LastLoginAt: user.LastLoginAt,
 		CreatedAt:   user.CreatedAt,
 		UpdatedAt:   user.UpdatedAt,
@@ -169,16 +173,6 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 }
 
 func (h *AdminHandler) GetUsers(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40305,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	// 分页参数（优先驼峰，兼容下划线）
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSizeStr := c.Query("pageSize")
@@ -189,6 +183,7 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 	userRole := c.Query("role")
 	status := c.Query("status")
 	department := c.Query("department")
+	accountType := c.Query("accountType")
 	search := c.Query("search")
 
 	if page < 1 {
@@ -210,6 +205,9 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 	if department != "" {
 		query = query.Where("department = ?", department)
 	}
+	if accountType != "" {
+		query = query.Where("account_type = ?", accountType)
+	}
 	if search != "" {
 		query = query.Where("username ILIKE ? OR email ILIKE ? OR display_name ILIKE ?",
 			"%"+search+"%", "%"+search+"%", "%"+search+"%")
@@ -242,6 +240,7 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 			Role:        user.Role,
 			Department:  user.Department,
 			Status:      user.Status,
+			AccountType: user.AccountType,
 			LastLoginAt: user.LastLoginAt,
 			CreatedAt:   user.CreatedAt,
 			UpdatedAt:   user.UpdatedAt,
@@ -262,16 +261,6 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 }
 
 func (h *AdminHandler) GetUser(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40306,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	userID := c.Param("id")
 
 	var user models.User
@@ -293,6 +282,7 @@ func (h *AdminHandler) GetUser(c *gin.Context) {
 		Role:        user.Role,
 		Department:  user.Department,
 		Status:      user.Status,
+		AccountType: user.AccountType,
 		LastLoginAt: user.LastLoginAt,
 		CreatedAt:   user.CreatedAt,
 		UpdatedAt:   user.UpdatedAt,
@@ -302,16 +292,6 @@ func (h *AdminHandler) GetUser(c *gin.Context) {
 }
 
 func (h *AdminHandler) UpdateUser(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40307,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	userID := c.Param("id")
 
 	var user models.User
@@ -334,6 +314,20 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// 角色或部门变化时须具备新角色与部门角色的全部权限
+	if (req.Role != "" && req.Role != user.Role) || (req.Department != "" && req.Department != user.Department) {
+		role, department := user.Role, user.Department
+		if req.Role != "" {
+			role = req.Role
+		}
+		if req.Department != "" {
+			department = req.Department
+		}
+		if !h.checkAssign(c, role, department) {
+			return
+		}
+	}
+
 	// 更新用户
 	updates := map[string]interface{}{
 		"updated_at": time.Now(),
@@ -352,7 +346,7 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		updates["status"] = req.Status
 	}
 
-	if err := h.db.Model(&user).Updates(updates).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&user).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50044,
 			"更新用户失败",
@@ -361,6 +355,16 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// 停用或暂停的用户立即下线
+	if req.Status != "" && req.Status != "active" {
+		if _, err := h.sessions.RevokeAll(c.Request.Context(), user.ID, uuid.Nil, authSvc.ReasonUserDisabled); err != nil {
+			logger.Warn("撤销用户会话失败 user=%s: %v", user.ID, err)
+		}
+	}
+	// 角色、部门与状态变化对 API Key 与有效权限立即生效
+	h.apiKeys.ForgetUser(user.ID)
+	h.permissions.ForgetUser(user.ID)
+
 	// 重新查询更新后的数据
 	h.db.Where("id = ?", userID).First(&user)
 
@@ -373,6 +377,7 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		Role:        user.Role,
 		Department:  user.Department,
 		Status:      user.Status,
+		AccountType: user.AccountType,
 		LastLoginAt: user.LastLoginAt,
 		CreatedAt:   user.CreatedAt,
 		UpdatedAt:   user.UpdatedAt,
@@ -382,16 +387,6 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 }
 
 func (h *AdminHandler) DeleteUser(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40308,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	userID := c.Param("id")
 	currentUserID, _ := c.Get("user_id")
 
@@ -416,7 +411,7 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 	}
 
 	// 软删除：设置状态为inactive
-	if err := h.db.Model(&user).Update("status", "inactive").Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&user).Update("status", "inactive").Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50045,
 			"删除用户失败",
@@ -424,22 +419,16 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 		))
 		return
 	}
+	if _, err := h.sessions.RevokeAll(c.Request.Context(), user.ID, uuid.Nil, authSvc.ReasonUserDisabled); err != nil {
+		logger.Warn("撤销用户会话失败 user=%s: %v", user.ID, err)
+	}
+	h.apiKeys.ForgetUser(user.ID)
 
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("用户删除成功"))
 }
 
 // 系统配置管理
 func (h *AdminHandler) CreateSystemConfig(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40309,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	userID, _ := c.Get("user_id")
 
 	var req SystemConfigRequest
@@ -451,6 +440,16 @@ func (h *AdminHandler) CreateSystemConfig(c *gin.Context) {
 		))
 		return
 	}
+	if req.ConfigType == ai.ProfileConfigType {
+		if err := ai.ValidateProfileConfig(req.ConfigValue); err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+				40046,
+				"模型配置无效",
+				err.Error(),
+			))
+			return
+		}
+	}
 
 	// 检查配置键是否已存在
 	var count int64
@@ -483,7 +482,7 @@ func (h *AdminHandler) CreateSystemConfig(c *gin.Context) {
 		UpdatedBy:   &userUUID,
 	}
 
-	if err := h.db.Create(&config).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&config).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50047,
 			"创建配置失败",
@@ -491,11 +490,12 @@ func (h *AdminHandler) CreateSystemConfig(c *gin.Context) {
 		))
 		return
 	}
+	h.reloadModels(c, config.ConfigType)
 
 	response := SystemConfigResponse{
 		ID:          config.ID,
 		ConfigKey:   config.ConfigKey,
-		ConfigValue: config.ConfigValue,
+		ConfigValue: maskProfileConfig(config),
 		Description: config.Description,
 		ConfigType:  config.ConfigType,
 		IsEncrypted: config.IsEncrypted,
@@ -508,16 +508,6 @@ func (h *AdminHandler) CreateSystemConfig(c *gin.Context) {
 }
 
 func (h *AdminHandler) GetSystemConfigs(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40310,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	configType := c.Query("config_type")
 
 	query := h.db.Model(&models.SystemConfig{})
@@ -551,7 +541,7 @@ func (h *AdminHandler) GetSystemConfigs(c *gin.Context) {
 		responses = append(responses, SystemConfigResponse{
 			ID:            config.ID,
 			ConfigKey:     config.ConfigKey,
-			ConfigValue:   config.ConfigValue,
+			ConfigValue:   maskProfileConfig(config),
 			Description:   config.Description,
 			ConfigType:    config.ConfigType,
 			IsEncrypted:   config.IsEncrypted,
@@ -566,16 +556,6 @@ func (h *AdminHandler) GetSystemConfigs(c *gin.Context) {
 }
 
 func (h *AdminHandler) UpdateSystemConfig(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40311,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	userID, _ := c.Get("user_id")
 	configID := c.Param("id")
 
@@ -598,10 +578,21 @@ func (h *AdminHandler) UpdateSystemConfig(c *gin.Context) {
 		))
 		return
 	}
+	if req.ConfigType == ai.ProfileConfigType {
+		keepStoredAPIKey(req.ConfigValue, config)
+		if err := ai.ValidateProfileConfig(req.ConfigValue); err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+				40046,
+				"模型配置无效",
+				err.Error(),
+			))
+			return
+		}
+	}
 
 	// 更新配置
 	updates := map[string]interface{}{
-		"config_value": req.ConfigValue,
+		"config_value": models.JSONMap(req.ConfigValue),
 		"description":  req.Description,
 		"config_type":  req.ConfigType,
 		"is_encrypted": req.IsEncrypted,
@@ -609,7 +600,7 @@ func (h *AdminHandler) UpdateSystemConfig(c *gin.Context) {
 		"updated_at":   time.Now(),
 	}
 
-	if err := h.db.Model(&config).Updates(updates).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&config).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50049,
 			"更新配置失败",
@@ -617,6 +608,7 @@ func (h *AdminHandler) UpdateSystemConfig(c *gin.Context) {
 		))
 		return
 	}
+	h.reloadModels(c, config.ConfigType, req.ConfigType)
 
 	// 重新查询更新后的数据
 	h.db.Preload("UpdatedByUser").Where("id = ?", configID).First(&config)
@@ -633,7 +625,7 @@ func (h *AdminHandler) UpdateSystemConfig(c *gin.Context) {
 	response := SystemConfigResponse{
 		ID:            config.ID,
 		ConfigKey:     config.ConfigKey,
-		ConfigValue:   config.ConfigValue,
+		ConfigValue:   maskProfileConfig(config),
 		Description:   config.Description,
 		ConfigType:    config.ConfigType,
 		IsEncrypted:   config.IsEncrypted,
@@ -647,16 +639,6 @@ func (h *AdminHandler) UpdateSystemConfig(c *gin.Context) {
 }
 
 func (h *AdminHandler) DeleteSystemConfig(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40312,
-			"权限不足",
-			nil,
-		))
-		return
-	}
-
 	configID := c.Param("id")
 
 	var config models.SystemConfig
@@ -669,7 +651,7 @@ func (h *AdminHandler) DeleteSystemConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Delete(&config).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Delete(&config).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50050,
 			"删除配置失败",
@@ -677,22 +659,78 @@ func (h *AdminHandler) DeleteSystemConfig(c *gin.Context) {
 		))
 		return
 	}
+	h.reloadModels(c, config.ConfigType)
 
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("配置删除成功"))
 }
 
-// 系统统计
-func (h *AdminHandler) GetSystemStats(c *gin.Context) {
-	role, _ := c.Get("role")
-	if role.(string) != "admin" {
-		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
-			40313,
-			"权限不足",
-			nil,
-		))
-		return
+// ReloadModels 立即重新加载模型配置，返回生效的配置与无效配置的错误
+func (h *AdminHandler) ReloadModels(c *gin.Context) {
+	errs := []string{}
+	if err := h.models.Reload(c.Request.Context(), h.db); err != nil {
+		errs = append(errs, err.Error())
 	}
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"profiles": h.models.Profiles(),
+		"errors":   errs,
+	}))
+}
 
+// reloadModels 涉及模型配置时重新加载（其它实例在下一个加载周期生效）
+func (h *AdminHandler) reloadModels(c *gin.Context, configTypes ...string) {
+	for _, t := range configTypes {
+		if t == ai.ProfileConfigType {
+			if err := h.models.Reload(c.Request.Context(), h.db); err != nil {
+				logger.Warn("重新加载模型配置失败: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// maskedAPIKey 返回模型配置时代替 api_key 的占位值，更新时原样提交表示保留已保存的密钥
+const maskedAPIKey = "***"
+
+// maskProfileConfig 模型配置（llm_profile）的 api_key 以占位值返回，其它配置原样返回
+func maskProfileConfig(config models.SystemConfig) models.JSONMap {
+	if config.ConfigType != ai.ProfileConfigType {
+		return config.ConfigValue
+	}
+	masked := make(models.JSONMap, len(config.ConfigValue))
+	for k, v := range config.ConfigValue {
+		if isAPIKeyField(k) && v != "" {
+			v = maskedAPIKey
+		}
+		masked[k] = v
+	}
+	return masked
+}
+
+// keepStoredAPIKey 提交的 api_key 仍为占位值时换回已保存的密钥（原配置没有密钥时去掉该字段）
+func keepStoredAPIKey(values map[string]interface{}, stored models.SystemConfig) {
+	for k, v := range values {
+		if !isAPIKeyField(k) || v != maskedAPIKey {
+			continue
+		}
+		delete(values, k)
+		if stored.ConfigType != ai.ProfileConfigType {
+			continue
+		}
+		for sk, sv := range stored.ConfigValue {
+			if isAPIKeyField(sk) {
+				values[k] = sv
+			}
+		}
+	}
+}
+
+// isAPIKeyField 模型配置的键不区分大小写（与 config.DecodeLLMConfig 一致）
+func isAPIKeyField(key string) bool {
+	return strings.EqualFold(key, "api_key")
+}
+
+// 系统统计
+func (h *AdminHandler) GetSystemStats(c *gin.Context) {
 	var stats SystemStatsResponse
 
 	// 统计用户数据
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	auditSvc "github.com/liusCraft/orion/internal/services/audit"
+	pkgErrors "github.com/liusCraft/orion/pkg/errors"
+)
+
+// auditExportBatch 导出时每批读取的条数
+const auditExportBatch = 500
+
+// GetAuditLogs 查询审计日志，format 为 csv 或 jsonl 时导出全部满足条件的记录
+// 可按操作者（userId）、动作（action，逗号分隔多个）、资源（resourceType、resourceId）与时间范围（from、to）过滤。
+func (h *AdminHandler) GetAuditLogs(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40054, "查询参数错误", err.Error()))
+		return
+	}
+
+	switch format := c.Query("format"); format {
+	case "":
+	case auditSvc.FormatCSV, auditSvc.FormatJSONL:
+		h.exportAuditLogs(c, filter, format)
+		return
+	default:
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40054, "查询参数错误", "format 应为 csv 或 jsonl"))
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	query := filter.Apply(h.db.Model(&models.AuditLog{}))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50076,
+			"查询审计日志失败",
+			err.Error(),
+		))
+		return
+	}
+
+	var logs []models.AuditLog
+	if err := query.Joins("User").
+		Order("audit_logs.created_at DESC, audit_logs.id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50076,
+			"查询审计日志失败",
+			err.Error(),
+		))
+		return
+	}
+
+	entries := make([]auditSvc.Entry, 0, len(logs))
+	for _, log := range logs {
+		entries = append(entries, auditSvc.NewEntry(log))
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"data": entries,
+		"pagination": map[string]interface{}{
+			"page":      page,
+			"pageSize":  pageSize,
+			"total":     total,
+			"totalPage": (total + int64(pageSize) - 1) / int64(pageSize),
+		},
+	}))
+}
+
+// exportAuditLogs 按时间顺序分批读取并写出，导出本身也记录审计日志
+func (h *AdminHandler) exportAuditLogs(c *gin.Context, filter auditSvc.Filter, format string) {
+	exporter, err := auditSvc.NewExporter(c.Writer, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40054, "查询参数错误", err.Error()))
+		return
+	}
+
+	if err := auditSvc.Record(c.Request.Context(), h.db, models.AuditLog{
+		Action:       auditSvc.ActionExport,
+		ResourceType: "audit_log",
+		NewValues:    models.JSONMap{"format": format, "query": c.Request.URL.RawQuery},
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50076,
+			"查询审计日志失败",
+			err.Error(),
+		))
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == auditSvc.FormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-logs-%s.%s"`, time.Now().Format("20060102150405"), format))
+	c.Status(http.StatusOK)
+
+	// 响应已开始写出，之后的错误只能记录日志
+	var last *models.AuditLog
+	for {
+		query := filter.Apply(h.db.Model(&models.AuditLog{})).Joins("User")
+		if last != nil {
+			query = query.Where("(audit_logs.created_at, audit_logs.id) > (?, ?)", last.CreatedAt, last.ID)
+		}
+		var logs []models.AuditLog
+		if err := query.Order("audit_logs.created_at, audit_logs.id").Limit(auditExportBatch).Find(&logs).Error; err != nil {
+			logger.Error("导出审计日志失败: %v", err)
+			return
+		}
+		for _, log := range logs {
+			if err := exporter.Write(auditSvc.NewEntry(log)); err != nil {
+				logger.Error("导出审计日志失败: %v", err)
+				return
+			}
+		}
+		if len(logs) < auditExportBatch {
+			break
+		}
+		last = &logs[len(logs)-1]
+	}
+	if err := exporter.Flush(); err != nil {
+		logger.Error("导出审计日志失败: %v", err)
+	}
+}
+
+// parseAuditFilter 解析审计日志的查询条件，时间可以是 RFC 3339 或 YYYY-MM-DD（to 为日期时包含当天）
+func parseAuditFilter(c *gin.Context) (auditSvc.Filter, error) {
+	var filter auditSvc.Filter
+	if v := c.Query("userId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return filter, errors.New("userId 应为 UUID")
+		}
+		filter.UserID = &id
+	}
+	if v := c.Query("resourceId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return filter, errors.New("resourceId 应为 UUID")
+		}
+		filter.ResourceID = &id
+	}
+	filter.ResourceType = c.Query("resourceType")
+	for _, action := range strings.Split(c.Query("action"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			filter.Actions = append(filter.Actions, action)
+		}
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseAuditTime(v)
+		if err != nil {
+			return filter, errors.New("from 应为 RFC 3339 时间或 YYYY-MM-DD")
+		}
+		filter.From = &from
+	}
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, err := parseAuditTime(v)
+		if err != nil {
+			return filter, errors.New("to 应为 RFC 3339 时间或 YYYY-MM-DD")
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return filter, errors.New("to 应晚于 from")
+	}
+	return filter, nil
+}
+
+func parseAuditTime(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+	return t, true, err
+}
@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	pkgErrors "github.com/liusCraft/orion/pkg/errors"
+)
+
+// RoleRequest 创建或更新角色
+type RoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleAssignmentRequest 把角色分配给用户或部门
+type RoleAssignmentRequest struct {
+	RoleID      uuid.UUID `json:"roleId" binding:"required"`
+	SubjectType string    `json:"subjectType" binding:"required,oneof=user department"`
+	Subject     string    `json:"subject" binding:"required,max=100"` // 用户ID或部门名称
+}
+
+type RoleResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Permissions []string   `json:"permissions"`
+	BuiltIn     bool       `json:"builtIn"`
+	Assignments int64      `json:"assignments"` // 分配给用户与部门的次数，不含作为基础角色的用户
+	UpdatedBy   *uuid.UUID `json:"updatedBy"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+type RoleAssignmentResponse struct {
+	ID          uuid.UUID `json:"id"`
+	RoleID      uuid.UUID `json:"roleId"`
+	RoleName    string    `json:"roleName"`
+	SubjectType string    `json:"subjectType"`
+	Subject     string    `json:"subject"`
+	Username    string    `json:"username,omitempty"` // 分配给用户时返回用户名
+	CreatedBy   uuid.UUID `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func toRoleResponse(r models.Role, assignments int64) RoleResponse {
+	return RoleResponse{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: r.Permissions,
+		BuiltIn:     r.BuiltIn,
+		Assignments: assignments,
+		UpdatedBy:   r.UpdatedBy,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+}
+
+// GetPermissionCatalog 全部可分配的权限，供角色编辑界面使用
+func (h *AdminHandler) GetPermissionCatalog(c *gin.Context) {
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(authSvc.PermissionCatalog))
+}
+
+// GetRoles 查询全部角色，附带分配次数
+func (h *AdminHandler) GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := h.db.Order("built_in DESC, name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50069,
+			"查询角色失败",
+			err.Error(),
+		))
+		return
+	}
+
+	type count struct {
+		RoleID uuid.UUID
+		Total  int64
+	}
+	var counts []count
+	h.db.Model(&models.RoleAssignment{}).Select("role_id, COUNT(*) AS total").Group("role_id").Scan(&counts)
+	totals := make(map[uuid.UUID]int64, len(counts))
+	for _, n := range counts {
+		totals[n.RoleID] = n.Total
+	}
+
+	responses := make([]RoleResponse, 0, len(roles))
+	for _, r := range roles {
+		responses = append(responses, toRoleResponse(r, totals[r.ID]))
+	}
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(responses))
+}
+
+// CreateRole 创建自定义角色
+func (h *AdminHandler) CreateRole(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40052,
+			"角色参数无效",
+			err.Error(),
+		))
+		return
+	}
+	perms, err := authSvc.ValidatePermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40052,
+			"角色参数无效",
+			err.Error(),
+		))
+		return
+	}
+	if !h.canGrant(c, perms) {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			40315,
+			"不能授予自己不具备的权限",
+			nil,
+		))
+		return
+	}
+	if h.roleNameExists(req.Name, uuid.Nil) {
+		c.JSON(http.StatusConflict, pkgErrors.NewErrorResponse(
+			40945,
+			"角色已存在",
+			nil,
+		))
+		return
+	}
+
+	uid := userID.(uuid.UUID)
+	role := models.Role{
+		ID:          uuid.New(),
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: perms,
+		UpdatedBy:   &uid,
+	}
+	if err := h.db.WithContext(c.Request.Context()).Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50070,
+			"创建角色失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(toRoleResponse(role, 0)))
+}
+
+// UpdateRole 更新角色；内置角色不能改名，admin 不能修改
+func (h *AdminHandler) UpdateRole(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var role models.Role
+	if err := h.db.Where("id = ?", c.Param("id")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40449,
+			"角色不存在",
+			nil,
+		))
+		return
+	}
+
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40052,
+			"角色参数无效",
+			err.Error(),
+		))
+		return
+	}
+	perms, err := authSvc.ValidatePermissions(req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40052,
+			"角色参数无效",
+			err.Error(),
+		))
+		return
+	}
+	switch {
+	case role.Name == authSvc.RoleAdmin:
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40052,
+			"角色参数无效",
+			"内置角色 admin 不能修改",
+		))
+		return
+	case role.BuiltIn && req.Name != role.Name:
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40052,
+			"角色参数无效",
+			"内置角色不能改名",
+		))
+		return
+	}
+	// 修改前后的权限都须自己具备，不能借此削弱或提升比自己权限高的角色
+	if !h.canGrant(c, role.Permissions) || !h.canGrant(c, perms) {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			40315,
+			"不能授予自己不具备的权限",
+			nil,
+		))
+		return
+	}
+	if h.roleNameExists(req.Name, role.ID) {
+		c.JSON(http.StatusConflict, pkgErrors.NewErrorResponse(
+			40945,
+			"角色已存在",
+			nil,
+		))
+		return
+	}
+
+	uid := userID.(uuid.UUID)
+	role.Name = req.Name
+	role.Description = req.Description
+	role.Permissions = perms
+	role.UpdatedBy = &uid
+	role.UpdatedAt = time.Now()
+	if err := h.db.WithContext(c.Request.Context()).Save(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50071,
+			"更新角色失败",
+			err.Error(),
+		))
+		return
+	}
+	h.permissions.ForgetAll()
+
+	var assignments int64
+	h.db.Model(&models.RoleAssignment{}).Where("role_id = ?", role.ID).Count(&assignments)
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(toRoleResponse(role, assignments)))
+}
+
+// DeleteRole 删除自定义角色及其全部分配；内置角色不能删除
+func (h *AdminHandler) DeleteRole(c *gin.Context) {
+	var role models.Role
+	if err := h.db.Where("id = ?", c.Param("id")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40449,
+			"角色不存在",
+			nil,
+		))
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40052,
+			"角色参数无效",
+			"内置角色不能删除",
+		))
+		return
+	}
+	if !h.canGrant(c, role.Permissions) {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			40315,
+			"不能授予自己不具备的权限",
+			nil,
+		))
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.RoleAssignment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50072,
+			"删除角色失败",
+			err.Error(),
+		))
+		return
+	}
+	h.permissions.ForgetAll()
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("角色删除成功"))
+}
+
+// GetRoleAssignments 查询角色分配，可按 roleId、subjectType、subject 过滤
+func (h *AdminHandler) GetRoleAssignments(c *gin.Context) {
+	query := h.db.Model(&models.RoleAssignment{}).Joins("Role")
+	if roleID := c.Query("roleId"); roleID != "" {
+		if _, err := uuid.Parse(roleID); err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+				40053,
+				"角色分配参数无效",
+				"roleId 无效",
+			))
+			return
+		}
+		query = query.Where("role_assignments.role_id = ?", roleID)
+	}
+	if subjectType := c.Query("subjectType"); subjectType != "" {
+		query = query.Where("role_assignments.subject_type = ?", subjectType)
+	}
+	if subject := c.Query("subject"); subject != "" {
+		query = query.Where("role_assignments.subject = ?", subject)
+	}
+
+	var assignments []models.RoleAssignment
+	if err := query.Order("role_assignments.created_at DESC").Find(&assignments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50073,
+			"查询角色分配失败",
+			err.Error(),
+		))
+		return
+	}
+
+	// 分配给用户的附带用户名
+	var userIDs []string
+	for _, a := range assignments {
+		if a.SubjectType == authSvc.SubjectUser {
+			userIDs = append(userIDs, a.Subject)
+		}
+	}
+	usernames := make(map[string]string)
+	if len(userIDs) > 0 {
+		var users []models.User
+		h.db.Select("id", "username").Where("id IN ?", userIDs).Find(&users)
+		for _, u := range users {
+			usernames[u.ID.String()] = u.Username
+		}
+	}
+
+	responses := make([]RoleAssignmentResponse, 0, len(assignments))
+	for _, a := range assignments {
+		responses = append(responses, RoleAssignmentResponse{
+			ID:          a.ID,
+			RoleID:      a.RoleID,
+			RoleName:    a.Role.Name,
+			SubjectType: a.SubjectType,
+			Subject:     a.Subject,
+			Username:    usernames[a.Subject],
+			CreatedBy:   a.CreatedBy,
+			CreatedAt:   a.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(responses))
+}
+
+// CreateRoleAssignment 把角色分配给用户或部门
+func (h *AdminHandler) CreateRoleAssignment(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req RoleAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40053,
+			"角色分配参数无效",
+			err.Error(),
+		))
+		return
+	}
+
+	var role models.Role
+	if err := h.db.Where("id = ?", req.RoleID).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40449,
+			"角色不存在",
+			nil,
+		))
+		return
+	}
+
+	// 分配给用户时 subject 为用户ID，统一为规范格式以便解析权限时匹配
+	if req.SubjectType == authSvc.SubjectUser {
+		subjectID, err := uuid.Parse(req.Subject)
+		if err == nil {
+			err = h.db.Select("id").Where("id = ?", subjectID).First(&models.User{}).Error
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+				40053,
+				"角色分配参数无效",
+				"用户不存在",
+			))
+			return
+		}
+		req.Subject = subjectID.String()
+	}
+
+	if !h.canGrant(c, role.Permissions) {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			40315,
+			"不能授予自己不具备的权限",
+			nil,
+		))
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.RoleAssignment{}).
+		Where("role_id = ? AND subject_type = ? AND subject = ?", role.ID, req.SubjectType, req.Subject).
+		Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, pkgErrors.NewErrorResponse(
+			40946,
+			"角色分配已存在",
+			nil,
+		))
+		return
+	}
+
+	assignment := models.RoleAssignment{
+		ID:          uuid.New(),
+		RoleID:      role.ID,
+		SubjectType: req.SubjectType,
+		Subject:     req.Subject,
+		CreatedBy:   userID.(uuid.UUID),
+		CreatedAt:   time.Now(),
+	}
+	if err := h.db.WithContext(c.Request.Context()).Omit("Role").Create(&assignment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50074,
+			"创建角色分配失败",
+			err.Error(),
+		))
+		return
+	}
+	h.permissions.ForgetAll()
+
+	c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(RoleAssignmentResponse{
+		ID:          assignment.ID,
+		RoleID:      role.ID,
+		RoleName:    role.Name,
+		SubjectType: assignment.SubjectType,
+		Subject:     assignment.Subject,
+		CreatedBy:   assignment.CreatedBy,
+		CreatedAt:   assignment.CreatedAt,
+	}))
+}
+
+// DeleteRoleAssignment 取消角色分配
+func (h *AdminHandler) DeleteRoleAssignment(c *gin.Context) {
+	var assignment models.RoleAssignment
+	if err := h.db.Joins("Role").Where("role_assignments.id = ?", c.Param("id")).First(&assignment).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40450,
+			"角色分配不存在",
+			nil,
+		))
+		return
+	}
+	if !h.canGrant(c, assignment.Role.Permissions) {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			40315,
+			"不能授予自己不具备的权限",
+			nil,
+		))
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Delete(&assignment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50075,
+			"删除角色分配失败",
+			err.Error(),
+		))
+		return
+	}
+	h.permissions.ForgetAll()
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("角色分配删除成功"))
+}
+
+// roleNameExists 是否已有同名的其它角色
+func (h *AdminHandler) roleNameExists(name string, exceptID uuid.UUID) bool {
+	var count int64
+	h.db.Model(&models.Role{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count)
+	return count > 0
+}
+
+// canGrant 当前用户是否具备全部这些权限：只能授出自己具备的权限，防止借角色管理提升权限
+func (h *AdminHandler) canGrant(c *gin.Context, perms []string) bool {
+	for _, perm := range perms {
+		if !hasPermission(c, h.permissions, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// canAssign 当前用户能否让用户成为该基础角色、所在部门：须具备该角色与分配给该部门的角色的全部权限
+func (h *AdminHandler) canAssign(c *gin.Context, role, department string) (bool, error) {
+	query := h.db.Where("name = ?", role)
+	if department != "" {
+		query = query.Or("id IN (?)", h.db.Model(&models.RoleAssignment{}).Select("role_id").
+			Where("subject_type = ? AND subject = ?", authSvc.SubjectDepartment, department))
+	}
+	var roles []models.Role
+	if err := query.Find(&roles).Error; err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, r := range roles {
+		found = found || r.Name == role
+		if !h.canGrant(c, r.Permissions) {
+			return false, nil
+		}
+	}
+	// 内置角色尚未写入数据库时按其初始权限判断
+	if !found {
+		for _, r := range authSvc.BuiltInRoles() {
+			if r.Name == role && !h.canGrant(c, r.Permissions) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// checkAssign 校验当前用户能否授予基础角色与部门，不能时写入响应并返回 false
+func (h *AdminHandler) checkAssign(c *gin.Context, role, department string) bool {
+	ok, err := h.canAssign(c, role, department)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50069,
+			"查询角色失败",
+			err.Error(),
+		))
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			40315,
+			"不能授予自己不具备的权限",
+			nil,
+		))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	pkgErrors "github.com/liusCraft/orion/pkg/errors"
+)
+
+// CreateServiceAccountRequest 创建服务账号
+type CreateServiceAccountRequest struct {
+	Username    string `json:"username" binding:"required,min=3,max=50"`
+	DisplayName string `json:"displayName" binding:"max=100"`
+	Role        string `json:"role" binding:"required,oneof=user viewer"`
+	Department  string `json:"department" binding:"max=50"`
+}
+
+// CreateServiceAccount 创建服务账号：供 CI、机器人等使用，没有密码，只能通过 API Key 访问
+func (h *AdminHandler) CreateServiceAccount(c *gin.Context) {
+	var req CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40049,
+			"请求参数错误",
+			err.Error(),
+		))
+		return
+	}
+
+	if !h.checkAssign(c, req.Role, req.Department) {
+		return
+	}
+
+	// 邮箱唯一且必填，服务账号使用保留域名下的占位地址
+	email := req.Username + "@service.invalid"
+	var count int64
+	if err := h.db.Model(&models.User{}).Where("username = ? OR email = ?", req.Username, email).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50041,
+			"数据库查询失败",
+			err.Error(),
+		))
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusConflict, pkgErrors.NewErrorResponse(
+			40944,
+			"用户名已存在",
+			nil,
+		))
+		return
+	}
+
+	user := models.User{
+		ID:          uuid.New(),
+		Username:    req.Username,
+		Email:       email,
+		DisplayName: req.DisplayName,
+		Role:        req.Role,
+		Department:  req.Department,
+		Status:      "active",
+		AccountType: "service",
+	}
+	if err := h.db.WithContext(c.Request.Context()).Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50061,
+			"创建服务账号失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(UserManagementResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		Role:        user.Role,
+		Department:  user.Department,
+		Status:      user.Status,
+		AccountType: user.AccountType,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+	}))
+}
+
+// CreateServiceAccountKey 为服务账号签发 API Key，明文只返回这一次
+func (h *AdminHandler) CreateServiceAccountKey(c *gin.Context) {
+	adminID, _ := c.Get("user_id")
+
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40050,
+			"服务账号ID无效",
+			err.Error(),
+		))
+		return
+	}
+
+	var account models.User
+	if err := h.db.Where("id = ? AND account_type = ?", accountID, "service").First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40447,
+			"服务账号不存在",
+			nil,
+		))
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40049,
+			"请求参数错误",
+			err.Error(),
+		))
+		return
+	}
+
+	// 密钥以服务账号的身份访问，签发者同样须具备其角色与部门的全部权限
+	if !h.checkAssign(c, account.Role, account.Department) {
+		return
+	}
+
+	key, plaintext, err := h.apiKeys.Create(c.Request.Context(), account.ID, adminID.(uuid.UUID), req.Name, req.Scopes, apiKeyExpiry(req.ExpiresInDays))
+	if err != nil {
+		if errors.Is(err, authSvc.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+				40051,
+				"权限范围无效",
+				map[string]interface{}{"error": err.Error(), "available": authSvc.Scopes},
+			))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50062,
+			"创建 API Key 失败",
+			err.Error(),
+		))
+		return
+	}
+	key.User = account
+
+	c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(CreatedAPIKeyResponse{
+		APIKeyResponse: toAPIKeyResponse(key),
+		Key:            plaintext,
+	}))
+}
+
+// GetAPIKeys 全部 API Key，可按所属用户与状态过滤
+func (h *AdminHandler) GetAPIKeys(c *gin.Context) {
+	query := h.db.Model(&models.APIKey{}).Joins("User")
+	if userID := c.Query("userId"); userID != "" {
+		if _, err := uuid.Parse(userID); err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40049, "查询参数错误", "userId 应为 UUID"))
+			return
+		}
+		query = query.Where("api_keys.user_id = ?", userID)
+	}
+	switch status := c.Query("status"); status {
+	case "":
+	case "active":
+		query = query.Where("api_keys.revoked_at IS NULL AND (api_keys.expires_at IS NULL OR api_keys.expires_at > ?)", time.Now())
+	case "expired":
+		query = query.Where("api_keys.revoked_at IS NULL AND api_keys.expires_at <= ?", time.Now())
+	case "revoked":
+		query = query.Where("api_keys.revoked_at IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40049, "查询参数错误", "status 应为 active、expired 或 revoked"))
+		return
+	}
+
+	var keys []models.APIKey
+	if err := query.Order("api_keys.created_at DESC").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50063,
+			"查询 API Key 失败",
+			err.Error(),
+		))
+		return
+	}
+
+	response := make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		response = append(response, toAPIKeyResponse(k))
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(response))
+}
+
+// RevokeAPIKey 撤销任意用户或服务账号的 API Key
+func (h *AdminHandler) RevokeAPIKey(c *gin.Context) {
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40050,
+			"API Key ID无效",
+			err.Error(),
+		))
+		return
+	}
+
+	if err := h.apiKeys.Revoke(c.Request.Context(), keyID, uuid.Nil); err != nil {
+		if errors.Is(err, authSvc.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+				40448,
+				"API Key 不存在或已撤销",
+				nil,
+			))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50064,
+			"撤销 API Key 失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("API Key 已撤销"))
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+)
+
+func TestCreateServiceAccountKeyRequiresAssignableRole(t *testing.T) {
+	accountID := uuid.New()
+
+	cases := []struct {
+		name       string
+		adminPerms []string
+		wantStatus int
+		wantCode   int
+	}{
+		// 只能管理用户的管理员不能为权限更大的服务账号签发密钥
+		{"lacks account permissions", []string{authSvc.PermUsersManage}, http.StatusForbidden, 40315},
+		{"has account permissions", []string{"*"}, http.StatusCreated, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			adminID := uuid.New()
+			tables := fakeTables{}.withUser(adminID, "ops", tc.adminPerms...)
+			db, fake := newFakeDB(t, func(q fakeQuery) *fakeRows {
+				if q.has(`FROM "users"`) && q.hasArg(accountID) {
+					return rowsOf("id", "username", "role", "department", "status", "account_type").
+						add(accountID, "ci-bot", authSvc.RoleUser, "sre", "active", "service")
+				}
+				return tables.respond(q)
+			})
+			h := NewAdminHandler(db, nil, nil, authSvc.NewAPIKeys(db), authSvc.NewPermissions(db))
+			c, w := newTestContext(http.MethodPost, `{"name":"deploy","scopes":["chat"]}`, adminID,
+				gin.Param{Key: "id", Value: accountID.String()})
+
+			h.CreateServiceAccountKey(c)
+
+			if resp := decodeResponse(t, w); w.Code != tc.wantStatus || resp.ErrorCode != tc.wantCode {
+				t.Fatalf("expected %d/%d, got %d: %s", tc.wantStatus, tc.wantCode, w.Code, w.Body.String())
+			}
+			inserted := len(fake.executed(`INSERT INTO "api_keys"`))
+			if (tc.wantStatus == http.StatusCreated) != (inserted == 1) {
+				t.Errorf("unexpected api key inserts: %d", inserted)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/services/ai"
+)
+
+func TestSystemConfigsMaskProfileAPIKey(t *testing.T) {
+	configID := uuid.New()
+	stored := models.JSONMap{"provider": "openai", "model": "gpt-4o-mini", "api_key": "sk-stored"}
+	db, fake := newFakeDB(t, fakeTables{
+		"system_configs": rowsOf("id", "config_key", "config_value", "config_type", "created_at").
+			add(configID, "fast", stored, ai.ProfileConfigType, time.Now()),
+	}.respond)
+	registry, err := ai.NewRegistry(config.AIConfig{LLM: config.LLMConfig{Provider: "openai", Model: "gpt-4o", APIKey: "sk-default"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewAdminHandler(db, registry, nil, nil, nil)
+
+	// 列表中不返回密钥
+	c, w := newTestContext(http.MethodGet, "", uuid.New())
+	h.GetSystemConfigs(c)
+	var listed []SystemConfigResponse
+	if err := json.Unmarshal(decodeResponse(t, w).Data, &listed); err != nil || len(listed) != 1 {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	if got := listed[0].ConfigValue["api_key"]; got != maskedAPIKey {
+		t.Errorf("api_key should be masked, got %v", got)
+	}
+
+	// 原样提交占位值时保留已保存的密钥
+	body := `{"configKey":"fast","configType":"llm_profile","configValue":{"provider":"openai","model":"gpt-4o","api_key":"***"}}`
+	c, w = newTestContext(http.MethodPut, body, uuid.New(), gin.Param{Key: "id", Value: configID.String()})
+	h.UpdateSystemConfig(c)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "sk-stored") {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	updates := fake.executed(`UPDATE "system_configs"`)
+	if len(updates) != 1 {
+		t.Fatalf("expected one update, got %+v", updates)
+	}
+	if saved := fmt.Sprintf("%s", updates[0].Args); !strings.Contains(saved, "sk-stored") || !strings.Contains(saved, "gpt-4o") {
+		t.Errorf("stored api_key should be kept: %s", saved)
+	}
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	usageSvc "github.com/liusCraft/orion/internal/services/usage"
+	pkgErrors "github.com/liusCraft/orion/pkg/errors"
+)
+
+// QuotaRequest 创建或更新 token 配额
+type QuotaRequest struct {
+	Scope          string `json:"scope" binding:"required,oneof=user department"`
+	Subject        string `json:"subject" binding:"required,max=100"` // 用户ID或部门名称
+	Period         string `json:"period" binding:"required,oneof=daily monthly"`
+	TokenLimit     int64  `json:"tokenLimit" binding:"required,min=1"`
+	Action         string `json:"action" binding:"omitempty,oneof=reject degrade"` // 默认 reject
+	DegradeProfile string `json:"degradeProfile" binding:"max=100"`
+	Enabled        *bool  `json:"enabled"` // 默认启用
+	Description    string `json:"description"`
+}
+
+type QuotaResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	Scope          string     `json:"scope"`
+	Subject        string     `json:"subject"`
+	Period         string     `json:"period"`
+	TokenLimit     int64      `json:"tokenLimit"`
+	Action         string     `json:"action"`
+	DegradeProfile string     `json:"degradeProfile"`
+	Enabled        bool       `json:"enabled"`
+	Description    string     `json:"description"`
+	UpdatedBy      *uuid.UUID `json:"updatedBy"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+func toQuotaResponse(q models.UsageQuota) QuotaResponse {
+	return QuotaResponse{
+		ID:             q.ID,
+		Scope:          q.Scope,
+		Subject:        q.Subject,
+		Period:         q.Period,
+		TokenLimit:     q.TokenLimit,
+		Action:         q.Action,
+		DegradeProfile: q.DegradeProfile,
+		Enabled:        q.Enabled,
+		Description:    q.Description,
+		UpdatedBy:      q.UpdatedBy,
+		CreatedAt:      q.CreatedAt,
+		UpdatedAt:      q.UpdatedAt,
+	}
+}
+
+// GetUsageReport 按部门、用户、模型、模型配置或日期汇总 token 用量（来自每日汇总）
+func (h *AdminHandler) GetUsageReport(c *gin.Context) {
+	groupBy := c.DefaultQuery("groupBy", "department")
+	if !usageSvc.ValidGroupBy(groupBy) {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40048, "查询参数错误", "groupBy 应为 department、user、model、profile 或 date"))
+		return
+	}
+	now := time.Now()
+	from := usageSvc.PeriodStart(usageSvc.PeriodMonthly, now)
+	to := now
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.ParseInLocation(time.DateOnly, v, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40048, "查询参数错误", "from 应为 YYYY-MM-DD"))
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.ParseInLocation(time.DateOnly, v, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40048, "查询参数错误", "to 应为 YYYY-MM-DD"))
+			return
+		}
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40048, "查询参数错误", "to 不能早于 from"))
+		return
+	}
+
+	rows, err := usageSvc.Report(c.Request.Context(), h.db, from, to, groupBy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50053,
+			"获取用量报表失败",
+			err.Error(),
+		))
+		return
+	}
+	if rows == nil {
+		rows = []usageSvc.ReportRow{}
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"from":    from.Format(time.DateOnly),
+		"to":      to.Format(time.DateOnly),
+		"groupBy": groupBy,
+		"items":   rows,
+	}))
+}
+
+// CreateQuota 创建 token 配额
+func (h *AdminHandler) CreateQuota(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req QuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40047,
+			"配额参数无效",
+			err.Error(),
+		))
+		return
+	}
+	quota := models.UsageQuota{ID: uuid.New()}
+	applyQuotaRequest(&quota, req)
+	if err := h.validateQuota(quota); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40047,
+			"配额参数无效",
+			err.Error(),
+		))
+		return
+	}
+
+	if h.quotaExists(quota) {
+		c.JSON(http.StatusConflict, pkgErrors.NewErrorResponse(
+			40943,
+			"配额已存在",
+			nil,
+		))
+		return
+	}
+
+	uid := userID.(uuid.UUID)
+	quota.UpdatedBy = &uid
+	// 显式写入所有字段，避免 enabled=false 被数据库默认值覆盖
+	if err := h.db.WithContext(c.Request.Context()).Select("*").Create(&quota).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50055,
+			"创建配额失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(toQuotaResponse(quota)))
+}
+
+// GetQuotas 查询 token 配额，可按 scope、subject 过滤，附带当前周期用量
+func (h *AdminHandler) GetQuotas(c *gin.Context) {
+	query := h.db.Model(&models.UsageQuota{})
+	if scope := c.Query("scope"); scope != "" {
+		query = query.Where("scope = ?", scope)
+	}
+	if subject := c.Query("subject"); subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+
+	var quotas []models.UsageQuota
+	if err := query.Order("scope, subject, period").Find(&quotas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50054,
+			"查询配额失败",
+			err.Error(),
+		))
+		return
+	}
+
+	now := time.Now()
+	items := make([]map[string]interface{}, 0, len(quotas))
+	for _, q := range quotas {
+		usage := h.db.Model(&models.LLMUsage{}).Where("created_at >= ?", usageSvc.PeriodStart(q.Period, now))
+		if q.Scope == usageSvc.ScopeDepartment {
+			usage = usage.Where("department = ?", q.Subject)
+		} else {
+			usage = usage.Where("user_id = ?", q.Subject)
+		}
+		var used int64
+		usage.Select("COALESCE(SUM(total_tokens), 0)").Scan(&used)
+		items = append(items, map[string]interface{}{
+			"quota":   toQuotaResponse(q),
+			"used":    used,
+			"resetAt": usageSvc.PeriodEnd(q.Period, now),
+		})
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(items))
+}
+
+// UpdateQuota 更新 token 配额
+func (h *AdminHandler) UpdateQuota(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var quota models.UsageQuota
+	if err := h.db.Where("id = ?", c.Param("id")).First(&quota).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40446,
+			"配额不存在",
+			nil,
+		))
+		return
+	}
+
+	var req QuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40047,
+			"配额参数无效",
+			err.Error(),
+		))
+		return
+	}
+	applyQuotaRequest(&quota, req)
+	if err := h.validateQuota(quota); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40047,
+			"配额参数无效",
+			err.Error(),
+		))
+		return
+	}
+
+	if h.quotaExists(quota) {
+		c.JSON(http.StatusConflict, pkgErrors.NewErrorResponse(
+			40943,
+			"配额已存在",
+			nil,
+		))
+		return
+	}
+
+	uid := userID.(uuid.UUID)
+	quota.UpdatedBy = &uid
+	quota.UpdatedAt = time.Now()
+	if err := h.db.WithContext(c.Request.Context()).Save(&quota).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50056,
+			"更新配额失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(toQuotaResponse(quota)))
+}
+
+// DeleteQuota 删除 token 配额
+func (h *AdminHandler) DeleteQuota(c *gin.Context) {
+	var quota models.UsageQuota
+	if err := h.db.Where("id = ?", c.Param("id")).First(&quota).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40446,
+			"配额不存在",
+			nil,
+		))
+		return
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).Delete(&quota).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50057,
+			"删除配额失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("配额删除成功"))
+}
+
+// applyQuotaRequest 将请求参数写入配额
+func applyQuotaRequest(q *models.UsageQuota, req QuotaRequest) {
+	q.Scope = req.Scope
+	q.Subject = req.Subject
+	q.Period = req.Period
+	q.TokenLimit = req.TokenLimit
+	q.Action = req.Action
+	if q.Action == "" {
+		q.Action = usageSvc.ActionReject
+	}
+	q.DegradeProfile = req.DegradeProfile
+	q.Enabled = req.Enabled == nil || *req.Enabled
+	q.Description = req.Description
+}
+
+// quotaExists 是否已有同一对象、同一周期的其它配额
+func (h *AdminHandler) quotaExists(q models.UsageQuota) bool {
+	var count int64
+	h.db.Model(&models.UsageQuota{}).
+		Where("scope = ? AND subject = ? AND period = ? AND id <> ?", q.Scope, q.Subject, q.Period, q.ID).
+		Count(&count)
+	return count > 0
+}
+
+// validateQuota 校验配额参数，降级目标须为已加载的模型配置
+func (h *AdminHandler) validateQuota(q models.UsageQuota) error {
+	if err := usageSvc.ValidateQuota(q); err != nil {
+		return err
+	}
+	if q.Action == usageSvc.ActionDegrade {
+		if _, ok := h.models.Get(q.DegradeProfile); !ok {
+			return errors.New("degrade_profile is not a loaded model profile: " + q.DegradeProfile)
+		}
+	}
+	return nil
+}
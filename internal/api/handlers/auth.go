@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	stderrors "errors"
 	"net/http"
 	"time"
 
@@ -9,17 +11,24 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"github.com/liusCraft/orion/internal/config"
 	"github.com/liusCraft/orion/internal/database/models"
-	"github.com/liusCraft/orion/internal/pkg/jwt"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	auditSvc "github.com/liusCraft/orion/internal/services/audit"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
 	"github.com/liusCraft/orion/pkg/errors"
 )
 
 type AuthHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	sessions    *authSvc.Sessions    // 登录会话：每次登录一个会话，刷新时轮换刷新令牌
+	apiKeys     *authSvc.APIKeys     // 用户自助管理的 API Key
+	sso         *authSvc.SSO         // OIDC 单点登录，未启用时为 nil
+	permissions *authSvc.Permissions // 当前用户的有效权限
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(db *gorm.DB, sessions *authSvc.Sessions, apiKeys *authSvc.APIKeys, sso *authSvc.SSO, permissions *authSvc.Permissions) *AuthHandler {
+	return &AuthHandler{db: db, sessions: sessions, apiKeys: apiKeys, sso: sso, permissions: permissions}
 }
 
 type LoginRequest struct {
@@ -65,9 +74,10 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 查找用户
+	// 查找用户（服务账号没有密码，只能通过 API Key 访问）
 	var user models.User
-	if err := h.db.Where("username = ? AND status = ?", req.Username, "active").First(&user).Error; err != nil {
+	if err := h.db.Where("username = ? AND status = ? AND account_type = ?", req.Username, "active", "human").First(&user).Error; err != nil {
+		h.recordAuthEvent(c, auditSvc.ActionLoginFailed, nil, nil, models.JSONMap{"method": "password", "username": req.Username, "reason": "user_not_found"})
 		c.JSON(http.StatusUnauthorized, errors.NewErrorResponse(
 			40101,
 			"用户名或密码错误",
@@ -78,6 +88,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		h.recordAuthEvent(c, auditSvc.ActionLoginFailed, nil, &user.ID, models.JSONMap{"method": "password", "username": req.Username, "reason": "invalid_password"})
 		c.JSON(http.StatusUnauthorized, errors.NewErrorResponse(
 			40102,
 			"用户名或密码错误",
@@ -86,8 +97,19 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// 生成JWT令牌
-	tokenPair, err := jwt.GenerateTokenPair(user.ID, user.Username, user.Role, user.Department)
+	// 强制单点登录时只有管理员可以使用密码
+	if !authSvc.PasswordLoginAllowed(config.GlobalConfig.OIDC, user.Role) {
+		h.recordAuthEvent(c, auditSvc.ActionLoginFailed, nil, &user.ID, models.JSONMap{"method": "password", "username": req.Username, "reason": "password_login_disabled"})
+		c.JSON(http.StatusForbidden, errors.NewErrorResponse(
+			40303,
+			"已启用单点登录，请使用 SSO 登录",
+			nil,
+		))
+		return
+	}
+
+	// 创建会话并签发JWT令牌
+	tokenPair, err := h.sessions.Start(c.Request.Context(), user, sessionClient(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
 			50002,
@@ -100,18 +122,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	// 更新最后登录时间
 	now := time.Now()
 	h.db.Model(&user).Update("last_login_at", now)
-
-	// 创建用户会话记录
-	session := models.UserSession{
-		UserID:    user.ID,
-		TokenHash: tokenPair.AccessToken[:32], // 存储token前32字符作为标识
-		DeviceInfo: map[string]interface{}{
-			"user_agent": c.Request.Header.Get("User-Agent"),
-		},
-		IPAddress: c.ClientIP(),
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-	}
-	h.db.Create(&session)
+	h.recordAuthEvent(c, auditSvc.ActionLogin, &user.ID, &user.ID, models.JSONMap{"method": "password"})
 
 	response := LoginResponse{
 		AccessToken:  tokenPair.AccessToken,
@@ -134,6 +145,15 @@ func (h *AuthHandler) Login(c *gin.Context) {
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
+	if !authSvc.PasswordLoginAllowed(config.GlobalConfig.OIDC, "") {
+		c.JSON(http.StatusForbidden, errors.NewErrorResponse(
+			40303,
+			"已启用单点登录，请使用 SSO 登录",
+			nil,
+		))
+		return
+	}
+
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, errors.NewErrorResponse(
@@ -187,7 +207,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Status:       "active",
 	}
 
-	if err := h.db.Create(&user).Error; err != nil {
+	if err := h.db.WithContext(auditContext(c, nil)).Create(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
 			50005,
 			"创建用户失败",
@@ -196,8 +216,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// 生成JWT令牌
-	tokenPair, err := jwt.GenerateTokenPair(user.ID, user.Username, user.Role, user.Department)
+	// 创建会话并签发JWT令牌
+	tokenPair, err := h.sessions.Start(c.Request.Context(), user, sessionClient(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
 			50006,
@@ -241,15 +261,39 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// 验证并刷新令牌
-	tokenPair, err := jwt.RefreshAccessToken(req.RefreshToken)
-	if err != nil {
+	// 验证并轮换刷新令牌：旧的刷新令牌随即失效，被再次使用时撤销整个会话
+	tokenPair, err := h.sessions.Refresh(c.Request.Context(), req.RefreshToken, sessionClient(c))
+	switch {
+	case err == nil:
+	case stderrors.Is(err, authSvc.ErrInvalidRefreshToken):
 		c.JSON(http.StatusUnauthorized, errors.NewErrorResponse(
 			40103,
 			"刷新令牌无效",
 			err.Error(),
 		))
 		return
+	case stderrors.Is(err, authSvc.ErrTokenReused):
+		logger.Warn("刷新令牌被重复使用，已撤销会话 ip=%s", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, errors.NewErrorResponse(
+			40106,
+			"刷新令牌已被使用，会话已撤销，请重新登录",
+			nil,
+		))
+		return
+	case stderrors.Is(err, authSvc.ErrSessionInactive), stderrors.Is(err, authSvc.ErrUserInactive):
+		c.JSON(http.StatusUnauthorized, errors.NewErrorResponse(
+			40105,
+			"会话已失效，请重新登录",
+			err.Error(),
+		))
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50007,
+			"刷新令牌失败",
+			err.Error(),
+		))
+		return
 	}
 
 	c.JSON(http.StatusOK, errors.NewSuccessResponse(tokenPair))
@@ -267,12 +311,123 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 		return
 	}
 
-	// 删除用户会话（这里简化处理，实际应该根据token删除特定会话）
-	h.db.Where("user_id = ?", userID).Delete(&models.UserSession{})
+	// 撤销当前会话：该会话的访问令牌与刷新令牌随即失效，其它设备不受影响
+	sessionID, _ := c.Get("session_id")
+	if err := h.sessions.Revoke(c.Request.Context(), userID.(uuid.UUID), sessionID.(uuid.UUID), authSvc.ReasonLogout); err != nil && !stderrors.Is(err, authSvc.ErrSessionNotFound) {
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50010,
+			"撤销会话失败",
+			err.Error(),
+		))
+		return
+	}
+	uid := userID.(uuid.UUID)
+	h.recordAuthEvent(c, auditSvc.ActionLogout, &uid, &uid, models.JSONMap{"session_id": sessionID})
 
 	c.JSON(http.StatusOK, errors.NewSuccessResponse("退出登录成功"))
 }
 
+// SessionResponse 登录会话
+type SessionResponse struct {
+	ID         uuid.UUID      `json:"id"`
+	DeviceInfo models.JSONMap `json:"deviceInfo"`
+	IPAddress  string         `json:"ipAddress"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	LastUsedAt *time.Time     `json:"lastUsedAt"`
+	ExpiresAt  time.Time      `json:"expiresAt"`
+	Current    bool           `json:"current"` // 是否为当前请求所用的会话
+}
+
+// GetSessions 当前用户的有效会话
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionID, _ := c.Get("session_id")
+
+	sessions, err := h.sessions.List(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50009,
+			"查询会话失败",
+			err.Error(),
+		))
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, SessionResponse{
+			ID:         s.ID,
+			DeviceInfo: s.DeviceInfo,
+			IPAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == sessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, errors.NewSuccessResponse(response))
+}
+
+// RevokeSession 撤销当前用户的一个会话（如在其它设备上登录的会话）
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewErrorResponse(
+			40015,
+			"会话ID无效",
+			err.Error(),
+		))
+		return
+	}
+
+	if err := h.sessions.Revoke(c.Request.Context(), userID.(uuid.UUID), sessionID, authSvc.ReasonRevoked); err != nil {
+		if stderrors.Is(err, authSvc.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, errors.NewErrorResponse(
+				40402,
+				"会话不存在",
+				nil,
+			))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50010,
+			"撤销会话失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, errors.NewSuccessResponse("会话已撤销"))
+}
+
+// RevokeOtherSessions 撤销当前用户除当前会话以外的全部会话
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionID, _ := c.Get("session_id")
+
+	count, err := h.sessions.RevokeAll(c.Request.Context(), userID.(uuid.UUID), sessionID.(uuid.UUID), authSvc.ReasonRevoked)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50010,
+			"撤销会话失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, errors.NewSuccessResponse(map[string]interface{}{
+		"revoked": count,
+	}))
+}
+
+// sessionClient 请求的客户端信息，记录在会话中
+func sessionClient(c *gin.Context) authSvc.Client {
+	return authSvc.Client{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
 func (h *AuthHandler) Profile(c *gin.Context) {
 	// 从上下文获取用户信息
 	userID, _ := c.Get("user_id")
@@ -305,3 +460,24 @@ func (h *AuthHandler) Profile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, errors.NewSuccessResponse(userInfo))
 }
+
+// auditContext 登录、注册等请求的审计上下文：操作者为登录的用户（未知时为空），并记录客户端 IP 与 User-Agent
+func auditContext(c *gin.Context, userID *uuid.UUID) context.Context {
+	return auditSvc.WithActor(c.Request.Context(), auditSvc.Actor{
+		UserID:    userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+}
+
+// recordAuthEvent 记录登录、登录失败与退出登录，资源为对应的用户；写入失败只记录日志，不影响登录
+func (h *AuthHandler) recordAuthEvent(c *gin.Context, action string, actorID, userID *uuid.UUID, values models.JSONMap) {
+	if err := auditSvc.Record(auditContext(c, actorID), h.db, models.AuditLog{
+		Action:       action,
+		ResourceType: "user",
+		ResourceID:   userID,
+		NewValues:    values,
+	}); err != nil {
+		logger.Error("记录审计日志失败: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	"github.com/liusCraft/orion/pkg/errors"
+)
+
+// CreateAPIKeyRequest 创建 API Key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"omitempty,min=1,max=3650"` // 不填表示永不过期
+}
+
+// APIKeyResponse API Key（不含明文）
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"userId"`
+	Username   string     `json:"username,omitempty"` // 管理员查询时返回所属用户
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Status     string     `json:"status"` // active, expired, revoked
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP string     `json:"lastUsedIp"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedBy  uuid.UUID  `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreatedAPIKeyResponse 新建的 API Key，明文只返回这一次
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// CreateAPIKey 为当前用户创建 API Key
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewErrorResponse(
+			40004,
+			"请求参数错误",
+			err.Error(),
+		))
+		return
+	}
+
+	key, plaintext, err := h.apiKeys.Create(c.Request.Context(), userID.(uuid.UUID), userID.(uuid.UUID), req.Name, req.Scopes, apiKeyExpiry(req.ExpiresInDays))
+	if err != nil {
+		if stderrors.Is(err, authSvc.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, errors.NewErrorResponse(
+				40006,
+				"权限范围无效",
+				map[string]interface{}{"error": err.Error(), "available": authSvc.Scopes},
+			))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50008,
+			"创建 API Key 失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusCreated, errors.NewSuccessResponse(CreatedAPIKeyResponse{
+		APIKeyResponse: toAPIKeyResponse(key),
+		Key:            plaintext,
+	}))
+}
+
+// GetAPIKeys 当前用户的 API Key
+func (h *AuthHandler) GetAPIKeys(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	keys, err := h.apiKeys.List(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50059,
+			"查询 API Key 失败",
+			err.Error(),
+		))
+		return
+	}
+
+	response := make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		response = append(response, toAPIKeyResponse(k))
+	}
+
+	c.JSON(http.StatusOK, errors.NewSuccessResponse(response))
+}
+
+// RevokeAPIKey 撤销当前用户的一个 API Key
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errors.NewErrorResponse(
+			40005,
+			"API Key ID无效",
+			err.Error(),
+		))
+		return
+	}
+
+	if err := h.apiKeys.Revoke(c.Request.Context(), keyID, userID.(uuid.UUID)); err != nil {
+		if stderrors.Is(err, authSvc.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, errors.NewErrorResponse(
+				40403,
+				"API Key 不存在或已撤销",
+				nil,
+			))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50060,
+			"撤销 API Key 失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, errors.NewSuccessResponse("API Key 已撤销"))
+}
+
+// apiKeyExpiry 有效天数对应的过期时间，0 表示永不过期
+func apiKeyExpiry(days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().AddDate(0, 0, days)
+	return &expiresAt
+}
+
+func toAPIKeyResponse(k models.APIKey) APIKeyResponse {
+	status := "active"
+	switch {
+	case k.RevokedAt != nil:
+		status = "revoked"
+	case k.ExpiresAt != nil && !time.Now().Before(*k.ExpiresAt):
+		status = "expired"
+	}
+	return APIKeyResponse{
+		ID:         k.ID,
+		UserID:     k.UserID,
+		Username:   k.User.Username,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.Scopes,
+		Status:     status,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		LastUsedIP: k.LastUsedIP,
+		RevokedAt:  k.RevokedAt,
+		CreatedBy:  k.CreatedBy,
+		CreatedAt:  k.CreatedAt,
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	"github.com/liusCraft/orion/internal/pkg/oidc"
+	auditSvc "github.com/liusCraft/orion/internal/services/audit"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	"github.com/liusCraft/orion/pkg/errors"
+)
+
+// 发起登录到回调之间保存登录状态的 Cookie，只在 OIDC 路径下发送
+const (
+	oidcStateCookie = "orion_oidc_state"
+	oidcCookiePath  = "/api/v1/auth/oidc"
+)
+
+// GetLoginProviders 可用的登录方式，供登录页决定展示密码表单还是单点登录按钮
+func (h *AuthHandler) GetLoginProviders(c *gin.Context) {
+	cfg := config.GlobalConfig.OIDC
+	c.JSON(http.StatusOK, errors.NewSuccessResponse(map[string]interface{}{
+		"passwordLogin": !cfg.Enabled || !cfg.DisablePasswordLogin,
+		"oidc":          h.sso != nil,
+	}))
+}
+
+// OIDCLogin 发起单点登录：生成 state、nonce 与 PKCE，跳转到 IdP 的授权页
+func (h *AuthHandler) OIDCLogin(c *gin.Context) {
+	if h.sso == nil {
+		c.JSON(http.StatusNotFound, errors.NewErrorResponse(
+			40404,
+			"未启用单点登录",
+			nil,
+		))
+		return
+	}
+
+	// 只允许站内路径，防止开放重定向
+	redirect := c.Query("redirect")
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		redirect = ""
+	}
+
+	authURL, st, err := h.sso.Begin(c.Request.Context(), redirect)
+	if err != nil {
+		logger.Error("发起单点登录失败: %v", err)
+		c.JSON(http.StatusBadGateway, errors.NewErrorResponse(
+			50065,
+			"连接身份提供方失败",
+			err.Error(),
+		))
+		return
+	}
+	sealed, err := oidc.SealState(st, []byte(config.GlobalConfig.JWT.Secret))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50066,
+			"单点登录失败",
+			err.Error(),
+		))
+		return
+	}
+
+	h.setStateCookie(c, sealed, int(time.Until(time.Unix(st.Expires, 0)).Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback IdP 回调：校验 state，用授权码换取并校验 ID Token，即时创建或更新用户后签发令牌
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+	if h.sso == nil {
+		c.JSON(http.StatusNotFound, errors.NewErrorResponse(
+			40404,
+			"未启用单点登录",
+			nil,
+		))
+		return
+	}
+
+	// 登录状态只能使用一次
+	sealed, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	if idpErr := c.Query("error"); idpErr != "" {
+		c.JSON(http.StatusUnauthorized, errors.NewErrorResponse(
+			40107,
+			"单点登录失败",
+			map[string]string{"error": idpErr, "description": c.Query("error_description")},
+		))
+		return
+	}
+
+	st, err := oidc.OpenState(sealed, []byte(config.GlobalConfig.JWT.Secret), time.Now())
+	if err != nil || c.Query("state") != st.State || c.Query("code") == "" {
+		c.JSON(http.StatusBadRequest, errors.NewErrorResponse(
+			40007,
+			"登录状态无效或已过期，请重新登录",
+			nil,
+		))
+		return
+	}
+
+	// 首次登录时创建的账号记录在审计日志中
+	user, err := h.sso.Complete(auditContext(c, nil), c.Query("code"), st)
+	switch {
+	case err == nil:
+	case stderrors.Is(err, oidc.ErrExchange), stderrors.Is(err, oidc.ErrInvalidToken):
+		logger.Warn("单点登录校验失败 ip=%s: %v", c.ClientIP(), err)
+		h.recordAuthEvent(c, auditSvc.ActionLoginFailed, nil, nil, models.JSONMap{"method": "oidc", "reason": "invalid_token"})
+		c.JSON(http.StatusUnauthorized, errors.NewErrorResponse(
+			40107,
+			"单点登录失败",
+			err.Error(),
+		))
+		return
+	case stderrors.Is(err, oidc.ErrDiscovery):
+		logger.Error("连接身份提供方失败: %v", err)
+		c.JSON(http.StatusBadGateway, errors.NewErrorResponse(
+			50065,
+			"连接身份提供方失败",
+			err.Error(),
+		))
+		return
+	case stderrors.Is(err, authSvc.ErrSSONotProvisioned):
+		h.recordAuthEvent(c, auditSvc.ActionLoginFailed, nil, nil, models.JSONMap{"method": "oidc", "reason": "not_provisioned"})
+		c.JSON(http.StatusForbidden, errors.NewErrorResponse(
+			40301,
+			"账号未开通，请联系管理员",
+			nil,
+		))
+		return
+	case stderrors.Is(err, authSvc.ErrUserInactive):
+		h.recordAuthEvent(c, auditSvc.ActionLoginFailed, nil, nil, models.JSONMap{"method": "oidc", "reason": "user_inactive"})
+		c.JSON(http.StatusForbidden, errors.NewErrorResponse(
+			40302,
+			"账号已停用",
+			nil,
+		))
+		return
+	case stderrors.Is(err, authSvc.ErrSSOEmailConflict):
+		c.JSON(http.StatusConflict, errors.NewErrorResponse(
+			40902,
+			"邮箱已被其它账号使用，请联系管理员",
+			nil,
+		))
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50066,
+			"单点登录失败",
+			err.Error(),
+		))
+		return
+	}
+
+	tokenPair, err := h.sessions.Start(c.Request.Context(), user, sessionClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50067,
+			"生成令牌失败",
+			err.Error(),
+		))
+		return
+	}
+	now := time.Now()
+	h.db.Model(&user).Update("last_login_at", now)
+	h.recordAuthEvent(c, auditSvc.ActionLogin, &user.ID, &user.ID, models.JSONMap{"method": "oidc"})
+
+	// 浏览器登录跳回前端，令牌放在 URL 片段中，不会发送到服务端或写入访问日志
+	if target := config.GlobalConfig.OIDC.PostLoginRedirect; target != "" {
+		fragment := url.Values{
+			"accessToken":  {tokenPair.AccessToken},
+			"refreshToken": {tokenPair.RefreshToken},
+			"expiresIn":    {strconv.FormatInt(tokenPair.ExpiresIn, 10)},
+		}
+		if st.Redirect != "" {
+			fragment.Set("redirect", st.Redirect)
+		}
+		c.Redirect(http.StatusFound, target+"#"+fragment.Encode())
+		return
+	}
+
+	c.JSON(http.StatusOK, errors.NewSuccessResponse(LoginResponse{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+		ExpiresIn:    tokenPair.ExpiresIn,
+		User: &UserInfo{
+			ID:          user.ID,
+			Username:    user.Username,
+			Email:       user.Email,
+			DisplayName: user.DisplayName,
+			AvatarURL:   user.AvatarURL,
+			Role:        user.Role,
+			Department:  user.Department,
+			Status:      user.Status,
+			LastLoginAt: &now,
+		},
+	}))
+}
+
+// setStateCookie 写入（maxAge < 0 时清除）登录状态 Cookie；SameSite=Lax 使 IdP 跳回时携带
+func (h *AuthHandler) setStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.HasPrefix(config.GlobalConfig.OIDC.RedirectURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, oidcCookiePath, "", secure, true)
+}
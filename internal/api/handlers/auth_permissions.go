@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	"github.com/liusCraft/orion/pkg/errors"
+)
+
+// GetPermissions 当前用户的角色与有效权限，供前端决定展示哪些入口
+// 权限可能包含通配符（如 "*"、tools.execute:*），前端按前缀匹配判断。
+func (h *AuthHandler) GetPermissions(c *gin.Context) {
+	grants, err := resolveGrants(c, h.permissions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errors.NewErrorResponse(
+			50068,
+			"查询权限失败",
+			err.Error(),
+		))
+		return
+	}
+	c.JSON(http.StatusOK, errors.NewSuccessResponse(grants))
+}
+
+// resolveGrants 当前用户的有效授权，RequirePermission 已解析过时直接复用
+func resolveGrants(c *gin.Context, permissions *authSvc.Permissions) (*authSvc.Grants, error) {
+	if v, ok := c.Get("permissions"); ok {
+		return v.(*authSvc.Grants), nil
+	}
+	userID, _ := c.Get("user_id")
+	grants, err := permissions.Resolve(c.Request.Context(), userID.(uuid.UUID))
+	if err != nil {
+		return nil, err
+	}
+	c.Set("permissions", grants)
+	return grants, nil
+}
+
+// hasPermission 当前用户是否具备权限；解析失败时记录日志并按不具备处理
+func hasPermission(c *gin.Context, permissions *authSvc.Permissions, perm string) bool {
+	grants, err := resolveGrants(c, permissions)
+	if err != nil {
+		logger.Error("解析用户权限失败: %v", err)
+		return false
+	}
+	return grants.Has(perm)
+}
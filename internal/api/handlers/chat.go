@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -12,27 +13,43 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
-	"strings"
-
-	einotool "github.com/cloudwego/eino/components/tool"
 	"github.com/cloudwego/eino/schema"
 	"github.com/liusCraft/orion/internal/config"
 	"github.com/liusCraft/orion/internal/constants"
 	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
 	"github.com/liusCraft/orion/internal/services/ai"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	chatSvc "github.com/liusCraft/orion/internal/services/chat"
+	knowledgeSvc "github.com/liusCraft/orion/internal/services/knowledge"
 	toolsSvc "github.com/liusCraft/orion/internal/services/tools"
+	usageSvc "github.com/liusCraft/orion/internal/services/usage"
 	pkgErrors "github.com/liusCraft/orion/pkg/errors"
 )
 
 type ChatHandler struct {
-	db        *gorm.DB
-	aiService *ai.AIService
+	db          *gorm.DB
+	models      *ai.Registry            // 命名模型配置，对话可通过 context.model 选用
+	retriever   *knowledgeSvc.Retriever // 未配置向量化时为nil，跳过知识库检索
+	mcpSessions *toolsSvc.SessionManager
+	approvals   *toolsSvc.ApprovalBroker
+	generations *chatSvc.GenerationRegistry
+	streams     *chatSvc.StreamHub   // 生成事件缓冲，支持断线重连补发
+	quotas      *usageSvc.Quotas     // 用户与部门的 token 配额
+	permissions *authSvc.Permissions // 工具规划只使用用户有权执行的工具；查看他人对话
 }
 
-func NewChatHandler(db *gorm.DB, aiService *ai.AIService) *ChatHandler {
+func NewChatHandler(db *gorm.DB, models *ai.Registry, retriever *knowledgeSvc.Retriever, mcpSessions *toolsSvc.SessionManager, approvals *toolsSvc.ApprovalBroker, generations *chatSvc.GenerationRegistry, streams *chatSvc.StreamHub, quotas *usageSvc.Quotas, permissions *authSvc.Permissions) *ChatHandler {
 	return &ChatHandler{
-		db:        db,
-		aiService: aiService,
+		db:          db,
+		models:      models,
+		retriever:   retriever,
+		mcpSessions: mcpSessions,
+		approvals:   approvals,
+		generations: generations,
+		streams:     streams,
+		quotas:      quotas,
+		permissions: permissions,
 	}
 }
 
@@ -53,6 +70,7 @@ type ConversationResponse struct {
 	Status              string         `json:"status"`
 	TotalMessages       int            `json:"totalMessages"`
 	LastMessageAt       *time.Time     `json:"lastMessageAt"`
+	ActiveMessageID     *uuid.UUID     `json:"activeMessageId"`
 	CreatedAt           time.Time      `json:"createdAt"`
 	UpdatedAt           time.Time      `json:"updatedAt"`
 	LastAIMessageStatus *string        `json:"lastAIMessageStatus"`
@@ -70,10 +88,17 @@ type MessageResponse struct {
 	ProcessingTimeMs *int           `json:"processingTimeMs"`
 	Status           string         `json:"status"`
 	ErrorMessage     string         `json:"errorMessage"`
+	SiblingIndex     int            `json:"siblingIndex"` // 在同一父节点下的序号（按创建时间，从 0 开始）
+	SiblingCount     int            `json:"siblingCount"` // 同一父节点下的消息数（含自身），大于 1 表示存在分支
 	CreatedAt        time.Time      `json:"createdAt"`
 	UpdatedAt        time.Time      `json:"updatedAt"`
 }
 
+// SelectBranchRequest 切换当前分支请求
+type SelectBranchRequest struct {
+	MessageID uuid.UUID `json:"messageId" binding:"required"`
+}
+
 // SSE事件类型
 type SSEEvent struct {
 	Type string      `json:"type"`
@@ -92,6 +117,14 @@ func (h *ChatHandler) CreateConversation(c *gin.Context) {
 		))
 		return
 	}
+	if err := h.validateSettings(req.Context); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40017,
+			"对话设置无效",
+			err.Error(),
+		))
+		return
+	}
 
 	conversation := models.Conversation{
 		ID:            uuid.New(),
@@ -127,6 +160,28 @@ func (h *ChatHandler) CreateConversation(c *gin.Context) {
 func (h *ChatHandler) GetConversations(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
+	// 具备 conversations.read_all 权限时可通过 userId 查看其他用户的对话
+	if v := c.Query("userId"); v != "" {
+		ownerID, err := uuid.Parse(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+				40018,
+				"请求参数错误",
+				"userId 无效",
+			))
+			return
+		}
+		if ownerID != userID.(uuid.UUID) && !hasPermission(c, h.permissions, authSvc.PermConversationsReadAll) {
+			c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+				40314,
+				"没有查看其他用户对话的权限",
+				nil,
+			))
+			return
+		}
+		userID = ownerID
+	}
+
 	// 分页参数（优先驼峰，兼容下划线）
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSizeStr := c.Query("pageSize")
@@ -182,6 +237,7 @@ func (h *ChatHandler) GetConversations(c *gin.Context) {
 			Status:              conv.Status,
 			TotalMessages:       conv.TotalMessages,
 			LastMessageAt:       conv.LastMessageAt,
+			ActiveMessageID:     conv.ActiveMessageID,
 			CreatedAt:           conv.CreatedAt,
 			UpdatedAt:           conv.UpdatedAt,
 			LastAIMessageStatus: lastAIStatus,
@@ -202,11 +258,10 @@ func (h *ChatHandler) GetConversations(c *gin.Context) {
 }
 
 func (h *ChatHandler) GetConversation(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	conversationID := c.Param("id")
 
 	var conversation models.Conversation
-	if err := h.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+	if err := h.readableConversations(c).Where("id = ?", conversationID).First(&conversation).Error; err != nil {
 		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
 			40411,
 			"对话不存在",
@@ -216,26 +271,26 @@ func (h *ChatHandler) GetConversation(c *gin.Context) {
 	}
 
 	response := ConversationResponse{
-		ID:            conversation.ID,
-		Title:         conversation.Title,
-		Context:       conversation.Context,
-		Status:        conversation.Status,
-		TotalMessages: conversation.TotalMessages,
-		LastMessageAt: conversation.LastMessageAt,
-		CreatedAt:     conversation.CreatedAt,
-		UpdatedAt:     conversation.UpdatedAt,
+		ID:              conversation.ID,
+		Title:           conversation.Title,
+		Context:         conversation.Context,
+		Status:          conversation.Status,
+		TotalMessages:   conversation.TotalMessages,
+		LastMessageAt:   conversation.LastMessageAt,
+		ActiveMessageID: conversation.ActiveMessageID,
+		CreatedAt:       conversation.CreatedAt,
+		UpdatedAt:       conversation.UpdatedAt,
 	}
 
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(response))
 }
 
 func (h *ChatHandler) GetMessages(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	conversationID := c.Param("id")
 
-	// 验证对话是否属于当前用户
+	// 验证当前用户可以查看该对话
 	var conversation models.Conversation
-	if err := h.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+	if err := h.readableConversations(c).Where("id = ?", conversationID).First(&conversation).Error; err != nil {
 		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
 			40412,
 			"对话不存在",
@@ -259,18 +314,8 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 		pageSize = 50
 	}
 
-	var messages []models.Message
-	var total int64
-
-	// 查询总数
-	h.db.Model(&models.Message{}).Where("conversation_id = ?", conversationID).Count(&total)
-
-	// 查询数据
-	offset := (page - 1) * pageSize
-	if err := h.db.Where("conversation_id = ?", conversationID).
-		Order("created_at ASC").
-		Offset(offset).Limit(pageSize).
-		Find(&messages).Error; err != nil {
+	tree, err := h.loadTree(conversation.ID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50013,
 			"查询消息列表失败",
@@ -279,6 +324,17 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
+	// 默认返回当前分支（根节点到 activeMessageId 的路径），view=all 返回全部消息
+	var listed []models.Message
+	if c.Query("view") == "all" {
+		listed = tree.Messages()
+	} else if conversation.ActiveMessageID != nil {
+		listed = tree.Path(*conversation.ActiveMessageID)
+	}
+	total := int64(len(listed))
+	offset := min((page-1)*pageSize, len(listed))
+	messages := listed[offset:min(offset+pageSize, len(listed))]
+
 	// 组装AI消息的工具执行记录
 	// 收集AI消息ID
 	aiMsgIDs := make([]uuid.UUID, 0, len(messages))
@@ -303,6 +359,7 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 
 	var responses []MessageResponse
 	for _, msg := range messages {
+		siblingIndex, siblingCount := siblingPosition(tree, msg.ID)
 		// 合并工具执行记录到 metadata.tools
 		meta := msg.Metadata
 		if meta == nil {
@@ -337,6 +394,8 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 			ProcessingTimeMs: msg.ProcessingTimeMs,
 			Status:           msg.Status,
 			ErrorMessage:     msg.ErrorMessage,
+			SiblingIndex:     siblingIndex,
+			SiblingCount:     siblingCount,
 			CreatedAt:        msg.CreatedAt,
 			UpdatedAt:        msg.UpdatedAt,
 		})
@@ -380,15 +439,16 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// 创建用户消息
+	// 创建用户消息，挂在当前分支的叶子下
 	userMessage := models.Message{
-		ID:             uuid.New(),
-		ConversationID: conversation.ID,
-		SenderType:     "user",
-		Content:        req.Content,
-		ContentType:    "text",
-		Metadata:       req.Metadata,
-		Status:         "completed",
+		ID:              uuid.New(),
+		ConversationID:  conversation.ID,
+		ParentMessageID: conversation.ActiveMessageID,
+		SenderType:      "user",
+		Content:         req.Content,
+		ContentType:     "text",
+		Metadata:        req.Metadata,
+		Status:          "completed",
 	}
 
 	if err := h.db.Create(&userMessage).Error; err != nil {
@@ -403,9 +463,10 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 	// 更新对话信息
 	now := time.Now()
 	h.db.Model(&conversation).Updates(map[string]interface{}{
-		"total_messages":  gorm.Expr("total_messages + 1"),
-		"last_message_at": now,
-		"updated_at":      now,
+		"total_messages":    gorm.Expr("total_messages + 1"),
+		"last_message_at":   now,
+		"active_message_id": userMessage.ID,
+		"updated_at":        now,
 	})
 
 	// 返回创建的用户消息
@@ -444,6 +505,26 @@ func (h *ChatHandler) StreamMessages(c *gin.Context) {
 		return
 	}
 
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50015,
+			"不支持流式响应",
+			nil,
+		))
+		return
+	}
+
+	// 断线重连：携带 Last-Event-ID 时补发错过的事件并继续跟随，不重新生成
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	if lastEventID != "" {
+		h.resumeStream(c, flusher, conversation, lastEventID)
+		return
+	}
+
 	// 选择父用户消息（优先使用显式传入的 userMessageId，其次回退到最近一条用户消息）
 	var parentUserMessage models.Message
 	userMsgIDStr := c.Query("userMessageId")
@@ -469,9 +550,20 @@ func (h *ChatHandler) StreamMessages(c *gin.Context) {
 			return
 		}
 	} else {
-		if err := h.db.Where("conversation_id = ? AND sender_type = ?", conversationID, "user").
-			Order("created_at DESC").
-			First(&parentUserMessage).Error; err != nil {
+		// 当前分支上最近的一条用户消息
+		found := false
+		if conversation.ActiveMessageID != nil {
+			if tree, err := h.loadTree(conversation.ID); err == nil {
+				path := tree.Path(*conversation.ActiveMessageID)
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i].SenderType == "user" {
+						parentUserMessage, found = path[i], true
+						break
+					}
+				}
+			}
+		}
+		if !found {
 			c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
 				40414,
 				"未找到用户消息",
@@ -481,20 +573,14 @@ func (h *ChatHandler) StreamMessages(c *gin.Context) {
 		}
 	}
 
-	// 设置SSE响应头
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache, no-transform")
-	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("X-Accel-Buffering", "no")
+	// 超出拒绝类配额时不再生成
+	quota, ok := h.checkQuota(c)
+	if !ok {
+		return
+	}
 
 	// 将同会话中仍处于 streaming 的AI消息标记为失败（被新流替代）
-	h.db.Model(&models.Message{}).Where("conversation_id = ? AND sender_type = ? AND status = ?", conversation.ID, "ai", "streaming").
-		Updates(map[string]interface{}{
-			"status":        "failed",
-			"error_message": "superseded by new stream",
-			"updated_at":    time.Now(),
-		})
+	h.supersedeStreaming(conversation.ID)
 
 	// 创建AI消息记录
 	aiMessage := models.Message{
@@ -515,297 +601,379 @@ func (h *ChatHandler) StreamMessages(c *gin.Context) {
 		))
 		return
 	}
+	h.db.Model(&conversation).Update("active_message_id", aiMessage.ID)
 
-	// 使用真实的AI服务进行流式对话
-	h.streamAIResponseWithService(c, aiMessage, conversationID)
+	h.startGeneration(c, flusher, aiMessage, quota)
 }
 
-// streamAIResponseWithService 使用AI服务进行流式响应
-func (h *ChatHandler) streamAIResponseWithService(c *gin.Context, message models.Message, conversationID string) {
-	w := c.Writer
-	flusher, ok := w.(http.Flusher)
+// startGeneration 在后台任务中生成AI回答并推送事件
+// 生成与本次请求解耦：客户端断开后继续生成并保存结果，重连时从缓冲补发。
+func (h *ChatHandler) startGeneration(c *gin.Context, flusher http.Flusher, message models.Message, quota usageSvc.Decision) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+	ctx := context.WithValue(context.Background(), "conversation_id", message.ConversationID.String())
+	// 本次生成中的模型调用计入该用户与部门
+	ctx = ai.WithUsageScope(ctx, ai.UsageScope{
+		UserID:         &uid,
+		Department:     c.GetString("department"),
+		ConversationID: &message.ConversationID,
+		MessageID:      &message.ID,
+		Purpose:        ai.PurposeAnswer,
+	})
+	// 将请求ID注入上下文，便于底层AI日志关联
+	if ridVal, ok := c.Get("request_id"); ok {
+		if rid, ok2 := ridVal.(string); ok2 {
+			ctx = context.WithValue(ctx, "request_id", rid)
+		}
+	}
+	// 登记生成：取消接口会中止模型流式输出、进行中的工具调用与审批等待
+	ctx, release := h.generations.Register(ctx, message.ID)
+	stream := h.streams.Open(message.ConversationID, message.ID)
+	go func() {
+		defer release()
+		defer stream.Close()
+		defer h.keepAlive(message.ID)()
+		defer h.recoverGeneration(stream, message)
+		h.generate(ctx, stream, message, uid, quota)
+	}()
+
+	setSSEHeaders(c)
+	h.serveStream(c, flusher, stream, 0)
+}
+
+// 生成心跳：streaming 消息超过 generationStaleAfter 未刷新时视为没有实例持有
+const (
+	generationHeartbeat  = 15 * time.Second
+	generationStaleAfter = 4 * generationHeartbeat
+)
+
+// streamResumeRetryAfter 生成在其它实例上时，建议客户端重试断线重连的间隔（秒）
+const streamResumeRetryAfter = 3
+
+// recoverGeneration 生成中的 panic：标记消息失败并结束流，须直接 defer 调用
+func (h *ChatHandler) recoverGeneration(stream *chatSvc.Stream, message models.Message) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	logger.Error("AI生成异常 message=%s: %v", message.ID, r)
+	// 回答已保存后（如生成标题时）的异常不改变消息状态
+	h.db.Model(&models.Message{}).Where("id = ? AND status = ?", message.ID, "streaming").
+		Updates(map[string]interface{}{
+			"status":        "failed",
+			"error_message": fmt.Sprint(r),
+			"updated_at":    time.Now(),
+		})
+	h.publish(stream, SSEEvent{Type: "ai_error", Data: map[string]interface{}{"messageId": message.ID, "error": "internal error"}})
+	stream.Publish("done", []byte("{}"))
+}
+
+// keepAlive 生成期间定期刷新消息的 updated_at，其它实例据此判断生成是否仍在进行；返回停止函数
+func (h *ChatHandler) keepAlive(messageID uuid.UUID) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(generationHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				h.db.Model(&models.Message{}).Where("id = ? AND status = ?", messageID, "streaming").
+					Update("updated_at", time.Now())
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// generationStale streaming 消息的心跳已停止：持有生成的实例已退出
+func generationStale(message models.Message) bool {
+	return time.Since(message.UpdatedAt) > generationStaleAfter
+}
+
+// checkQuota 检查用户与部门的 token 配额，超出拒绝类配额时返回 429
+// 检查失败时放行，不因统计故障阻断对话。
+func (h *ChatHandler) checkQuota(c *gin.Context) (usageSvc.Decision, bool) {
+	userID, _ := c.Get("user_id")
+	decision, err := h.quotas.Check(c.Request.Context(), userID.(uuid.UUID), c.GetString("department"))
+	if err != nil {
+		logger.Warn("检查 token 配额失败 user=%v: %v", userID, err)
+		return usageSvc.Decision{}, true
+	}
+	if decision.Rejected() {
+		c.JSON(http.StatusTooManyRequests, pkgErrors.NewErrorResponse(
+			42911,
+			"token 配额已用尽",
+			quotaDetail(decision),
+		))
+		return decision, false
+	}
+	return decision, true
+}
+
+// quotaDetail 超出配额的说明，用于 429 响应与 quota_degraded 事件
+func quotaDetail(d usageSvc.Decision) map[string]interface{} {
+	return map[string]interface{}{
+		"scope":      d.Quota.Scope,
+		"subject":    d.Quota.Subject,
+		"period":     d.Quota.Period,
+		"tokenLimit": d.Quota.TokenLimit,
+		"used":       d.Used,
+		"resetAt":    d.ResetAt,
+	}
+}
+
+// supersedeStreaming 中止对话中仍处于 streaming 的AI消息（被新流替代）
+// 本实例内的生成由其自身以 partial 状态保存已生成的内容，这里不再写入，以免两次写入的先后覆盖结果；
+// 其余消息直接标记为失败。
+func (h *ChatHandler) supersedeStreaming(conversationID uuid.UUID) {
+	var runningIDs []uuid.UUID
+	h.db.Model(&models.Message{}).Where("conversation_id = ? AND sender_type = ? AND status = ?", conversationID, "ai", "streaming").
+		Pluck("id", &runningIDs)
+	var others []uuid.UUID
+	for _, id := range runningIDs {
+		if !h.generations.Supersede(id) {
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 {
+		return
+	}
+	h.db.Model(&models.Message{}).Where("id IN ? AND status = ?", others, "streaming").
+		Updates(map[string]interface{}{
+			"status":        "failed",
+			"error_message": "superseded by new stream",
+			"updated_at":    time.Now(),
+		})
+}
+
+// resumeStream 断线重连：从缓冲补发 Last-Event-ID 之后的事件再跟随实时事件；
+// 生成仍在其它实例上进行时返回 503，客户端稍后重试（会话保持后通常会落到持有生成的实例）；
+// 生成已结束、缓冲已过保留期时返回消息的当前快照
+func (h *ChatHandler) resumeStream(c *gin.Context, flusher http.Flusher, conversation models.Conversation, lastEventID string) {
+	messageID, seq, ok := chatSvc.ParseEventID(lastEventID)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
-			50015,
-			"不支持流式响应",
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40016,
+			"Last-Event-ID 无效",
 			nil,
 		))
 		return
 	}
 
-	// 发送消息开始事件
-	startAt := time.Now()
-	h.writeSSEEvent(w, flusher, SSEEvent{
-		Type: "message_start",
+	if stream, ok := h.streams.Get(conversation.ID); ok && stream.MessageID == messageID {
+		setSSEHeaders(c)
+		h.serveStream(c, flusher, stream, seq)
+		return
+	}
+
+	var message models.Message
+	if err := h.db.Where("id = ? AND conversation_id = ? AND sender_type = ?", messageID, conversation.ID, "ai").First(&message).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40461,
+			"消息不存在",
+			nil,
+		))
+		return
+	}
+	if message.Status == "streaming" {
+		if !generationStale(message) {
+			c.Header("Retry-After", strconv.Itoa(streamResumeRetryAfter))
+			c.JSON(http.StatusServiceUnavailable, pkgErrors.NewErrorResponse(
+				50077,
+				"生成在其它实例上进行，请稍后重试",
+				gin.H{"messageId": message.ID, "status": message.Status, "retryAfter": streamResumeRetryAfter},
+			))
+			return
+		}
+		// 心跳已停止：持有生成的实例已退出，生成不会再继续
+		interrupted := map[string]interface{}{
+			"status":        "failed",
+			"error_message": "generation interrupted",
+			"updated_at":    time.Now(),
+		}
+		if res := h.db.Model(&models.Message{}).Where("id = ? AND status = ?", message.ID, "streaming").Updates(interrupted); res.Error == nil && res.RowsAffected > 0 {
+			message.Status, message.ErrorMessage = "failed", "generation interrupted"
+		} else {
+			h.db.Where("id = ?", message.ID).First(&message)
+		}
+	}
+	setSSEHeaders(c)
+	h.writeSSEEvent(c.Writer, flusher, SSEEvent{
+		Type: "message_snapshot",
 		Data: map[string]interface{}{
-			"messageId": message.ID,
-			"timestamp": time.Now(),
+			"messageId":        message.ID,
+			"status":           message.Status,
+			"content":          message.Content,
+			"errorMessage":     message.ErrorMessage,
+			"metadata":         message.Metadata,
+			"tokenCount":       message.TokenCount,
+			"processingTimeMs": message.ProcessingTimeMs,
+			"timestamp":        time.Now(),
 		},
 	})
+	fmt.Fprintf(c.Writer, "event: done\ndata: {}\n\n")
+	flusher.Flush()
+}
 
-	// 获取对话历史并构建上下文
-	// 重要：排除当前占位的AI消息以及任何处于 streaming 状态的消息，
-	// 确保传给模型的最后一条消息是用户消息，避免上下文错乱。
-	var historyMessages []models.Message
-	h.db.Where("conversation_id = ? AND status <> ?", conversationID, "streaming").
-		Order("created_at ASC").
-		Find(&historyMessages)
-
-	// 使用AI服务构建上下文消息
-	contextMessages := h.aiService.BuildContextMessages(historyMessages)
+// serveStream 将缓冲中序号 after 之后的事件推送给客户端，并持续跟随直到生成结束或客户端断开
+func (h *ChatHandler) serveStream(c *gin.Context, flusher http.Flusher, stream *chatSvc.Stream, after int64) {
+	w := c.Writer
 
-	// 计划阶段：加载用户启用的 MCP 工具，先非流调用以完成工具调用，再进行最终流式回答
-	ctx := c.Request.Context()
-	// 将请求ID与会话ID注入上下文，便于底层AI日志关联
-	if ridVal, ok := c.Get("request_id"); ok {
-		if rid, ok2 := ridVal.(string); ok2 {
-			ctx = context.WithValue(ctx, "request_id", rid)
-		}
+	// 心跳保持（可配置），防止代理/连接超时
+	heartbeatSec := config.GlobalConfig.Server.SSEHeartbeat
+	if heartbeatSec <= 0 {
+		heartbeatSec = 15
 	}
-	ctx = context.WithValue(ctx, "conversation_id", conversationID)
+	ticker := time.NewTicker(time.Duration(heartbeatSec) * time.Second)
+	defer ticker.Stop()
 
-	// 配置：最多规划轮数与是否启用意图判断
-	agentCfg := config.GlobalConfig.AI.Agent
-	maxIter := agentCfg.ToolPlanMaxIter
-	if maxIter <= 0 {
-		maxIter = 1
+	for {
+		events, wait, done, gap := stream.Next(after)
+		if gap {
+			// 错过的事件已超出缓冲上限，提示客户端以消息详情为准
+			h.writeSSEEvent(w, flusher, SSEEvent{Type: "stream_gap", Data: map[string]interface{}{
+				"messageId": stream.MessageID,
+				"timestamp": time.Now(),
+			}})
+		}
+		for _, e := range events {
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", stream.EventID(e.Seq), e.Type, e.Data)
+			after = e.Seq
+		}
+		if len(events) > 0 {
+			flusher.Flush()
+		}
+		if done {
+			return
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-wait:
+		case <-ticker.C:
+			fmt.Fprintf(w, ": ping\n\n")
+			flusher.Flush()
+		}
 	}
+}
 
-	// 先构造一份可用于规划/最终回答的上下文（eino）
-	planEino := h.aiService.ToEinoMessages(contextMessages)
-
-	// 工具意图判断：默认开启时才判断
-	intentOK := true
-	intentReason := "plan"
-
-	// SSE：规划开始
-	h.writeSSEEvent(w, flusher, SSEEvent{Type: "planning_start", Data: map[string]interface{}{
-		"messageId":      message.ID,
-		"intentDetected": intentOK,
-		"intentReason":   intentReason,
-		"maxIterations":  maxIter,
-		"timestamp":      time.Now(),
-	}})
+// setSSEHeaders 设置SSE响应头
+func setSSEHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache, no-transform")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("X-Accel-Buffering", "no")
+}
 
-	// 规划阶段（可选），并行成两个分支：跳过 vs 执行规划
-	toolCalled := false
-	if intentOK {
-		// 1) 加载启用的 MCP 工具
-		h.writeSSEEvent(w, flusher, SSEEvent{Type: "tools_loading_start", Data: map[string]interface{}{
+// generate 生成AI回答：知识库检索 → 工具规划 → 流式回答，事件写入 stream
+func (h *ChatHandler) generate(ctx context.Context, stream *chatSvc.Stream, message models.Message, userID uuid.UUID, quota usageSvc.Decision) {
+	// 发送消息开始事件
+	startAt := time.Now()
+	h.publish(stream, SSEEvent{
+		Type: "message_start",
+		Data: map[string]interface{}{
 			"messageId": message.ID,
 			"timestamp": time.Now(),
-		}})
-		curUserID, _ := c.Get("user_id")
-		var mcpTools []models.Tool
-		if err := h.db.Where("enabled = ? AND tool_type = ?", true, "mcp").Order("created_at ASC").Find(&mcpTools).Error; err != nil {
-			h.db.Model(&message).Updates(map[string]interface{}{
-				"status":        "failed",
-				"error_message": "加载MCP工具失败: " + err.Error(),
-				"updated_at":    time.Now(),
-			})
-			h.writeSSEEvent(w, flusher, SSEEvent{Type: "ai_error", Data: map[string]interface{}{"messageId": message.ID, "error": err.Error()}})
-			return
-		}
-		// 构建 Eino 工具集合与名称到可调用实例的映射
-		type invokable interface {
-			InvokableRun(ctx context.Context, argumentsInJSON string, opts ...interface{}) (string, error)
-		}
-		// 为避免接口不一致，这里采用更宽松的调用，实际断言在执行时进行
-		var toolInfos []*schema.ToolInfo
-		invokers := make(map[string]interface{}) // name -> tool(BaseTool)
-		var closers []func() error
-		for _, t := range mcpTools {
-			prefix := t.Name
-			allowList := ""
-			if v, ok := t.Config["allowTools"]; ok {
-				if s, ok2 := v.(string); ok2 {
-					allowList = s
-				}
-			}
-			tools, closer, err := toolsSvc.BuildMCPTools(ctx, map[string]interface{}(t.Config), prefix, allowList)
-			if err != nil {
-				// 不阻断：某个MCP失败，继续其它
-				continue
-			}
-			closers = append(closers, closer)
-			for _, bt := range tools {
-				if info, err := bt.Info(ctx); err == nil {
-					toolInfos = append(toolInfos, info)
-					invokers[info.Name] = bt
+		},
+	})
+
+	// 获取对话历史并构建上下文：只沿当前分支从父用户消息回溯到根节点，
+	// 其它分支（旧回答、编辑前的消息）不进入上下文。
+	// 重要：排除任何处于 streaming 状态的消息，确保传给模型的最后一条消息是用户消息，避免上下文错乱。
+	var historyMessages []models.Message
+	if message.ParentMessageID != nil {
+		if tree, err := h.loadTree(message.ConversationID); err == nil {
+			for _, m := range tree.Path(*message.ParentMessageID) {
+				if m.Status != "streaming" {
+					historyMessages = append(historyMessages, m)
 				}
 			}
 		}
-		h.writeSSEEvent(w, flusher, SSEEvent{Type: "tools_loading_finished", Data: map[string]interface{}{
-			"messageId": message.ID,
-			"toolCount": len(toolInfos),
-			"timestamp": time.Now(),
+	}
+
+	// 对话级设置（模型、人设/系统提示词、温度、工具范围）
+	svc, settings := h.conversationService(message.ConversationID)
+
+	// 超出降级类配额：改用配额指定的模型配置（保留人设、温度等其它设置）
+	if quota.Degraded() {
+		degraded := settings
+		degraded.Model = quota.Quota.DegradeProfile
+		if _, ok := h.models.Get(degraded.Model); !ok {
+			logger.Warn("配额降级模型配置 %s 不存在，继续使用 %s", degraded.Model, svc.Profile())
+		} else if s, err := h.models.ForSettings(degraded); err != nil {
+			logger.Warn("应用配额降级失败 conversation=%s: %v", message.ConversationID, err)
+		} else {
+			svc = s
+			detail := quotaDetail(quota)
+			detail["messageId"] = message.ID
+			detail["profile"] = s.Profile()
+			detail["model"] = s.Model()
+			h.publish(stream, SSEEvent{Type: "quota_degraded", Data: detail})
+		}
+	}
+
+	// 工具规划与最终回答：主模型重试仍失败、改由备用模型配置回答时告知用户
+	answerCtx := ai.WithFallbackObserver(ctx, func(ev ai.FallbackEvent) {
+		logger.Warn("模型 %s 调用失败，改用备用配置 %s (%s): %s", ev.FromModel, ev.ToProfile, ev.ToModel, ev.Error)
+		h.publish(stream, SSEEvent{Type: "model_fallback", Data: map[string]interface{}{
+			"messageId":   message.ID,
+			"fromProfile": ev.FromProfile,
+			"fromModel":   ev.FromModel,
+			"toProfile":   ev.ToProfile,
+			"toModel":     ev.ToModel,
+			"error":       ev.Error,
+			"timestamp":   time.Now(),
 		}})
-		defer func() {
-			for _, f := range closers {
-				_ = f()
-			}
-		}()
+	})
 
-		// 2) 进行最多N轮的非流工具调用计划（使用 eino 消息以携带 tool_calls）
-		for iter := 0; iter < maxIter; iter++ {
-			h.writeSSEEvent(w, flusher, SSEEvent{Type: "model_step_started", Data: map[string]interface{}{
-				"messageId": message.ID,
-				"iteration": iter + 1,
-				"timestamp": time.Now(),
-			}})
-			if len(toolInfos) == 0 {
-				h.writeSSEEvent(w, flusher, SSEEvent{Type: "model_step_finished", Data: map[string]interface{}{
-					"messageId":    message.ID,
-					"iteration":    iter + 1,
-					"hasToolCalls": false,
-				}})
-				break
-			}
-			// 调用一次生成，附带tools（直接使用 eino 消息）
-			msg, err := h.aiService.GenerateEinoMessage(ctx, planEino, toolInfos, &ai.GenerateOptions{})
-			if err != nil {
-				h.db.Model(&message).Updates(map[string]interface{}{
-					"status":        "failed",
-					"error_message": err.Error(),
-					"updated_at":    time.Now(),
-				})
-				h.writeSSEEvent(w, flusher, SSEEvent{Type: "ai_error", Data: map[string]interface{}{"messageId": message.ID, "error": err.Error()}})
-				return
-			}
-			// 若无工具调用，停止计划（不追加该assistant内容，避免污染上下文）
-			if len(msg.ToolCalls) == 0 {
-				h.writeSSEEvent(w, flusher, SSEEvent{Type: "model_step_finished", Data: map[string]interface{}{
-					"messageId":    message.ID,
-					"iteration":    iter + 1,
-					"hasToolCalls": false,
-				}})
-				break
-			}
-			// 追加assistant消息（包含工具调用），然后执行每个工具调用
-			planEino = append(planEino, msg)
-			h.writeSSEEvent(w, flusher, SSEEvent{Type: "model_step_finished", Data: map[string]interface{}{
-				"messageId":    message.ID,
-				"iteration":    iter + 1,
-				"hasToolCalls": true,
-			}})
-			for _, tc := range msg.ToolCalls {
-				toolName := tc.Function.Name
-				argsJSON := tc.Function.Arguments
-				// 事件：开始
-				h.writeSSEEvent(w, flusher, SSEEvent{Type: "tool_call_started", Data: map[string]interface{}{
-					"messageId": message.ID,
-					"toolName":  toolName,
-					"args":      argsJSON,
-					"timestamp": time.Now(),
-				}})
-
-				// 建立执行记录（关联到对应MCP工具：根据前缀匹配）
-				var matchedTool *models.Tool
-				for i := range mcpTools {
-					if strings.HasPrefix(toolName, mcpTools[i].Name+"__") || toolName == mcpTools[i].Name {
-						matchedTool = &mcpTools[i]
-						break
-					}
-				}
-				execRec := models.ToolExecution{}
-				if matchedTool != nil {
-					execRec = models.ToolExecution{
-						ID:          uuid.New(),
-						ToolID:      matchedTool.ID,
-						UserID:      curUserID.(uuid.UUID),
-						MessageID:   &message.ID,
-						InputParams: models.JSONMap{"tool": toolName, "args": argsJSON},
-						Status:      "pending",
-						CreatedAt:   time.Now(),
-					}
-					_ = h.db.Create(&execRec).Error
-				}
+	// 按 token 预算组装上下文：较早的消息并入滚动摘要
+	contextMessages := h.buildContext(ctx, stream, svc, message, historyMessages)
 
-				startTool := time.Now()
-				// 执行 InvokableRun
-				var resultStr string
-				var runErr error
-				if base := invokers[toolName]; base != nil {
-					// 类型断言为 InvokableTool
-					type inv interface {
-						InvokableRun(context.Context, string, ...einotool.Option) (string, error)
-					}
-					if it, ok := base.(inv); ok {
-						resultStr, runErr = it.InvokableRun(ctx, argsJSON)
-					} else {
-						runErr = fmt.Errorf("tool %s not invokable", toolName)
-					}
-				} else {
-					runErr = fmt.Errorf("tool %s not found", toolName)
-				}
+	// 先构造一份可用于规划/最终回答的上下文（eino）
+	planEino := svc.ToEinoMessages(contextMessages)
 
-				durMs := int(time.Since(startTool).Milliseconds())
-				if matchedTool != nil {
-					updates := map[string]interface{}{
-						"execution_time_ms": durMs,
-					}
-					if runErr != nil {
-						updates["status"] = "failed"
-						updates["error_message"] = runErr.Error()
-					} else {
-						updates["status"] = "success"
-						updates["output_result"] = models.JSONMap{"raw": resultStr}
-					}
-					_ = h.db.Model(&execRec).Updates(updates).Error
-				}
-				// 标记本轮存在工具调用
-				toolCalled = true
-
-				// 事件：结束
-				if runErr != nil {
-					h.writeSSEEvent(w, flusher, SSEEvent{Type: "tool_call_finished", Data: map[string]interface{}{
-						"messageId":  message.ID,
-						"toolName":   toolName,
-						"status":     "failed",
-						"durationMs": durMs,
-						"error":      runErr.Error(),
-					}})
-					// 将错误简述追加到上下文，避免中断对话
-					planEino = append(planEino, &schema.Message{Role: schema.Tool, Content: fmt.Sprintf("{\"tool\":%q,\"error\":%q}", toolName, runErr.Error()), ToolCallID: tc.ID})
-					continue
-				}
+	// 回答可引用的来源：先知识库分块，后工具调用结果
+	citations := &ai.CitationSources{}
 
-				// 结果预览（最多200字符）
-				preview := resultStr
-				if len(preview) > 200 {
-					preview = preview[:200] + "..."
-				}
-				h.writeSSEEvent(w, flusher, SSEEvent{Type: "tool_call_finished", Data: map[string]interface{}{
-					"messageId":     message.ID,
-					"toolName":      toolName,
-					"status":        "success",
-					"durationMs":    durMs,
-					"result":        resultStr,
-					"resultPreview": preview,
-				}})
-
-				// 将工具结果追加到上下文
-				planEino = append(planEino, &schema.Message{Role: schema.Tool, Content: resultStr, ToolCallID: tc.ID})
+	// 知识库检索：以最近一条用户消息为问题，命中内容作为系统消息插入到该问题之前
+	if h.retriever != nil {
+		var question string
+		for i := len(historyMessages) - 1; i >= 0; i-- {
+			if historyMessages[i].SenderType == "user" {
+				question = historyMessages[i].Content
+				break
 			}
 		}
-		// 规划阶段完成（执行分支）
-		h.writeSSEEvent(w, flusher, SSEEvent{Type: "planning_finished", Data: map[string]interface{}{
-			"messageId":  message.ID,
-			"iterations": maxIter,
-			"toolCalled": toolCalled,
-			"timestamp":  time.Now(),
-		}})
-	} else {
-		// 规划阶段完成（跳过分支）
-		h.writeSSEEvent(w, flusher, SSEEvent{Type: "planning_finished", Data: map[string]interface{}{
-			"messageId":  message.ID,
-			"skipped":    true,
-			"iterations": 0,
-			"toolCalled": false,
-			"timestamp":  time.Now(),
-		}})
+		if question != "" {
+			planEino = h.retrieveKnowledge(ctx, stream, message.ID, question, planEino, citations)
+		}
 	}
 
+	// 工具规划：模型选择工具 → 并行执行 → 结果回填，直到不再调用工具
+	outcome, err := h.runAgent(ai.WithUsagePurpose(answerCtx, ai.PurposePlanning), stream, svc, message, userID, settings.ToolIDs, planEino, citations)
+	if err != nil {
+		if chatSvc.Cancelled(ctx) {
+			h.finishCancelled(stream, message, "", startAt)
+			return
+		}
+		errMsg := err.Error()
+		if ctx.Err() != nil {
+			errMsg = context.Cause(ctx).Error()
+		}
+		h.db.Model(&message).Updates(map[string]interface{}{
+			"status":        "failed",
+			"error_message": errMsg,
+			"updated_at":    time.Now(),
+		})
+		h.publish(stream, SSEEvent{Type: "ai_error", Data: map[string]interface{}{"messageId": message.ID, "error": err.Error()}})
+		return
+	}
+	planEino = outcome.Messages
+	toolCalled := outcome.ToolCalled
+
 	// 在有工具调用时，追加一条系统指令，要求总结工具输出给出清晰结论
 	if toolCalled {
 		summarizeHint := "请基于以上工具调用返回的数据和上下文，面向用户输出清晰的中文结论与可执行建议：\n" +
@@ -817,54 +985,61 @@ func (h *ChatHandler) streamAIResponseWithService(c *gin.Context, message models
 		planEino = append(planEino, &schema.Message{Role: schema.System, Content: summarizeHint})
 	}
 
+	// 有可引用来源时要求模型在回答中标注 [n]
+	if citations.Len() > 0 {
+		planEino = append(planEino, &schema.Message{Role: schema.System, Content: citations.Prompt()})
+	}
+
 	// 3) 最终流式回答（不再附带工具，避免再次触发调用）
-	streamChan, err := h.aiService.ChatStreamEino(ctx, planEino, &ai.GenerateOptions{Stream: true})
+	streamChan, err := svc.ChatStreamEino(answerCtx, planEino, &ai.GenerateOptions{Stream: true})
 	if err != nil {
+		if chatSvc.Cancelled(ctx) {
+			h.finishCancelled(stream, message, "", startAt)
+			return
+		}
 		h.db.Model(&message).Updates(map[string]interface{}{
 			"status":             "failed",
 			"error_message":      err.Error(),
 			"updated_at":         time.Now(),
 			"processing_time_ms": int(time.Since(startAt).Milliseconds()),
 		})
-		h.writeSSEEvent(w, flusher, SSEEvent{Type: "ai_error", Data: map[string]interface{}{"messageId": message.ID, "error": err.Error()}})
+		h.publish(stream, SSEEvent{Type: "ai_error", Data: map[string]interface{}{"messageId": message.ID, "error": err.Error()}})
 		return
 	}
 
 	fullContent := ""
 	var finalTokenCount int
 	var finalFinishReason string
+	var answeredBy map[string]interface{} // 实际回答的 model 与 profile
 
-	// 处理流式响应 + 心跳保持（可配置）
-	heartbeatSec := config.GlobalConfig.Server.SSEHeartbeat
-	if heartbeatSec <= 0 {
-		heartbeatSec = 15
-	}
-	ticker := time.NewTicker(time.Duration(heartbeatSec) * time.Second)
-	defer ticker.Stop()
-
+	// 处理流式响应（心跳由订阅的 SSE 连接负责）
 STREAM_LOOP:
 	for {
 		select {
 		case <-ctx.Done():
-			// 客户端断开，标记为部分完成并保存已生成的内容
+			if chatSvc.Cancelled(ctx) {
+				h.finishCancelled(stream, message, fullContent, startAt)
+				return
+			}
+			// 被新的生成替代或服务关闭，标记为部分完成并保存已生成的内容
 			h.db.Model(&message).Updates(map[string]interface{}{
 				"status":             "partial",
-				"error_message":      "client canceled",
+				"error_message":      context.Cause(ctx).Error(),
 				"content":            fullContent,
 				"updated_at":         time.Now(),
 				"processing_time_ms": int(time.Since(startAt).Milliseconds()),
 			})
 			return
-		case <-ticker.C:
-			// 周期性心跳，防止代理/连接超时
-			fmt.Fprintf(w, ": ping\n\n")
-			flusher.Flush()
 		case chunk, ok := <-streamChan:
 			if !ok {
 				// 流结束
 				break STREAM_LOOP
 			}
 			if chunk.Error != nil {
+				if chatSvc.Cancelled(ctx) {
+					h.finishCancelled(stream, message, fullContent, startAt)
+					return
+				}
 				// 标记失败并保存已生成的部分内容
 				h.db.Model(&message).Updates(map[string]interface{}{
 					"status":             "failed",
@@ -873,7 +1048,7 @@ STREAM_LOOP:
 					"updated_at":         time.Now(),
 					"processing_time_ms": int(time.Since(startAt).Milliseconds()),
 				})
-				h.writeSSEEvent(w, flusher, SSEEvent{
+				h.publish(stream, SSEEvent{
 					Type: "ai_error",
 					Data: map[string]interface{}{
 						"messageId": message.ID,
@@ -884,7 +1059,7 @@ STREAM_LOOP:
 			}
 			if chunk.Delta != "" {
 				// 发送内容增量
-				h.writeSSEEvent(w, flusher, SSEEvent{
+				h.publish(stream, SSEEvent{
 					Type: "content_delta",
 					Data: map[string]interface{}{
 						"messageId": message.ID,
@@ -897,11 +1072,28 @@ STREAM_LOOP:
 			if chunk.Finished {
 				finalTokenCount = chunk.TokenCount
 				finalFinishReason = chunk.FinishReason
+				answeredBy = chunk.Metadata
 				break STREAM_LOOP
 			}
 		}
 	}
 
+	// 解析回答中实际引用的来源
+	cited := citations.Extract(fullContent)
+	if cited == nil {
+		cited = []ai.Citation{}
+	}
+	metadata := models.JSONMap{}
+	for k, v := range message.Metadata {
+		metadata[k] = v
+	}
+	metadata["citations"] = cited
+	for _, k := range []string{"model", "profile"} {
+		if v, ok := answeredBy[k]; ok {
+			metadata[k] = v
+		}
+	}
+
 	// 更新数据库中的AI消息
 	processingTime := int(time.Since(startAt).Milliseconds())
 	h.db.Model(&message).Updates(map[string]interface{}{
@@ -909,6 +1101,7 @@ STREAM_LOOP:
 		"status":             "completed",
 		"token_count":        finalTokenCount,
 		"processing_time_ms": processingTime,
+		"metadata":           metadata,
 		"updated_at":         time.Now(),
 	})
 
@@ -920,13 +1113,14 @@ STREAM_LOOP:
 		})
 
 	// 发送消息完成事件
-	h.writeSSEEvent(w, flusher, SSEEvent{
+	h.publish(stream, SSEEvent{
 		Type: "message_complete",
 		Data: map[string]interface{}{
 			"messageId":        message.ID,
 			"tokenCount":       finalTokenCount,
 			"processingTimeMs": processingTime,
 			"finishReason":     finalFinishReason,
+			"citations":        cited,
 			"timestamp":        time.Now(),
 		},
 	})
@@ -939,9 +1133,9 @@ STREAM_LOOP:
 			if message.ParentMessageID != nil {
 				_ = h.db.Where("id = ?", *message.ParentMessageID).First(&userMsg).Error
 			}
-			titleCtx, cancel := context.WithTimeout(c.Request.Context(), 8*time.Second)
+			titleCtx, cancel := context.WithTimeout(ai.WithUsagePurpose(ctx, ai.PurposeTitle), 8*time.Second)
 			defer cancel()
-			if newTitle, err := h.aiService.GenerateTitle(titleCtx, userMsg.Content, fullContent); err == nil && newTitle != "" {
+			if newTitle, err := h.models.Auxiliary().GenerateTitle(titleCtx, userMsg.Content, fullContent); err == nil && newTitle != "" {
 				h.db.Model(&models.Conversation{}).
 					Where("id = ? AND (title = '' OR title = ?)", message.ConversationID, constants.DefaultConversationTitle).
 					Updates(map[string]interface{}{
@@ -949,7 +1143,7 @@ STREAM_LOOP:
 						"updated_at": time.Now(),
 					})
 
-				h.writeSSEEvent(w, flusher, SSEEvent{
+				h.publish(stream, SSEEvent{
 					Type: "conversation_title_updated",
 					Data: map[string]interface{}{
 						"conversationId": message.ConversationID,
@@ -961,8 +1155,281 @@ STREAM_LOOP:
 	}
 
 	// 发送结束标记
-	fmt.Fprintf(w, "event: done\ndata: {}\n\n")
-	flusher.Flush()
+	stream.Publish("done", []byte("{}"))
+}
+
+// finishCancelled 保存已生成的内容并将消息标记为已取消，随后结束SSE流
+func (h *ChatHandler) finishCancelled(stream *chatSvc.Stream, message models.Message, content string, startAt time.Time) {
+	processingTime := int(time.Since(startAt).Milliseconds())
+	h.db.Model(&message).Updates(map[string]interface{}{
+		"status":             "cancelled",
+		"error_message":      "cancelled by user",
+		"content":            content,
+		"updated_at":         time.Now(),
+		"processing_time_ms": processingTime,
+	})
+	h.publish(stream, SSEEvent{
+		Type: "message_cancelled",
+		Data: map[string]interface{}{
+			"messageId":        message.ID,
+			"content":          content,
+			"processingTimeMs": processingTime,
+			"timestamp":        time.Now(),
+		},
+	})
+	stream.Publish("done", []byte("{}"))
+}
+
+// CancelMessage 取消进行中的AI生成
+// 生成可能运行在其它实例上，此时通过广播通知持有者；最终状态以SSE流中的 message_cancelled 事件为准。
+func (h *ChatHandler) CancelMessage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	conversationID := c.Param("id")
+
+	var conversation models.Conversation
+	if err := h.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40413,
+			"对话不存在",
+			nil,
+		))
+		return
+	}
+
+	var message models.Message
+	if err := h.db.Where("id = ? AND conversation_id = ? AND sender_type = ?", c.Param("messageId"), conversation.ID, "ai").First(&message).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40461,
+			"消息不存在",
+			nil,
+		))
+		return
+	}
+	if message.Status != "streaming" {
+		c.JSON(http.StatusConflict, pkgErrors.NewErrorResponse(
+			40912,
+			"消息未在生成中",
+			gin.H{"status": message.Status},
+		))
+		return
+	}
+
+	owned, err := h.generations.Cancel(c.Request.Context(), message.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50051,
+			"取消生成失败",
+			err.Error(),
+		))
+		return
+	}
+	// 没有实例持有该生成（实例已退出或重启），或心跳已停止：直接结束消息，否则会一直停留在 streaming
+	if !owned || generationStale(message) {
+		if err := h.db.Model(&models.Message{}).Where("id = ? AND status = ?", message.ID, "streaming").
+			Updates(map[string]interface{}{
+				"status":        "cancelled",
+				"error_message": "cancelled by user",
+				"updated_at":    time.Now(),
+			}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+				50051,
+				"取消生成失败",
+				err.Error(),
+			))
+			return
+		}
+		c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(gin.H{
+			"messageId": message.ID,
+			"status":    "cancelled",
+		}))
+		return
+	}
+
+	c.JSON(http.StatusAccepted, pkgErrors.NewSuccessResponse(gin.H{
+		"messageId": message.ID,
+		"status":    "cancelling",
+	}))
+}
+
+// ToolApprovalRequest 工具调用审批请求
+type ToolApprovalRequest struct {
+	Approved *bool  `json:"approved" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+// DecideToolApproval 批准或拒绝对话中等待审批的工具调用
+func (h *ChatHandler) DecideToolApproval(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	conversationID := c.Param("id")
+	executionID, err := uuid.Parse(c.Param("executionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40015, "请求参数错误", "executionId 无效"))
+		return
+	}
+
+	var req ToolApprovalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40015, "请求参数错误", err.Error()))
+		return
+	}
+
+	// 验证对话是否属于当前用户
+	var conversation models.Conversation
+	if err := h.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(40410, "对话不存在", nil))
+		return
+	}
+
+	// 执行记录需属于该对话中的消息
+	var execution models.ToolExecution
+	if err := h.db.Joins("JOIN messages ON messages.id = tool_executions.message_id").
+		Where("tool_executions.id = ? AND messages.conversation_id = ?", executionID, conversation.ID).
+		First(&execution).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(40460, "工具调用不存在", nil))
+		return
+	}
+
+	decision, err := h.approvals.Decide(c.Request.Context(), execution.ID, userID.(uuid.UUID), *req.Approved, req.Comment)
+	if errors.Is(err, toolsSvc.ErrApprovalNotPending) {
+		c.JSON(http.StatusConflict, pkgErrors.NewErrorResponse(40911, "该工具调用不在待审批状态", nil))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(50019, "记录审批结果失败", err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"executionId": execution.ID,
+		"decision":    decision.Status,
+		"approvedBy":  decision.ApprovedBy,
+		"comment":     decision.Comment,
+	}))
+}
+
+// buildContext 按 token 预算组装上下文
+// 超出预算（或 memory_length）的较早消息与已有摘要合并为新的滚动摘要，保存在 Conversation.Context["summary"]；
+// 摘要失败时沿用已有摘要并只保留预算内的消息，不阻断对话。
+func (h *ChatHandler) buildContext(ctx context.Context, stream *chatSvc.Stream, svc *ai.AIService, message models.Message, history []models.Message) []ai.ChatMessage {
+	var conversation models.Conversation
+	var summary *ai.ConversationSummary
+	if err := h.db.Select("id", "context").Where("id = ?", message.ConversationID).First(&conversation).Error; err == nil {
+		summary = ai.SummaryFromContext(conversation.Context)
+	}
+
+	opts := svc.ContextOptions(config.GlobalConfig.AI.Agent)
+	plan := ai.PlanContext(history, summary, ai.EstimateTokens(svc.SystemPrompt()), opts)
+	if len(plan.Summarize) == 0 {
+		return svc.BuildContextMessages(plan.Kept, plan.Summary)
+	}
+
+	previous, count := "", 0
+	if plan.Summary != nil {
+		previous, count = plan.Summary.Text, plan.Summary.MessageCount
+	}
+	summarizeAt := time.Now()
+	text, err := svc.Summarize(ai.WithUsagePurpose(ctx, ai.PurposeSummary), previous, plan.Summarize)
+	if err != nil {
+		logger.Warn("对话摘要失败 conversation=%s: %v", message.ConversationID, err)
+		h.publish(stream, SSEEvent{Type: "context_summarized", Data: map[string]interface{}{
+			"messageId":  message.ID,
+			"status":     "failed",
+			"error":      err.Error(),
+			"durationMs": int(time.Since(summarizeAt).Milliseconds()),
+		}})
+		return svc.BuildContextMessages(plan.Kept, plan.Summary)
+	}
+
+	updated := &ai.ConversationSummary{
+		Text:             text,
+		ThroughMessageID: plan.Summarize[len(plan.Summarize)-1].ID,
+		MessageCount:     count + len(plan.Summarize),
+		UpdatedAt:        time.Now(),
+	}
+	if b, err := json.Marshal(updated); err == nil {
+		h.db.Model(&models.Conversation{}).Where("id = ?", message.ConversationID).
+			Update("context", gorm.Expr("COALESCE(context, '{}'::jsonb) || jsonb_build_object(?::text, ?::jsonb)", ai.SummaryContextKey, string(b)))
+	}
+	h.publish(stream, SSEEvent{Type: "context_summarized", Data: map[string]interface{}{
+		"messageId":       message.ID,
+		"status":          "success",
+		"summarizedCount": len(plan.Summarize),
+		"totalSummarized": updated.MessageCount,
+		"keptCount":       len(plan.Kept),
+		"durationMs":      int(time.Since(summarizeAt).Milliseconds()),
+	}})
+	return svc.BuildContextMessages(plan.Kept, updated)
+}
+
+// conversationService 按对话设置得到本次回答使用的 AI 服务
+// 设置无效（如模型已从 allowed_models 移除、人设已删除）时记录告警并回退到全局配置，不阻断对话。
+func (h *ChatHandler) conversationService(conversationID uuid.UUID) (*ai.AIService, ai.ConversationSettings) {
+	var conversation models.Conversation
+	if err := h.db.Select("id", "context").Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		return h.models.Default(), ai.ConversationSettings{}
+	}
+	settings, err := ai.SettingsFromContext(conversation.Context)
+	if err != nil {
+		logger.Warn("对话设置无效 conversation=%s: %v", conversationID, err)
+		return h.models.Default(), ai.ConversationSettings{}
+	}
+	svc, err := h.models.ForSettings(settings)
+	if err != nil {
+		logger.Warn("应用对话设置失败 conversation=%s: %v", conversationID, err)
+		return h.models.Default(), ai.ConversationSettings{ToolIDs: settings.ToolIDs}
+	}
+	return svc, settings
+}
+
+// retrieveKnowledge 检索知识库并注入上下文；检索失败不阻断对话
+func (h *ChatHandler) retrieveKnowledge(ctx context.Context, stream *chatSvc.Stream, messageID uuid.UUID, question string, planEino []*schema.Message, citations *ai.CitationSources) []*schema.Message {
+	h.publish(stream, SSEEvent{Type: "retrieval_started", Data: map[string]interface{}{
+		"messageId": messageID,
+		"timestamp": time.Now(),
+	}})
+
+	retrieveAt := time.Now()
+	chunks, err := h.retriever.Retrieve(ctx, question)
+	if err != nil {
+		logger.Warn("知识库检索失败 message=%s: %v", messageID, err)
+		h.publish(stream, SSEEvent{Type: "retrieval_finished", Data: map[string]interface{}{
+			"messageId":  messageID,
+			"status":     "failed",
+			"error":      err.Error(),
+			"documents":  []knowledgeSvc.RetrievedDocument{},
+			"durationMs": int(time.Since(retrieveAt).Milliseconds()),
+		}})
+		return planEino
+	}
+
+	documents := knowledgeSvc.GroupByDocument(chunks)
+	if documents == nil {
+		documents = []knowledgeSvc.RetrievedDocument{}
+	}
+	h.publish(stream, SSEEvent{Type: "retrieval_finished", Data: map[string]interface{}{
+		"messageId":  messageID,
+		"status":     "success",
+		"chunkCount": len(chunks),
+		"documents":  documents,
+		"durationMs": int(time.Since(retrieveAt).Milliseconds()),
+	}})
+	if len(chunks) == 0 {
+		return planEino
+	}
+
+	start := citations.Len() + 1
+	for _, chunk := range chunks {
+		citations.AddKnowledge(chunk.DocumentID, chunk.DocumentTitle, chunk.ChunkIndex)
+	}
+	grounding := &schema.Message{Role: schema.System, Content: knowledgeSvc.BuildGroundingPrompt(chunks, start)}
+	if len(planEino) == 0 {
+		return []*schema.Message{grounding}
+	}
+	last := len(planEino) - 1
+	result := make([]*schema.Message, 0, len(planEino)+1)
+	result = append(result, planEino[:last]...)
+	result = append(result, grounding, planEino[last])
+	return result
 }
 
 func (h *ChatHandler) streamAIResponse(c *gin.Context, message models.Message, userInput string) {
@@ -1054,6 +1521,12 @@ func (h *ChatHandler) streamAIResponse(c *gin.Context, message models.Message, u
 	flusher.Flush()
 }
 
+// publish 将事件写入生成的事件缓冲，由订阅的 SSE 连接推送
+func (h *ChatHandler) publish(stream *chatSvc.Stream, event SSEEvent) {
+	data, _ := json.Marshal(event)
+	stream.Publish(event.Type, data)
+}
+
 func (h *ChatHandler) writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event SSEEvent) {
 	data, _ := json.Marshal(event)
 	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, string(data))
@@ -1062,13 +1535,12 @@ func (h *ChatHandler) writeSSEEvent(w http.ResponseWriter, flusher http.Flusher,
 
 // GetMessage 获取单个消息详情
 func (h *ChatHandler) GetMessage(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	conversationID := c.Param("id")
 	messageID := c.Param("messageId")
 
-	// 验证对话是否属于当前用户
+	// 验证当前用户可以查看该对话
 	var conversation models.Conversation
-	if err := h.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+	if err := h.readableConversations(c).Where("id = ?", conversationID).First(&conversation).Error; err != nil {
 		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
 			40415,
 			"对话不存在",
@@ -1155,6 +1627,24 @@ func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
 		return
 	}
 
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50015,
+			"不支持流式响应",
+			nil,
+		))
+		return
+	}
+
+	quota, ok := h.checkQuota(c)
+	if !ok {
+		return
+	}
+
+	// 中止仍在进行的生成，避免与新生成同时写入
+	h.supersedeStreaming(conversation.ID)
+
 	// 创建新的AI消息记录
 	newAIMessage := models.Message{
 		ID:              uuid.New(),
@@ -1174,16 +1664,11 @@ func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
 		))
 		return
 	}
-
-	// 设置SSE响应头
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache, no-transform")
-	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("X-Accel-Buffering", "no")
+	// 新回答与原回答互为兄弟节点，切换为当前分支
+	h.db.Model(&conversation).Update("active_message_id", newAIMessage.ID)
 
 	// 使用真实AI服务（与普通流式一致的路径）
-	h.streamAIResponseWithService(c, newAIMessage, conversationID)
+	h.startGeneration(c, flusher, newAIMessage, quota)
 }
 
 func (h *ChatHandler) DeleteConversation(c *gin.Context) {
@@ -1247,7 +1732,27 @@ func (h *ChatHandler) UpdateConversation(c *gin.Context) {
 		updates["title"] = req.Title
 	}
 	if req.Context != nil {
-		updates["context"] = req.Context
+		// 合并而不是整体替换，保留滚动摘要等服务端写入的键；值为 null 表示删除该键
+		merged := models.JSONMap{}
+		for k, v := range conversation.Context {
+			merged[k] = v
+		}
+		for k, v := range req.Context {
+			if v == nil {
+				delete(merged, k)
+			} else {
+				merged[k] = v
+			}
+		}
+		if err := h.validateSettings(merged); err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+				40017,
+				"对话设置无效",
+				err.Error(),
+			))
+			return
+		}
+		updates["context"] = merged
 	}
 
 	if err := h.db.Model(&conversation).Updates(updates).Error; err != nil {
@@ -1263,15 +1768,125 @@ func (h *ChatHandler) UpdateConversation(c *gin.Context) {
 	h.db.Where("id = ?", conversationID).First(&conversation)
 
 	response := ConversationResponse{
-		ID:            conversation.ID,
-		Title:         conversation.Title,
-		Context:       conversation.Context,
-		Status:        conversation.Status,
-		TotalMessages: conversation.TotalMessages,
-		LastMessageAt: conversation.LastMessageAt,
-		CreatedAt:     conversation.CreatedAt,
-		UpdatedAt:     conversation.UpdatedAt,
+		ID:              conversation.ID,
+		Title:           conversation.Title,
+		Context:         conversation.Context,
+		Status:          conversation.Status,
+		TotalMessages:   conversation.TotalMessages,
+		LastMessageAt:   conversation.LastMessageAt,
+		ActiveMessageID: conversation.ActiveMessageID,
+		CreatedAt:       conversation.CreatedAt,
+		UpdatedAt:       conversation.UpdatedAt,
 	}
 
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(response))
 }
+
+// readableConversations 当前用户可以查看的对话：自己的；具备 conversations.read_all 权限时为全部
+// 只用于只读接口，发送消息、修改与删除仍限于本人的对话。
+func (h *ChatHandler) readableConversations(c *gin.Context) *gorm.DB {
+	if hasPermission(c, h.permissions, authSvc.PermConversationsReadAll) {
+		return h.db
+	}
+	userID, _ := c.Get("user_id")
+	return h.db.Where("user_id = ?", userID)
+}
+
+// GetModels 对话可选用的模型配置、默认配置允许的其它模型与预置人设
+func (h *ChatHandler) GetModels(c *gin.Context) {
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"profiles":      h.models.Profiles(),
+		"allowedModels": h.models.Default().AllowedModels(),
+		"personas":      h.models.Default().Personas(),
+	}))
+}
+
+// GetMyUsage 当前用户今日与本月的 token 用量，以及适用的配额
+func (h *ChatHandler) GetMyUsage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	uid := userID.(uuid.UUID)
+	ctx := c.Request.Context()
+
+	usage := map[string]interface{}{}
+	for _, period := range []string{usageSvc.PeriodDaily, usageSvc.PeriodMonthly} {
+		used, err := h.quotas.Used(ctx, uid, period)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+				50058,
+				"获取用量失败",
+				err.Error(),
+			))
+			return
+		}
+		usage[period] = used
+	}
+
+	statuses, err := h.quotas.Statuses(ctx, uid, c.GetString("department"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50058,
+			"获取用量失败",
+			err.Error(),
+		))
+		return
+	}
+	quotas := make([]map[string]interface{}, 0, len(statuses))
+	for _, st := range statuses {
+		quotas = append(quotas, map[string]interface{}{
+			"scope":          st.Quota.Scope,
+			"subject":        st.Quota.Subject,
+			"period":         st.Quota.Period,
+			"tokenLimit":     st.Quota.TokenLimit,
+			"used":           st.Used,
+			"remaining":      max(st.Quota.TokenLimit-st.Used, 0),
+			"action":         st.Quota.Action,
+			"degradeProfile": st.Quota.DegradeProfile,
+			"exceeded":       st.Exceeded(),
+			"resetAt":        st.ResetAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"tokens": usage,
+		"quotas": quotas,
+	}))
+}
+
+// validateSettings 校验对话设置：模型须为模型配置名或在允许列表中，人设与工具须存在
+func (h *ChatHandler) validateSettings(ctx models.JSONMap) error {
+	settings, err := ai.SettingsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !h.models.ModelAllowed(settings.Model) {
+		return fmt.Errorf("model not allowed: %s", settings.Model)
+	}
+	if settings.Persona != "" {
+		if _, ok := h.models.Default().PersonaPrompt(settings.Persona); !ok {
+			return fmt.Errorf("unknown persona: %s", settings.Persona)
+		}
+	}
+	if len(settings.ToolIDs) > 0 {
+		var count int64
+		if err := h.db.Model(&models.Tool{}).Where("id IN ?", settings.ToolIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(uniqueIDs(settings.ToolIDs)) {
+			return fmt.Errorf("%s contains unknown tools", ai.SettingToolIDs)
+		}
+	}
+	return nil
+}
+
+// uniqueIDs 去重
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
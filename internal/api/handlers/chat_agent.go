@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	einotool "github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	"github.com/liusCraft/orion/internal/services/ai"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	chatSvc "github.com/liusCraft/orion/internal/services/chat"
+	toolsSvc "github.com/liusCraft/orion/internal/services/tools"
+)
+
+// 规划结束原因（planning_finished.stopReason）
+const (
+	agentStopNoTools       = "no_tools"       // 没有可用工具
+	agentStopCompleted     = "completed"      // 模型不再调用工具
+	agentStopMaxIterations = "max_iterations" // 达到轮数上限
+	agentStopRepeated      = "repeated_calls" // 模型重复发起完全相同的调用
+)
+
+// agentRun 一次回答的工具规划（ReAct）：模型选择工具 → 并行执行 → 结果回填，
+// 直到模型不再调用工具、达到轮数上限或重复相同调用
+type agentRun struct {
+	h         *ChatHandler
+	ctx       context.Context
+	stream    *chatSvc.Stream
+	svc       *ai.AIService
+	message   models.Message
+	userID    uuid.UUID
+	toolIDs   []uuid.UUID // 对话限定的工具，nil 表示全部启用的工具
+	citations *ai.CitationSources
+
+	tools     []models.Tool
+	toolInfos []*schema.ToolInfo
+	invokers  map[string]einotool.BaseTool
+
+	mu   sync.Mutex        // 串行化 SSE 写入与引用登记（工具并行执行）
+	seen map[string]string // 调用签名 -> 工具结果，识别重复调用
+}
+
+// agentOutcome 规划结果
+type agentOutcome struct {
+	Messages   []*schema.Message // 追加了工具调用与结果的上下文
+	Iterations int               // 实际调用模型的轮数
+	ToolCalled bool
+	StopReason string
+}
+
+// runAgent 执行工具规划阶段，返回用于最终回答的上下文
+// 返回错误表示模型调用失败或客户端已断开，调用方负责标记消息失败。
+func (h *ChatHandler) runAgent(ctx context.Context, stream *chatSvc.Stream, svc *ai.AIService, message models.Message, userID uuid.UUID, toolIDs []uuid.UUID, planEino []*schema.Message, citations *ai.CitationSources) (agentOutcome, error) {
+	maxIter := config.GlobalConfig.AI.Agent.MaxIterations
+	if maxIter <= 0 {
+		maxIter = 1
+	}
+	r := &agentRun{
+		h:         h,
+		ctx:       ctx,
+		stream:    stream,
+		svc:       svc,
+		message:   message,
+		userID:    userID,
+		toolIDs:   toolIDs,
+		citations: citations,
+		seen:      make(map[string]string),
+	}
+
+	r.emit(SSEEvent{Type: "planning_start", Data: map[string]interface{}{
+		"messageId":      message.ID,
+		"intentDetected": true,
+		"intentReason":   "plan",
+		"maxIterations":  maxIter,
+		"timestamp":      time.Now(),
+	}})
+
+	if err := r.loadTools(); err != nil {
+		return agentOutcome{}, fmt.Errorf("加载工具失败: %w", err)
+	}
+
+	out := agentOutcome{Messages: planEino, StopReason: agentStopMaxIterations}
+	if len(r.toolInfos) == 0 {
+		out.StopReason = agentStopNoTools
+	}
+	for out.StopReason != agentStopNoTools && out.Iterations < maxIter {
+		out.Iterations++
+		iter := out.Iterations
+		r.emit(SSEEvent{Type: "model_step_started", Data: map[string]interface{}{
+			"messageId": message.ID,
+			"iteration": iter,
+			"timestamp": time.Now(),
+		}})
+		msg, err := r.svc.GenerateEinoMessage(ctx, out.Messages, r.toolInfos, &ai.GenerateOptions{})
+		if err != nil {
+			return out, err
+		}
+		r.emit(SSEEvent{Type: "model_step_finished", Data: map[string]interface{}{
+			"messageId":    message.ID,
+			"iteration":    iter,
+			"hasToolCalls": len(msg.ToolCalls) > 0,
+			"toolCalls":    len(msg.ToolCalls),
+		}})
+		// 无工具调用：规划结束（不追加该assistant内容，避免污染上下文）
+		if len(msg.ToolCalls) == 0 {
+			out.StopReason = agentStopCompleted
+			break
+		}
+
+		out.Messages = append(out.Messages, msg)
+		results, repeated, err := r.executeTurn(msg.ToolCalls)
+		if err != nil {
+			return out, err
+		}
+		out.Messages = append(out.Messages, results...)
+		out.ToolCalled = true
+		if repeated {
+			out.StopReason = agentStopRepeated
+			break
+		}
+	}
+
+	r.emit(SSEEvent{Type: "planning_finished", Data: map[string]interface{}{
+		"messageId":  message.ID,
+		"iterations": out.Iterations,
+		"toolCalled": out.ToolCalled,
+		"stopReason": out.StopReason,
+		"timestamp":  time.Now(),
+	}})
+	return out, nil
+}
+
+// loadTools 加载启用的 MCP、API 与脚本工具，构建 Eino 工具集合
+// 对话设置了 toolIds 时只加载其中的工具，空列表表示不使用工具；用户没有执行权限的工具不加载。
+func (r *agentRun) loadTools() error {
+	r.emit(SSEEvent{Type: "tools_loading_start", Data: map[string]interface{}{
+		"messageId": r.message.ID,
+		"timestamp": time.Now(),
+	}})
+	toolTypes := []string{"mcp", "api"}
+	if config.GlobalConfig.Tools.Script.Enabled {
+		toolTypes = append(toolTypes, "script")
+	}
+	query := r.h.db.Where("enabled = ? AND tool_type IN ?", true, toolTypes)
+	if r.toolIDs != nil {
+		if len(r.toolIDs) == 0 {
+			query = query.Where("1 = 0")
+		} else {
+			query = query.Where("id IN ?", r.toolIDs)
+		}
+	}
+	var tools []models.Tool
+	if err := query.Order("created_at ASC").Find(&tools).Error; err != nil {
+		return err
+	}
+
+	// 只使用用户有权执行的工具
+	grants, err := r.h.permissions.Resolve(r.ctx, r.userID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tools {
+		if grants.Has(authSvc.ToolExecutePermission(t.ID)) {
+			r.tools = append(r.tools, t)
+		}
+	}
+
+	r.invokers = make(map[string]einotool.BaseTool)
+	apiOpts, scriptOpts := apiToolOptions(), scriptToolOptions()
+	for _, t := range r.tools {
+		var candidates []einotool.BaseTool
+		switch t.ToolType {
+		case "api":
+			// API 与脚本工具直接以工具名暴露给模型
+			candidates = []einotool.BaseTool{toolsSvc.NewAPITool(t, apiOpts)}
+		case "script":
+			candidates = []einotool.BaseTool{toolsSvc.NewScriptTool(t, scriptOpts)}
+		default:
+			// 复用长连接会话，工具名带 "工具名__" 前缀
+			tools, err := r.h.mcpSessions.Tools(r.ctx, t)
+			if err != nil {
+				// 不阻断：某个MCP失败，继续其它
+				continue
+			}
+			candidates = tools
+		}
+		for _, bt := range candidates {
+			info, err := bt.Info(r.ctx)
+			if err != nil {
+				logger.Warn("工具参数定义无效 tool=%s: %v", t.Name, err)
+				continue
+			}
+			r.toolInfos = append(r.toolInfos, info)
+			r.invokers[info.Name] = bt
+		}
+	}
+	r.emit(SSEEvent{Type: "tools_loading_finished", Data: map[string]interface{}{
+		"messageId": r.message.ID,
+		"toolCount": len(r.toolInfos),
+		"timestamp": time.Now(),
+	}})
+	return nil
+}
+
+// executeTurn 并行执行一轮中的工具调用（受 ToolsConfig.MaxConcurrent 限制），按调用顺序返回工具消息
+// 与之前完全相同的调用不再执行，直接复用结果；本轮调用全部重复时 repeated 为 true。
+func (r *agentRun) executeTurn(calls []schema.ToolCall) ([]*schema.Message, bool, error) {
+	limit := config.GlobalConfig.Tools.MaxConcurrent
+	if limit <= 0 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+
+	contents := make([]string, len(calls))
+	errs := make([]error, len(calls))
+	dupOf := make([]int, len(calls)) // 本轮内重复调用指向首次出现的位置，-1 表示需执行
+	firstInTurn := make(map[string]int)
+	repeats := 0
+
+	var wg sync.WaitGroup
+	for i, tc := range calls {
+		dupOf[i] = -1
+		sig := callSignature(tc)
+		if cached, ok := r.seen[sig]; ok {
+			contents[i] = cached
+			repeats++
+			r.emitDuplicate(tc)
+			continue
+		}
+		if j, ok := firstInTurn[sig]; ok {
+			dupOf[i] = j
+			repeats++
+			r.emitDuplicate(tc)
+			continue
+		}
+		firstInTurn[sig] = i
+
+		wg.Add(1)
+		go func(i int, tc schema.ToolCall) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			contents[i], errs[i] = r.executeCall(tc)
+		}(i, tc)
+	}
+	wg.Wait()
+
+	msgs := make([]*schema.Message, 0, len(calls))
+	for i, tc := range calls {
+		if errs[i] != nil {
+			return nil, false, errs[i]
+		}
+		if dupOf[i] >= 0 {
+			contents[i] = contents[dupOf[i]]
+		} else if _, ok := r.seen[callSignature(tc)]; !ok {
+			r.seen[callSignature(tc)] = contents[i]
+		}
+		msgs = append(msgs, &schema.Message{Role: schema.Tool, Content: contents[i], ToolCallID: tc.ID})
+	}
+	return msgs, repeats == len(calls), nil
+}
+
+// executeCall 执行单个工具调用：记录执行、必要时等待审批、推送事件，返回回填给模型的内容
+// 仅在客户端断开等无法继续规划的情况下返回错误；工具失败以错误描述作为内容回填。
+func (r *agentRun) executeCall(tc schema.ToolCall) (string, error) {
+	toolName := tc.Function.Name
+	argsJSON := tc.Function.Arguments
+	r.emit(SSEEvent{Type: "tool_call_started", Data: map[string]interface{}{
+		"messageId":  r.message.ID,
+		"toolCallId": tc.ID,
+		"toolName":   toolName,
+		"args":       argsJSON,
+		"timestamp":  time.Now(),
+	}})
+
+	// 建立执行记录（API/脚本工具按名称、MCP 工具按前缀匹配）
+	var matchedTool *models.Tool
+	for i := range r.tools {
+		if strings.HasPrefix(toolName, r.tools[i].Name+"__") || toolName == r.tools[i].Name {
+			matchedTool = &r.tools[i]
+			break
+		}
+	}
+	execRec := models.ToolExecution{}
+	if matchedTool != nil {
+		execRec = models.ToolExecution{
+			ID:          uuid.New(),
+			ToolID:      matchedTool.ID,
+			UserID:      r.userID,
+			MessageID:   &r.message.ID,
+			InputParams: models.JSONMap{"tool": toolName, "args": argsJSON},
+			Status:      "pending",
+			CreatedAt:   time.Now(),
+		}
+		_ = r.h.db.Create(&execRec).Error
+	}
+
+	// 需要审批的工具：暂停该调用，等待用户批准或拒绝
+	if matchedTool != nil && toolsSvc.RequiresApproval(*matchedTool, toolName) {
+		decision, err := r.awaitApproval(execRec.ID, toolName, argsJSON)
+		if err != nil {
+			return "", err
+		}
+		if !decision.Approved() {
+			reason := "用户拒绝执行该工具调用"
+			if decision.Status == toolsSvc.ApprovalExpired {
+				reason = "审批超时，未执行该工具调用"
+			}
+			r.emit(SSEEvent{Type: "tool_call_finished", Data: map[string]interface{}{
+				"messageId":   r.message.ID,
+				"toolCallId":  tc.ID,
+				"executionId": execRec.ID,
+				"toolName":    toolName,
+				"status":      "rejected",
+				"durationMs":  0,
+				"error":       reason,
+			}})
+			rejected, _ := json.Marshal(map[string]interface{}{"tool": toolName, "error": reason, "comment": decision.Comment})
+			return string(rejected), nil
+		}
+	}
+
+	startTool := time.Now()
+	var resultStr string
+	var runErr error
+	if base := r.invokers[toolName]; base != nil {
+		if it, ok := base.(einotool.InvokableTool); ok {
+			resultStr, runErr = it.InvokableRun(r.ctx, argsJSON)
+		} else {
+			runErr = fmt.Errorf("tool %s not invokable", toolName)
+		}
+	} else {
+		runErr = fmt.Errorf("tool %s not found", toolName)
+	}
+	durMs := int(time.Since(startTool).Milliseconds())
+
+	if matchedTool != nil {
+		updates := map[string]interface{}{
+			"execution_time_ms": durMs,
+		}
+		if runErr != nil {
+			updates["status"] = "failed"
+			updates["error_message"] = runErr.Error()
+		} else {
+			updates["status"] = "success"
+			updates["output_result"] = models.JSONMap{"raw": resultStr}
+		}
+		_ = r.h.db.Model(&execRec).Updates(updates).Error
+	}
+
+	if runErr != nil {
+		r.emit(SSEEvent{Type: "tool_call_finished", Data: map[string]interface{}{
+			"messageId":  r.message.ID,
+			"toolCallId": tc.ID,
+			"toolName":   toolName,
+			"status":     "failed",
+			"durationMs": durMs,
+			"error":      runErr.Error(),
+		}})
+		// 将错误简述回填到上下文，避免中断对话
+		return fmt.Sprintf("{\"tool\":%q,\"error\":%q}", toolName, runErr.Error()), nil
+	}
+
+	// 结果预览（最多200字符）
+	preview := resultStr
+	if len(preview) > 200 {
+		preview = preview[:200] + "..."
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// 登记为可引用来源（按完成顺序编号）
+	var execID *uuid.UUID
+	if matchedTool != nil {
+		execID = &execRec.ID
+	}
+	citationIndex := r.citations.AddTool(execID, toolName)
+	r.h.publish(r.stream, SSEEvent{Type: "tool_call_finished", Data: map[string]interface{}{
+		"messageId":     r.message.ID,
+		"toolCallId":    tc.ID,
+		"toolName":      toolName,
+		"status":        "success",
+		"durationMs":    durMs,
+		"result":        resultStr,
+		"resultPreview": preview,
+		"citationIndex": citationIndex,
+	}})
+	return resultStr, nil
+}
+
+// awaitApproval 标记执行记录为待审批，推送 tool_approval_required 事件并等待审批结果
+// 等待期间保持 SSE 心跳；超时按拒绝处理；客户端断开时返回错误。
+func (r *agentRun) awaitApproval(executionID uuid.UUID, toolName, argsJSON string) (toolsSvc.ApprovalDecision, error) {
+	approvals := r.h.approvals
+	if err := approvals.Request(r.ctx, executionID); err != nil {
+		return toolsSvc.ApprovalDecision{}, err
+	}
+	var args interface{}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		args = argsJSON
+	}
+	r.emit(SSEEvent{Type: "tool_approval_required", Data: map[string]interface{}{
+		"messageId":      r.message.ID,
+		"conversationId": r.message.ConversationID,
+		"executionId":    executionID,
+		"toolName":       toolName,
+		"args":           args,
+		"expiresAt":      time.Now().Add(approvals.Timeout()),
+		"timestamp":      time.Now(),
+	}})
+
+	// 等待期间的 SSE 心跳由订阅连接负责
+	decision, err := approvals.Wait(r.ctx, executionID, 0, nil)
+	if err != nil {
+		return decision, err
+	}
+	r.emit(SSEEvent{Type: "tool_approval_resolved", Data: map[string]interface{}{
+		"messageId":   r.message.ID,
+		"executionId": executionID,
+		"toolName":    toolName,
+		"decision":    decision.Status,
+		"approvedBy":  decision.ApprovedBy,
+		"comment":     decision.Comment,
+		"timestamp":   time.Now(),
+	}})
+	return decision, nil
+}
+
+// emitDuplicate 重复调用不再执行，直接复用之前的结果
+func (r *agentRun) emitDuplicate(tc schema.ToolCall) {
+	r.emit(SSEEvent{Type: "tool_call_finished", Data: map[string]interface{}{
+		"messageId":  r.message.ID,
+		"toolCallId": tc.ID,
+		"toolName":   tc.Function.Name,
+		"status":     "duplicate",
+		"durationMs": 0,
+	}})
+}
+
+// emit 并发安全地写入 SSE 事件
+func (r *agentRun) emit(event SSEEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.h.publish(r.stream, event)
+}
+
+// callSignature 工具名与规范化参数（键排序）组成的调用签名
+func callSignature(tc schema.ToolCall) string {
+	args := strings.TrimSpace(tc.Function.Arguments)
+	var v interface{}
+	if err := json.Unmarshal([]byte(args), &v); err == nil {
+		if b, err := json.Marshal(v); err == nil {
+			args = string(b)
+		}
+	}
+	return tc.Function.Name + "\x00" + args
+}
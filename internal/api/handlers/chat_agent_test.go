@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	"github.com/liusCraft/orion/internal/services/ai"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	chatSvc "github.com/liusCraft/orion/internal/services/chat"
+	toolsSvc "github.com/liusCraft/orion/internal/services/tools"
+)
+
+// fakeModelRequest 模型收到的一次 chat/completions 请求
+type fakeModelRequest struct {
+	Messages []struct {
+		Role       string `json:"role"`
+		Content    string `json:"content"`
+		ToolCallID string `json:"tool_call_id"`
+	} `json:"messages"`
+	Tools []struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	} `json:"tools"`
+}
+
+func (r fakeModelRequest) toolNames() []string {
+	var names []string
+	for _, t := range r.Tools {
+		names = append(names, t.Function.Name)
+	}
+	return names
+}
+
+// fakeModel OpenAI 兼容的模型服务：第 n 次请求（从 1 开始）的回复由 reply 给出，
+// 返回的工具调用非空时模型发起调用，否则以文本结束规划
+type fakeModel struct {
+	reply func(n int, req fakeModelRequest) []schema.ToolCall
+
+	mu       sync.Mutex
+	requests []fakeModelRequest
+}
+
+func (m *fakeModel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req fakeModelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	m.requests = append(m.requests, req)
+	n := len(m.requests)
+	m.mu.Unlock()
+
+	message := map[string]interface{}{"role": "assistant", "content": "无需调用工具"}
+	finish := "stop"
+	if calls := m.reply(n, req); len(calls) > 0 {
+		var toolCalls []map[string]interface{}
+		for _, c := range calls {
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":       c.ID,
+				"type":     "function",
+				"function": map[string]interface{}{"name": c.Function.Name, "arguments": c.Function.Arguments},
+			})
+		}
+		message = map[string]interface{}{"role": "assistant", "content": "", "tool_calls": toolCalls}
+		finish = "tool_calls"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      fmt.Sprintf("chatcmpl-%d", n),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   "fake",
+		"choices": []map[string]interface{}{{"index": 0, "message": message, "finish_reason": finish}},
+		"usage":   map[string]int{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+	})
+}
+
+func (m *fakeModel) calls() []fakeModelRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]fakeModelRequest(nil), m.requests...)
+}
+
+func toolCall(id, name, args string) schema.ToolCall {
+	return schema.ToolCall{ID: id, Function: schema.FunctionCall{Name: name, Arguments: args}}
+}
+
+// agentFixture 执行工具规划所需的处理器、模型与工具服务
+type agentFixture struct {
+	h         *ChatHandler
+	svc       *ai.AIService
+	stream    *chatSvc.Stream
+	message   models.Message
+	userID    uuid.UUID
+	approvals *toolsSvc.ApprovalBroker
+	db        *fakeDB
+
+	mu       sync.Mutex
+	apiCalls []string // api 工具服务收到的请求路径
+}
+
+// newAgentFixture 启动模型与工具服务；tools 为启用的 api 工具（url 由 fixture 填写），用户拥有 permissions
+func newAgentFixture(t *testing.T, model *fakeModel, maxIterations int, permissions []string, tools ...models.Tool) *agentFixture {
+	t.Helper()
+	logger.Init("test")
+	f := &agentFixture{
+		userID:  uuid.New(),
+		message: models.Message{ID: uuid.New(), ConversationID: uuid.New(), SenderType: "ai", Status: "streaming"},
+	}
+
+	prev := config.GlobalConfig
+	cfg := &config.Config{}
+	cfg.AI.Agent.MaxIterations = maxIterations
+	cfg.Tools.MaxConcurrent = 2
+	cfg.Tools.Timeout = 5
+	cfg.Tools.AllowedNetworks = []string{"127.0.0.0/8", "::1"} // 工具服务运行在本机
+	config.GlobalConfig = cfg
+	toolClientOnce = sync.Once{}
+	t.Cleanup(func() {
+		config.GlobalConfig = prev
+		toolClientOnce = sync.Once{}
+	})
+
+	modelSrv := httptest.NewServer(model)
+	t.Cleanup(modelSrv.Close)
+	toolSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.apiCalls = append(f.apiCalls, r.URL.Path)
+		f.mu.Unlock()
+		_, _ = w.Write([]byte(`{"result":"ok ` + r.URL.Path + `"}`))
+	}))
+	t.Cleanup(toolSrv.Close)
+
+	toolRows := rowsOf("id", "name", "tool_type", "config", "enabled", "created_at")
+	for _, tool := range tools {
+		tool.Config["method"] = "GET"
+		tool.Config["url"] = toolSrv.URL + "/" + tool.Name + "/{{arg}}"
+		toolRows.add(tool.ID, tool.Name, "api", tool.Config, true, time.Now())
+	}
+	gdb, fake := newFakeDB(t, fakeTables{"tools": toolRows}.withUser(f.userID, "agent-tester", permissions...).respond)
+	f.db = fake
+
+	svc, err := ai.NewAIService(&config.LLMConfig{Provider: "openai", BaseURL: modelSrv.URL, APIKey: "test", Model: "fake"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.svc = svc
+	f.approvals = toolsSvc.NewApprovalBroker(gdb, time.Minute)
+	hub := chatSvc.NewStreamHub(time.Minute, 0)
+	f.stream = hub.Open(f.message.ConversationID, f.message.ID)
+	f.h = NewChatHandler(gdb, nil, nil, toolsSvc.NewSessionManager(), f.approvals, chatSvc.NewGenerationRegistry(nil), hub, nil, authSvc.NewPermissions(gdb))
+	return f
+}
+
+// runAgent 以一条用户消息执行工具规划
+func (f *agentFixture) runAgent() (agentOutcome, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	history := []*schema.Message{schema.UserMessage("查询一下")}
+	return f.h.runAgent(ctx, f.stream, f.svc, f.message, f.userID, nil, history, &ai.CitationSources{})
+}
+
+func (f *agentFixture) run(t *testing.T) agentOutcome {
+	t.Helper()
+	out, err := f.runAgent()
+	if err != nil {
+		t.Fatalf("agent failed: %v", err)
+	}
+	return out
+}
+
+func (f *agentFixture) toolRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.apiCalls...)
+}
+
+// events 流中指定类型事件的 data
+func (f *agentFixture) events(eventType string) []map[string]interface{} {
+	events, _, _, _ := f.stream.Next(0)
+	var out []map[string]interface{}
+	for _, e := range events {
+		if e.Type != eventType {
+			continue
+		}
+		var ev struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		_ = json.Unmarshal(e.Data, &ev)
+		out = append(out, ev.Data)
+	}
+	return out
+}
+
+// waitEvent 等待流中出现指定类型的事件
+func (f *agentFixture) waitEvent(t *testing.T, eventType string) map[string]interface{} {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		if evs := f.events(eventType); len(evs) > 0 {
+			return evs[0]
+		}
+		_, wait, _, _ := f.stream.Next(1 << 30)
+		select {
+		case <-wait:
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("timed out waiting for %s", eventType)
+		}
+	}
+}
+
+func apiTool(name string, cfg models.JSONMap) models.Tool {
+	if cfg == nil {
+		cfg = models.JSONMap{}
+	}
+	return models.Tool{ID: uuid.New(), Name: name, ToolType: "api", Config: cfg}
+}
+
+func TestAgentSelectsPermittedTools(t *testing.T) {
+	weather, billing := apiTool("weather", nil), apiTool("billing", nil)
+	model := &fakeModel{reply: func(n int, req fakeModelRequest) []schema.ToolCall {
+		if n == 1 {
+			return []schema.ToolCall{toolCall("call_1", "weather", `{"arg":"beijing"}`)}
+		}
+		return nil
+	}}
+	// 用户只能执行 weather
+	f := newAgentFixture(t, model, 5, []string{authSvc.ToolExecutePermission(weather.ID)}, weather, billing)
+
+	out := f.run(t)
+
+	if out.StopReason != agentStopCompleted || out.Iterations != 2 || !out.ToolCalled {
+		t.Errorf("unexpected outcome: %+v", out)
+	}
+	calls := model.calls()
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 model calls, got %d", len(calls))
+	}
+	if names := calls[0].toolNames(); len(names) != 1 || names[0] != "weather" {
+		t.Errorf("only permitted tools should be offered, got %v", names)
+	}
+	if got := f.toolRequests(); len(got) != 1 || got[0] != "/weather/beijing" {
+		t.Errorf("unexpected tool requests: %v", got)
+	}
+	// 工具结果以 tool 消息回填给下一轮
+	last := calls[1].Messages[len(calls[1].Messages)-1]
+	if last.Role != "tool" || last.ToolCallID != "call_1" || !strings.Contains(last.Content, "ok /weather/beijing") {
+		t.Errorf("tool result should be fed back to the model: %+v", last)
+	}
+	if len(f.db.executed(`INSERT INTO "tool_executions"`)) != 1 {
+		t.Error("tool call should be recorded")
+	}
+	finished := f.events("tool_call_finished")
+	if len(finished) != 1 || finished[0]["status"] != "success" {
+		t.Errorf("unexpected tool_call_finished events: %v", finished)
+	}
+}
+
+func TestAgentApprovalGating(t *testing.T) {
+	for _, approve := range []bool{true, false} {
+		t.Run(fmt.Sprintf("approve=%v", approve), func(t *testing.T) {
+			purge := apiTool("purge", models.JSONMap{"requires_approval": true})
+			model := &fakeModel{reply: func(n int, req fakeModelRequest) []schema.ToolCall {
+				if n == 1 {
+					return []schema.ToolCall{toolCall("call_1", "purge", `{"arg":"cache"}`)}
+				}
+				return nil
+			}}
+			f := newAgentFixture(t, model, 5, []string{"tools.execute:*"}, purge)
+
+			type result struct {
+				out agentOutcome
+				err error
+			}
+			done := make(chan result, 1)
+			go func() {
+				out, err := f.runAgent()
+				done <- result{out, err}
+			}()
+
+			required := f.waitEvent(t, "tool_approval_required")
+			// 审批前不执行
+			if got := f.toolRequests(); len(got) != 0 {
+				t.Fatalf("tool should not run before approval: %v", got)
+			}
+			executionID, err := uuid.Parse(fmt.Sprint(required["executionId"]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.approvals.Decide(context.Background(), executionID, uuid.New(), approve, "检查过了"); err != nil {
+				t.Fatal(err)
+			}
+
+			var res result
+			select {
+			case res = <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("agent did not resume after the decision")
+			}
+			if res.err != nil || res.out.StopReason != agentStopCompleted {
+				t.Errorf("unexpected outcome: %+v, %v", res.out, res.err)
+			}
+
+			wantStatus, wantRequests := "rejected", 0
+			if approve {
+				wantStatus, wantRequests = "success", 1
+			}
+			if got := f.toolRequests(); len(got) != wantRequests {
+				t.Errorf("expected %d tool requests, got %v", wantRequests, got)
+			}
+			finished := f.events("tool_call_finished")
+			if len(finished) != 1 || finished[0]["status"] != wantStatus {
+				t.Errorf("unexpected tool_call_finished events: %v", finished)
+			}
+			if resolved := f.events("tool_approval_resolved"); len(resolved) != 1 {
+				t.Errorf("unexpected tool_approval_resolved events: %v", resolved)
+			}
+			// 拒绝原因同样回填给模型
+			calls := model.calls()
+			if last := calls[len(calls)-1].Messages; last[len(last)-1].Role != "tool" {
+				t.Errorf("decision should be fed back to the model: %+v", last[len(last)-1])
+			}
+		})
+	}
+}
+
+func TestAgentStopsAtMaxIterations(t *testing.T) {
+	lookup := apiTool("lookup", nil)
+	// 模型每轮都以不同参数继续调用工具
+	model := &fakeModel{reply: func(n int, req fakeModelRequest) []schema.ToolCall {
+		return []schema.ToolCall{toolCall(fmt.Sprintf("call_%d", n), "lookup", fmt.Sprintf(`{"arg":"page%d"}`, n))}
+	}}
+	f := newAgentFixture(t, model, 3, []string{"tools.execute:*"}, lookup)
+
+	out := f.run(t)
+
+	if out.StopReason != agentStopMaxIterations || out.Iterations != 3 {
+		t.Errorf("unexpected outcome: %+v", out)
+	}
+	if n := len(model.calls()); n != 3 {
+		t.Errorf("model should be called once per iteration, got %d", n)
+	}
+	if got := f.toolRequests(); len(got) != 3 {
+		t.Errorf("unexpected tool requests: %v", got)
+	}
+	finished := f.events("planning_finished")
+	if len(finished) != 1 || finished[0]["stopReason"] != agentStopMaxIterations {
+		t.Errorf("unexpected planning_finished events: %v", finished)
+	}
+}
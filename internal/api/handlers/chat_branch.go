@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	chatSvc "github.com/liusCraft/orion/internal/services/chat"
+	pkgErrors "github.com/liusCraft/orion/pkg/errors"
+)
+
+// EditMessage 编辑历史用户消息
+// 不修改原消息，而是在同一父节点下创建新的用户消息（新分支）并切换为当前分支；
+// 随后通过流式接口（userMessageId 指向新消息）生成回答。
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	conversationID := c.Param("id")
+
+	var conversation models.Conversation
+	if err := h.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40413,
+			"对话不存在",
+			nil,
+		))
+		return
+	}
+
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40012,
+			"请求参数错误",
+			err.Error(),
+		))
+		return
+	}
+
+	var original models.Message
+	if err := h.db.Where("id = ? AND conversation_id = ? AND sender_type = ?", c.Param("messageId"), conversation.ID, "user").First(&original).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40461,
+			"消息不存在",
+			nil,
+		))
+		return
+	}
+
+	metadata := models.JSONMap{}
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	metadata["editedFrom"] = original.ID
+
+	edited := models.Message{
+		ID:              uuid.New(),
+		ConversationID:  conversation.ID,
+		ParentMessageID: original.ParentMessageID,
+		SenderType:      "user",
+		Content:         req.Content,
+		ContentType:     "text",
+		Metadata:        metadata,
+		Status:          "completed",
+	}
+	if err := h.db.Create(&edited).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50014,
+			"创建消息失败",
+			err.Error(),
+		))
+		return
+	}
+
+	now := time.Now()
+	h.db.Model(&conversation).Updates(map[string]interface{}{
+		"total_messages":    gorm.Expr("total_messages + 1"),
+		"last_message_at":   now,
+		"active_message_id": edited.ID,
+		"updated_at":        now,
+	})
+
+	tree, err := h.loadTree(conversation.ID)
+	if err != nil {
+		c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(newMessageResponse(edited, 0, 1)))
+		return
+	}
+	index, count := siblingPosition(tree, edited.ID)
+	c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(newMessageResponse(edited, index, count)))
+}
+
+// GetMessageSiblings 获取与指定消息同一父节点的全部消息（各分支），activeIndex 为当前分支所在的序号
+func (h *ChatHandler) GetMessageSiblings(c *gin.Context) {
+	conversationID := c.Param("id")
+
+	var conversation models.Conversation
+	if err := h.readableConversations(c).Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40413,
+			"对话不存在",
+			nil,
+		))
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40461,
+			"消息不存在",
+			nil,
+		))
+		return
+	}
+	tree, err := h.loadTree(conversation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50013,
+			"查询消息列表失败",
+			err.Error(),
+		))
+		return
+	}
+	if _, ok := tree.Get(messageID); !ok {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40461,
+			"消息不存在",
+			nil,
+		))
+		return
+	}
+
+	onPath := make(map[uuid.UUID]bool)
+	if conversation.ActiveMessageID != nil {
+		for _, m := range tree.Path(*conversation.ActiveMessageID) {
+			onPath[m.ID] = true
+		}
+	}
+	siblings := tree.Siblings(messageID)
+	activeIndex := -1
+	responses := make([]MessageResponse, 0, len(siblings))
+	for i, m := range siblings {
+		if onPath[m.ID] {
+			activeIndex = i
+		}
+		responses = append(responses, newMessageResponse(m, i, len(siblings)))
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"data":        responses,
+		"activeIndex": activeIndex,
+	}))
+}
+
+// SelectBranch 切换当前分支
+// 选中的消息可以是任意节点，当前分支沿其最新的后代延伸到叶子。
+func (h *ChatHandler) SelectBranch(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	conversationID := c.Param("id")
+
+	var conversation models.Conversation
+	if err := h.db.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40413,
+			"对话不存在",
+			nil,
+		))
+		return
+	}
+
+	var req SelectBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
+			40012,
+			"请求参数错误",
+			err.Error(),
+		))
+		return
+	}
+
+	tree, err := h.loadTree(conversation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50013,
+			"查询消息列表失败",
+			err.Error(),
+		))
+		return
+	}
+	if _, ok := tree.Get(req.MessageID); !ok {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40461,
+			"消息不存在",
+			nil,
+		))
+		return
+	}
+
+	leaf := tree.Leaf(req.MessageID)
+	if err := h.db.Model(&conversation).Updates(map[string]interface{}{
+		"active_message_id": leaf,
+		"updated_at":        time.Now(),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50052,
+			"切换分支失败",
+			err.Error(),
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"conversationId":  conversation.ID,
+		"activeMessageId": leaf,
+	}))
+}
+
+// loadTree 加载对话的全部消息并构建消息树
+func (h *ChatHandler) loadTree(conversationID uuid.UUID) (*chatSvc.MessageTree, error) {
+	var messages []models.Message
+	if err := h.db.Where("conversation_id = ?", conversationID).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	return chatSvc.NewMessageTree(messages), nil
+}
+
+// siblingPosition 消息在同一父节点下的序号与兄弟数量
+func siblingPosition(tree *chatSvc.MessageTree, id uuid.UUID) (int, int) {
+	siblings := tree.Siblings(id)
+	for i, m := range siblings {
+		if m.ID == id {
+			return i, len(siblings)
+		}
+	}
+	return 0, 1
+}
+
+func newMessageResponse(msg models.Message, siblingIndex, siblingCount int) MessageResponse {
+	return MessageResponse{
+		ID:               msg.ID,
+		ConversationID:   msg.ConversationID,
+		ParentMessageID:  msg.ParentMessageID,
+		SenderType:       msg.SenderType,
+		Content:          msg.Content,
+		ContentType:      msg.ContentType,
+		Metadata:         msg.Metadata,
+		TokenCount:       msg.TokenCount,
+		ProcessingTimeMs: msg.ProcessingTimeMs,
+		Status:           msg.Status,
+		ErrorMessage:     msg.ErrorMessage,
+		SiblingIndex:     siblingIndex,
+		SiblingCount:     siblingCount,
+		CreatedAt:        msg.CreatedAt,
+		UpdatedAt:        msg.UpdatedAt,
+	}
+}
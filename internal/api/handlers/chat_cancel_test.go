@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	chatSvc "github.com/liusCraft/orion/internal/services/chat"
+)
+
+func TestCancelMessageWithoutOwner(t *testing.T) {
+	cases := []struct {
+		name       string
+		running    bool          // 本实例持有生成
+		idle       time.Duration // 距上次心跳
+		wantStatus int
+		wantState  string
+	}{
+		{"owned", true, time.Second, http.StatusAccepted, "cancelling"},
+		{"no owner", false, time.Second, http.StatusOK, "cancelled"},
+		{"stale heartbeat", true, 5 * time.Minute, http.StatusOK, "cancelled"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			userID, conversationID, messageID := uuid.New(), uuid.New(), uuid.New()
+			db, fake := newFakeDB(t, fakeTables{
+				"conversations": rowsOf("id", "user_id").add(conversationID, userID),
+				"messages": rowsOf("id", "conversation_id", "sender_type", "status", "updated_at").
+					add(messageID, conversationID, "ai", "streaming", time.Now().Add(-tc.idle)),
+			}.respond)
+			generations := chatSvc.NewGenerationRegistry(nil)
+			ctx, release := generations.Register(context.Background(), messageID)
+			defer release()
+			if !tc.running {
+				release()
+			}
+			h := NewChatHandler(db, nil, nil, nil, nil, generations, nil, nil, nil)
+			c, w := newTestContext(http.MethodPost, "", userID,
+				gin.Param{Key: "id", Value: conversationID.String()}, gin.Param{Key: "messageId", Value: messageID.String()})
+
+			h.CancelMessage(c)
+
+			var data struct {
+				Status string `json:"status"`
+			}
+			_ = json.Unmarshal(decodeResponse(t, w).Data, &data)
+			if w.Code != tc.wantStatus || data.Status != tc.wantState {
+				t.Fatalf("expected %d/%s, got %d: %s", tc.wantStatus, tc.wantState, w.Code, w.Body.String())
+			}
+			if tc.running && !chatSvc.Cancelled(ctx) {
+				t.Error("owned generation should be cancelled")
+			}
+			updates := fake.executed(`UPDATE "messages"`)
+			if direct := len(updates) == 1 && updates[0].hasArg("cancelled"); direct != (tc.wantState == "cancelled") {
+				t.Errorf("unexpected message updates: %+v", updates)
+			}
+		})
+	}
+}
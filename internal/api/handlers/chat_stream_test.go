@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	chatSvc "github.com/liusCraft/orion/internal/services/chat"
+)
+
+func TestResumeStreamOutsideLocalHub(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     string
+		idle       time.Duration // 距上次心跳
+		wantStatus int
+		wantBody   string
+		wantUpdate bool
+	}{
+		// 仍在其它实例上生成：不能返回快照与 done，否则客户端会当作生成已结束
+		{"streaming elsewhere", "streaming", time.Second, http.StatusServiceUnavailable, `"errorCode":50077`, false},
+		{"orphaned", "streaming", 5 * time.Minute, http.StatusOK, `"status":"failed"`, true},
+		{"finished", "completed", 5 * time.Minute, http.StatusOK, `"status":"completed"`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			userID, conversationID, messageID := uuid.New(), uuid.New(), uuid.New()
+			db, fake := newFakeDB(t, fakeTables{
+				"conversations": rowsOf("id", "user_id").add(conversationID, userID),
+				"messages": rowsOf("id", "conversation_id", "sender_type", "status", "content", "updated_at").
+					add(messageID, conversationID, "ai", tc.status, "部分内容", time.Now().Add(-tc.idle)),
+			}.respond)
+			h := NewChatHandler(db, nil, nil, nil, nil, chatSvc.NewGenerationRegistry(nil), chatSvc.NewStreamHub(time.Minute, 0), nil, nil)
+
+			c, w := newTestContext(http.MethodGet, "", userID, gin.Param{Key: "id", Value: conversationID.String()})
+			c.Request.Header.Set("Last-Event-ID", messageID.String()+":3")
+
+			h.StreamMessages(c)
+
+			body := w.Body.String()
+			if w.Code != tc.wantStatus || !strings.Contains(body, tc.wantBody) {
+				t.Fatalf("expected %d with %s, got %d: %s", tc.wantStatus, tc.wantBody, w.Code, body)
+			}
+			if finished := strings.Contains(body, "event: done"); finished != (tc.wantStatus == http.StatusOK) {
+				t.Errorf("unexpected done event: %s", body)
+			}
+			if tc.wantStatus == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+				t.Error("retryable response should carry Retry-After")
+			}
+			if updated := len(fake.executed(`UPDATE "messages"`)) > 0; updated != tc.wantUpdate {
+				t.Errorf("unexpected message updates: %v", updated)
+			}
+		})
+	}
+}
+
+func TestSupersedeStreamingLeavesLocalGenerations(t *testing.T) {
+	conversationID, local, remote := uuid.New(), uuid.New(), uuid.New()
+	db, fake := newFakeDB(t, fakeTables{"messages": rowsOf("id").add(local).add(remote)}.respond)
+	generations := chatSvc.NewGenerationRegistry(nil)
+	ctx, release := generations.Register(context.Background(), local)
+	defer release()
+	h := NewChatHandler(db, nil, nil, nil, nil, generations, nil, nil, nil)
+
+	h.supersedeStreaming(conversationID)
+
+	if ctx.Err() == nil {
+		t.Error("local generation should be aborted")
+	}
+	// 本实例的生成自行保存 partial，只有其它消息直接标记为失败
+	updates := fake.executed(`UPDATE "messages"`)
+	if len(updates) != 1 || updates[0].hasArg(local) || !updates[0].hasArg(remote) {
+		t.Errorf("unexpected message updates: %+v", updates)
+	}
+}
+
+func TestRecoverGenerationFinishesStream(t *testing.T) {
+	logger.Init("test")
+	db, fake := newFakeDB(t, fakeTables{}.respond)
+	hub := chatSvc.NewStreamHub(time.Minute, 0)
+	h := NewChatHandler(db, nil, nil, nil, nil, chatSvc.NewGenerationRegistry(nil), hub, nil, nil)
+	message := models.Message{ID: uuid.New(), ConversationID: uuid.New(), Status: "streaming"}
+	stream := hub.Open(message.ConversationID, message.ID)
+
+	func() {
+		defer h.recoverGeneration(stream, message)
+		panic("boom")
+	}()
+
+	events, _, _, _ := stream.Next(0)
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	// 客户端以 done 结束流，缺少时会一直等待
+	if strings.Join(types, ",") != "ai_error,done" {
+		t.Errorf("unexpected events: %v", types)
+	}
+	if len(fake.executed(`UPDATE "messages"`)) != 1 {
+		t.Error("message should be marked failed")
+	}
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeQuery 测试数据库收到的一条语句
+type fakeQuery struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// has 语句是否包含片段
+func (q fakeQuery) has(fragment string) bool {
+	return strings.Contains(q.SQL, fragment)
+}
+
+// hasArg 参数中是否有该取值（按驱动取值比较，uuid 等转换为字符串）
+func (q fakeQuery) hasArg(v interface{}) bool {
+	want, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if valuer, ok := v.(driver.Valuer); ok {
+		want, err = valuer.Value()
+	}
+	if err != nil {
+		return false
+	}
+	for _, arg := range q.Args {
+		if arg == want {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeRows 查询返回的结果行
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func rowsOf(columns ...string) *fakeRows {
+	return &fakeRows{columns: columns}
+}
+
+// add 追加一行，取值按列的顺序；实现 driver.Valuer 的类型（uuid、pq.StringArray 等）转换为驱动取值
+func (r *fakeRows) add(values ...interface{}) *fakeRows {
+	row := make([]driver.Value, len(values))
+	for i, v := range values {
+		if valuer, ok := v.(driver.Valuer); ok {
+			v, _ = valuer.Value()
+		}
+		row[i] = v
+	}
+	r.values = append(r.values, row)
+	return r
+}
+
+// fakeTables 按表名应答查询：语句中含 FROM "<表名>" 的查询返回对应的结果行
+type fakeTables map[string]*fakeRows
+
+func (t fakeTables) respond(q fakeQuery) *fakeRows {
+	for table, rows := range t {
+		if q.has(`FROM "` + table + `"`) {
+			return rows
+		}
+	}
+	return nil
+}
+
+// withUser 加入用户及其角色，供 authSvc.Permissions 解析权限
+func (t fakeTables) withUser(userID uuid.UUID, role string, permissions ...string) fakeTables {
+	t["users"] = rowsOf("id", "role", "department").add(userID, role, "")
+	t["roles"] = rowsOf("id", "name", "permissions").add(uuid.New(), role, pq.StringArray(permissions))
+	return t
+}
+
+// fakeDB 脚本化的测试数据库：查询的结果由 respond 给出（返回 nil 表示没有结果行），
+// 更新类语句总是影响一行；收到的全部语句按顺序记录
+type fakeDB struct {
+	respond func(q fakeQuery) *fakeRows
+
+	mu      sync.Mutex
+	queries []fakeQuery
+}
+
+func newFakeDB(t *testing.T, respond func(q fakeQuery) *fakeRows) (*gorm.DB, *fakeDB) {
+	t.Helper()
+	f := &fakeDB{respond: respond}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(fakeConnector{f})}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, f
+}
+
+// newTestContext 以 userID 身份发起请求的处理器上下文，body 非空时按 JSON 提交
+func newTestContext(method, body string, userID uuid.UUID, params ...gin.Param) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/", strings.NewReader(body))
+	if body != "" {
+		c.Request.Header.Set("Content-Type", "application/json")
+	}
+	c.Params = params
+	c.Set("user_id", userID)
+	return c, w
+}
+
+// testResponse 处理器返回的统一响应
+type testResponse struct {
+	ErrorCode int             `json:"errorCode"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder) testResponse {
+	t.Helper()
+	var resp testResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+// executed 包含片段的语句
+func (f *fakeDB) executed(fragment string) []fakeQuery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var matched []fakeQuery
+	for _, q := range f.queries {
+		if q.has(fragment) {
+			matched = append(matched, q)
+		}
+	}
+	return matched
+}
+
+func (f *fakeDB) record(query string, args []driver.NamedValue) fakeQuery {
+	q := fakeQuery{SQL: query}
+	for _, arg := range args {
+		q.Args = append(q.Args, arg.Value)
+	}
+	f.mu.Lock()
+	f.queries = append(f.queries, q)
+	f.mu.Unlock()
+	return q
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake database is opened through its connector")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c fakeConn) Close() error                                                 { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                                    { return fakeTx{}, nil }
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows := c.db.respond(c.db.record(query, args))
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return &fakeCursor{rows: rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeCursor struct {
+	rows *fakeRows
+	next int
+}
+
+func (r *fakeCursor) Columns() []string { return r.rows.columns }
+func (r *fakeCursor) Close() error      { return nil }
+
+func (r *fakeCursor) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows.values) {
+		return io.EOF
+	}
+	copy(dest, r.rows.values[r.next])
+	r.next++
+	return nil
+}
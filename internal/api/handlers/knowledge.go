@@ -11,16 +11,20 @@ import (
 	"github.com/lib/pq"
 	"gorm.io/gorm"
 
+	"github.com/liusCraft/orion/internal/config"
 	"github.com/liusCraft/orion/internal/database/models"
+	knowledgeSvc "github.com/liusCraft/orion/internal/services/knowledge"
 	pkgErrors "github.com/liusCraft/orion/pkg/errors"
 )
 
 type KnowledgeHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	indexer   *knowledgeSvc.Indexer   // 未配置向量化时为nil
+	retriever *knowledgeSvc.Retriever // 未配置向量化时为nil，搜索退化为关键词模式
 }
 
-func NewKnowledgeHandler(db *gorm.DB) *KnowledgeHandler {
-	return &KnowledgeHandler{db: db}
+func NewKnowledgeHandler(db *gorm.DB, indexer *knowledgeSvc.Indexer, retriever *knowledgeSvc.Retriever) *KnowledgeHandler {
+	return &KnowledgeHandler{db: db, indexer: indexer, retriever: retriever}
 }
 
 type CreateCategoryRequest struct {
@@ -82,12 +86,31 @@ type DocumentResponse struct {
 	Status      string            `json:"status"`
 	ViewCount   int               `json:"viewCount"`
 	LikeCount   int               `json:"likeCount"`
+	IndexStatus string            `json:"indexStatus"`
 	CreatedAt   time.Time         `json:"createdAt"`
 	UpdatedAt   time.Time         `json:"updatedAt"`
 	Category    *CategoryResponse `json:"category,omitempty"`
 	Author      *AuthorInfo       `json:"author,omitempty"`
 }
 
+type SearchResultResponse struct {
+	Document       DocumentResponse          `json:"document"`
+	TotalScore     float64                   `json:"totalScore"`
+	Snippet        string                    `json:"snippet"` // 命中词以 <mark></mark> 标记
+	RelevantChunks []knowledgeSvc.ChunkMatch `json:"relevantChunks"`
+}
+
+type DocumentIndexResponse struct {
+	DocumentID     uuid.UUID  `json:"documentId"`
+	Status         string     `json:"status"`
+	Error          string     `json:"error,omitempty"`
+	Version        int        `json:"version"`
+	IndexedVersion int        `json:"indexedVersion"`
+	ChunkCount     int        `json:"chunkCount"`
+	IndexStartedAt *time.Time `json:"indexStartedAt"`
+	IndexedAt      *time.Time `json:"indexedAt"`
+}
+
 type AuthorInfo struct {
 	ID          uuid.UUID `json:"id"`
 	Username    string    `json:"username"`
@@ -129,7 +152,7 @@ func (h *KnowledgeHandler) CreateCategory(c *gin.Context) {
 		Status:      "active",
 	}
 
-	if err := h.db.Create(&category).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&category).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50021,
 			"创建分类失败",
@@ -230,7 +253,7 @@ func (h *KnowledgeHandler) UpdateCategory(c *gin.Context) {
 		"updated_at":  time.Now(),
 	}
 
-	if err := h.db.Model(&category).Updates(updates).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&category).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50023,
 			"更新分类失败",
@@ -294,7 +317,7 @@ func (h *KnowledgeHandler) DeleteCategory(c *gin.Context) {
 	}
 
 	// 软删除
-	if err := h.db.Model(&category).Update("status", "inactive").Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&category).Update("status", "inactive").Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50024,
 			"删除分类失败",
@@ -350,7 +373,7 @@ func (h *KnowledgeHandler) CreateDocument(c *gin.Context) {
 		Status:      "published",
 	}
 
-	if err := h.db.Create(&document).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&document).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50025,
 			"创建文档失败",
@@ -370,8 +393,8 @@ func (h *KnowledgeHandler) CreateDocument(c *gin.Context) {
 	}
 	h.db.Create(&version)
 
-	// TODO: 这里应该触发向量化处理
-	// go h.processDocumentEmbedding(document.ID)
+	// 投递后台向量化
+	h.indexer.Enqueue(document.ID)
 
 	categoryResp := CategoryResponse{
 		ID:          category.ID,
@@ -562,7 +585,7 @@ func (h *KnowledgeHandler) UpdateDocument(c *gin.Context) {
 		updates["source_url"] = req.SourceURL
 	}
 
-	if err := h.db.Model(&document).Updates(updates).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&document).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50027,
 			"更新文档失败",
@@ -587,8 +610,8 @@ func (h *KnowledgeHandler) UpdateDocument(c *gin.Context) {
 		}
 		h.db.Create(&version)
 
-		// TODO: 重新处理向量化
-		// go h.processDocumentEmbedding(document.ID)
+		// 重新向量化
+		h.indexer.Enqueue(document.ID)
 	}
 
 	// 重新查询更新后的数据
@@ -631,7 +654,7 @@ func (h *KnowledgeHandler) DeleteDocument(c *gin.Context) {
 	}
 
 	// 软删除：更新状态为archived
-	if err := h.db.Model(&document).Update("status", "archived").Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&document).Update("status", "archived").Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50028,
 			"删除文档失败",
@@ -640,9 +663,70 @@ func (h *KnowledgeHandler) DeleteDocument(c *gin.Context) {
 		return
 	}
 
+	// 清理已有分块
+	h.indexer.Enqueue(document.ID)
+
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("文档删除成功"))
 }
 
+// GetDocumentIndexStatus 查询文档向量化状态
+func (h *KnowledgeHandler) GetDocumentIndexStatus(c *gin.Context) {
+	documentID := c.Param("id")
+
+	var document models.KnowledgeDocument
+	if err := h.db.Where("id = ?", documentID).First(&document).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40426,
+			"文档不存在",
+			nil,
+		))
+		return
+	}
+
+	response := DocumentIndexResponse{
+		DocumentID:     document.ID,
+		Status:         document.IndexStatus,
+		Error:          document.IndexError,
+		Version:        document.Version,
+		IndexedVersion: document.IndexedVersion,
+		ChunkCount:     document.ChunkCount,
+		IndexStartedAt: document.IndexStartedAt,
+		IndexedAt:      document.IndexedAt,
+	}
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(response))
+}
+
+// ReindexDocument 手动触发文档重新向量化
+func (h *KnowledgeHandler) ReindexDocument(c *gin.Context) {
+	documentID := c.Param("id")
+
+	if h.indexer == nil {
+		c.JSON(http.StatusServiceUnavailable, pkgErrors.NewErrorResponse(
+			50020,
+			"向量化服务未启用",
+			nil,
+		))
+		return
+	}
+
+	var document models.KnowledgeDocument
+	if err := h.db.Where("id = ? AND status != ?", documentID, "archived").First(&document).Error; err != nil {
+		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(
+			40427,
+			"文档不存在",
+			nil,
+		))
+		return
+	}
+
+	h.indexer.Enqueue(document.ID)
+
+	c.JSON(http.StatusAccepted, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"documentId": document.ID,
+		"status":     knowledgeSvc.IndexStatusPending,
+	}))
+}
+
 func (h *KnowledgeHandler) SearchDocuments(c *gin.Context) {
 	var req SearchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -658,6 +742,86 @@ func (h *KnowledgeHandler) SearchDocuments(c *gin.Context) {
 		req.Limit = 10
 	}
 
+	searchAt := time.Now()
+	mode := "keyword"
+	var results []SearchResultResponse
+	var err error
+	if h.retriever != nil && config.GlobalConfig.AI.RAG.HybridEnabled {
+		mode = "hybrid"
+		results, err = h.hybridSearch(c, req)
+	} else {
+		results, err = h.keywordSearch(req)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50029,
+			"搜索文档失败",
+			err.Error(),
+		))
+		return
+	}
+	if results == nil {
+		results = []SearchResultResponse{}
+	}
+
+	result := map[string]interface{}{
+		"results":    results,
+		"total":      len(results),
+		"query":      req.Query,
+		"mode":       mode,
+		"searchTime": time.Since(searchAt).Milliseconds(),
+	}
+
+	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(result))
+}
+
+// hybridSearch 向量 + 全文混合检索，按相关度排序
+func (h *KnowledgeHandler) hybridSearch(c *gin.Context, req SearchRequest) ([]SearchResultResponse, error) {
+	matches, err := h.retriever.Search(c.Request.Context(), knowledgeSvc.SearchOptions{
+		Query:      req.Query,
+		Categories: req.Categories,
+		Tags:       req.Tags,
+		Limit:      req.Limit,
+	})
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(matches))
+	for i, m := range matches {
+		ids[i] = m.DocumentID
+	}
+	var documents []models.KnowledgeDocument
+	if err := h.db.Preload("Category").Preload("Author").Where("id IN ?", ids).Find(&documents).Error; err != nil {
+		return nil, err
+	}
+	docMap := make(map[uuid.UUID]models.KnowledgeDocument, len(documents))
+	for _, doc := range documents {
+		docMap[doc.ID] = doc
+	}
+
+	var results []SearchResultResponse
+	for _, m := range matches {
+		doc, ok := docMap[m.DocumentID]
+		if !ok {
+			continue
+		}
+		snippet := ""
+		if len(m.Chunks) > 0 {
+			snippet = m.Chunks[0].Snippet
+		}
+		results = append(results, SearchResultResponse{
+			Document:       h.buildDocumentResponseWithRelations(doc),
+			TotalScore:     m.Score,
+			Snippet:        snippet,
+			RelevantChunks: m.Chunks,
+		})
+	}
+	return results, nil
+}
+
+// keywordSearch 关键词匹配，按热度排序（未启用混合检索时使用）
+func (h *KnowledgeHandler) keywordSearch(req SearchRequest) ([]SearchResultResponse, error) {
 	// 构建搜索查询
 	query := h.db.Model(&models.KnowledgeDocument{}).Where("status = ?", "published")
 
@@ -685,45 +849,43 @@ func (h *KnowledgeHandler) SearchDocuments(c *gin.Context) {
 		Order("view_count DESC, like_count DESC, created_at DESC").
 		Limit(req.Limit).
 		Find(&documents).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
-			50029,
-			"搜索文档失败",
-			err.Error(),
-		))
-		return
+		return nil, err
 	}
 
-	var responses []DocumentResponse
+	terms := strings.Fields(req.Query)
+	var results []SearchResultResponse
 	for _, doc := range documents {
-		var categoryResp *CategoryResponse
-		if doc.Category.ID != uuid.Nil {
-			categoryResp = &CategoryResponse{
-				ID:          doc.Category.ID,
-				Name:        doc.Category.Name,
-				Description: doc.Category.Description,
-			}
-		}
+		results = append(results, SearchResultResponse{
+			Document:       h.buildDocumentResponseWithRelations(doc),
+			Snippet:        knowledgeSvc.Highlight(doc.Content, append([]string{req.Query}, terms...), 160),
+			RelevantChunks: []knowledgeSvc.ChunkMatch{},
+		})
+	}
+	return results, nil
+}
 
-		var authorResp *AuthorInfo
-		if doc.Author != nil {
-			authorResp = &AuthorInfo{
-				ID:          doc.Author.ID,
-				Username:    doc.Author.Username,
-				DisplayName: doc.Author.DisplayName,
-				AvatarURL:   doc.Author.AvatarURL,
-			}
+// buildDocumentResponseWithRelations 使用已预加载的分类与作者构建响应
+func (h *KnowledgeHandler) buildDocumentResponseWithRelations(doc models.KnowledgeDocument) DocumentResponse {
+	var categoryResp *CategoryResponse
+	if doc.Category.ID != uuid.Nil {
+		categoryResp = &CategoryResponse{
+			ID:          doc.Category.ID,
+			Name:        doc.Category.Name,
+			Description: doc.Category.Description,
 		}
-
-		responses = append(responses, h.buildDocumentResponse(doc, categoryResp, authorResp))
 	}
 
-	result := map[string]interface{}{
-		"documents": responses,
-		"total":     len(responses),
-		"query":     req.Query,
+	var authorResp *AuthorInfo
+	if doc.Author != nil {
+		authorResp = &AuthorInfo{
+			ID:          doc.Author.ID,
+			Username:    doc.Author.Username,
+			DisplayName: doc.Author.DisplayName,
+			AvatarURL:   doc.Author.AvatarURL,
+		}
 	}
 
-	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(result))
+	return h.buildDocumentResponse(doc, categoryResp, authorResp)
 }
 
 func (h *KnowledgeHandler) buildDocumentResponse(doc models.KnowledgeDocument, category *CategoryResponse, author *AuthorInfo) DocumentResponse {
@@ -741,6 +903,7 @@ func (h *KnowledgeHandler) buildDocumentResponse(doc models.KnowledgeDocument, c
 		Status:      doc.Status,
 		ViewCount:   doc.ViewCount,
 		LikeCount:   doc.LikeCount,
+		IndexStatus: doc.IndexStatus,
 		CreatedAt:   doc.CreatedAt,
 		UpdatedAt:   doc.UpdatedAt,
 		Category:    category,
@@ -1,26 +1,38 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/liusCraft/orion/internal/config"
 	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
 	toolsSvc "github.com/liusCraft/orion/internal/services/tools"
 	pkgErrors "github.com/liusCraft/orion/pkg/errors"
 )
 
 type ToolHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	mcpSessions *toolsSvc.SessionManager
+	permissions *authSvc.Permissions // 脚本工具配置、按工具的执行权限与查看全部执行记录
 }
 
-func NewToolHandler(db *gorm.DB) *ToolHandler {
-	return &ToolHandler{db: db}
+func NewToolHandler(db *gorm.DB, mcpSessions *toolsSvc.SessionManager, permissions *authSvc.Permissions) *ToolHandler {
+	return &ToolHandler{db: db, mcpSessions: mcpSessions, permissions: permissions}
 }
 
 type CreateToolRequest struct {
@@ -70,6 +82,10 @@ type ToolExecutionResponse struct {
 	ExecutionTimeMs *int           `json:"executionTimeMs"`
 	Status          string         `json:"status"`
 	ErrorMessage    string         `json:"errorMessage"`
+	ApprovalStatus  string         `json:"approvalStatus,omitempty"`
+	ApprovedBy      *uuid.UUID     `json:"approvedBy,omitempty"`
+	ApprovedAt      *time.Time     `json:"approvedAt,omitempty"`
+	ApprovalComment string         `json:"approvalComment,omitempty"`
 	CreatedAt       time.Time      `json:"createdAt"`
 	Tool            *ToolResponse  `json:"tool,omitempty"`
 }
@@ -118,6 +134,12 @@ func (h *ToolHandler) CreateTool(c *gin.Context) {
 		enabled = *req.Enabled
 	}
 
+	// 脚本工具在服务端执行任意代码，需要单独的权限
+	if req.ToolType == "script" && !hasPermission(c, h.permissions, authSvc.PermToolsScript) {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(40331, "没有配置脚本工具的权限", nil))
+		return
+	}
+
 	// 验证工具配置
 	if err := h.validateToolConfig(req.ToolType, req.Config); err != nil {
 		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(
@@ -153,7 +175,7 @@ func (h *ToolHandler) CreateTool(c *gin.Context) {
 		CreatedBy:   &userUUID,
 	}
 
-	if err := h.db.Create(&tool).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&tool).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50032,
 			"创建工具失败",
@@ -162,7 +184,7 @@ func (h *ToolHandler) CreateTool(c *gin.Context) {
 		return
 	}
 
-	response := h.buildToolResponse(tool, nil)
+	response := h.buildToolResponse(tool, nil, true)
 	c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(response))
 }
 
@@ -218,6 +240,7 @@ func (h *ToolHandler) GetTools(c *gin.Context) {
 		return
 	}
 
+	showAuth := hasPermission(c, h.permissions, authSvc.PermToolsManage)
 	var responses []ToolResponse
 	for _, tool := range tools {
 		var creatorInfo *CreatorInfo
@@ -228,7 +251,7 @@ func (h *ToolHandler) GetTools(c *gin.Context) {
 				DisplayName: tool.Creator.DisplayName,
 			}
 		}
-		responses = append(responses, h.buildToolResponse(tool, creatorInfo))
+		responses = append(responses, h.buildToolResponse(tool, creatorInfo, showAuth))
 	}
 
 	result := map[string]interface{}{
@@ -266,7 +289,7 @@ func (h *ToolHandler) GetTool(c *gin.Context) {
 		}
 	}
 
-	response := h.buildToolResponse(tool, creatorInfo)
+	response := h.buildToolResponse(tool, creatorInfo, hasPermission(c, h.permissions, authSvc.PermToolsManage))
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(response))
 }
 
@@ -304,6 +327,10 @@ func (h *ToolHandler) UpdateTool(c *gin.Context) {
 	if req.Description != "" {
 		updates["description"] = req.Description
 	}
+	if tool.ToolType == "script" && !hasPermission(c, h.permissions, authSvc.PermToolsScript) {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(40331, "没有配置脚本工具的权限", nil))
+		return
+	}
 	if req.Config != nil {
 		// 验证新配置
 		if err := h.validateToolConfig(tool.ToolType, req.Config); err != nil {
@@ -330,7 +357,7 @@ func (h *ToolHandler) UpdateTool(c *gin.Context) {
 		updates["enabled"] = *req.Enabled
 	}
 
-	if err := h.db.Model(&tool).Updates(updates).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Model(&tool).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50034,
 			"更新工具失败",
@@ -338,6 +365,7 @@ func (h *ToolHandler) UpdateTool(c *gin.Context) {
 		))
 		return
 	}
+	h.mcpSessions.Invalidate(tool.ID)
 
 	// 重新查询更新后的数据
 	h.db.Preload("Creator").Where("id = ?", toolID).First(&tool)
@@ -351,7 +379,7 @@ func (h *ToolHandler) UpdateTool(c *gin.Context) {
 		}
 	}
 
-	response := h.buildToolResponse(tool, creatorInfo)
+	response := h.buildToolResponse(tool, creatorInfo, true)
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(response))
 }
 
@@ -373,7 +401,7 @@ func (h *ToolHandler) DeleteTool(c *gin.Context) {
 	h.db.Model(&models.ToolExecution{}).Where("tool_id = ?", toolID).Count(&execCount)
 	if execCount > 0 {
 		// 有执行记录，只禁用不删除
-		if err := h.db.Model(&tool).Update("enabled", false).Error; err != nil {
+		if err := h.db.WithContext(c.Request.Context()).Model(&tool).Update("enabled", false).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 				50035,
 				"禁用工具失败",
@@ -381,12 +409,13 @@ func (h *ToolHandler) DeleteTool(c *gin.Context) {
 			))
 			return
 		}
+		h.mcpSessions.Invalidate(tool.ID)
 		c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("工具已禁用"))
 		return
 	}
 
 	// 没有执行记录，可以直接删除
-	if err := h.db.Delete(&tool).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Delete(&tool).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50036,
 			"删除工具失败",
@@ -394,6 +423,7 @@ func (h *ToolHandler) DeleteTool(c *gin.Context) {
 		))
 		return
 	}
+	h.mcpSessions.Invalidate(tool.ID)
 
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse("工具删除成功"))
 }
@@ -413,20 +443,21 @@ func (h *ToolHandler) ToggleTool(c *gin.Context) {
 		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(40435, "工具不存在", nil))
 		return
 	}
-	if err := h.db.Model(&tool).Updates(map[string]interface{}{
+	if err := h.db.WithContext(c.Request.Context()).Model(&tool).Updates(map[string]interface{}{
 		"enabled":    body.Enabled,
 		"updated_at": time.Now(),
 	}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(50039, "更新工具状态失败", err.Error()))
 		return
 	}
+	h.mcpSessions.Invalidate(tool.ID)
 	h.db.Preload("Creator").Where("id = ?", toolID).First(&tool)
 	resp := h.buildToolResponse(tool, func() *CreatorInfo {
 		if tool.Creator != nil {
 			return &CreatorInfo{ID: tool.Creator.ID, Username: tool.Creator.Username, DisplayName: tool.Creator.DisplayName}
 		}
 		return nil
-	}())
+	}(), true)
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(resp))
 }
 
@@ -443,6 +474,14 @@ func (h *ToolHandler) ExecuteTool(c *gin.Context) {
 		))
 		return
 	}
+	if !hasPermission(c, h.permissions, authSvc.ToolExecutePermission(tool.ID)) {
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			40332,
+			"没有执行该工具的权限",
+			nil,
+		))
+		return
+	}
 
 	var req ExecuteToolRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -463,7 +502,7 @@ func (h *ToolHandler) ExecuteTool(c *gin.Context) {
 		Status:      "pending",
 	}
 
-	if err := h.db.Create(&execution).Error; err != nil {
+	if err := h.db.WithContext(c.Request.Context()).Create(&execution).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
 			50037,
 			"创建执行记录失败",
@@ -474,7 +513,7 @@ func (h *ToolHandler) ExecuteTool(c *gin.Context) {
 
 	// 执行工具
 	startTime := time.Now()
-	result, err := h.executeToolLogic(tool, req.InputParams)
+	result, err := h.executeToolLogic(c.Request.Context(), tool, req.InputParams)
 	executionTime := int(time.Since(startTime).Milliseconds())
 
 	// 更新执行结果
@@ -485,12 +524,16 @@ func (h *ToolHandler) ExecuteTool(c *gin.Context) {
 	if err != nil {
 		updates["status"] = "failed"
 		updates["error_message"] = err.Error()
+		if result != nil {
+			updates["output_result"] = models.JSONMap(result)
+		}
 	} else {
 		updates["status"] = "success"
 		updates["output_result"] = models.JSONMap(result)
 	}
 
-	h.db.Model(&execution).Updates(updates)
+	// 客户端断开时也要保存执行结果
+	h.db.WithContext(context.WithoutCancel(c.Request.Context())).Model(&execution).Updates(updates)
 
 	// 重新查询执行记录
 	h.db.Preload("Tool").Where("id = ?", execution.ID).First(&execution)
@@ -501,7 +544,6 @@ func (h *ToolHandler) ExecuteTool(c *gin.Context) {
 
 func (h *ToolHandler) GetExecutions(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	// 分页参数（优先驼峰，兼容下划线）
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -525,8 +567,8 @@ func (h *ToolHandler) GetExecutions(c *gin.Context) {
 
 	query := h.db.Model(&models.ToolExecution{})
 
-	// 非管理员只能查看自己的执行记录
-	if role.(string) != "admin" {
+	// 没有 tools.executions.read_all 权限时只能查看自己的执行记录
+	if !hasPermission(c, h.permissions, authSvc.PermToolsExecutionsReadAll) {
 		query = query.Where("user_id = ?", userID)
 	}
 
@@ -574,6 +616,19 @@ func (h *ToolHandler) GetExecutions(c *gin.Context) {
 }
 
 func (h *ToolHandler) validateToolConfig(toolType string, config map[string]interface{}) error {
+	// requires_approval：true 表示整个工具需要审批，字符串数组表示需要审批的 MCP 子工具
+	switch v := config["requires_approval"].(type) {
+	case nil, bool:
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(string); !ok {
+				return errors.New("requires_approval 只能是布尔值或工具名数组")
+			}
+		}
+	default:
+		return errors.New("requires_approval 只能是布尔值或工具名数组")
+	}
+
 	switch toolType {
 	case "api":
 		// 验证API工具配置
@@ -593,9 +648,13 @@ func (h *ToolHandler) validateToolConfig(toolType string, config map[string]inte
 		if _, ok := config["script"]; !ok {
 			return errors.New("脚本工具需要配置script")
 		}
-		if _, ok := config["language"]; !ok {
+		lang, ok := config["language"].(string)
+		if !ok {
 			return errors.New("脚本工具需要配置language")
 		}
+		if !toolsSvc.ScriptLanguageSupported(lang) {
+			return errors.New("不支持的脚本语言，允许：shell | bash | python")
+		}
 	case "mcp":
 		// 验证 MCP 工具配置
 		// 必填：protocol (sse|http_streamable|stdio)
@@ -622,28 +681,53 @@ func (h *ToolHandler) validateToolConfig(toolType string, config map[string]inte
 	return nil
 }
 
-func (h *ToolHandler) executeToolLogic(tool models.Tool, params map[string]interface{}) (map[string]interface{}, error) {
-	// TODO: 实现实际的工具执行逻辑
-	// 这里只是模拟执行
+func (h *ToolHandler) executeToolLogic(ctx context.Context, tool models.Tool, params map[string]interface{}) (map[string]interface{}, error) {
 	switch tool.ToolType {
 	case "api":
-		return h.executeAPITool(tool, params)
+		return h.executeAPITool(ctx, tool, params)
 	case "webhook":
 		return h.executeWebhookTool(tool, params)
 	case "script":
-		return h.executeScriptTool(tool, params)
+		return h.executeScriptTool(ctx, tool, params)
 	default:
 		return nil, errors.New("不支持的工具类型")
 	}
 }
 
-func (h *ToolHandler) executeAPITool(tool models.Tool, params map[string]interface{}) (map[string]interface{}, error) {
-	// 模拟API调用
-	return map[string]interface{}{
-		"status": "success",
-		"data":   "API调用成功",
-		"params": params,
-	}, nil
+func (h *ToolHandler) executeAPITool(ctx context.Context, tool models.Tool, params map[string]interface{}) (map[string]interface{}, error) {
+	result, err := toolsSvc.ExecuteAPI(ctx, tool, params, apiToolOptions())
+	if result == nil {
+		return nil, err
+	}
+	// 非 2xx 响应同时返回结果与错误，便于执行记录保留响应内容
+	return result.ToMap(), err
+}
+
+// apiToolOptions API 工具的全局执行限制
+func apiToolOptions() toolsSvc.APIOptions {
+	return toolsSvc.APIOptions{
+		Timeout:          time.Duration(config.GlobalConfig.Tools.Timeout) * time.Second,
+		MaxResponseBytes: int64(config.GlobalConfig.Tools.MaxResponseBytes),
+		Client:           toolHTTPClient(),
+	}
+}
+
+var (
+	toolClientOnce sync.Once
+	toolClient     *http.Client
+)
+
+// toolHTTPClient 工具访问外部 HTTP 服务共用的客户端，只能访问公网与 tools.allowed_networks 中的网段
+func toolHTTPClient() *http.Client {
+	toolClientOnce.Do(func() {
+		allowed, err := toolsSvc.ParseNetworks(config.GlobalConfig.Tools.AllowedNetworks)
+		if err != nil {
+			logger.Error("tools.allowed_networks 配置无效，不允许访问任何内网地址: %v", err)
+		}
+		// 单次请求的超时由调用方控制，这里只限制总时长的上限
+		toolClient = toolsSvc.NewHTTPClient(10*time.Minute, allowed)
+	})
+	return toolClient
 }
 
 func (h *ToolHandler) executeWebhookTool(tool models.Tool, params map[string]interface{}) (map[string]interface{}, error) {
@@ -655,16 +739,35 @@ func (h *ToolHandler) executeWebhookTool(tool models.Tool, params map[string]int
 	}, nil
 }
 
-func (h *ToolHandler) executeScriptTool(tool models.Tool, params map[string]interface{}) (map[string]interface{}, error) {
-	// 模拟脚本执行
-	return map[string]interface{}{
-		"status": "success",
-		"output": "脚本执行成功",
-		"params": params,
-	}, nil
+func (h *ToolHandler) executeScriptTool(ctx context.Context, tool models.Tool, params map[string]interface{}) (map[string]interface{}, error) {
+	if !config.GlobalConfig.Tools.Script.Enabled {
+		return nil, errors.New("脚本工具未启用")
+	}
+	result, err := toolsSvc.ExecuteScript(ctx, tool, params, scriptToolOptions())
+	if result == nil {
+		return nil, err
+	}
+	// 非零退出码或超时同时返回结果与错误，便于执行记录保留输出
+	return result.ToMap(), err
 }
 
-func (h *ToolHandler) buildToolResponse(tool models.Tool, creator *CreatorInfo) ToolResponse {
+// scriptToolOptions 脚本工具的全局沙箱限制
+func scriptToolOptions() toolsSvc.ScriptOptions {
+	cfg := config.GlobalConfig.Tools
+	return toolsSvc.ScriptOptions{
+		Timeout:        time.Duration(cfg.Timeout) * time.Second,
+		CPUSeconds:     cfg.Script.CPUSeconds,
+		MemoryMB:       cfg.Script.MemoryMB,
+		MaxOutputBytes: cfg.Script.MaxOutputBytes,
+		EnvAllowlist:   cfg.Script.EnvAllowlist,
+		ShellPath:      cfg.Script.ShellPath,
+		BashPath:       cfg.Script.BashPath,
+		PythonPath:     cfg.Script.PythonPath,
+	}
+}
+
+// buildToolResponse 构建工具响应；showAuth 为 false 时认证配置只保留认证方式，不返回凭据
+func (h *ToolHandler) buildToolResponse(tool models.Tool, creator *CreatorInfo, showAuth bool) ToolResponse {
 	response := ToolResponse{
 		ID:          tool.ID,
 		Name:        tool.Name,
@@ -679,15 +782,33 @@ func (h *ToolHandler) buildToolResponse(tool models.Tool, creator *CreatorInfo)
 		Creator:     creator,
 	}
 
-	// 不返回敏感的认证配置给普通用户
-	if tool.AuthConfig != nil {
-		// 这里可以根据用户权限决定是否返回认证配置
+	// 完整的认证配置（凭据）只返回给具备 tools.manage 的用户
+	if showAuth {
 		response.AuthConfig = tool.AuthConfig
+	} else {
+		response.AuthConfig = maskAuthConfig(tool.AuthConfig)
 	}
 
 	return response
 }
 
+// publicAuthFields 认证配置中可以公开的字段，其余（token、username、password、key 等）均视为凭据
+var publicAuthFields = []string{"type", "name", "in"}
+
+// maskAuthConfig 去掉认证配置中的凭据，只保留认证方式与参数位置
+func maskAuthConfig(auth models.JSONMap) models.JSONMap {
+	if auth == nil {
+		return nil
+	}
+	masked := models.JSONMap{}
+	for _, field := range publicAuthFields {
+		if v, ok := auth[field]; ok {
+			masked[field] = v
+		}
+	}
+	return masked
+}
+
 func (h *ToolHandler) buildExecutionResponse(execution models.ToolExecution) ToolExecutionResponse {
 	response := ToolExecutionResponse{
 		ID:              execution.ID,
@@ -699,6 +820,10 @@ func (h *ToolHandler) buildExecutionResponse(execution models.ToolExecution) Too
 		ExecutionTimeMs: execution.ExecutionTimeMs,
 		Status:          execution.Status,
 		ErrorMessage:    execution.ErrorMessage,
+		ApprovalStatus:  execution.ApprovalStatus,
+		ApprovedBy:      execution.ApprovedBy,
+		ApprovedAt:      execution.ApprovedAt,
+		ApprovalComment: execution.ApprovalComment,
 		CreatedAt:       execution.CreatedAt,
 	}
 
@@ -726,7 +851,21 @@ type ToolTypeInfo struct {
 	Examples     map[string]interface{} `json:"examples,omitempty"`
 }
 
-// GetToolTypes 返回支持的工具类型（当前仅 mcp）
+// apiConfigSchema api 类型工具的配置说明
+var apiConfigSchema = map[string]interface{}{
+	"url":               map[string]interface{}{"type": "string", "title": "URL", "description": "请求地址，可含 {{param}} 占位符"},
+	"method":            map[string]interface{}{"type": "string", "title": "方法", "description": "GET/POST/PUT/PATCH/DELETE"},
+	"headers":           map[string]interface{}{"type": "object", "title": "请求头", "description": "值可含 {{param}}"},
+	"query":             map[string]interface{}{"type": "object", "title": "查询参数", "description": "值可含 {{param}}，渲染为空时忽略"},
+	"body":              map[string]interface{}{"type": "object", "title": "请求体", "description": "JSON 对象或字符串模板"},
+	"bodyParam":         map[string]interface{}{"type": "string", "title": "请求体参数", "description": "直接以该参数作为请求体"},
+	"inputSchema":       map[string]interface{}{"type": "object", "title": "参数定义", "description": "JSON Schema，留空按占位符生成"},
+	"timeout":           map[string]interface{}{"type": "number", "title": "超时(秒)", "description": "默认取全局工具超时"},
+	"maxResponseBytes":  map[string]interface{}{"type": "number", "title": "响应上限(字节)", "description": "超出部分截断"},
+	"requires_approval": map[string]interface{}{"type": "boolean", "title": "需要审批", "description": "对话中调用前需用户批准"},
+}
+
+// GetToolTypes 返回支持的工具类型（mcp、api）
 func (h *ToolHandler) GetToolTypes(c *gin.Context) {
 	types := []ToolTypeInfo{
 		{
@@ -775,6 +914,11 @@ func (h *ToolHandler) GetToolTypes(c *gin.Context) {
 					"title":       "工具白名单",
 					"description": "逗号分隔的工具名，留空表示全部",
 				},
+				"requires_approval": map[string]interface{}{
+					"type":        "array",
+					"title":       "需要审批",
+					"description": "true 表示全部子工具，或列出需要审批的子工具名",
+				},
 			},
 			Examples: map[string]interface{}{
 				"http_streamable": map[string]string{
@@ -795,13 +939,63 @@ func (h *ToolHandler) GetToolTypes(c *gin.Context) {
 				},
 			},
 		},
+		{
+			Type:         "api",
+			Name:         "HTTP API",
+			Description:  "直接调用 REST 接口，URL/查询参数/请求体按输入参数渲染；鉴权取自 authConfig（bearer、basic、api_key）",
+			ConfigSchema: apiConfigSchema,
+			Examples: map[string]interface{}{
+				"get": map[string]interface{}{
+					"method": "GET",
+					"url":    "https://cdn.example.com/api/v1/domains/{{domain}}/status",
+					"query":  map[string]string{"region": "{{region}}"},
+				},
+				"post": map[string]interface{}{
+					"method": "POST",
+					"url":    "https://cdn.example.com/api/v1/purge",
+					"body":   map[string]string{"urls": "{{urls}}"},
+				},
+			},
+		},
+		{
+			Type:        "script",
+			Name:        "脚本",
+			Description: "在沙箱子进程中执行 shell/python 脚本，输入参数以 JSON 写入 stdin（需要 tools.script 权限）",
+			ConfigSchema: map[string]interface{}{
+				"language":    map[string]interface{}{"type": "string", "title": "语言", "description": "shell | bash | python"},
+				"script":      map[string]interface{}{"type": "string", "title": "脚本内容"},
+				"timeout":     map[string]interface{}{"type": "number", "title": "超时(秒)", "description": "不超过全局工具超时"},
+				"env":         map[string]interface{}{"type": "object", "title": "环境变量", "description": "固定的 KEY=VALUE"},
+				"inputSchema": map[string]interface{}{"type": "object", "title": "参数定义", "description": "JSON Schema，对话中暴露给模型"},
+			},
+			Examples: map[string]interface{}{
+				"cert_expiry": map[string]interface{}{
+					"language": "shell",
+					"script":   "host=$(python3 -c 'import json,sys;print(json.load(sys.stdin)[\"host\"])')\necho | openssl s_client -servername \"$host\" -connect \"$host:443\" 2>/dev/null | openssl x509 -noout -enddate",
+				},
+			},
+		},
 	}
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(types))
 }
 
-// GetToolTemplate 返回某类型的模板（仅 mcp）
+// GetToolTemplate 返回某类型的模板（mcp、api）
 func (h *ToolHandler) GetToolTemplate(c *gin.Context) {
 	toolType := c.Param("type")
+	if toolType == "api" {
+		c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+			"type":         "api",
+			"name":         "HTTP API",
+			"description":  "直接调用 REST 接口",
+			"configSchema": apiConfigSchema,
+			"defaultConfig": map[string]interface{}{
+				"method":  "GET",
+				"timeout": 30,
+			},
+			"examples": map[string]interface{}{},
+		}))
+		return
+	}
 	if toolType != "mcp" {
 		c.JSON(http.StatusNotFound, pkgErrors.NewErrorResponse(40436, "不支持的工具类型", nil))
 		return
@@ -811,14 +1005,15 @@ func (h *ToolHandler) GetToolTemplate(c *gin.Context) {
 		"name":        "MCP Server",
 		"description": "通过 MCP 协议接入外部工具",
 		"configSchema": map[string]interface{}{
-			"protocol":      map[string]interface{}{"type": "string", "title": "协议"},
-			"endpoint":      map[string]interface{}{"type": "string", "title": "Endpoint"},
-			"authorization": map[string]interface{}{"type": "string", "format": "password", "title": "Authorization"},
-			"timeout":       map[string]interface{}{"type": "number", "title": "超时(秒)"},
-			"command":       map[string]interface{}{"type": "string", "title": "命令(仅STDIO)"},
-			"args":          map[string]interface{}{"type": "string", "title": "参数(仅STDIO)"},
-			"env":           map[string]interface{}{"type": "string", "title": "环境变量(仅STDIO)"},
-			"allowTools":    map[string]interface{}{"type": "string", "title": "工具白名单(逗号分隔)"},
+			"protocol":          map[string]interface{}{"type": "string", "title": "协议"},
+			"endpoint":          map[string]interface{}{"type": "string", "title": "Endpoint"},
+			"authorization":     map[string]interface{}{"type": "string", "format": "password", "title": "Authorization"},
+			"timeout":           map[string]interface{}{"type": "number", "title": "超时(秒)"},
+			"command":           map[string]interface{}{"type": "string", "title": "命令(仅STDIO)"},
+			"args":              map[string]interface{}{"type": "string", "title": "参数(仅STDIO)"},
+			"env":               map[string]interface{}{"type": "string", "title": "环境变量(仅STDIO)"},
+			"allowTools":        map[string]interface{}{"type": "string", "title": "工具白名单(逗号分隔)"},
+			"requires_approval": map[string]interface{}{"type": "array", "title": "需要审批的子工具(true 表示全部)"},
 		},
 		"defaultConfig": map[string]interface{}{
 			"protocol": "http_streamable",
@@ -829,7 +1024,7 @@ func (h *ToolHandler) GetToolTemplate(c *gin.Context) {
 	c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(data))
 }
 
-// ValidateToolTypeConfig 校验某类型工具配置（仅 mcp）
+// ValidateToolTypeConfig 校验某类型工具配置（mcp、api）
 func (h *ToolHandler) ValidateToolTypeConfig(c *gin.Context) {
 	toolType := c.Param("type")
 	var body struct {
@@ -840,7 +1035,7 @@ func (h *ToolHandler) ValidateToolTypeConfig(c *gin.Context) {
 		return
 	}
 
-	if toolType != "mcp" {
+	if toolType != "mcp" && toolType != "api" {
 		c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
 			"valid":    false,
 			"errors":   []string{"不支持的工具类型"},
@@ -848,7 +1043,7 @@ func (h *ToolHandler) ValidateToolTypeConfig(c *gin.Context) {
 		}))
 		return
 	}
-	if err := h.validateToolConfig("mcp", body.Config); err != nil {
+	if err := h.validateToolConfig(toolType, body.Config); err != nil {
 		c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
 			"valid":    false,
 			"errors":   []string{err.Error()},
@@ -906,3 +1101,212 @@ func (h *ToolHandler) TestToolConnection(c *gin.Context) {
 		},
 	}))
 }
+
+// openAPIMaxUploadBytes 上传文档大小上限
+const openAPIMaxUploadBytes = 10 << 20
+
+// ImportOpenAPIRequest 从 OpenAPI 文档导入工具
+type ImportOpenAPIRequest struct {
+	URL        string                 `json:"url" form:"url"`
+	Spec       json.RawMessage        `json:"spec"` // 文档内容：JSON 对象或 JSON/YAML 字符串
+	Operations []string               `json:"operations" form:"operations"`
+	BaseURL    string                 `json:"baseUrl" form:"baseUrl"`
+	NamePrefix string                 `json:"namePrefix" form:"namePrefix"`
+	AuthConfig map[string]interface{} `json:"authConfig"`
+	Enabled    *bool                  `json:"enabled"`
+}
+
+// ImportSkippedOperation 未导入的操作及原因
+type ImportSkippedOperation struct {
+	Key    string `json:"key"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ImportOpenAPITools 从 OpenAPI 3 文档批量生成 api 工具（需要 tools.import 权限）
+// 支持 JSON（spec 或 url）与 multipart 上传（file 字段）；未指定 operations 时仅返回可选操作列表。
+func (h *ToolHandler) ImportOpenAPITools(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	req, data, err := bindImportOpenAPIRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40038, "请求参数错误", err.Error()))
+		return
+	}
+	if len(data) == 0 && req.URL != "" {
+		if data, err = toolsSvc.FetchOpenAPI(c.Request.Context(), toolHTTPClient(), req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40039, "获取OpenAPI文档失败", err.Error()))
+			return
+		}
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40038, "请求参数错误", "需要提供 spec、url 或上传文件"))
+		return
+	}
+
+	spec, err := toolsSvc.ParseOpenAPI(c.Request.Context(), data, req.URL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, pkgErrors.NewErrorResponse(40039, "OpenAPI文档无效", err.Error()))
+		return
+	}
+	operations := spec.Operations()
+
+	// 未选择操作：返回预览供管理员勾选
+	if len(req.Operations) == 0 {
+		c.JSON(http.StatusOK, pkgErrors.NewSuccessResponse(map[string]interface{}{
+			"title":      spec.Title(),
+			"operations": operations,
+		}))
+		return
+	}
+
+	byKey := make(map[string]toolsSvc.OpenAPIOperation, len(operations))
+	for _, op := range operations {
+		byKey[op.Key] = op
+		byKey[op.Method+" "+op.Path] = op
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	opts := toolsSvc.OpenAPIImportOptions{BaseURL: req.BaseURL, NamePrefix: req.NamePrefix}
+	userUUID := userID.(uuid.UUID)
+
+	var tools []models.Tool
+	skipped := []ImportSkippedOperation{}
+	opKeys := make(map[string]string) // 工具名 -> 操作
+	seen := make(map[string]bool)
+	for _, key := range req.Operations {
+		key = strings.TrimSpace(key)
+		op, ok := byKey[key]
+		if !ok {
+			skipped = append(skipped, ImportSkippedOperation{Key: key, Reason: "操作不存在"})
+			continue
+		}
+		tool, err := spec.BuildTool(op, opts)
+		if err != nil {
+			skipped = append(skipped, ImportSkippedOperation{Key: key, Reason: err.Error()})
+			continue
+		}
+		if tool.Name == "" || seen[tool.Name] {
+			skipped = append(skipped, ImportSkippedOperation{Key: key, Name: tool.Name, Reason: "工具名称为空或重复"})
+			continue
+		}
+		seen[tool.Name] = true
+		opKeys[tool.Name] = key
+		tool.ID = uuid.New()
+		tool.AuthConfig = models.JSONMap(req.AuthConfig)
+		tool.Enabled = enabled
+		tool.CreatedBy = &userUUID
+		tools = append(tools, tool)
+	}
+
+	// 已存在的同名工具不覆盖
+	if len(tools) > 0 {
+		names := make([]string, 0, len(tools))
+		for _, t := range tools {
+			names = append(names, t.Name)
+		}
+		var existing []string
+		if err := h.db.Model(&models.Tool{}).Where("name IN ?", names).Pluck("name", &existing).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(50031, "数据库查询失败", err.Error()))
+			return
+		}
+		exists := make(map[string]bool, len(existing))
+		for _, n := range existing {
+			exists[n] = true
+		}
+		kept := tools[:0]
+		for _, t := range tools {
+			if exists[t.Name] {
+				skipped = append(skipped, ImportSkippedOperation{Key: opKeys[t.Name], Name: t.Name, Reason: "工具名称已存在"})
+				continue
+			}
+			kept = append(kept, t)
+		}
+		tools = kept
+	}
+
+	if len(tools) > 0 {
+		if err := h.db.WithContext(c.Request.Context()).Create(&tools).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(50030, "导入工具失败", err.Error()))
+			return
+		}
+	}
+
+	showAuth := hasPermission(c, h.permissions, authSvc.PermToolsManage)
+	created := make([]ToolResponse, 0, len(tools))
+	for _, t := range tools {
+		created = append(created, h.buildToolResponse(t, nil, showAuth))
+	}
+	c.JSON(http.StatusCreated, pkgErrors.NewSuccessResponse(map[string]interface{}{
+		"created": created,
+		"skipped": skipped,
+	}))
+}
+
+// bindImportOpenAPIRequest 解析 JSON 或 multipart 请求，返回请求与文档内容（未提供时为空）
+func bindImportOpenAPIRequest(c *gin.Context) (*ImportOpenAPIRequest, []byte, error) {
+	var req ImportOpenAPIRequest
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if err := c.ShouldBind(&req); err != nil {
+			return nil, nil, err
+		}
+		// operations 兼容逗号分隔
+		var ops []string
+		for _, v := range req.Operations {
+			for _, k := range strings.Split(v, ",") {
+				if k = strings.TrimSpace(k); k != "" {
+					ops = append(ops, k)
+				}
+			}
+		}
+		req.Operations = ops
+		if raw := c.PostForm("authConfig"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.AuthConfig); err != nil {
+				return nil, nil, fmt.Errorf("authConfig 不是有效的 JSON: %w", err)
+			}
+		}
+		if raw := c.PostForm("enabled"); raw != "" {
+			enabled, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, nil, fmt.Errorf("enabled 无效: %w", err)
+			}
+			req.Enabled = &enabled
+		}
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return &req, nil, nil
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		data, err := io.ReadAll(io.LimitReader(f, openAPIMaxUploadBytes+1))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(data) > openAPIMaxUploadBytes {
+			return nil, nil, errors.New("文件过大")
+		}
+		return &req, data, nil
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, nil, err
+	}
+	spec := bytes.TrimSpace(req.Spec)
+	if len(spec) == 0 || bytes.Equal(spec, []byte("null")) {
+		return &req, nil, nil
+	}
+	// 字符串形式的文档（可为 YAML）
+	if spec[0] == '"' {
+		var text string
+		if err := json.Unmarshal(spec, &text); err != nil {
+			return nil, nil, err
+		}
+		return &req, []byte(text), nil
+	}
+	return &req, spec, nil
+}
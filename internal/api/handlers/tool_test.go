@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+)
+
+func TestGetToolMasksAuthConfig(t *testing.T) {
+	toolID := uuid.New()
+	auth := models.JSONMap{"type": "api_key", "key": "s3cret", "name": "X-Token", "in": "header"}
+
+	cases := []struct {
+		name        string
+		permissions []string
+		want        map[string]interface{}
+	}{
+		// 只能读取与执行工具的用户看不到凭据
+		{"reader", []string{"tools.execute:*"}, map[string]interface{}{"type": "api_key", "name": "X-Token", "in": "header"}},
+		{"manager", []string{authSvc.PermToolsManage}, auth},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			userID := uuid.New()
+			db, _ := newFakeDB(t, fakeTables{
+				"tools": rowsOf("id", "name", "tool_type", "config", "auth_config", "enabled", "created_at").
+					add(toolID, "billing", "api", models.JSONMap{"method": "GET"}, auth, true, time.Now()),
+			}.withUser(userID, "tester", tc.permissions...).respond)
+			h := NewToolHandler(db, nil, authSvc.NewPermissions(db))
+			c, w := newTestContext(http.MethodGet, "", userID, gin.Param{Key: "id", Value: toolID.String()})
+
+			h.GetTool(c)
+
+			var data struct {
+				AuthConfig map[string]interface{} `json:"authConfig"`
+			}
+			if err := json.Unmarshal(decodeResponse(t, w).Data, &data); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+			}
+			if len(data.AuthConfig) != len(tc.want) {
+				t.Fatalf("expected authConfig %v, got %v", tc.want, data.AuthConfig)
+			}
+			for k, v := range tc.want {
+				if data.AuthConfig[k] != v {
+					t.Errorf("expected authConfig %v, got %v", tc.want, data.AuthConfig)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	pkgErrors "github.com/liusCraft/orion/pkg/errors"
+)
+
+// apiKeys API Key 管理，启动时由 SetAPIKeys 设置；未设置时不接受 API Key
+var apiKeys *authSvc.APIKeys
+
+// SetAPIKeys 设置 API Key 管理，Auth 据此接受 X-API-Key 或 Bearer 形式的 API Key
+func SetAPIKeys(k *authSvc.APIKeys) {
+	apiKeys = k
+}
+
+// authenticateAPIKey 校验 API Key 并把其身份写入上下文，失败时写入响应并返回 false
+func authenticateAPIKey(c *gin.Context, key string) bool {
+	if apiKeys == nil {
+		c.JSON(http.StatusUnauthorized, pkgErrors.NewErrorResponse(
+			20008,
+			"API Key 无效或已过期",
+			nil,
+		))
+		c.Abort()
+		return false
+	}
+
+	identity, err := apiKeys.Authenticate(c.Request.Context(), key, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, authSvc.ErrInvalidAPIKey) {
+			c.JSON(http.StatusUnauthorized, pkgErrors.NewErrorResponse(
+				20008,
+				"API Key 无效或已过期",
+				nil,
+			))
+		} else {
+			logger.Error("校验 API Key 失败: %v", err)
+			c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+				50001,
+				"内部服务器错误",
+				nil,
+			))
+		}
+		c.Abort()
+		return false
+	}
+
+	c.Set("user_id", identity.UserID)
+	c.Set("username", identity.Username)
+	c.Set("role", identity.Role)
+	c.Set("department", identity.Department)
+	c.Set("api_key_id", identity.KeyID)
+	c.Set("scopes", identity.Scopes)
+	setAuditActor(c, identity.UserID)
+	return true
+}
+
+// RequireScope API Key 必须具备指定的权限范围之一；登录会话（JWT）不受限制
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); !ok {
+			c.Next()
+			return
+		}
+
+		granted := c.GetStringSlice("scopes")
+		for _, scope := range scopes {
+			if slices.Contains(granted, scope) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			20009,
+			"API Key 缺少所需的权限范围",
+			map[string]interface{}{"required": scopes},
+		))
+		c.Abort()
+	}
+}
+
+// SessionOnly 只允许登录会话访问，拒绝 API Key：如管理后台、会话与 API Key 管理
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("api_key_id"); ok {
+			c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+				20010,
+				"该操作需要登录，不支持 API Key",
+				nil,
+			))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	auditSvc "github.com/liusCraft/orion/internal/services/audit"
+)
+
+// setAuditActor 把当前用户、客户端 IP 与 User-Agent 写入请求上下文
+// 处理函数经 db.WithContext(c.Request.Context()) 执行的变更据此记录审计日志的操作者。
+func setAuditActor(c *gin.Context, userID uuid.UUID) {
+	c.Request = c.Request.WithContext(auditSvc.WithActor(c.Request.Context(), auditSvc.Actor{
+		UserID:    &userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}))
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/liusCraft/orion/internal/pkg/jwt"
 	"github.com/liusCraft/orion/internal/pkg/logger"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
 	"github.com/liusCraft/orion/pkg/errors"
 )
 
@@ -51,7 +52,7 @@ func CORS() gin.HandlerFunc {
 		// 在生产环境中，应该配置具体的允许域名
 		c.Header("Access-Control-Allow-Origin", origin)
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, accept, origin, Cache-Control, X-Requested-With")
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -77,9 +78,17 @@ func RequestID() gin.HandlerFunc {
 	}
 }
 
-// Auth JWT认证中间件
+// Auth 认证中间件：接受 Bearer JWT，也接受 X-API-Key 或 Bearer 形式的 API Key
 func Auth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API Key 供 CI、机器人等无人值守的调用方使用，不从 query 参数读取以免写入访问日志
+		if key := c.Request.Header.Get("X-API-Key"); key != "" {
+			if authenticateAPIKey(c, key) {
+				c.Next()
+			}
+			return
+		}
+
 		var token string
 
 		// 从Authorization header获取token
@@ -92,6 +101,13 @@ func Auth() gin.HandlerFunc {
 			}
 		}
 
+		if authSvc.IsAPIKey(token) {
+			if authenticateAPIKey(c, token) {
+				c.Next()
+			}
+			return
+		}
+
 		// 如果header中没有token，尝试从query参数中获取（用于SSE连接）
 		if token == "" {
 			token = c.Query("token")
@@ -130,11 +146,18 @@ func Auth() gin.HandlerFunc {
 			return
 		}
 
+		// 会话已撤销（退出登录、刷新令牌重用等）的令牌不再有效
+		if !checkSession(c, claims) {
+			return
+		}
+
 		// 将用户信息存储到上下文
 		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
 		c.Set("department", claims.Department)
+		setAuditActor(c, claims.UserID)
 
 		c.Next()
 	}
@@ -176,11 +199,3 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 		c.Next()
 	}
 }
-
-// RateLimit 限流中间件（简单实现，生产环境建议使用Redis）
-func RateLimit() gin.HandlerFunc {
-	// TODO: 实现基于Redis的限流
-	return func(c *gin.Context) {
-		c.Next()
-	}
-}
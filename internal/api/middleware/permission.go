@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	pkgErrors "github.com/liusCraft/orion/pkg/errors"
+)
+
+// permissions 权限解析，启动时由 SetPermissions 设置；未设置时 RequirePermission 一律拒绝
+var permissions *authSvc.Permissions
+
+// SetPermissions 设置权限解析
+func SetPermissions(p *authSvc.Permissions) {
+	permissions = p
+}
+
+// RequirePermission 当前用户须具备指定的权限之一，需在 Auth 之后使用
+// 解析出的有效授权保存在上下文 permissions 中，同一请求内的后续检查直接复用。
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var grants *authSvc.Grants
+		if v, ok := c.Get("permissions"); ok {
+			grants = v.(*authSvc.Grants)
+		} else if userID, ok := c.Get("user_id"); ok && permissions != nil {
+			var err error
+			grants, err = permissions.Resolve(c.Request.Context(), userID.(uuid.UUID))
+			if err != nil {
+				logger.Error("解析用户权限失败 user=%s: %v", userID, err)
+				c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+					50001,
+					"内部服务器错误",
+					nil,
+				))
+				c.Abort()
+				return
+			}
+			c.Set("permissions", grants)
+		}
+
+		if grants != nil {
+			for _, perm := range perms {
+				if grants.Has(perm) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.JSON(http.StatusForbidden, pkgErrors.NewErrorResponse(
+			20011,
+			"权限不足",
+			map[string]interface{}{"required": perms},
+		))
+		c.Abort()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/liusCraft/orion/internal/pkg/jwt"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	authSvc "github.com/liusCraft/orion/internal/services/auth"
+	pkgErrors "github.com/liusCraft/orion/pkg/errors"
+)
+
+// sessions 登录会话，启动时由 SetSessions 设置；未设置时不校验会话
+var sessions *authSvc.Sessions
+
+// SetSessions 设置登录会话，Auth 据此拒绝已撤销或已过期会话的令牌
+func SetSessions(s *authSvc.Sessions) {
+	sessions = s
+}
+
+// checkSession 校验访问令牌所属的会话，失败时写入响应并返回 false
+func checkSession(c *gin.Context, claims *jwt.Claims) bool {
+	if sessions == nil {
+		return true
+	}
+	err := sessions.Validate(c.Request.Context(), claims.UserID, claims.SessionID)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, authSvc.ErrSessionInactive) {
+		c.JSON(http.StatusUnauthorized, pkgErrors.NewErrorResponse(
+			20007,
+			"会话已失效，请重新登录",
+			nil,
+		))
+	} else {
+		logger.Error("校验会话失败 session=%s: %v", claims.SessionID, err)
+		c.JSON(http.StatusInternalServerError, pkgErrors.NewErrorResponse(
+			50001,
+			"内部服务器错误",
+			nil,
+		))
+	}
+	c.Abort()
+	return false
+}
@@ -10,16 +10,38 @@ import (
 func SetupAuthRoutes(rg *gin.RouterGroup, handler *handlers.AuthHandler) {
 	auth := rg.Group("/auth")
 	{
-		auth.POST("/login", handler.Login)
+		auth.POST("/login", middleware.RateLimit("login"), handler.Login) // 按客户端 IP 限流，防止暴力破解
 		auth.POST("/register", handler.Register)
 		auth.POST("/refresh", handler.RefreshToken)
 
+		// OIDC 单点登录
+		auth.GET("/providers", handler.GetLoginProviders)
+		auth.GET("/oidc/login", middleware.RateLimit("login"), handler.OIDCLogin)
+		auth.GET("/oidc/callback", middleware.RateLimit("login"), handler.OIDCCallback)
+
 		// 需要认证的路由
 		authenticated := auth.Group("/")
 		authenticated.Use(middleware.Auth())
 		{
-			authenticated.POST("/logout", handler.Logout)
 			authenticated.GET("/profile", handler.Profile)
+			authenticated.GET("/permissions", handler.GetPermissions) // 当前用户的角色与有效权限
+
+			// 登录会话与 API Key 管理只允许登录后操作，API Key 不能用来签发或撤销凭据
+			session := authenticated.Group("/")
+			session.Use(middleware.SessionOnly())
+			{
+				session.POST("/logout", handler.Logout)
+
+				// 登录会话
+				session.GET("/sessions", handler.GetSessions)
+				session.DELETE("/sessions", handler.RevokeOtherSessions)
+				session.DELETE("/sessions/:id", handler.RevokeSession)
+
+				// API Key
+				session.POST("/api-keys", handler.CreateAPIKey)
+				session.GET("/api-keys", handler.GetAPIKeys)
+				session.DELETE("/api-keys/:id", handler.RevokeAPIKey)
+			}
 		}
 	}
 }
@@ -27,7 +49,7 @@ func SetupAuthRoutes(rg *gin.RouterGroup, handler *handlers.AuthHandler) {
 func SetupChatRoutes(rg *gin.RouterGroup, handler *handlers.ChatHandler) {
 	// 直接在根路径下设置对话路由，以匹配前端API调用
 	conversations := rg.Group("/conversations")
-	conversations.Use(middleware.Auth()) // 所有聊天API都需要认证
+	conversations.Use(middleware.Auth(), middleware.RequireScope("chat")) // 所有聊天API都需要认证
 	{
 		// 对话管理
 		conversations.POST("", handler.CreateConversation)
@@ -38,12 +60,35 @@ func SetupChatRoutes(rg *gin.RouterGroup, handler *handlers.ChatHandler) {
 
 		// 消息管理
 		conversations.GET("/:id/messages", handler.GetMessages)
-		conversations.POST("/:id/messages", handler.SendMessage)
+		conversations.POST("/:id/messages", middleware.RateLimit("message"), handler.SendMessage)
 		conversations.GET("/:id/messages/:messageId", handler.GetMessage)
-		conversations.POST("/:id/messages/:messageId/regenerate", handler.RegenerateMessage)
+		conversations.POST("/:id/messages/:messageId/regenerate", middleware.RateLimit("message"), handler.RegenerateMessage)
+		conversations.POST("/:id/messages/:messageId/cancel", handler.CancelMessage)
+
+		// 消息分支
+		conversations.POST("/:id/messages/:messageId/edit", middleware.RateLimit("message"), handler.EditMessage)
+		conversations.GET("/:id/messages/:messageId/siblings", handler.GetMessageSiblings)
+		conversations.PUT("/:id/active-message", handler.SelectBranch)
+
+		// 工具调用审批（不接受 API Key，须由用户本人在登录会话中确认）
+		conversations.POST("/:id/tool-approvals/:executionId", middleware.SessionOnly(), handler.DecideToolApproval)
 
 		// SSE流式响应
-		conversations.GET("/:id/stream", handler.StreamMessages)
+		conversations.GET("/:id/stream", middleware.StreamRateLimit(), handler.StreamMessages)
+	}
+
+	// 可选用的模型配置与人设
+	models := rg.Group("/models")
+	models.Use(middleware.Auth(), middleware.RequireScope("chat"))
+	{
+		models.GET("", handler.GetModels)
+	}
+
+	// 当前用户的 token 用量与配额
+	usage := rg.Group("/usage")
+	usage.Use(middleware.Auth(), middleware.RequireScope("chat"))
+	{
+		usage.GET("/me", handler.GetMyUsage)
 	}
 }
 
@@ -56,23 +101,30 @@ func SetupKnowledgeRoutes(rg *gin.RouterGroup, handler *handlers.KnowledgeHandle
 		authenticated := knowledge.Group("/")
 		authenticated.Use(middleware.Auth())
 		{
-			// 分类管理
-			authenticated.POST("/categories", handler.CreateCategory)
-			authenticated.PUT("/categories/:id", handler.UpdateCategory)
-			authenticated.DELETE("/categories/:id", handler.DeleteCategory)
-
-			// 文档管理
-			authenticated.POST("/documents", handler.CreateDocument)
-			authenticated.PUT("/documents/:id", handler.UpdateDocument)
-			authenticated.DELETE("/documents/:id", handler.DeleteDocument)
+			// 增删改需要 knowledge.write 权限
+			write := authenticated.Group("/")
+			write.Use(middleware.RequireScope("knowledge:write"), middleware.RequirePermission("knowledge.write"))
+			{
+				// 分类管理
+				write.POST("/categories", handler.CreateCategory)
+				write.PUT("/categories/:id", handler.UpdateCategory)
+				write.DELETE("/categories/:id", handler.DeleteCategory)
+
+				// 文档管理
+				write.POST("/documents", handler.CreateDocument)
+				write.PUT("/documents/:id", handler.UpdateDocument)
+				write.DELETE("/documents/:id", handler.DeleteDocument)
+				write.POST("/documents/:id/reindex", handler.ReindexDocument)
+			}
 
 			// 文档搜索
-			authenticated.POST("/documents/search", handler.SearchDocuments)
+			authenticated.POST("/documents/search", middleware.RequireScope("knowledge:read", "knowledge:write"), handler.SearchDocuments)
 		}
 
 		// 文档查看（公开读取）
 		knowledge.GET("/documents", handler.GetDocuments)
 		knowledge.GET("/documents/:id", handler.GetDocument)
+		knowledge.GET("/documents/:id/index", handler.GetDocumentIndexStatus)
 	}
 }
 
@@ -80,33 +132,43 @@ func SetupToolRoutes(rg *gin.RouterGroup, handler *handlers.ToolHandler) {
 	tools := rg.Group("/tools")
 	tools.Use(middleware.Auth()) // 所有工具API都需要认证
 	{
+		read := middleware.RequireScope("tools:read", "tools:execute", "tools:write")
+		write := middleware.RequireScope("tools:write")
+		execute := middleware.RequireScope("tools:execute")
+		manage := middleware.RequirePermission("tools.manage")
+
 		// 工具类型与模板
-		tools.GET("/types", handler.GetToolTypes)
-		tools.GET("/types/:type/template", handler.GetToolTemplate)
-		tools.POST("/types/:type/validate", handler.ValidateToolTypeConfig)
-		tools.POST("/test", handler.TestToolConnection)
-
-		// 工具管理
-		tools.GET("", handler.GetTools)
-		tools.GET("/:id", handler.GetTool)
-		tools.POST("", handler.CreateTool)
-		tools.PUT("/:id", handler.UpdateTool)
-		tools.PUT("/:id/toggle", handler.ToggleTool)
-		tools.DELETE("/:id", handler.DeleteTool)
-
-		// 工具执行
-		tools.POST("/:id/execute", handler.ExecuteTool)
-		tools.GET("/executions", handler.GetExecutions)
+		tools.GET("/types", read, handler.GetToolTypes)
+		tools.GET("/types/:type/template", read, handler.GetToolTemplate)
+		tools.POST("/types/:type/validate", write, manage, handler.ValidateToolTypeConfig)
+		tools.POST("/test", write, manage, middleware.RateLimit("tool"), handler.TestToolConnection)
+
+		// 工具管理（脚本工具另需 tools.script 权限）
+		tools.GET("", read, handler.GetTools)
+		tools.GET("/:id", read, handler.GetTool)
+		tools.POST("", write, manage, handler.CreateTool)
+		tools.PUT("/:id", write, manage, handler.UpdateTool)
+		tools.PUT("/:id/toggle", write, manage, handler.ToggleTool)
+		tools.DELETE("/:id", write, manage, handler.DeleteTool)
+
+		// 从 OpenAPI 文档导入
+		tools.POST("/import/openapi", write, middleware.RequirePermission("tools.import"), handler.ImportOpenAPITools)
+
+		// 工具执行（按工具检查 tools.execute:<工具ID>）
+		tools.POST("/:id/execute", execute, middleware.RateLimit("tool"), handler.ExecuteTool)
+		tools.GET("/executions", read, handler.GetExecutions)
 	}
 }
 
 func SetupAdminRoutes(rg *gin.RouterGroup, handler *handlers.AdminHandler) {
 	admin := rg.Group("/admin")
-	admin.Use(middleware.Auth())               // 需要认证
-	admin.Use(middleware.RequireRole("admin")) // 需要管理员权限
+	admin.Use(middleware.Auth())        // 需要认证
+	admin.Use(middleware.SessionOnly()) // 不接受 API Key
 	{
 		// 用户管理
+		usersManage := middleware.RequirePermission("users.manage")
 		users := admin.Group("/users")
+		users.Use(usersManage)
 		{
 			users.POST("", handler.CreateUser)
 			users.GET("", handler.GetUsers)
@@ -115,8 +177,34 @@ func SetupAdminRoutes(rg *gin.RouterGroup, handler *handlers.AdminHandler) {
 			users.DELETE("/:id", handler.DeleteUser)
 		}
 
+		// 服务账号与 API Key
+		admin.POST("/service-accounts", usersManage, handler.CreateServiceAccount)
+		admin.POST("/service-accounts/:id/api-keys", usersManage, handler.CreateServiceAccountKey)
+		admin.GET("/api-keys", usersManage, handler.GetAPIKeys)
+		admin.DELETE("/api-keys/:id", usersManage, handler.RevokeAPIKey)
+
+		// 角色与权限
+		rolesManage := middleware.RequirePermission("roles.manage")
+		admin.GET("/permissions", rolesManage, handler.GetPermissionCatalog)
+		roles := admin.Group("/roles")
+		roles.Use(rolesManage)
+		{
+			roles.POST("", handler.CreateRole)
+			roles.GET("", handler.GetRoles)
+			roles.PUT("/:id", handler.UpdateRole)
+			roles.DELETE("/:id", handler.DeleteRole)
+		}
+		assignments := admin.Group("/role-assignments")
+		assignments.Use(rolesManage)
+		{
+			assignments.POST("", handler.CreateRoleAssignment)
+			assignments.GET("", handler.GetRoleAssignments)
+			assignments.DELETE("/:id", handler.DeleteRoleAssignment)
+		}
+
 		// 系统配置管理
 		configs := admin.Group("/configs")
+		configs.Use(middleware.RequirePermission("system.config"))
 		{
 			configs.POST("", handler.CreateSystemConfig)
 			configs.GET("", handler.GetSystemConfigs)
@@ -124,7 +212,25 @@ func SetupAdminRoutes(rg *gin.RouterGroup, handler *handlers.AdminHandler) {
 			configs.DELETE("/:id", handler.DeleteSystemConfig)
 		}
 
+		// 模型配置
+		admin.POST("/models/reload", middleware.RequirePermission("system.config"), handler.ReloadModels)
+
+		// 模型用量报表与 token 配额
+		usageManage := middleware.RequirePermission("usage.manage")
+		admin.GET("/usage", usageManage, handler.GetUsageReport)
+		quotas := admin.Group("/quotas")
+		quotas.Use(usageManage)
+		{
+			quotas.POST("", handler.CreateQuota)
+			quotas.GET("", handler.GetQuotas)
+			quotas.PUT("/:id", handler.UpdateQuota)
+			quotas.DELETE("/:id", handler.DeleteQuota)
+		}
+
 		// 系统统计
-		admin.GET("/stats", handler.GetSystemStats)
+		admin.GET("/stats", middleware.RequirePermission("stats.read"), handler.GetSystemStats)
+
+		// 审计日志（format=csv 或 jsonl 时导出）
+		admin.GET("/audit-logs", middleware.RequirePermission("audit.read"), handler.GetAuditLogs)
 	}
 }
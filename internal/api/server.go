@@ -1,7 +1,10 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -10,27 +13,115 @@ import (
 	"github.com/liusCraft/orion/internal/api/middleware"
 	"github.com/liusCraft/orion/internal/api/routes"
 	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/database"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	"github.com/liusCraft/orion/internal/pkg/ratelimit"
 	"github.com/liusCraft/orion/internal/services/ai"
+	"github.com/liusCraft/orion/internal/services/audit"
+	"github.com/liusCraft/orion/internal/services/auth"
+	"github.com/liusCraft/orion/internal/services/chat"
+	"github.com/liusCraft/orion/internal/services/knowledge"
+	"github.com/liusCraft/orion/internal/services/tools"
+	"github.com/liusCraft/orion/internal/services/usage"
 )
 
 type Server struct {
-	db        *gorm.DB
-	aiService *ai.AIService
-	router    *gin.Engine
+	db          *gorm.DB
+	models      *ai.Registry // 命名模型配置
+	indexer     *knowledge.Indexer
+	retriever   *knowledge.Retriever
+	mcpSessions *tools.SessionManager    // MCP长连接会话，对话与工具管理共用
+	approvals   *tools.ApprovalBroker    // 工具调用人工审批
+	generations *chat.GenerationRegistry // 进行中的AI生成，支持跨实例取消
+	streams     *chat.StreamHub          // 生成事件缓冲，支持断线重连
+	quotas      *usage.Quotas            // 用户与部门的 token 配额
+	rollup      *usage.Rollup            // 模型用量按天汇总
+	limiter     ratelimit.Limiter        // 限流存储：Redis 可用时多实例共享，否则为本实例内存
+	sessions    *auth.Sessions           // 登录会话与刷新令牌轮换
+	apiKeys     *auth.APIKeys            // 用户与服务账号的 API Key
+	sso         *auth.SSO                // OIDC 单点登录，未启用时为 nil
+	permissions *auth.Permissions        // 角色与有效权限
+	router      *gin.Engine
 }
 
 func NewServer(db *gorm.DB) (*Server, error) {
 	// 设置Gin模式
 	gin.SetMode(config.GlobalConfig.Server.Mode)
 
-	// 初始化AI服务
-	aiService, err := ai.NewAIService(&config.GlobalConfig.AI.LLM)
+	// 审计：用户、工具、系统配置、文档等的变更自动写入审计日志
+	if err := audit.Register(db); err != nil {
+		return nil, fmt.Errorf("register audit callbacks: %w", err)
+	}
+
+	// 初始化模型配置：配置文件 + system_configs 中的 llm_profile，定期重新加载
+	models, err := ai.NewRegistry(config.GlobalConfig.AI)
 	if err != nil {
 		return nil, err
 	}
+	if err := models.Reload(context.Background(), db); err != nil {
+		logger.Warn("加载模型配置失败: %v", err)
+	}
+	models.Watch(db, time.Duration(config.GlobalConfig.AI.ModelsReloadInterval)*time.Second)
+
+	// 记录每次模型调用的用量，并定期按天汇总到 usage_statistics
+	models.SetUsageRecorder(usage.NewRecorder(db))
+	rollup := usage.NewRollup(db, time.Duration(config.GlobalConfig.Usage.RollupInterval)*time.Second)
+	rollup.Start(context.Background())
+
+	// 初始化知识库向量化worker（未配置时跳过，知识库仍可正常使用）
+	var indexer *knowledge.Indexer
+	var retriever *knowledge.Retriever
+	embedder, err := ai.NewEmbedder(&config.GlobalConfig.AI.Embedding)
+	if err == nil {
+		err = database.EnsureEmbeddingDimensions(db, embedder.Dimensions())
+	}
+	if err != nil {
+		logger.Warn("Embedding未启用，知识文档将不会被向量化: %v", err)
+	} else {
+		indexer = knowledge.NewIndexer(db, embedder, config.GlobalConfig.AI.Embedding)
+		indexer.Start(context.Background())
+		retriever = knowledge.NewRetriever(db, embedder, config.GlobalConfig.AI.RAG)
+	}
+
+	// 生成取消：监听其它实例广播的取消请求（失败时仅支持本实例内取消）
+	generations := chat.NewGenerationRegistry(db)
+	if err := generations.Listen(database.DSN(&config.GlobalConfig.Database)); err != nil {
+		logger.Warn("生成取消监听未启用，仅支持取消本实例内的生成: %v", err)
+	}
+
+	// 限流：Redis 不可用时退回本实例内存
+	limiter := ratelimit.New(config.GlobalConfig.Redis)
+	middleware.SetRateLimiter(limiter)
+
+	// 登录会话：认证时拒绝已撤销会话的令牌
+	sessions := auth.NewSessions(db)
+	middleware.SetSessions(sessions)
+
+	// API Key：供 CI、机器人等无人值守的调用方使用
+	apiKeys := auth.NewAPIKeys(db)
+	middleware.SetAPIKeys(apiKeys)
+
+	// 权限：用户的有效权限来自基础角色与分配给本人、所在部门的角色
+	permissions := auth.NewPermissions(db)
+	if err := permissions.EnsureBuiltInRoles(context.Background()); err != nil {
+		return nil, err
+	}
+	middleware.SetPermissions(permissions)
+
+	// OIDC 单点登录
+	var sso *auth.SSO
+	if config.GlobalConfig.OIDC.Enabled {
+		if sso, err = auth.NewSSO(db, config.GlobalConfig.OIDC); err != nil {
+			return nil, fmt.Errorf("invalid oidc config: %w", err)
+		}
+	}
 
 	// 创建路由器
 	router := gin.New()
+	// 限流按客户端 IP 计数，只信任配置的代理转发的地址，避免伪造 X-Forwarded-For 绕过
+	if err := router.SetTrustedProxies(config.GlobalConfig.Server.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
 
 	// 添加全局中间件
 	router.Use(middleware.Logger())
@@ -40,9 +131,25 @@ func NewServer(db *gorm.DB) (*Server, error) {
 
 	// 创建服务器实例
 	server := &Server{
-		db:        db,
-		aiService: aiService,
-		router:    router,
+		db:          db,
+		models:      models,
+		indexer:     indexer,
+		retriever:   retriever,
+		mcpSessions: tools.NewSessionManager(),
+		approvals:   tools.NewApprovalBroker(db, time.Duration(config.GlobalConfig.Tools.ApprovalTimeout)*time.Second),
+		generations: generations,
+		streams: chat.NewStreamHub(
+			time.Duration(config.GlobalConfig.Server.SSEReplayGrace)*time.Second,
+			config.GlobalConfig.Server.SSEReplayMaxEvents,
+		),
+		quotas:      usage.NewQuotas(db),
+		rollup:      rollup,
+		limiter:     limiter,
+		sessions:    sessions,
+		apiKeys:     apiKeys,
+		sso:         sso,
+		permissions: permissions,
+		router:      router,
 	}
 
 	// 设置路由
@@ -64,11 +171,11 @@ func (s *Server) setupRoutes() {
 	api := s.router.Group("/api/v1")
 
 	// 初始化handlers
-	authHandler := handlers.NewAuthHandler(s.db)
-	chatHandler := handlers.NewChatHandler(s.db, s.aiService)
-	knowledgeHandler := handlers.NewKnowledgeHandler(s.db)
-	toolHandler := handlers.NewToolHandler(s.db)
-	adminHandler := handlers.NewAdminHandler(s.db)
+	authHandler := handlers.NewAuthHandler(s.db, s.sessions, s.apiKeys, s.sso, s.permissions)
+	chatHandler := handlers.NewChatHandler(s.db, s.models, s.retriever, s.mcpSessions, s.approvals, s.generations, s.streams, s.quotas, s.permissions)
+	knowledgeHandler := handlers.NewKnowledgeHandler(s.db, s.indexer, s.retriever)
+	toolHandler := handlers.NewToolHandler(s.db, s.mcpSessions, s.permissions)
+	adminHandler := handlers.NewAdminHandler(s.db, s.models, s.sessions, s.apiKeys, s.permissions)
 
 	// 设置路由
 	routes.SetupAuthRoutes(api, authHandler)
@@ -85,3 +192,13 @@ func (s *Server) setupRoutes() {
 func (s *Server) Router() *gin.Engine {
 	return s.router
 }
+
+// Close 停止后台任务
+func (s *Server) Close() {
+	s.indexer.Stop()
+	s.mcpSessions.Close()
+	s.generations.Close()
+	s.models.Close()
+	s.rollup.Stop()
+	s.limiter.Close()
+}
@@ -10,12 +10,15 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	AI       AIConfig       `mapstructure:"ai"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Tools    ToolsConfig    `mapstructure:"tools"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	AI        AIConfig        `mapstructure:"ai"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	OIDC      OIDCConfig      `mapstructure:"oidc"`
+	Tools     ToolsConfig     `mapstructure:"tools"`
+	Usage     UsageConfig     `mapstructure:"usage"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
 }
 
 type ServerConfig struct {
@@ -26,6 +29,12 @@ type ServerConfig struct {
 	WriteTimeout int    `mapstructure:"write_timeout"`
 	// SSE 心跳间隔（秒），用于保持长连接活跃
 	SSEHeartbeat int `mapstructure:"sse_heartbeat"`
+	// 生成结束后事件缓冲的保留时长（秒），供断线客户端通过 Last-Event-ID 补发
+	SSEReplayGrace int `mapstructure:"sse_replay_grace"`
+	// 单次生成缓冲的最大事件数，超出后丢弃最早的事件
+	SSEReplayMaxEvents int `mapstructure:"sse_replay_max_events"`
+	// 可信的反向代理地址（IP 或 CIDR），只有来自这些地址的 X-Forwarded-For 才用于识别客户端 IP
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -45,21 +54,64 @@ type RedisConfig struct {
 	DB       int    `mapstructure:"db"`
 }
 
+// RateLimitConfig 令牌桶限流；配置了 Redis 时多实例共享限额
+type RateLimitConfig struct {
+	Enabled  bool                       `mapstructure:"enabled"`
+	Policies map[string]RateLimitPolicy `mapstructure:"policies"` // 按路由分组：login、message、stream、tool
+}
+
+// RateLimitPolicy 一类路由的限流策略，可按角色覆盖
+type RateLimitPolicy struct {
+	PerMinute int                      `mapstructure:"per_minute"` // 每分钟补充的令牌数，0 表示不限流
+	Burst     int                      `mapstructure:"burst"`      // 桶容量（允许的突发请求数），默认等于 per_minute
+	Roles     map[string]RateLimitRule `mapstructure:"roles"`
+}
+
+// RateLimitRule 角色的限流参数
+type RateLimitRule struct {
+	PerMinute int `mapstructure:"per_minute"`
+	Burst     int `mapstructure:"burst"`
+}
+
+// RuleFor 角色适用的限流参数，角色未单独设置时使用策略的参数
+func (p RateLimitPolicy) RuleFor(role string) RateLimitRule {
+	rule := RateLimitRule{PerMinute: p.PerMinute, Burst: p.Burst}
+	if r, ok := p.Roles[role]; ok && role != "" {
+		rule = r
+	}
+	if rule.Burst <= 0 {
+		rule.Burst = rule.PerMinute
+	}
+	return rule
+}
+
 type AIConfig struct {
 	LLM       LLMConfig       `mapstructure:"llm"`
 	RAG       RAGConfig       `mapstructure:"rag"`
 	Agent     AgentConfig     `mapstructure:"agent"`
 	Embedding EmbeddingConfig `mapstructure:"embedding"`
+	// 预置人设：名称 -> 系统提示词，对话可通过 context.persona 选用
+	Personas map[string]string `mapstructure:"personas"`
+	// 命名模型配置（profile），未设置的参数沿用 llm；llm 本身即名为 default 的配置
+	Models map[string]LLMConfig `mapstructure:"models"`
+	// 辅助任务（生成标题等）使用的模型配置名，为空时使用 default
+	AuxiliaryModel string `mapstructure:"auxiliary_model"`
+	// 重新加载模型配置（含 system_configs 中 llm_profile 类型的配置）的间隔（秒），0 表示只在管理员修改时加载
+	ModelsReloadInterval int `mapstructure:"models_reload_interval"`
 }
 
 type LLMConfig struct {
-	Provider    string  `mapstructure:"provider"` // openai, claude, qwen
-	Model       string  `mapstructure:"model"`    // gpt-4, claude-3-sonnet-20240229, qwen-plus
-	APIKey      string  `mapstructure:"api_key"`
-	BaseURL     string  `mapstructure:"base_url"`
-	Temperature float64 `mapstructure:"temperature"`
-	MaxTokens   int     `mapstructure:"max_tokens"`
-	Timeout     int     `mapstructure:"timeout"`
+	Provider    string   `mapstructure:"provider"` // claude, openai, qwen, deepseek, vllm, ollama
+	Model       string   `mapstructure:"model"`    // gpt-4, claude-3-sonnet-20240229, qwen-plus
+	APIKey      string   `mapstructure:"api_key"`
+	BaseURL     string   `mapstructure:"base_url"`
+	Temperature *float64 `mapstructure:"temperature"` // 未设置为 nil，0 为有效取值
+	MaxTokens   int      `mapstructure:"max_tokens"`
+	Timeout     int      `mapstructure:"timeout"`
+	// 模型上下文窗口（token），用于组装上下文时的预算
+	ContextWindow int `mapstructure:"context_window"`
+	// 对话可选用的其它模型（同一提供商），默认模型始终可用
+	AllowedModels []string `mapstructure:"allowed_models"`
 
 	// Claude特有参数
 	TopK int     `mapstructure:"top_k"`
@@ -68,9 +120,12 @@ type LLMConfig struct {
 	// 系统提示词配置
 	SystemPrompt string `mapstructure:"system_prompt"`
 
-	// 重试配置
+	// 重试配置：限流、服务端错误与超时按指数退避（含随机抖动）重试
 	RetryCount int `mapstructure:"retry_count"`
-	RetryDelay int `mapstructure:"retry_delay"` // seconds
+	RetryDelay int `mapstructure:"retry_delay"` // 首次重试的基础间隔（秒）
+
+	// 重试用尽后依次尝试的备用模型配置名（见 AIConfig.Models）
+	Fallbacks []string `mapstructure:"fallbacks"`
 }
 
 type RAGConfig struct {
@@ -82,22 +137,28 @@ type RAGConfig struct {
 }
 
 type AgentConfig struct {
-	MaxIterations   int  `mapstructure:"max_iterations"`
+	MaxIterations   int  `mapstructure:"max_iterations"` // 工具规划最多轮数
 	ThinkingEnabled bool `mapstructure:"thinking_enabled"`
 	MemoryEnabled   bool `mapstructure:"memory_enabled"`
-	MemoryLength    int  `mapstructure:"memory_length"`
-	// 规划阶段：工具调用最多轮数（非流式），默认1轮即可
-	ToolPlanMaxIter int `mapstructure:"tool_plan_max_iter"`
+	MemoryLength    int  `mapstructure:"memory_length"` // 原文保留的最多历史消息数，更早的消息并入摘要
+	// 上下文中为工具定义、工具结果与知识库预留的 token 数
+	ContextReserveTokens int `mapstructure:"context_reserve_tokens"`
 	// 是否根据用户意图判断再启用工具规划（简单关键词启发式）
 	ToolIntentEnabled bool `mapstructure:"tool_intent_enabled"`
 }
 
 type EmbeddingConfig struct {
-	Provider     string `mapstructure:"provider"` // openai, local
-	Model        string `mapstructure:"model"`    // text-embedding-ada-002
-	ChunkSize    int    `mapstructure:"chunk_size"`
-	ChunkOverlap int    `mapstructure:"chunk_overlap"`
-	BatchSize    int    `mapstructure:"batch_size"`
+	Provider      string `mapstructure:"provider"` // openai, local
+	Model         string `mapstructure:"model"`    // text-embedding-ada-002
+	APIKey        string `mapstructure:"api_key"`
+	BaseURL       string `mapstructure:"base_url"`
+	Timeout       int    `mapstructure:"timeout"`    // seconds
+	Dimensions    int    `mapstructure:"dimensions"` // 向量维度，需与 knowledge_embeddings.embedding 列一致
+	ChunkSize     int    `mapstructure:"chunk_size"`
+	ChunkOverlap  int    `mapstructure:"chunk_overlap"`
+	BatchSize     int    `mapstructure:"batch_size"`
+	Workers       int    `mapstructure:"workers"`        // 后台向量化worker数量
+	SweepInterval int    `mapstructure:"sweep_interval"` // 扫描待向量化文档的间隔（秒）
 }
 
 type JWTConfig struct {
@@ -107,12 +168,62 @@ type JWTConfig struct {
 	Issuer    string `mapstructure:"issuer"`
 }
 
+// OIDCConfig OpenID Connect 单点登录（授权码 + PKCE）
+type OIDCConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	Issuer       string   `mapstructure:"issuer"` // 由 {issuer}/.well-known/openid-configuration 发现各端点
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	RedirectURL  string   `mapstructure:"redirect_url"` // 回调地址，须在 IdP 中登记，如 https://orion.example.com/api/v1/auth/oidc/callback
+	Scopes       []string `mapstructure:"scopes"`
+	// 登录成功后跳转的前端地址，令牌放在 URL 片段中；为空时回调直接返回 JSON
+	PostLoginRedirect string `mapstructure:"post_login_redirect"`
+	// 首次登录时自动创建用户；关闭后只有已存在（按邮箱关联）的用户可以登录
+	AutoProvision   bool   `mapstructure:"auto_provision"`
+	UsernameClaim   string `mapstructure:"username_claim"`
+	GroupsClaim     string `mapstructure:"groups_claim"`
+	DepartmentClaim string `mapstructure:"department_claim"`
+	DefaultRole     string `mapstructure:"default_role"` // 没有匹配的组映射时新用户的角色
+	// 按顺序匹配用户所在的组，第一个指定了 role（department）的映射生效
+	GroupMappings []OIDCGroupMapping `mapstructure:"group_mappings"`
+	// 强制单点登录：关闭本地密码登录与注册，管理员仍可用密码登录以便 IdP 故障时应急
+	DisablePasswordLogin bool `mapstructure:"disable_password_login"`
+}
+
+// OIDCGroupMapping IdP 中的组对应的角色与部门
+type OIDCGroupMapping struct {
+	Group      string `mapstructure:"group"`
+	Role       string `mapstructure:"role"`
+	Department string `mapstructure:"department"`
+}
+
+// UsageConfig 模型用量统计
+type UsageConfig struct {
+	RollupInterval int `mapstructure:"rollup_interval"` // 汇总到 usage_statistics 的间隔（秒）
+}
+
 type ToolsConfig struct {
-	Timeout       int           `mapstructure:"timeout"`
-	MaxConcurrent int           `mapstructure:"max_concurrent"`
-	Grafana       GrafanaConfig `mapstructure:"grafana"`
-	Logs          LogsConfig    `mapstructure:"logs"`
-	CDN           CDNConfig     `mapstructure:"cdn"`
+	Timeout          int           `mapstructure:"timeout"`
+	MaxConcurrent    int           `mapstructure:"max_concurrent"`
+	MaxResponseBytes int           `mapstructure:"max_response_bytes"` // api 工具响应体上限
+	ApprovalTimeout  int           `mapstructure:"approval_timeout"`   // 工具调用等待审批的最长时间（秒）
+	AllowedNetworks  []string      `mapstructure:"allowed_networks"`   // 工具请求可访问的内网网段（CIDR 或 IP），其余内网地址不可访问
+	Script           ScriptConfig  `mapstructure:"script"`
+	Grafana          GrafanaConfig `mapstructure:"grafana"`
+	Logs             LogsConfig    `mapstructure:"logs"`
+	CDN              CDNConfig     `mapstructure:"cdn"`
+}
+
+// ScriptConfig 脚本工具沙箱配置
+type ScriptConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	CPUSeconds     int      `mapstructure:"cpu_seconds"`      // CPU 时间上限
+	MemoryMB       int      `mapstructure:"memory_mb"`        // 虚拟内存上限
+	MaxOutputBytes int      `mapstructure:"max_output_bytes"` // stdout/stderr 各自保留上限
+	EnvAllowlist   []string `mapstructure:"env_allowlist"`    // 可继承的服务端环境变量
+	ShellPath      string   `mapstructure:"shell_path"`
+	BashPath       string   `mapstructure:"bash_path"`
+	PythonPath     string   `mapstructure:"python_path"`
 }
 
 type GrafanaConfig struct {
@@ -175,9 +286,15 @@ func Load() error {
 	if apiKey := os.Getenv("CDNAGENT_AI_LLM_API_KEY"); apiKey != "" {
 		config.AI.LLM.APIKey = apiKey
 	}
+	if apiKey := os.Getenv("CDNAGENT_AI_EMBEDDING_API_KEY"); apiKey != "" {
+		config.AI.Embedding.APIKey = apiKey
+	}
 	if jwtSecret := os.Getenv("CDNAGENT_JWT_SECRET"); jwtSecret != "" {
 		config.JWT.Secret = jwtSecret
 	}
+	if clientSecret := os.Getenv("CDNAGENT_OIDC_CLIENT_SECRET"); clientSecret != "" {
+		config.OIDC.ClientSecret = clientSecret
+	}
 
 	GlobalConfig = config
 	return nil
@@ -212,9 +329,12 @@ func replacePlaceholders(v reflect.Value) {
 			replacePlaceholders(v.Index(i))
 		}
 	case reflect.Map:
+		// map 元素不可寻址，复制后替换再写回
 		for _, key := range v.MapKeys() {
-			val := v.MapIndex(key)
+			val := reflect.New(v.Type().Elem()).Elem()
+			val.Set(v.MapIndex(key))
 			replacePlaceholders(val)
+			v.SetMapIndex(key, val)
 		}
 	case reflect.String:
 		if v.CanSet() {
@@ -242,6 +362,48 @@ func replacePlaceholders(v reflect.Value) {
 	}
 }
 
+// HasEnvPlaceholder 取值（含嵌套的 map 与切片）中是否有 ${VAR} 形式的环境变量占位符
+func HasEnvPlaceholder(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return envPlaceholderRe.MatchString(v)
+	case map[string]interface{}:
+		for _, item := range v {
+			if HasEnvPlaceholder(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if HasEnvPlaceholder(item) {
+				return true
+			}
+		}
+	case []string:
+		for _, item := range v {
+			if HasEnvPlaceholder(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DecodeLLMConfig 将与配置文件 ai.llm 相同键名的键值解析为 LLMConfig
+// 用于 system_configs 中保存的模型配置。占位符只在配置文件中展开：数据库中的配置可由管理员修改，
+// 展开环境变量会让其借 base_url 等字段把服务端的密钥发送出去。
+func DecodeLLMConfig(values map[string]interface{}) (LLMConfig, error) {
+	v := viper.New()
+	if err := v.MergeConfigMap(values); err != nil {
+		return LLMConfig{}, err
+	}
+	var cfg LLMConfig
+	if err := v.Unmarshal(&cfg); err != nil {
+		return LLMConfig{}, err
+	}
+	return cfg, nil
+}
+
 func setDefaults() {
 	// Server defaults
 	viper.SetDefault("server.host", "0.0.0.0")
@@ -252,6 +414,9 @@ func setDefaults() {
 	viper.SetDefault("server.write_timeout", 0)
 	// SSE 心跳，默认5秒（可根据代理链路调小）
 	viper.SetDefault("server.sse_heartbeat", 5)
+	viper.SetDefault("server.sse_replay_grace", 300)
+	viper.SetDefault("server.sse_replay_max_events", 10000)
+	viper.SetDefault("server.trusted_proxies", []string{"127.0.0.1", "::1"})
 
 	// Database defaults
 	viper.SetDefault("database.host", "localhost")
@@ -271,11 +436,16 @@ func setDefaults() {
 	viper.SetDefault("ai.llm.model", "claude-3-sonnet-20240229")
 	viper.SetDefault("ai.llm.temperature", 0.7)
 	viper.SetDefault("ai.llm.max_tokens", 2000)
+	viper.SetDefault("ai.llm.context_window", 200000)
+	viper.SetDefault("ai.llm.allowed_models", []string{})
+	viper.SetDefault("ai.auxiliary_model", "")
+	viper.SetDefault("ai.models_reload_interval", 60)
 	viper.SetDefault("ai.llm.timeout", 60)
 	viper.SetDefault("ai.llm.top_k", 5)
 	viper.SetDefault("ai.llm.top_p", 0.9)
 	viper.SetDefault("ai.llm.retry_count", 3)
 	viper.SetDefault("ai.llm.retry_delay", 1)
+	viper.SetDefault("ai.llm.fallbacks", []string{})
 	viper.SetDefault("ai.llm.system_prompt", `你是工程效能 AI 助手，面向研发、运维、技术支持等角色。
 
 你的能力包括但不限于：
@@ -306,8 +476,8 @@ func setDefaults() {
 	viper.SetDefault("ai.agent.thinking_enabled", true)
 	viper.SetDefault("ai.agent.memory_enabled", true)
 	viper.SetDefault("ai.agent.memory_length", 50)
+	viper.SetDefault("ai.agent.context_reserve_tokens", 8000)
 	// 工具规划相关默认
-	viper.SetDefault("ai.agent.tool_plan_max_iter", 1)
 	viper.SetDefault("ai.agent.tool_intent_enabled", true)
 
 	// Embedding defaults
@@ -316,15 +486,52 @@ func setDefaults() {
 	viper.SetDefault("ai.embedding.chunk_size", 1000)
 	viper.SetDefault("ai.embedding.chunk_overlap", 200)
 	viper.SetDefault("ai.embedding.batch_size", 10)
+	viper.SetDefault("ai.embedding.timeout", 30)
+	viper.SetDefault("ai.embedding.dimensions", 1536)
+	viper.SetDefault("ai.embedding.workers", 2)
+	viper.SetDefault("ai.embedding.sweep_interval", 30)
 
 	// JWT defaults
 	viper.SetDefault("jwt.expires_in", 24)  // 24 hours
 	viper.SetDefault("jwt.refresh_in", 168) // 7 days
 	viper.SetDefault("jwt.issuer", "cdnagent")
 
+	// OIDC defaults
+	viper.SetDefault("oidc.enabled", false)
+	viper.SetDefault("oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("oidc.auto_provision", true)
+	viper.SetDefault("oidc.username_claim", "preferred_username")
+	viper.SetDefault("oidc.groups_claim", "groups")
+	viper.SetDefault("oidc.department_claim", "department")
+	viper.SetDefault("oidc.default_role", "user")
+	viper.SetDefault("oidc.disable_password_login", false)
+
+	// Rate limit defaults
+	viper.SetDefault("rate_limit.enabled", true)
+	viper.SetDefault("rate_limit.policies.login.per_minute", 5)
+	viper.SetDefault("rate_limit.policies.login.burst", 5)
+	viper.SetDefault("rate_limit.policies.message.per_minute", 20)
+	viper.SetDefault("rate_limit.policies.message.burst", 10)
+	viper.SetDefault("rate_limit.policies.stream.per_minute", 120) // 断线重连
+	viper.SetDefault("rate_limit.policies.stream.burst", 30)
+	viper.SetDefault("rate_limit.policies.tool.per_minute", 30)
+	viper.SetDefault("rate_limit.policies.tool.burst", 10)
+
+	// Usage defaults
+	viper.SetDefault("usage.rollup_interval", 3600)
+
 	// Tools defaults
 	viper.SetDefault("tools.timeout", 30)
 	viper.SetDefault("tools.max_concurrent", 5)
+	viper.SetDefault("tools.max_response_bytes", 1048576)
+	viper.SetDefault("tools.approval_timeout", 600)
+	viper.SetDefault("tools.script.enabled", false) // 脚本在服务端执行，须显式开启
+	viper.SetDefault("tools.script.cpu_seconds", 10)
+	viper.SetDefault("tools.script.memory_mb", 256)
+	viper.SetDefault("tools.script.max_output_bytes", 65536)
+	viper.SetDefault("tools.script.shell_path", "/bin/sh")
+	viper.SetDefault("tools.script.bash_path", "bash")
+	viper.SetDefault("tools.script.python_path", "python3")
 	viper.SetDefault("tools.grafana.enabled", false)
 	viper.SetDefault("tools.logs.enabled", false)
 	viper.SetDefault("tools.cdn.enabled", false)
@@ -11,9 +11,14 @@ import (
 	"github.com/liusCraft/orion/internal/database/models"
 )
 
-func Init(cfg *config.DatabaseConfig) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=%s client_encoding=UTF8",
+// DSN 构造 Postgres 连接串（GORM 与 LISTEN 监听连接共用）
+func DSN(cfg *config.DatabaseConfig) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=%s client_encoding=UTF8",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode, cfg.TimeZone)
+}
+
+func Init(cfg *config.DatabaseConfig) (*gorm.DB, error) {
+	dsn := DSN(cfg)
 
 	// 配置GORM
 	gormConfig := &gorm.Config{
@@ -44,10 +49,18 @@ func Init(cfg *config.DatabaseConfig) (*gorm.DB, error) {
 }
 
 func Migrate(db *gorm.DB) error {
+	// 旧版本的 idx_doc_chunk 只约束了 chunk_index，会导致不同文档的分块互相冲突
+	if err := db.Exec("DROP INDEX IF EXISTS idx_doc_chunk").Error; err != nil {
+		return fmt.Errorf("failed to drop legacy index: %w", err)
+	}
+
 	// 自动迁移数据库表
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.UserSession{},
+		&models.APIKey{},
+		&models.Role{},
+		&models.RoleAssignment{},
 		&models.Conversation{},
 		&models.Message{},
 		&models.MessageAttachment{},
@@ -60,11 +73,51 @@ func Migrate(db *gorm.DB) error {
 		&models.SystemConfig{},
 		&models.AuditLog{},
 		&models.UsageStatistic{},
+		&models.LLMUsage{},
+		&models.UsageQuota{},
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// 知识分块全文索引，供混合检索使用
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_knowledge_embedding_content_fts ON knowledge_embeddings USING GIN (to_tsvector('simple', chunk_content))").Error; err != nil {
+		return fmt.Errorf("failed to create full-text index: %w", err)
+	}
+
+	// 使用统计的唯一约束增加了维度，移除旧的 (date, metric_type) 唯一索引
+	if err := db.Exec("DROP INDEX IF EXISTS idx_date_type").Error; err != nil {
+		return fmt.Errorf("failed to drop legacy usage index: %w", err)
+	}
+
+	if err := backfillMessageTree(db); err != nil {
+		return fmt.Errorf("failed to backfill message tree: %w", err)
+	}
+
 	return nil
 }
+
+// backfillMessageTree 为引入分支之前的对话补齐消息树
+// 旧对话的用户消息没有父节点：按创建时间挂到前一条消息下，并以最新消息作为当前分支。
+// 仅处理尚未设置 active_message_id 的对话，可重复执行。
+func backfillMessageTree(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			UPDATE messages m SET parent_message_id = p.prev_id
+			FROM (
+				SELECT ms.id, LAG(ms.id) OVER (PARTITION BY ms.conversation_id ORDER BY ms.created_at, ms.id) AS prev_id
+				FROM messages ms
+				JOIN conversations c ON c.id = ms.conversation_id
+				WHERE c.active_message_id IS NULL
+			) p
+			WHERE m.id = p.id AND m.sender_type = 'user' AND m.parent_message_id IS NULL AND p.prev_id IS NOT NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			UPDATE conversations c SET active_message_id = (
+				SELECT ms.id FROM messages ms WHERE ms.conversation_id = c.id ORDER BY ms.created_at DESC, ms.id DESC LIMIT 1
+			)
+			WHERE c.active_message_id IS NULL AND EXISTS (SELECT 1 FROM messages ms WHERE ms.conversation_id = c.id)`).Error
+	})
+}
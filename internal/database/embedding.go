@@ -0,0 +1,37 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// EnsureEmbeddingDimensions 校验向量列维度与配置是否一致
+// 表为空时直接调整列维度；已有数据时返回错误，需清空向量表后重新向量化。
+func EnsureEmbeddingDimensions(db *gorm.DB, dimensions int) error {
+	var current int
+	// pgvector 的 atttypmod 即为声明的维度，未声明维度时为 -1
+	if err := db.Raw(`SELECT atttypmod FROM pg_attribute
+		WHERE attrelid = 'knowledge_embeddings'::regclass AND attname = 'embedding' AND NOT attisdropped`).
+		Scan(&current).Error; err != nil {
+		return fmt.Errorf("failed to read embedding column: %w", err)
+	}
+	if current == dimensions {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.KnowledgeEmbedding{}).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count embeddings: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("embedding column has %d dimensions but %d configured; clear knowledge_embeddings and reindex to switch", current, dimensions)
+	}
+
+	if err := db.Exec(fmt.Sprintf("ALTER TABLE knowledge_embeddings ALTER COLUMN embedding TYPE vector(%d)", dimensions)).Error; err != nil {
+		return fmt.Errorf("failed to alter embedding column: %w", err)
+	}
+	return nil
+}
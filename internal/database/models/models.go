@@ -54,24 +54,73 @@ type User struct {
 	PasswordHash string     `gorm:"type:varchar(255);not null" json:"-"`
 	DisplayName  string     `gorm:"type:varchar(100)" json:"display_name"`
 	AvatarURL    string     `gorm:"type:text" json:"avatar_url"`
-	Role         string     `gorm:"type:varchar(20);not null;default:'user'" json:"role"`     // admin, user, viewer
-	Department   string     `gorm:"type:varchar(50)" json:"department"`                       // 运维、研发、TS
-	Status       string     `gorm:"type:varchar(20);not null;default:'active'" json:"status"` // active, inactive, suspended
+	Role         string     `gorm:"type:varchar(20);not null;default:'user'" json:"role"`           // admin, user, viewer
+	Department   string     `gorm:"type:varchar(50)" json:"department"`                             // 运维、研发、TS
+	Status       string     `gorm:"type:varchar(20);not null;default:'active'" json:"status"`       // active, inactive, suspended
+	AccountType  string     `gorm:"type:varchar(20);not null;default:'human'" json:"account_type"`  // human, service（服务账号只能通过 API Key 访问）
+	AuthProvider string     `gorm:"type:varchar(20);not null;default:'local'" json:"auth_provider"` // local, oidc（单点登录首次登录时创建）
+	ExternalID   *string    `gorm:"type:varchar(255);uniqueIndex" json:"-"`                         // 单点登录的身份标识 issuer|sub
 	LastLoginAt  *time.Time `gorm:"type:timestamptz" json:"last_login_at"`
 	CreatedAt    time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
 	UpdatedAt    time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
 }
 
 // UserSession 用户会话表
+// 一次登录对应一个会话（令牌族）：刷新时轮换刷新令牌，旧的刷新令牌被再次使用时撤销整个会话。
 type UserSession struct {
-	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID     uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
-	TokenHash  string    `gorm:"type:varchar(255);not null;index" json:"-"`
-	DeviceInfo JSONMap   `gorm:"type:jsonb" json:"device_info"`
-	IPAddress  string    `gorm:"type:inet" json:"ip_address"`
-	ExpiresAt  time.Time `gorm:"type:timestamptz;not null;index" json:"expires_at"`
-	CreatedAt  time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
-	User       User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	TokenHash     string     `gorm:"type:varchar(255);not null;index" json:"-"` // 当前刷新令牌的 SHA-256
+	DeviceInfo    JSONMap    `gorm:"type:jsonb" json:"device_info"`
+	IPAddress     string     `gorm:"type:inet" json:"ip_address"`
+	ExpiresAt     time.Time  `gorm:"type:timestamptz;not null;index" json:"expires_at"` // 当前刷新令牌的过期时间
+	LastUsedAt    *time.Time `gorm:"type:timestamptz" json:"last_used_at"`              // 最近一次刷新
+	RevokedAt     *time.Time `gorm:"type:timestamptz;index" json:"revoked_at"`
+	RevokedReason string     `gorm:"type:varchar(50)" json:"revoked_reason"` // logout, revoked, token_reuse, user_disabled
+	CreatedAt     time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	User          User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// APIKey API Key 表
+// 只保存密钥的 SHA-256，明文仅在创建时返回一次；Prefix 为明文开头的几个字符，便于用户辨认。
+type APIKey struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"` // 所属用户或服务账号，以其身份访问
+	Name       string         `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string         `gorm:"type:varchar(20);not null" json:"prefix"`
+	KeyHash    string         `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	Scopes     pq.StringArray `gorm:"type:text[];not null" json:"scopes"` // chat, knowledge:read, knowledge:write, tools:read, tools:execute, tools:write
+	ExpiresAt  *time.Time     `gorm:"type:timestamptz" json:"expires_at"` // 为空表示永不过期
+	LastUsedAt *time.Time     `gorm:"type:timestamptz" json:"last_used_at"`
+	LastUsedIP string         `gorm:"type:varchar(45)" json:"last_used_ip"`
+	RevokedAt  *time.Time     `gorm:"type:timestamptz;index" json:"revoked_at"`
+	CreatedBy  uuid.UUID      `gorm:"type:uuid;not null" json:"created_by"`
+	CreatedAt  time.Time      `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	User       User           `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+}
+
+// Role 角色表
+// 内置角色 admin、user、viewer 对应用户的基础角色（User.Role），自定义角色通过 RoleAssignment 分配给用户或部门。
+type Role struct {
+	ID          uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name        string         `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description string         `gorm:"type:text" json:"description"`
+	Permissions pq.StringArray `gorm:"type:text[];not null" json:"permissions"` // knowledge.write、tools.execute:<工具ID>、tools.* 等
+	BuiltIn     bool           `gorm:"not null;default:false" json:"built_in"`
+	UpdatedBy   *uuid.UUID     `gorm:"type:uuid" json:"updated_by"`
+	CreatedAt   time.Time      `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+}
+
+// RoleAssignment 角色分配表，用户的有效权限为基础角色与分配给本人、所在部门的角色的并集
+type RoleAssignment struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	RoleID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_role_assignment,priority:1" json:"role_id"`
+	SubjectType string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_role_assignment,priority:2;index:idx_role_assignment_subject,priority:1" json:"subject_type"` // user, department
+	Subject     string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_role_assignment,priority:3;index:idx_role_assignment_subject,priority:2" json:"subject"`     // 用户ID或部门名称
+	CreatedBy   uuid.UUID `gorm:"type:uuid;not null" json:"created_by"`
+	CreatedAt   time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	Role        Role      `gorm:"foreignKey:RoleID;constraint:OnDelete:CASCADE" json:"role,omitempty"`
 }
 
 // Conversation 对话会话表
@@ -83,9 +132,11 @@ type Conversation struct {
 	Status        string     `gorm:"type:varchar(20);not null;default:'active';index" json:"status"` // active, archived, deleted
 	TotalMessages int        `gorm:"not null;default:0" json:"total_messages"`
 	LastMessageAt *time.Time `gorm:"type:timestamptz;index" json:"last_message_at"`
-	CreatedAt     time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
-	UpdatedAt     time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
-	User          User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
+	// 当前分支的叶子消息：上下文与消息列表沿它回溯到根节点
+	ActiveMessageID *uuid.UUID `gorm:"type:uuid" json:"active_message_id"`
+	CreatedAt       time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+	User            User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"user,omitempty"`
 }
 
 // Message 消息表
@@ -99,7 +150,7 @@ type Message struct {
 	Metadata         JSONMap      `gorm:"type:jsonb" json:"metadata"`
 	TokenCount       *int         `gorm:"type:int" json:"token_count"`
 	ProcessingTimeMs *int         `gorm:"type:int" json:"processing_time_ms"`
-	Status           string       `gorm:"type:varchar(20);not null;default:'completed'" json:"status"` // pending, completed, failed, streaming
+	Status           string       `gorm:"type:varchar(20);not null;default:'completed'" json:"status"` // pending, completed, failed, streaming, partial, cancelled
 	ErrorMessage     string       `gorm:"type:text" json:"error_message"`
 	CreatedAt        time.Time    `gorm:"type:timestamptz;not null;default:now();index" json:"created_at"`
 	UpdatedAt        time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
@@ -152,6 +203,14 @@ type KnowledgeDocument struct {
 	UpdatedAt   time.Time         `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
 	Category    KnowledgeCategory `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
 	Author      *User             `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
+
+	// 向量化索引状态（由后台 worker 维护）
+	IndexStatus    string     `gorm:"type:varchar(20);not null;default:'pending';index" json:"index_status"` // pending, indexing, indexed, failed, skipped
+	IndexError     string     `gorm:"type:text" json:"index_error"`
+	IndexedVersion int        `gorm:"not null;default:0" json:"indexed_version"`
+	ChunkCount     int        `gorm:"not null;default:0" json:"chunk_count"`
+	IndexStartedAt *time.Time `gorm:"type:timestamptz" json:"index_started_at"`
+	IndexedAt      *time.Time `gorm:"type:timestamptz" json:"indexed_at"`
 }
 
 // KnowledgeDocumentVersion 文档版本表
@@ -171,13 +230,14 @@ type KnowledgeDocumentVersion struct {
 // KnowledgeEmbedding 知识向量表
 type KnowledgeEmbedding struct {
 	ID           uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	DocumentID   uuid.UUID         `gorm:"type:uuid;not null;index" json:"document_id"`
-	ChunkIndex   int               `gorm:"not null;uniqueIndex:idx_doc_chunk,priority:2" json:"chunk_index"`
+	DocumentID   uuid.UUID         `gorm:"type:uuid;not null;index;uniqueIndex:idx_knowledge_embedding_doc_chunk,priority:1" json:"document_id"`
+	ChunkIndex   int               `gorm:"not null;uniqueIndex:idx_knowledge_embedding_doc_chunk,priority:2" json:"chunk_index"`
 	ChunkContent string            `gorm:"type:text;not null" json:"chunk_content"`
 	ChunkSummary string            `gorm:"type:text" json:"chunk_summary"`
-	Embedding    pgvector.Vector   `gorm:"type:vector(1536)" json:"-"` // OpenAI text-embedding-ada-002的维度
+	Embedding    pgvector.Vector   `gorm:"type:vector(1536)" json:"-"` // 默认维度，启动时按 ai.embedding.dimensions 校验/调整
 	TokenCount   *int              `gorm:"type:int" json:"token_count"`
 	CreatedAt    time.Time         `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt    time.Time         `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
 	Document     KnowledgeDocument `gorm:"foreignKey:DocumentID;constraint:OnDelete:CASCADE" json:"document,omitempty"`
 }
 
@@ -206,8 +266,12 @@ type ToolExecution struct {
 	InputParams     JSONMap    `gorm:"type:jsonb;not null" json:"input_params"`
 	OutputResult    JSONMap    `gorm:"type:jsonb" json:"output_result"`
 	ExecutionTimeMs *int       `gorm:"type:int" json:"execution_time_ms"`
-	Status          string     `gorm:"type:varchar(20);not null;index" json:"status"` // pending, success, failed, timeout
+	Status          string     `gorm:"type:varchar(20);not null;index" json:"status"` // pending, awaiting_approval, rejected, success, failed, timeout
 	ErrorMessage    string     `gorm:"type:text" json:"error_message"`
+	ApprovalStatus  string     `gorm:"type:varchar(20);index" json:"approval_status"` // 空表示无需审批；pending, approved, rejected, expired
+	ApprovedBy      *uuid.UUID `gorm:"type:uuid" json:"approved_by"`                  // 审批人（批准或拒绝）
+	ApprovedAt      *time.Time `gorm:"type:timestamptz" json:"approved_at"`
+	ApprovalComment string     `gorm:"type:text" json:"approval_comment"`
 	CreatedAt       time.Time  `gorm:"type:timestamptz;not null;default:now();index" json:"created_at"`
 	Tool            Tool       `gorm:"foreignKey:ToolID" json:"tool,omitempty"`
 	Message         *Message   `gorm:"foreignKey:MessageID" json:"message,omitempty"`
@@ -230,27 +294,62 @@ type SystemConfig struct {
 
 // AuditLog 审计日志表
 type AuditLog struct {
-	ID           uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID       *uuid.UUID             `gorm:"type:uuid;index" json:"user_id"`
-	Action       string                 `gorm:"type:varchar(100);not null;index" json:"action"`       // create, update, delete, login, etc.
-	ResourceType string                 `gorm:"type:varchar(50);not null;index" json:"resource_type"` // user, document, tool, etc.
-	ResourceID   *uuid.UUID             `gorm:"type:uuid;index" json:"resource_id"`
-	OldValues    map[string]interface{} `gorm:"type:jsonb" json:"old_values"`
-	NewValues    map[string]interface{} `gorm:"type:jsonb" json:"new_values"`
-	IPAddress    string                 `gorm:"type:inet" json:"ip_address"`
-	UserAgent    string                 `gorm:"type:text" json:"user_agent"`
-	CreatedAt    time.Time              `gorm:"type:timestamptz;not null;default:now();index" json:"created_at"`
-	User         *User                  `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID       *uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Action       string     `gorm:"type:varchar(100);not null;index" json:"action"`       // create, update, delete, login, etc.
+	ResourceType string     `gorm:"type:varchar(50);not null;index" json:"resource_type"` // user, document, tool, etc.
+	ResourceID   *uuid.UUID `gorm:"type:uuid;index" json:"resource_id"`
+	OldValues    JSONMap    `gorm:"type:jsonb" json:"old_values"` // 更新前变化的列，删除前的整行
+	NewValues    JSONMap    `gorm:"type:jsonb" json:"new_values"` // 更新后变化的列，新增的整行
+	IPAddress    *string    `gorm:"type:inet" json:"ip_address"`  // 系统操作为空
+	UserAgent    string     `gorm:"type:text" json:"user_agent"`
+	CreatedAt    time.Time  `gorm:"type:timestamptz;not null;default:now();index" json:"created_at"`
+	User         *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
 // UsageStatistic 使用统计表
+// 按天汇总的指标，同一天同一指标按 DimensionKey（维度的摘要）区分，如按用户、部门与模型汇总的 token 用量。
 type UsageStatistic struct {
-	ID          uuid.UUID              `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Date        time.Time              `gorm:"type:date;not null;uniqueIndex:idx_date_type,priority:1" json:"date"`
-	MetricType  string                 `gorm:"type:varchar(50);not null;index;uniqueIndex:idx_date_type,priority:2" json:"metric_type"` // daily_active_users, message_count, etc.
-	MetricValue int64                  `gorm:"type:bigint;not null" json:"metric_value"`
-	Dimensions  map[string]interface{} `gorm:"type:jsonb" json:"dimensions"`
-	CreatedAt   time.Time              `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Date         time.Time `gorm:"type:date;not null;uniqueIndex:idx_usage_statistic_dimension,priority:1" json:"date"`
+	MetricType   string    `gorm:"type:varchar(50);not null;index;uniqueIndex:idx_usage_statistic_dimension,priority:2" json:"metric_type"` // daily_active_users, message_count, llm_prompt_tokens, etc.
+	DimensionKey string    `gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_usage_statistic_dimension,priority:3" json:"dimension_key"`
+	MetricValue  int64     `gorm:"type:bigint;not null" json:"metric_value"`
+	Dimensions   JSONMap   `gorm:"type:jsonb" json:"dimensions"`
+	CreatedAt    time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+}
+
+// LLMUsage 模型调用用量明细，每次调用一条
+type LLMUsage struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID           *uuid.UUID `gorm:"type:uuid;index:idx_llm_usage_user_time,priority:1" json:"user_id"` // 系统任务为空
+	Department       string     `gorm:"type:varchar(50);index:idx_llm_usage_department_time,priority:1" json:"department"`
+	ConversationID   *uuid.UUID `gorm:"type:uuid;index" json:"conversation_id"`
+	MessageID        *uuid.UUID `gorm:"type:uuid" json:"message_id"`
+	Purpose          string     `gorm:"type:varchar(20);not null" json:"purpose"` // answer, planning, summary, title, chat
+	Profile          string     `gorm:"type:varchar(100)" json:"profile"`
+	Model            string     `gorm:"type:varchar(100);not null" json:"model"`
+	PromptTokens     int        `gorm:"not null;default:0" json:"prompt_tokens"`
+	CompletionTokens int        `gorm:"not null;default:0" json:"completion_tokens"`
+	TotalTokens      int        `gorm:"not null;default:0" json:"total_tokens"`
+	Estimated        bool       `gorm:"not null;default:false" json:"estimated"` // 模型未返回用量时按文本估算
+	CreatedAt        time.Time  `gorm:"type:timestamptz;not null;default:now();index;index:idx_llm_usage_user_time,priority:2;index:idx_llm_usage_department_time,priority:2" json:"created_at"`
+}
+
+// UsageQuota token 配额
+type UsageQuota struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Scope          string     `gorm:"type:varchar(20);not null;uniqueIndex:idx_usage_quota_subject,priority:1" json:"scope"`    // user, department
+	Subject        string     `gorm:"type:varchar(100);not null;uniqueIndex:idx_usage_quota_subject,priority:2" json:"subject"` // 用户ID或部门名称
+	Period         string     `gorm:"type:varchar(20);not null;uniqueIndex:idx_usage_quota_subject,priority:3" json:"period"`   // daily, monthly
+	TokenLimit     int64      `gorm:"type:bigint;not null" json:"token_limit"`
+	Action         string     `gorm:"type:varchar(20);not null;default:'reject'" json:"action"` // reject, degrade
+	DegradeProfile string     `gorm:"type:varchar(100)" json:"degrade_profile"`                 // action 为 degrade 时改用的模型配置
+	Enabled        bool       `gorm:"not null;default:true" json:"enabled"`
+	Description    string     `gorm:"type:text" json:"description"`
+	UpdatedBy      *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+	CreatedAt      time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
 }
 
 // BeforeCreate hook for User
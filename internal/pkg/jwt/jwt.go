@@ -1,6 +1,8 @@
 package jwt
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -16,18 +18,22 @@ type Claims struct {
 	Role       string    `json:"role"`
 	Department string    `json:"department"`
 	TokenType  string    `json:"tokenType"` // access, refresh
+	SessionID  uuid.UUID `json:"sid"`       // 所属会话（同一次登录的令牌族）
 	jwt.RegisteredClaims
 }
 
 type TokenPair struct {
-	AccessToken  string `json:"accessToken"`
-	RefreshToken string `json:"refreshToken"`
-	ExpiresIn    int64  `json:"expiresIn"`
+	AccessToken      string    `json:"accessToken"`
+	RefreshToken     string    `json:"refreshToken"`
+	ExpiresIn        int64     `json:"expiresIn"`
+	RefreshExpiresAt time.Time `json:"-"`
 }
 
-func GenerateTokenPair(userID uuid.UUID, username, role, department string) (*TokenPair, error) {
+// GenerateTokenPair 为会话 sessionID 签发访问令牌与刷新令牌，每个令牌带唯一的 jti
+func GenerateTokenPair(userID uuid.UUID, username, role, department string, sessionID uuid.UUID) (*TokenPair, error) {
 	cfg := config.GlobalConfig.JWT
 	now := time.Now()
+	refreshExpiresAt := now.Add(time.Duration(cfg.RefreshIn) * time.Hour)
 
 	// 生成访问令牌
 	accessClaims := Claims{
@@ -36,7 +42,9 @@ func GenerateTokenPair(userID uuid.UUID, username, role, department string) (*To
 		Role:       role,
 		Department: department,
 		TokenType:  "access",
+		SessionID:  sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			Issuer:    cfg.Issuer,
 			Subject:   userID.String(),
 			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(cfg.ExpiresIn) * time.Hour)),
@@ -58,10 +66,12 @@ func GenerateTokenPair(userID uuid.UUID, username, role, department string) (*To
 		Role:       role,
 		Department: department,
 		TokenType:  "refresh",
+		SessionID:  sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			Issuer:    cfg.Issuer,
 			Subject:   userID.String(),
-			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(cfg.RefreshIn) * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(refreshExpiresAt),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 		},
@@ -74,9 +84,10 @@ func GenerateTokenPair(userID uuid.UUID, username, role, department string) (*To
 	}
 
 	return &TokenPair{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
-		ExpiresIn:    int64(cfg.ExpiresIn * 3600), // 转换为秒
+		AccessToken:      accessTokenString,
+		RefreshToken:     refreshTokenString,
+		ExpiresIn:        int64(cfg.ExpiresIn * 3600), // 转换为秒
+		RefreshExpiresAt: refreshExpiresAt,
 	}, nil
 }
 
@@ -102,16 +113,8 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-func RefreshAccessToken(refreshTokenString string) (*TokenPair, error) {
-	claims, err := ValidateToken(refreshTokenString)
-	if err != nil {
-		return nil, fmt.Errorf("invalid refresh token: %w", err)
-	}
-
-	if claims.TokenType != "refresh" {
-		return nil, fmt.Errorf("token is not a refresh token")
-	}
-
-	// 生成新的令牌对
-	return GenerateTokenPair(claims.UserID, claims.Username, claims.Role, claims.Department)
+// HashToken 令牌的 SHA-256 摘要，数据库中只保存摘要
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,277 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/liusCraft/orion/internal/config"
+)
+
+// mockProvider 本地模拟的 OIDC 身份提供方
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu        sync.Mutex
+	key       *rsa.PrivateKey
+	kid       string
+	challenge string        // 授权请求中的 code_challenge
+	claims    jwt.MapClaims // 换取令牌时签发的 ID Token 声明
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	m := &mockProvider{t: t, key: newKey(t), kid: "key-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": m.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		id, secret, _ := r.BasicAuth()
+		m.mu.Lock()
+		challenge := m.challenge
+		m.mu.Unlock()
+		switch {
+		case id != "orion" || secret != "s3cret":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		case r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("code") != "good-code" ||
+			Challenge(r.Form.Get("code_verifier")) != challenge:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad code or verifier"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     m.sign(m.claims),
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) sign(claims jwt.MapClaims) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return signToken(m.t, claims, m.key, m.kid)
+}
+
+func (m *mockProvider) rotate(kid string) {
+	key := newKey(m.t)
+	m.mu.Lock()
+	m.key, m.kid = key, kid
+	m.mu.Unlock()
+}
+
+func newKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signToken(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newTestProvider(m *mockProvider, now *time.Time) *Provider {
+	p := New(config.OIDCConfig{
+		Issuer:       m.server.URL,
+		ClientID:     "orion",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://orion.example.com/api/v1/auth/oidc/callback",
+		Scopes:       []string{"profile", "email"},
+	})
+	p.now = func() time.Time { return *now }
+	return p
+}
+
+func idClaims(issuer string, now time.Time, nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                issuer,
+		"sub":                "u-123",
+		"aud":                "orion",
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              nonce,
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"name":               "Alice",
+		"preferred_username": "alice",
+		"groups":             []string{"sre"},
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	m := newMockProvider(t)
+	now := time.Now()
+	p := newTestProvider(m, &now)
+	ctx := context.Background()
+
+	verifier, _ := RandomString()
+	authURL, err := p.AuthCodeURL(ctx, "st", "nc", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("response_type") != "code" || q.Get("client_id") != "orion" ||
+		q.Get("state") != "st" || q.Get("nonce") != "nc" || q.Get("scope") != "openid profile email" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != Challenge(verifier) ||
+		q.Get("redirect_uri") != "https://orion.example.com/api/v1/auth/oidc/callback" {
+		t.Fatalf("unexpected authorization url: %s", authURL)
+	}
+	m.challenge = q.Get("code_challenge")
+	m.claims = idClaims(m.server.URL, now, "nc")
+
+	// code_verifier 不匹配时 IdP 拒绝换取令牌
+	if _, err := p.Exchange(ctx, "good-code", "wrong-verifier"); !errors.Is(err, ErrExchange) || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("exchange with a wrong verifier should fail: %v", err)
+	}
+
+	token, err := p.Exchange(ctx, "good-code", verifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	id, err := p.Verify(ctx, token.IDToken, "nc")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if id.Subject != "u-123" || id.Email != "alice@example.com" || !id.EmailVerified || id.Name != "Alice" || id.Claims["preferred_username"] != "alice" {
+		t.Errorf("unexpected id token: %+v", id)
+	}
+
+	if _, err := p.Verify(ctx, token.IDToken, "other"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("nonce mismatch should be rejected: %v", err)
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	m := newMockProvider(t)
+	now := time.Now()
+	p := newTestProvider(m, &now)
+	ctx := context.Background()
+	valid := func() jwt.MapClaims { return idClaims(m.server.URL, now, "nc") }
+
+	if _, err := p.Verify(ctx, m.sign(valid()), "nc"); err != nil {
+		t.Fatalf("valid token should pass: %v", err)
+	}
+
+	hs256, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, valid()).SignedString([]byte("s3cret"))
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	cases := map[string]string{
+		"wrong audience": m.sign(func() jwt.MapClaims { c := valid(); c["aud"] = "other-client"; return c }()),
+		"wrong issuer":   m.sign(func() jwt.MapClaims { c := valid(); c["iss"] = "https://evil.example.com"; return c }()),
+		"expired":        m.sign(func() jwt.MapClaims { c := valid(); c["exp"] = now.Add(-2 * clockSkew).Unix(); return c }()),
+		"no expiry":      m.sign(func() jwt.MapClaims { c := valid(); delete(c, "exp"); return c }()),
+		"azp mismatch": m.sign(func() jwt.MapClaims {
+			c := valid()
+			c["aud"] = []string{"orion", "other"}
+			c["azp"] = "other"
+			return c
+		}()),
+		"no subject":  m.sign(func() jwt.MapClaims { c := valid(); delete(c, "sub"); return c }()),
+		"unknown key": signToken(t, valid(), newKey(t), "key-1"),
+		"hs256":       hs256,
+		"alg none":    none,
+	}
+	for name, token := range cases {
+		if _, err := p.Verify(ctx, token, "nc"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: should be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	now := time.Now()
+	p := newTestProvider(m, &now)
+	ctx := context.Background()
+
+	if _, err := p.Verify(ctx, m.sign(idClaims(m.server.URL, now, "nc")), "nc"); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// IdP 轮换密钥后，遇到未知 kid 重新获取 JWKS（有最小间隔）
+	m.rotate("key-2")
+	if _, err := p.Verify(ctx, m.sign(idClaims(m.server.URL, now, "nc")), "nc"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("jwks should not be refetched within the refresh interval: %v", err)
+	}
+	now = now.Add(keysRefreshInterval)
+	if _, err := p.Verify(ctx, m.sign(idClaims(m.server.URL, now, "nc")), "nc"); err != nil {
+		t.Errorf("rotated key should be fetched: %v", err)
+	}
+}
+
+func TestLoginState(t *testing.T) {
+	secret := []byte("jwt-secret")
+	now := time.Now()
+	st := LoginState{State: "s", Nonce: "n", Verifier: "v", Redirect: "/chat", Expires: now.Add(10 * time.Minute).Unix()}
+
+	sealed, err := SealState(st, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := OpenState(sealed, secret, now)
+	if err != nil || got != st {
+		t.Fatalf("state should round trip: %+v, %v", got, err)
+	}
+
+	if _, err := OpenState(sealed, []byte("other"), now); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("state signed with another secret should be rejected: %v", err)
+	}
+	tampered := LoginState{State: "s", Nonce: "n", Verifier: "attacker", Expires: st.Expires}
+	forged, _ := SealState(tampered, []byte("other"))
+	payload, _, _ := strings.Cut(forged, ".")
+	_, sig, _ := strings.Cut(sealed, ".")
+	if _, err := OpenState(payload+"."+sig, secret, now); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("tampered state should be rejected: %v", err)
+	}
+	if _, err := OpenState(sealed, secret, now.Add(10*time.Minute)); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("expired state should be rejected: %v", err)
+	}
+}
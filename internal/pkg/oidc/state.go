@@ -0,0 +1,75 @@
+package oidc
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidState = errors.New("invalid or expired login state")
+
+// LoginState 发起登录到回调之间需要保留的数据，签名后存放在 Cookie 中
+type LoginState struct {
+	State    string `json:"s"`           // 与回调参数 state 比对，防止登录 CSRF
+	Nonce    string `json:"n"`           // 与 ID Token 的 nonce 比对，防止重放
+	Verifier string `json:"v"`           // PKCE code_verifier
+	Redirect string `json:"r,omitempty"` // 登录后返回的前端路径
+	Expires  int64  `json:"e"`
+}
+
+// RandomString 32 字节随机数的 base64url 编码，用作 state、nonce 与 code_verifier
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge PKCE S256 的 code_challenge（RFC 7636 4.2）
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// SealState 以 HMAC-SHA256 签名登录状态，Cookie 只做防篡改，不加密
+func SealState(st LoginState, secret []byte) (string, error) {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(encoded, secret), nil
+}
+
+// OpenState 校验签名与有效期并还原登录状态
+func OpenState(value string, secret []byte, now time.Time) (LoginState, error) {
+	var st LoginState
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(encoded, secret))) {
+		return st, ErrInvalidState
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return st, ErrInvalidState
+	}
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return st, ErrInvalidState
+	}
+	if now.Unix() >= st.Expires {
+		return st, ErrInvalidState
+	}
+	return st, nil
+}
+
+// sign 加上用途前缀，与同一密钥签发的 JWT 互不通用
+func sign(data string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("oidc-state:" + data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 内存桶的清理间隔：已装满的桶与新建的桶等价，可以丢弃
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // 在此之后桶已装满
+}
+
+// Memory 进程内的令牌桶，只在单实例内生效
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemory 创建内存限流
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow 从 key 对应的桶中取一个令牌
+func (m *Memory) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		for k, b := range m.buckets {
+			if now.After(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	tokens, allowed := take(b.tokens, now.Sub(b.updated), rule)
+	b.tokens, b.updated = tokens, now
+	res := result(tokens, allowed, rule)
+	b.full = now.Add(res.ResetAfter)
+	return res, nil
+}
+
+// Close 无需释放资源
+func (m *Memory) Close() error {
+	return nil
+}
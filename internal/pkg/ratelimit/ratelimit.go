@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+)
+
+// Rule 令牌桶参数
+type Rule struct {
+	Rate  float64 // 每秒补充的令牌数
+	Burst int     // 桶容量
+}
+
+// Result 一次取令牌的结果
+type Result struct {
+	Allowed    bool
+	Limit      int           // 桶容量
+	Remaining  int           // 剩余令牌数（向下取整）
+	RetryAfter time.Duration // 被拒绝时到下一个令牌可用的时间
+	ResetAfter time.Duration // 桶重新装满的时间
+}
+
+// Limiter 令牌桶限流，key 区分不同的桶
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+	Close() error
+}
+
+// New 配置了 Redis 且可连接时使用 Redis（多实例共享限额），否则使用进程内存
+func New(cfg config.RedisConfig) Limiter {
+	if cfg.Host == "" {
+		return NewMemory()
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		logger.Warn("Redis 不可用，限流仅在本实例内生效: %v", err)
+		client.Close()
+		return NewMemory()
+	}
+	return NewRedis(client)
+}
+
+// take 按经过的时间补充令牌后尝试取一个，返回剩余令牌数与是否成功
+func take(tokens float64, elapsed time.Duration, rule Rule) (float64, bool) {
+	tokens = math.Min(float64(rule.Burst), tokens+elapsed.Seconds()*rule.Rate)
+	if tokens >= 1 {
+		return tokens - 1, true
+	}
+	return tokens, false
+}
+
+// result 由剩余令牌数得到结果
+func result(tokens float64, allowed bool, rule Rule) Result {
+	r := Result{
+		Allowed:    allowed,
+		Limit:      rule.Burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: seconds((float64(rule.Burst) - tokens) / rule.Rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / rule.Rate)
+	}
+	return r
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
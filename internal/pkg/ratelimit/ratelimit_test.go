@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenBucket(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	rule := Rule{Rate: 1, Burst: 3} // 每秒 1 个，最多 3 个
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		res, _ := m.Allow(ctx, "user:a", rule)
+		if !res.Allowed || res.Remaining != 2-i || res.Limit != 3 {
+			t.Fatalf("request %d should use the burst: %+v", i, res)
+		}
+	}
+	res, _ := m.Allow(ctx, "user:a", rule)
+	if res.Allowed || res.RetryAfter != time.Second || res.ResetAfter != 3*time.Second {
+		t.Fatalf("empty bucket should reject: %+v", res)
+	}
+
+	// 其它 key 使用独立的桶
+	if res, _ := m.Allow(ctx, "user:b", rule); !res.Allowed {
+		t.Errorf("buckets should be independent")
+	}
+
+	// 半秒后仍不足一个令牌，再过半秒补充一个
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := m.Allow(ctx, "user:a", rule); res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("partial token should not be enough: %+v", res)
+	}
+	now = now.Add(500 * time.Millisecond)
+	if res, _ := m.Allow(ctx, "user:a", rule); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("refilled token should be allowed: %+v", res)
+	}
+
+	// 补充不超过桶容量；已装满的桶在清理时被丢弃
+	now = now.Add(time.Hour)
+	if res, _ := m.Allow(ctx, "user:a", rule); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("bucket should be capped at burst: %+v", res)
+	}
+	if _, ok := m.buckets["user:b"]; ok {
+		t.Errorf("full buckets should be swept")
+	}
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/liusCraft/orion/internal/pkg/logger"
+)
+
+// tokenBucketScript 原子地补充并取令牌，时间取 Redis 服务器时钟，避免实例间时钟偏差
+// 返回 {是否成功, 剩余令牌数}；剩余令牌数为小数，以字符串返回以免被截断。
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// Redis 多实例共享的令牌桶；Redis 出错时退回本实例内存限流，不阻断请求
+type Redis struct {
+	client *redis.Client
+	local  *Memory
+	failed atomic.Bool // 已记录过 Redis 故障，恢复前不重复告警
+}
+
+// NewRedis 创建 Redis 限流
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client, local: NewMemory()}
+}
+
+// Allow 从 key 对应的桶中取一个令牌
+func (r *Redis) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	res, err := r.allow(ctx, key, rule)
+	if err != nil {
+		if !r.failed.Swap(true) {
+			logger.Warn("Redis 限流失败，改用本实例内存限流: %v", err)
+		}
+		return r.local.Allow(ctx, key, rule)
+	}
+	if r.failed.Swap(false) {
+		logger.Info("Redis 限流已恢复")
+	}
+	return res, nil
+}
+
+func (r *Redis) allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	vals, err := tokenBucketScript.Run(ctx, r.client, []string{key}, rule.Rate, rule.Burst).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(vals) != 2 {
+		return Result{}, fmt.Errorf("unexpected script result: %v", vals)
+	}
+	allowed, _ := vals[0].(int64)
+	s, _ := vals[1].(string)
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("parse tokens %q: %w", s, err)
+	}
+	return result(tokens, allowed == 1, rule), nil
+}
+
+// Close 关闭 Redis 连接
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
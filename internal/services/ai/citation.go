@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// 引用来源类型
+const (
+	CitationTypeKnowledge = "knowledge"
+	CitationTypeTool      = "tool"
+)
+
+// Citation 回答中可引用的来源，Index 即回答中的 [n] 编号
+type Citation struct {
+	Index           int        `json:"index"`
+	Type            string     `json:"type"`
+	DocumentID      *uuid.UUID `json:"documentId,omitempty"`
+	DocumentTitle   string     `json:"documentTitle,omitempty"`
+	ChunkIndex      *int       `json:"chunkIndex,omitempty"`
+	ToolExecutionID *uuid.UUID `json:"toolExecutionId,omitempty"`
+	ToolName        string     `json:"toolName,omitempty"`
+}
+
+// CitationSources 按加入顺序为来源编号（从1开始）
+type CitationSources struct {
+	items []Citation
+}
+
+// AddKnowledge 登记知识库分块，返回编号
+func (s *CitationSources) AddKnowledge(documentID uuid.UUID, title string, chunkIndex int) int {
+	idx := len(s.items) + 1
+	s.items = append(s.items, Citation{
+		Index:         idx,
+		Type:          CitationTypeKnowledge,
+		DocumentID:    &documentID,
+		DocumentTitle: title,
+		ChunkIndex:    &chunkIndex,
+	})
+	return idx
+}
+
+// AddTool 登记工具调用结果，返回编号；未关联执行记录时 executionID 为nil
+func (s *CitationSources) AddTool(executionID *uuid.UUID, toolName string) int {
+	idx := len(s.items) + 1
+	s.items = append(s.items, Citation{
+		Index:           idx,
+		Type:            CitationTypeTool,
+		ToolExecutionID: executionID,
+		ToolName:        toolName,
+	})
+	return idx
+}
+
+// Len 来源数量
+func (s *CitationSources) Len() int {
+	return len(s.items)
+}
+
+// Prompt 生成引用要求的系统提示，列出全部可用编号
+func (s *CitationSources) Prompt() string {
+	var b strings.Builder
+	b.WriteString("回答中凡是依据以下来源得出的内容，请在对应语句末尾用方括号标注来源编号，如 [1] 或 [1][3]；")
+	b.WriteString("只能使用下列编号，不要编造编号，未依据任何来源的内容无需标注。\n")
+	for _, c := range s.items {
+		switch c.Type {
+		case CitationTypeKnowledge:
+			fmt.Fprintf(&b, "[%d] 知识库《%s》\n", c.Index, c.DocumentTitle)
+		case CitationTypeTool:
+			fmt.Fprintf(&b, "[%d] 工具 %s 的调用结果\n", c.Index, c.ToolName)
+		}
+	}
+	return b.String()
+}
+
+// citationMarker 匹配 [1]、[1,2]、[1, 3] 以及全角【1】
+var citationMarker = regexp.MustCompile(`[\[【](\d+(?:\s*[,，、]\s*\d+)*)[\]】]`)
+
+// Extract 解析回答中的引用标记，返回实际被引用的来源（按首次出现顺序去重，忽略无效编号）
+func (s *CitationSources) Extract(content string) []Citation {
+	var cited []Citation
+	seen := make(map[int]bool)
+	for _, m := range citationMarker.FindAllStringSubmatch(content, -1) {
+		for _, part := range strings.FieldsFunc(m[1], func(r rune) bool {
+			return r == ',' || r == '，' || r == '、' || r == ' '
+		}) {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 1 || n > len(s.items) || seen[n] {
+				continue
+			}
+			seen[n] = true
+			cited = append(cited, s.items[n-1])
+		}
+	}
+	return cited
+}
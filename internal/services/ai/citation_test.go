@@ -0,0 +1,45 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCitationSources(t *testing.T) {
+	sources := &CitationSources{}
+	docID := uuid.New()
+	execID := uuid.New()
+	if idx := sources.AddKnowledge(docID, "回源排查手册", 2); idx != 1 {
+		t.Fatalf("unexpected index: %d", idx)
+	}
+	sources.AddKnowledge(docID, "回源排查手册", 5)
+	if idx := sources.AddTool(&execID, "prometheus__query"); idx != 3 {
+		t.Fatalf("unexpected index: %d", idx)
+	}
+
+	prompt := sources.Prompt()
+	if !strings.Contains(prompt, "[1] 知识库《回源排查手册》") || !strings.Contains(prompt, "[3] 工具 prometheus__query") {
+		t.Fatalf("prompt should list all sources: %s", prompt)
+	}
+
+	answer := "先检查回源地址 [3]，再按手册调整超时【1】。参考 [3][1, 2]，忽略无效编号 [9] 与年份 [2024]。"
+	cited := sources.Extract(answer)
+	if len(cited) != 3 {
+		t.Fatalf("expected 3 citations, got %+v", cited)
+	}
+	if cited[0].Index != 3 || cited[0].Type != CitationTypeTool || *cited[0].ToolExecutionID != execID {
+		t.Fatalf("first citation should be the tool result: %+v", cited[0])
+	}
+	if cited[1].Index != 1 || *cited[1].DocumentID != docID || *cited[1].ChunkIndex != 2 {
+		t.Fatalf("second citation should be the first chunk: %+v", cited[1])
+	}
+	if cited[2].Index != 2 || *cited[2].ChunkIndex != 5 {
+		t.Fatalf("third citation should be the second chunk: %+v", cited[2])
+	}
+
+	if got := (&CitationSources{}).Extract("没有来源 [1]"); len(got) != 0 {
+		t.Fatalf("no sources should yield no citations: %+v", got)
+	}
+}
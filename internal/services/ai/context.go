@@ -0,0 +1,205 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/config"
+	dbmodels "github.com/liusCraft/orion/internal/database/models"
+)
+
+// 上下文组装默认值
+const (
+	defaultContextWindow  = 200000
+	defaultReserveTokens  = 8000
+	defaultMemoryLength   = 50
+	summaryMaxTokens      = 1024 // 摘要的生成上限，同时作为摘要在预算中的占用
+	messageOverheadTokens = 4    // 每条消息的角色与分隔开销
+)
+
+// SummaryContextKey 摘要在 Conversation.Context 中的键
+const SummaryContextKey = "summary"
+
+// ContextOptions 上下文组装参数
+type ContextOptions struct {
+	ContextWindow int  // 模型上下文窗口（token）
+	AnswerTokens  int  // 为回答预留
+	ReserveTokens int  // 为工具定义、工具结果与知识库预留
+	MemoryEnabled bool // 关闭时只保留当前问题
+	MemoryLength  int  // 原文保留的最多历史消息数
+}
+
+// ConversationSummary 滚动摘要：早期消息被压缩为摘要，保存在 Conversation.Context["summary"]
+type ConversationSummary struct {
+	Text             string    `json:"text"`
+	ThroughMessageID uuid.UUID `json:"throughMessageId"` // 摘要覆盖到的最后一条消息（含）
+	MessageCount     int       `json:"messageCount"`     // 摘要累计覆盖的消息数
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// ContextPlan 上下文组装计划
+type ContextPlan struct {
+	Summary   *ConversationSummary // 仍然有效的已有摘要，nil 表示没有
+	Summarize []dbmodels.Message   // 超出预算、需要并入摘要的消息（按时间顺序）
+	Kept      []dbmodels.Message   // 原文保留的消息
+}
+
+// ContextOptions 由模型配置与 Agent 配置得到上下文组装参数
+func (s *AIService) ContextOptions(agent config.AgentConfig) ContextOptions {
+	return ContextOptions{
+		ContextWindow: s.config.ContextWindow,
+		AnswerTokens:  s.config.MaxTokens,
+		ReserveTokens: agent.ContextReserveTokens,
+		MemoryEnabled: agent.MemoryEnabled,
+		MemoryLength:  agent.MemoryLength,
+	}
+}
+
+// SystemPrompt 当前配置的系统提示词
+func (s *AIService) SystemPrompt() string {
+	return s.config.SystemPrompt
+}
+
+// EstimateTokens 粗略估算文本的 token 数
+// 中日韩字符按每字 1 个 token，其它字符按每 4 字节 1 个 token。
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other += len(string(r))
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// estimateMessage 单条消息的 token 估算（含开销）
+func estimateMessage(m dbmodels.Message) int {
+	return EstimateTokens(m.Content) + messageOverheadTokens
+}
+
+// PlanContext 按 token 预算决定历史消息的去留
+// 预算 = 上下文窗口 - 回答预留 - 工具预留 - fixedTokens（系统提示词等）。已有摘要覆盖的消息不再计入；
+// 剩余消息从最新往前保留，超出预算或 MemoryLength 的较早消息交由调用方并入摘要，而不是直接丢弃。
+// 摘要所覆盖的消息不在 history 中（如切换了分支）时，已有摘要失效。
+func PlanContext(history []dbmodels.Message, summary *ConversationSummary, fixedTokens int, opts ContextOptions) ContextPlan {
+	if len(history) == 0 {
+		return ContextPlan{}
+	}
+	if !opts.MemoryEnabled {
+		return ContextPlan{Kept: history[len(history)-1:]}
+	}
+	window := opts.ContextWindow
+	if window <= 0 {
+		window = defaultContextWindow
+	}
+	reserve := opts.ReserveTokens
+	if reserve <= 0 {
+		reserve = defaultReserveTokens
+	}
+	memoryLength := opts.MemoryLength
+	if memoryLength <= 0 {
+		memoryLength = defaultMemoryLength
+	}
+
+	plan := ContextPlan{}
+	remaining := history
+	if summary != nil && summary.Text != "" {
+		for i, m := range history {
+			if m.ID == summary.ThroughMessageID {
+				plan.Summary = summary
+				remaining = history[i+1:]
+				break
+			}
+		}
+	}
+
+	budget := window - opts.AnswerTokens - reserve - fixedTokens
+	total := 0
+	for _, m := range remaining {
+		total += estimateMessage(m)
+	}
+	if plan.Summary == nil && total <= budget && len(remaining) <= memoryLength {
+		plan.Kept = remaining
+		return plan
+	}
+	// 需要摘要（或已有摘要）时为其预留空间
+	budget -= summaryMaxTokens
+
+	cut := len(remaining)
+	used := 0
+	for cut > 0 {
+		cost := estimateMessage(remaining[cut-1])
+		if cut < len(remaining) && (used+cost > budget || len(remaining)-cut >= memoryLength) {
+			break
+		}
+		used += cost
+		cut--
+	}
+	// 保留部分不以 AI 回答开头，避免回答脱离对应的问题
+	for cut < len(remaining)-1 && remaining[cut].SenderType != "user" {
+		cut++
+	}
+	plan.Summarize = remaining[:cut]
+	plan.Kept = remaining[cut:]
+	return plan
+}
+
+// SummaryFromContext 读取 Conversation.Context 中保存的摘要
+func SummaryFromContext(ctx map[string]interface{}) *ConversationSummary {
+	raw, ok := ctx[SummaryContextKey]
+	if !ok || raw == nil {
+		return nil
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var summary ConversationSummary
+	if err := json.Unmarshal(b, &summary); err != nil || summary.Text == "" {
+		return nil
+	}
+	return &summary
+}
+
+// Summarize 将较早的消息并入滚动摘要
+func (s *AIService) Summarize(ctx context.Context, previous string, messages []dbmodels.Message) (string, error) {
+	var b strings.Builder
+	if previous != "" {
+		b.WriteString("已有摘要：\n")
+		b.WriteString(previous)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("需要并入摘要的对话：\n")
+	for _, m := range messages {
+		role := "用户"
+		if m.SenderType == "ai" {
+			role = "助手"
+		}
+		fmt.Fprintf(&b, "[%s] %s\n", role, m.Content)
+	}
+
+	sys := "你是对话摘要助手。请将已有摘要与新的对话内容合并为一份新的摘要，供后续对话作为背景。要求：" +
+		"保留用户确认过的事实、排查结论、已执行的操作及结果、关键标识（主机名、域名、IP、告警名、工单号、时间点等）和未解决的问题；" +
+		"删除寒暄与重复内容；使用简洁的中文要点；只输出摘要本身。"
+	maxTokens := summaryMaxTokens
+	resp, err := s.Chat(ctx, []ChatMessage{
+		{Role: "system", Content: sys},
+		{Role: "user", Content: b.String()},
+	}, &GenerateOptions{MaxTokens: &maxTokens})
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(resp.Content)
+	if text == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return text, nil
+}
@@ -0,0 +1,84 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	dbmodels "github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	if got := EstimateTokens("你好世界"); got != 4 {
+		t.Errorf("CJK characters should count one token each, got %d", got)
+	}
+	if got := EstimateTokens("abcdefgh"); got != 2 {
+		t.Errorf("latin text should count four bytes per token, got %d", got)
+	}
+	if got := EstimateTokens(""); got != 0 {
+		t.Errorf("empty text should be zero, got %d", got)
+	}
+}
+
+func TestPlanContext(t *testing.T) {
+	base := time.Now()
+	var history []dbmodels.Message
+	for i := 0; i < 11; i++ {
+		sender := "user"
+		if i%2 == 1 {
+			sender = "ai"
+		}
+		history = append(history, dbmodels.Message{
+			ID:         uuid.New(),
+			SenderType: sender,
+			Content:    strings.Repeat("字", 500),
+			CreatedAt:  base.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	// 预算充足：全部保留
+	opts := ContextOptions{ContextWindow: 100000, ReserveTokens: 100, MemoryEnabled: true, MemoryLength: 50}
+	plan := PlanContext(history, nil, 0, opts)
+	if len(plan.Kept) != 11 || len(plan.Summarize) != 0 {
+		t.Fatalf("everything should fit: kept=%d summarize=%d", len(plan.Kept), len(plan.Summarize))
+	}
+
+	// 超出预算：较早的消息交由摘要，保留部分以用户消息开头
+	opts.ContextWindow = 100 + summaryMaxTokens + 1600
+	plan = PlanContext(history, nil, 0, opts)
+	if len(plan.Kept) != 3 || len(plan.Summarize) != 8 {
+		t.Fatalf("older messages should be summarized: kept=%d summarize=%d", len(plan.Kept), len(plan.Summarize))
+	}
+	if plan.Kept[0].SenderType != "user" {
+		t.Errorf("kept history should start with a user message")
+	}
+
+	// 已有摘要覆盖的消息不再计入
+	summary := &ConversationSummary{Text: "早期结论", ThroughMessageID: history[5].ID}
+	opts.ContextWindow = 100000
+	plan = PlanContext(history, summary, 0, opts)
+	if plan.Summary != summary || len(plan.Kept) != 5 || len(plan.Summarize) != 0 {
+		t.Errorf("summary should cover earlier messages: kept=%d summarize=%d", len(plan.Kept), len(plan.Summarize))
+	}
+
+	// 摘要不在当前分支上时失效
+	stale := &ConversationSummary{Text: "其它分支", ThroughMessageID: uuid.New()}
+	if plan = PlanContext(history, stale, 0, opts); plan.Summary != nil || len(plan.Kept) != 11 {
+		t.Errorf("summary from another branch should be ignored")
+	}
+
+	// MemoryLength 限制原文条数
+	opts.MemoryLength = 3
+	plan = PlanContext(history, nil, 0, opts)
+	if len(plan.Kept) > 3 || len(plan.Summarize) < 8 {
+		t.Errorf("memory length should cap kept messages: kept=%d", len(plan.Kept))
+	}
+
+	// 关闭记忆：只保留当前问题
+	opts.MemoryEnabled = false
+	if plan = PlanContext(history, nil, 0, opts); len(plan.Kept) != 1 || len(plan.Summarize) != 0 {
+		t.Errorf("memory disabled should keep only the last message")
+	}
+}
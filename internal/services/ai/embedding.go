@@ -0,0 +1,169 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/liusCraft/orion/internal/config"
+)
+
+// Embedder 文本向量化接口
+type Embedder interface {
+	// EmbedStrings 批量向量化，返回的向量顺序与输入一致
+	EmbedStrings(ctx context.Context, texts []string) ([][]float32, error)
+	// Dimensions 向量维度
+	Dimensions() int
+}
+
+// EmbedderFactory 向量化实现的构造函数
+type EmbedderFactory func(cfg *config.EmbeddingConfig) (Embedder, error)
+
+var embedderFactories = map[string]EmbedderFactory{
+	"openai": func(cfg *config.EmbeddingConfig) (Embedder, error) { return newOpenAIEmbedder(cfg) },
+	"local":  func(cfg *config.EmbeddingConfig) (Embedder, error) { return newLocalEmbedder(cfg) },
+}
+
+// RegisterEmbedder 注册自定义向量化实现，需在 NewEmbedder 之前调用
+func RegisterEmbedder(provider string, factory EmbedderFactory) {
+	embedderFactories[provider] = factory
+}
+
+// NewEmbedder 根据配置创建向量化实现
+func NewEmbedder(cfg *config.EmbeddingConfig) (Embedder, error) {
+	if cfg.Dimensions <= 0 {
+		return nil, fmt.Errorf("invalid embedding dimensions: %d", cfg.Dimensions)
+	}
+	factory, ok := embedderFactories[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported embedding provider: %s", cfg.Provider)
+	}
+	return factory(cfg)
+}
+
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// openAIEmbedder 兼容 OpenAI /embeddings 协议的HTTP实现
+type openAIEmbedder struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	dimensions int
+	client     *http.Client
+}
+
+func newOpenAIEmbedder(cfg *config.EmbeddingConfig) (*openAIEmbedder, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("missing api key for openai embedding")
+	}
+	if cfg.Model == "" {
+		return nil, errors.New("missing model for openai embedding")
+	}
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30
+	}
+	return &openAIEmbedder{
+		baseURL:    baseURL,
+		apiKey:     cfg.APIKey,
+		model:      cfg.Model,
+		dimensions: cfg.Dimensions,
+		client:     &http.Client{Timeout: time.Duration(timeout) * time.Second},
+	}, nil
+}
+
+type openAIEmbeddingRequest struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+func (e *openAIEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (e *openAIEmbedder) EmbedStrings(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	reqBody := openAIEmbeddingRequest{Model: e.model, Input: texts}
+	// text-embedding-3 系列支持指定输出维度，旧模型传该参数会报错
+	if strings.HasPrefix(e.model, "text-embedding-3") {
+		reqBody.Dimensions = e.dimensions
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.apiKey)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read embedding response failed: %w", err)
+	}
+	var parsed openAIEmbeddingResponse
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("embedding response status %d: %s", resp.StatusCode, truncate(string(raw), 200))
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := truncate(string(raw), 200)
+		if parsed.Error != nil && parsed.Error.Message != "" {
+			msg = parsed.Error.Message
+		}
+		return nil, fmt.Errorf("embedding response status %d: %s", resp.StatusCode, msg)
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding count mismatch: want %d, got %d", len(texts), len(parsed.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range parsed.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index out of range: %d", d.Index)
+		}
+		if len(d.Embedding) != e.dimensions {
+			return nil, fmt.Errorf("embedding dimensions mismatch: want %d, got %d", e.dimensions, len(d.Embedding))
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// truncate 截断字符串用于错误信息
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
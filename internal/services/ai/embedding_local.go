@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/liusCraft/orion/internal/config"
+)
+
+// localEmbedder 基于哈希 n-gram 的本地向量化实现
+// 不依赖网络和模型文件，相同输入始终得到相同向量，适用于离线环境与测试。
+// 语义能力有限：只能反映字面重合度（词、字符片段），无法理解同义改写。
+type localEmbedder struct {
+	dimensions int
+}
+
+// localNgramSizes 参与哈希的字符 n-gram 长度
+var localNgramSizes = []int{1, 2, 3}
+
+func newLocalEmbedder(cfg *config.EmbeddingConfig) (*localEmbedder, error) {
+	return &localEmbedder{dimensions: cfg.Dimensions}, nil
+}
+
+func (e *localEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+func (e *localEmbedder) EmbedStrings(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *localEmbedder) embed(text string) []float32 {
+	vec := make([]float64, e.dimensions)
+	for _, token := range localTokens(text) {
+		// 完整词权重更高，字符片段用于覆盖中文及词形变化
+		e.add(vec, "w:"+token, 2)
+		runes := []rune(token)
+		for _, n := range localNgramSizes {
+			for i := 0; i+n <= len(runes); i++ {
+				e.add(vec, "g:"+string(runes[i:i+n]), 1)
+			}
+		}
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	result := make([]float32, e.dimensions)
+	if norm == 0 {
+		return result
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range vec {
+		result[i] = float32(v / norm)
+	}
+	return result
+}
+
+// add 将特征哈希到某一维，哈希高位决定符号以减少冲突带来的偏差
+func (e *localEmbedder) add(vec []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	idx := int(sum % uint64(e.dimensions))
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	vec[idx] += weight
+}
+
+// localTokens 按字母数字连续段切词并转小写；中日韩文字没有空格分词，整段作为一个词交给 n-gram 处理
+func localTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,68 @@
+package ai
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/liusCraft/orion/internal/config"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestLocalEmbedder(t *testing.T) {
+	embedder, err := NewEmbedder(&config.EmbeddingConfig{Provider: "local", Dimensions: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embedder.Dimensions() != 256 {
+		t.Fatalf("unexpected dimensions: %d", embedder.Dimensions())
+	}
+
+	texts := []string{
+		"CDN 节点回源超时排查",
+		"CDN 节点回源超时如何排查",
+		"员工年假申请流程",
+	}
+	first, err := embedder.EmbedStrings(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := embedder.EmbedStrings(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range texts {
+		if len(first[i]) != 256 {
+			t.Fatalf("vector %d has %d dimensions", i, len(first[i]))
+		}
+		for j := range first[i] {
+			if first[i][j] != second[i][j] {
+				t.Fatalf("vector %d is not deterministic", i)
+			}
+		}
+		if norm := cosine(first[i], first[i]); math.Abs(norm-1) > 1e-5 {
+			t.Fatalf("vector %d is not normalized: %f", i, norm)
+		}
+	}
+
+	if similar, unrelated := cosine(first[0], first[1]), cosine(first[0], first[2]); similar <= unrelated {
+		t.Fatalf("similar texts should score higher: similar=%f unrelated=%f", similar, unrelated)
+	}
+}
+
+func TestNewEmbedderValidation(t *testing.T) {
+	if _, err := NewEmbedder(&config.EmbeddingConfig{Provider: "local"}); err == nil {
+		t.Fatal("expected error for missing dimensions")
+	}
+	if _, err := NewEmbedder(&config.EmbeddingConfig{Provider: "unknown", Dimensions: 8}); err == nil {
+		t.Fatal("expected error for unknown provider")
+	}
+}
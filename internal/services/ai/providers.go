@@ -0,0 +1,81 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+
+	"github.com/liusCraft/orion/internal/config"
+)
+
+// ProviderFactory 按模型配置创建模型客户端
+type ProviderFactory func(cfg *config.LLMConfig) (model.ToolCallingChatModel, error)
+
+// provider 模型提供商
+type provider struct {
+	factory        ProviderFactory
+	defaultBaseURL string // base_url 未配置时使用
+	keyOptional    bool   // 本地部署的服务通常不校验密钥
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]provider{
+		"claude": {factory: createClaudeModel},
+		"openai": {factory: createOpenAIModel},
+		// 以下均为 OpenAI 兼容接口
+		"qwen":      {factory: createOpenAIModel, defaultBaseURL: "https://dashscope.aliyuncs.com/compatible-mode/v1"},
+		"dashscope": {factory: createOpenAIModel, defaultBaseURL: "https://dashscope.aliyuncs.com/compatible-mode/v1"},
+		"deepseek":  {factory: createOpenAIModel, defaultBaseURL: "https://api.deepseek.com/v1"},
+		"vllm":      {factory: createOpenAIModel, defaultBaseURL: "http://localhost:8000/v1", keyOptional: true},
+		"ollama":    {factory: createOpenAIModel, defaultBaseURL: "http://localhost:11434/v1", keyOptional: true},
+	}
+)
+
+// RegisterProvider 注册（或覆盖）模型提供商
+// defaultBaseURL 可为空；用于接入其它 OpenAI 兼容服务或自定义客户端。
+func RegisterProvider(name string, factory ProviderFactory, defaultBaseURL string) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[strings.ToLower(name)] = provider{factory: factory, defaultBaseURL: defaultBaseURL}
+}
+
+// Providers 已注册的提供商名称
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// createChatModel 按提供商创建模型客户端
+func createChatModel(cfg *config.LLMConfig) (model.ToolCallingChatModel, error) {
+	providersMu.RLock()
+	p, ok := providers[strings.ToLower(cfg.Provider)]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported AI provider: %s", cfg.Provider)
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("model is required")
+	}
+
+	resolved := *cfg
+	if resolved.BaseURL == "" {
+		resolved.BaseURL = p.defaultBaseURL
+	}
+	if resolved.APIKey == "" && p.keyOptional {
+		resolved.APIKey = "none"
+	}
+
+	chatModel, err := p.factory(&resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat model: %w", err)
+	}
+	return chatModel, nil
+}
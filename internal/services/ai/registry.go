@@ -0,0 +1,337 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/config"
+	dbmodels "github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+)
+
+// DefaultProfile 默认模型配置名，对应 ai.llm
+const DefaultProfile = "default"
+
+// ProfileConfigType system_configs 中模型配置的 config_type，config_key 为配置名
+const ProfileConfigType = "llm_profile"
+
+// ProfileInfo 模型配置概要（不含密钥）
+type ProfileInfo struct {
+	Name          string `json:"name"`
+	Provider      string `json:"provider"`
+	Model         string `json:"model"`
+	ContextWindow int    `json:"contextWindow"`
+	Default       bool   `json:"default"`
+	Auxiliary     bool   `json:"auxiliary"`
+}
+
+// Registry 命名模型配置（profile）注册表
+// 配置来自配置文件 ai.llm（default）、ai.models 与 system_configs 中 llm_profile 类型的配置（同名时后者优先），
+// 可在运行时重新加载；未变化的配置复用已有的模型客户端。
+type Registry struct {
+	base      config.LLMConfig            // ai.llm，其它配置未设置的参数沿用它
+	files     map[string]config.LLMConfig // ai.models
+	personas  map[string]string
+	auxiliary string
+	recorder  UsageRecorder
+
+	reloadMu sync.Mutex // 串行化重新加载
+	mu       sync.RWMutex
+	profiles map[string]*AIService
+	specs    map[string]config.LLMConfig // 生效的配置，用于判断是否需要重建客户端
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRegistry 由配置文件创建模型配置注册表，default 配置创建失败时返回错误
+func NewRegistry(cfg config.AIConfig) (*Registry, error) {
+	r := &Registry{
+		base:      cfg.LLM,
+		files:     cfg.Models,
+		personas:  cfg.Personas,
+		auxiliary: cfg.AuxiliaryModel,
+		profiles:  make(map[string]*AIService),
+		specs:     make(map[string]config.LLMConfig),
+	}
+	if err := r.apply(nil); err != nil {
+		if r.Default() == nil {
+			return nil, err
+		}
+		logger.Warn("部分模型配置无效: %v", err)
+	}
+	return r, nil
+}
+
+// SetUsageRecorder 设置用量记录，应在开始处理请求前调用
+func (r *Registry) SetUsageRecorder(recorder UsageRecorder) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recorder = recorder
+	for _, svc := range r.profiles {
+		svc.recorder = recorder
+	}
+}
+
+// Default 默认模型配置
+func (r *Registry) Default() *AIService {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.profiles[DefaultProfile]
+}
+
+// Auxiliary 辅助任务（生成标题等）使用的模型配置，未配置或不存在时使用默认配置
+func (r *Registry) Auxiliary() *AIService {
+	if svc, ok := r.Get(r.auxiliary); ok {
+		return svc
+	}
+	return r.Default()
+}
+
+// Get 按名称获取模型配置
+func (r *Registry) Get(name string) (*AIService, bool) {
+	if name == "" {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	svc, ok := r.profiles[name]
+	return svc, ok
+}
+
+// Profiles 全部模型配置概要（按名称排序）
+func (r *Registry) Profiles() []ProfileInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	auxiliary := r.auxiliary
+	if _, ok := r.profiles[auxiliary]; !ok {
+		auxiliary = DefaultProfile
+	}
+	out := make([]ProfileInfo, 0, len(r.profiles))
+	for name, svc := range r.profiles {
+		out = append(out, ProfileInfo{
+			Name:          name,
+			Provider:      svc.config.Provider,
+			Model:         svc.config.Model,
+			ContextWindow: svc.config.ContextWindow,
+			Default:       name == DefaultProfile,
+			Auxiliary:     name == auxiliary,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// ModelAllowed 对话设置中的 model 是否可用：模型配置名，或默认配置允许的模型
+func (r *Registry) ModelAllowed(name string) bool {
+	if _, ok := r.Get(name); ok {
+		return true
+	}
+	return r.Default().ModelAllowed(name)
+}
+
+// ForSettings 返回应用了对话设置的服务实例
+// settings.Model 为模型配置名时使用该配置，否则视为默认配置下的模型名。
+func (r *Registry) ForSettings(settings ConversationSettings) (*AIService, error) {
+	base := r.Default()
+	if svc, ok := r.Get(settings.Model); ok {
+		base = svc
+		settings.Model = ""
+	}
+	return base.WithSettings(settings)
+}
+
+// Reload 重新加载模型配置：配置文件中的配置叠加 system_configs 中 llm_profile 类型的配置
+// 无效的配置保留原有实例（若有）并返回错误。
+func (r *Registry) Reload(ctx context.Context, db *gorm.DB) error {
+	var rows []dbmodels.SystemConfig
+	if err := db.WithContext(ctx).Where("config_type = ?", ProfileConfigType).Find(&rows).Error; err != nil {
+		return err
+	}
+	stored, err := ProfilesFromConfigs(rows)
+	return errors.Join(err, r.apply(stored))
+}
+
+// Watch 定期重新加载模型配置，使管理员在任一实例上的修改在其它实例生效
+// 启动时的首次加载由调用方通过 Reload 完成。
+func (r *Registry) Watch(db *gorm.DB, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := r.Reload(ctx, db); err != nil && ctx.Err() == nil {
+				logger.Warn("重新加载模型配置失败: %v", err)
+			}
+		}
+	}()
+}
+
+// Close 停止定期加载
+func (r *Registry) Close() {
+	if r == nil || r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+}
+
+// ErrEnvPlaceholder system_configs 中的模型配置不展开环境变量占位符，含有占位符的配置不予保存与加载
+var ErrEnvPlaceholder = errors.New("environment placeholders ${...} are only supported in the config file")
+
+// ValidateProfileConfig 校验 system_configs 中的模型配置：不含环境变量占位符、可解析、提供商已注册且指定了模型
+func ValidateProfileConfig(values map[string]interface{}) error {
+	if config.HasEnvPlaceholder(values) {
+		return ErrEnvPlaceholder
+	}
+	cfg, err := config.DecodeLLMConfig(values)
+	if err != nil {
+		return err
+	}
+	_, err = createChatModel(&cfg)
+	return err
+}
+
+// ProfilesFromConfigs 解析 system_configs 中的模型配置，无效的配置跳过并返回错误
+func ProfilesFromConfigs(rows []dbmodels.SystemConfig) (map[string]config.LLMConfig, error) {
+	var errs []error
+	out := make(map[string]config.LLMConfig, len(rows))
+	for _, row := range rows {
+		if config.HasEnvPlaceholder(map[string]interface{}(row.ConfigValue)) {
+			errs = append(errs, fmt.Errorf("profile %s: %w", row.ConfigKey, ErrEnvPlaceholder))
+			continue
+		}
+		cfg, err := config.DecodeLLMConfig(row.ConfigValue)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", row.ConfigKey, err))
+			continue
+		}
+		out[row.ConfigKey] = cfg
+	}
+	return out, errors.Join(errs...)
+}
+
+// apply 以配置文件与 stored（system_configs）生成新的配置集合并替换
+func (r *Registry) apply(stored map[string]config.LLMConfig) error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	specs := map[string]config.LLMConfig{DefaultProfile: r.base}
+	for name, cfg := range r.files {
+		specs[name] = cfg
+	}
+	for name, cfg := range stored {
+		specs[name] = cfg
+	}
+	// 覆盖 default 时同样沿用 ai.llm 中未设置的参数
+	specs[DefaultProfile] = inheritLLMConfig(specs[DefaultProfile], r.base)
+	for name, cfg := range specs {
+		if name != DefaultProfile {
+			specs[name] = inheritLLMConfig(cfg, specs[DefaultProfile])
+		}
+	}
+
+	r.mu.RLock()
+	current, currentSpecs := r.profiles, r.specs
+	r.mu.RUnlock()
+
+	var errs []error
+	next := make(map[string]*AIService, len(specs))
+	nextSpecs := make(map[string]config.LLMConfig, len(specs))
+	for name, spec := range specs {
+		if svc, ok := current[name]; ok && reflect.DeepEqual(currentSpecs[name], spec) {
+			next[name], nextSpecs[name] = svc, spec
+			continue
+		}
+		cfg := spec
+		svc, err := NewAIService(&cfg, r.personas)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", name, err))
+			if old, ok := current[name]; ok {
+				next[name], nextSpecs[name] = old, currentSpecs[name]
+			}
+			continue
+		}
+		svc.profile = name
+		svc.fallbacks = r.fallbacksOf(name)
+		svc.recorder = r.recorder
+		next[name], nextSpecs[name] = svc, spec
+	}
+	if next[DefaultProfile] == nil {
+		return errors.Join(errs...)
+	}
+
+	r.mu.Lock()
+	r.profiles, r.specs = next, nextSpecs
+	r.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// fallbacksOf 按当前生效的配置解析 name 的备用配置，跳过自身与不存在的配置
+// 每次调用时解析，重新加载后立即生效。
+func (r *Registry) fallbacksOf(name string) func() []*AIService {
+	return func() []*AIService {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		var out []*AIService
+		for _, fb := range r.specs[name].Fallbacks {
+			if svc, ok := r.profiles[fb]; ok && fb != name {
+				out = append(out, svc)
+			}
+		}
+		return out
+	}
+}
+
+// inheritLLMConfig 模型配置未设置的参数沿用默认配置
+// 连接相关的参数（提供商、模型、地址、密钥）不沿用，避免把默认配置的密钥发往其它服务。
+func inheritLLMConfig(cfg, base config.LLMConfig) config.LLMConfig {
+	if cfg.Temperature == nil {
+		cfg.Temperature = base.Temperature
+	}
+	if cfg.MaxTokens == 0 {
+		cfg.MaxTokens = base.MaxTokens
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = base.Timeout
+	}
+	if cfg.ContextWindow == 0 {
+		cfg.ContextWindow = base.ContextWindow
+	}
+	if cfg.TopK == 0 {
+		cfg.TopK = base.TopK
+	}
+	if cfg.TopP == 0 {
+		cfg.TopP = base.TopP
+	}
+	if cfg.SystemPrompt == "" {
+		cfg.SystemPrompt = base.SystemPrompt
+	}
+	if cfg.RetryCount == 0 {
+		cfg.RetryCount = base.RetryCount
+	}
+	if cfg.RetryDelay == 0 {
+		cfg.RetryDelay = base.RetryDelay
+	}
+	return cfg
+}
@@ -0,0 +1,170 @@
+package ai
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/components/model"
+
+	"github.com/liusCraft/orion/internal/config"
+	dbmodels "github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+)
+
+func testAIConfig() config.AIConfig {
+	return config.AIConfig{
+		LLM: config.LLMConfig{
+			Provider:      "openai",
+			Model:         "gpt-4o",
+			APIKey:        "test",
+			BaseURL:       "http://127.0.0.1:1",
+			MaxTokens:     2000,
+			ContextWindow: 128000,
+			SystemPrompt:  "默认",
+			Fallbacks:     []string{"missing", "default", "fast"},
+		},
+		Models: map[string]config.LLMConfig{
+			"fast":   {Provider: "qwen", Model: "qwen-turbo", APIKey: "k", MaxTokens: 500},
+			"broken": {Provider: "unknown", Model: "x"},
+		},
+		AuxiliaryModel: "fast",
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	logger.Init("test")
+
+	r, err := NewRegistry(testAIConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Default() == nil || r.Default().Profile() != DefaultProfile {
+		t.Fatalf("default profile should exist")
+	}
+	if _, ok := r.Get("broken"); ok {
+		t.Errorf("invalid profile should be skipped")
+	}
+
+	fast, ok := r.Get("fast")
+	if !ok {
+		t.Fatalf("fast profile should exist")
+	}
+	if r.Auxiliary() != fast {
+		t.Errorf("auxiliary tasks should use the configured profile")
+	}
+	// 未设置的参数沿用 ai.llm，连接参数不沿用
+	if fast.config.MaxTokens != 500 || fast.config.ContextWindow != 128000 || fast.SystemPrompt() != "默认" {
+		t.Errorf("unexpected inherited config: %+v", *fast.config)
+	}
+	if fast.config.BaseURL != "" {
+		t.Errorf("base url should not be inherited")
+	}
+
+	// 备用配置跳过自身与不存在的配置
+	if fbs := r.Default().fallbacks(); len(fbs) != 1 || fbs[0] != fast {
+		t.Errorf("unexpected fallbacks: %v", fbs)
+	}
+
+	if !r.ModelAllowed("fast") || r.ModelAllowed("gpt-3.5") {
+		t.Errorf("profiles should be selectable by name")
+	}
+	svc, err := r.ForSettings(ConversationSettings{Model: "fast"})
+	if err != nil || svc.Model() != "qwen-turbo" {
+		t.Errorf("settings should select the profile: %v", err)
+	}
+
+	// 重新加载：未变化的配置复用实例，新增与覆盖的配置生效
+	stored, err := ProfilesFromConfigs([]dbmodels.SystemConfig{
+		{ConfigKey: "local", ConfigValue: dbmodels.JSONMap{"provider": "ollama", "model": "llama3"}},
+		{ConfigKey: DefaultProfile, ConfigValue: dbmodels.JSONMap{"provider": "deepseek", "model": "deepseek-chat", "api_key": "k"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.apply(stored); err == nil {
+		t.Errorf("broken profile should still be reported")
+	}
+	if again, _ := r.Get("fast"); again != fast {
+		t.Errorf("unchanged profile should be reused")
+	}
+	if _, ok := r.Get("local"); !ok {
+		t.Errorf("stored profile should be loaded")
+	}
+	if d := r.Default(); d.Model() != "deepseek-chat" || d.config.MaxTokens != 2000 {
+		t.Errorf("stored default should override ai.llm and inherit unset params")
+	}
+
+	// 删除后回到配置文件
+	r.apply(nil)
+	if _, ok := r.Get("local"); ok {
+		t.Errorf("removed profile should be dropped")
+	}
+	if r.Default().Model() != "gpt-4o" {
+		t.Errorf("default should fall back to ai.llm")
+	}
+}
+
+func TestValidateProfileConfig(t *testing.T) {
+	if err := ValidateProfileConfig(map[string]interface{}{"provider": "vllm", "model": "qwen2"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateProfileConfig(map[string]interface{}{"provider": "nope", "model": "x"}); err == nil {
+		t.Errorf("unknown provider should be rejected")
+	}
+	if err := ValidateProfileConfig(map[string]interface{}{"provider": "openai"}); err == nil {
+		t.Errorf("model should be required")
+	}
+	// 数据库中的配置不展开环境变量，保存时拒绝占位符
+	for _, values := range []map[string]interface{}{
+		{"provider": "openai", "model": "x", "api_key": "${DB_PASSWORD}"},
+		{"provider": "openai", "model": "x", "base_url": "https://evil.example.com/${JWT_SECRET:-x}"},
+		{"provider": "openai", "model": "x", "fallbacks": []interface{}{"fast", "${OIDC_CLIENT_SECRET}"}},
+	} {
+		if err := ValidateProfileConfig(values); !errors.Is(err, ErrEnvPlaceholder) {
+			t.Errorf("placeholder should be rejected: %v, %v", values, err)
+		}
+	}
+}
+
+func TestInheritTemperature(t *testing.T) {
+	base := 0.7
+	zero, err := config.DecodeLLMConfig(map[string]interface{}{"provider": "vllm", "model": "qwen2", "temperature": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 显式设置的 0 不沿用默认配置
+	if cfg := inheritLLMConfig(zero, config.LLMConfig{Temperature: &base}); cfg.Temperature == nil || *cfg.Temperature != 0 {
+		t.Errorf("explicit zero temperature should be kept: %v", cfg.Temperature)
+	}
+	unset, _ := config.DecodeLLMConfig(map[string]interface{}{"provider": "vllm", "model": "qwen2"})
+	if cfg := inheritLLMConfig(unset, config.LLMConfig{Temperature: &base}); cfg.Temperature == nil || *cfg.Temperature != base {
+		t.Errorf("unset temperature should be inherited: %v", cfg.Temperature)
+	}
+
+	svc, err := NewAIService(&zero, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := model.GetCommonOptions(nil, svc.buildModelOptions(nil)...)
+	if opts.Temperature == nil || *opts.Temperature != 0 {
+		t.Errorf("zero temperature should be sent to the model: %v", opts.Temperature)
+	}
+}
+
+func TestStoredProfileIgnoresEnv(t *testing.T) {
+	t.Setenv("ORION_TEST_SECRET", "s3cret")
+
+	cfg, err := config.DecodeLLMConfig(map[string]interface{}{"provider": "openai", "model": "x", "api_key": "${ORION_TEST_SECRET}"})
+	if err != nil || cfg.APIKey != "${ORION_TEST_SECRET}" {
+		t.Errorf("stored profile should not expand environment variables: %q, %v", cfg.APIKey, err)
+	}
+
+	// 数据库中已有的含占位符配置加载时跳过
+	stored, err := ProfilesFromConfigs([]dbmodels.SystemConfig{
+		{ConfigKey: "leak", ConfigValue: dbmodels.JSONMap{"provider": "openai", "model": "x", "api_key": "${ORION_TEST_SECRET}"}},
+		{ConfigKey: "local", ConfigValue: dbmodels.JSONMap{"provider": "ollama", "model": "llama3"}},
+	})
+	if !errors.Is(err, ErrEnvPlaceholder) || len(stored) != 1 {
+		t.Errorf("profile with placeholders should be skipped: %v, %v", stored, err)
+	}
+}
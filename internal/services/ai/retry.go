@@ -0,0 +1,241 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// 重试退避上限
+const maxRetryBackoff = 30 * time.Second
+
+// FallbackEvent 主模型调用失败后改由备用模型配置回答
+type FallbackEvent struct {
+	FromProfile string
+	FromModel   string
+	ToProfile   string
+	ToModel     string
+	Error       string // 主模型（及之前的备用配置）最后的错误
+}
+
+type fallbackObserverKey struct{}
+
+// WithFallbackObserver 在 ctx 上登记备用模型回调，调用方据此告知用户实际回答的模型
+func WithFallbackObserver(ctx context.Context, fn func(FallbackEvent)) context.Context {
+	return context.WithValue(ctx, fallbackObserverKey{}, fn)
+}
+
+func notifyFallback(ctx context.Context, ev FallbackEvent) {
+	if fn, ok := ctx.Value(fallbackObserverKey{}).(func(FallbackEvent)); ok && fn != nil {
+		fn(ev)
+	}
+}
+
+// 错误信息中的 HTTP 状态码：OpenAI 兼容客户端为 "status code: 429"，Claude 客户端为 `POST "url": 429 Too Many Requests`
+var statusCodeRe = regexp.MustCompile(`status code: (\d{3})|": (\d{3}) `)
+
+// statusCode 从错误信息中提取 HTTP 状态码，没有时返回 0
+func statusCode(err error) int {
+	m := statusCodeRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	code, _ := strconv.Atoi(m[1] + m[2])
+	return code
+}
+
+// retryable 是否为可重试的错误：限流、服务端错误、超时与连接中断
+func retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if code := statusCode(err); code != 0 {
+		switch code {
+		case 408, 409, 425, 429, 500, 502, 503, 504, 529:
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"rate limit", "overloaded", "connection reset", "timeout"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBackoff 第 attempt 次重试前的等待：基础间隔按 2 的幂增长，取其一半到全部之间的随机值
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base
+	for i := 0; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// withRetry 调用 fn，可重试的错误按退避重试 retry_count 次
+func (s *AIService) withRetry(ctx context.Context, fn func() error) error {
+	base := time.Duration(s.config.RetryDelay) * time.Second
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || ctx.Err() != nil || attempt >= s.config.RetryCount || !retryable(err) {
+			return err
+		}
+		timer := time.NewTimer(retryBackoff(base, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// candidates 主模型及其备用配置（沿用对话级温度覆盖）
+func (s *AIService) candidates() []*AIService {
+	out := []*AIService{s}
+	if s.fallbacks == nil {
+		return out
+	}
+	for _, f := range s.fallbacks() {
+		fb := *f
+		if s.temperature != nil {
+			fb.temperature = s.temperature
+		}
+		out = append(out, &fb)
+	}
+	return out
+}
+
+// failover 依次用主模型与备用配置执行 call，直到成功或调用方取消
+// 由备用配置回答时通知 ctx 上登记的回调。
+func (s *AIService) failover(ctx context.Context, call func(c *AIService) error) (*AIService, error) {
+	var lastErr error
+	for i, c := range s.candidates() {
+		err := c.withRetry(ctx, func() error { return call(c) })
+		if err == nil {
+			if i > 0 {
+				notifyFallback(ctx, FallbackEvent{
+					FromProfile: s.profile,
+					FromModel:   s.config.Model,
+					ToProfile:   c.profile,
+					ToModel:     c.config.Model,
+					Error:       lastErr.Error(),
+				})
+			}
+			return c, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// generate 非流式调用：重试与备用配置，返回回答及实际回答的服务
+func (s *AIService) generate(ctx context.Context, einoMessages []*schema.Message, tools []*schema.ToolInfo, opts *GenerateOptions) (*schema.Message, *AIService, error) {
+	var msg *schema.Message
+	used, err := s.failover(ctx, func(c *AIService) error {
+		modelOpts := c.buildModelOptions(opts)
+		if len(tools) > 0 {
+			modelOpts = append(modelOpts, model.WithTools(tools))
+		}
+		var err error
+		msg, err = c.chatModel.Generate(ctx, einoMessages, modelOpts...)
+		return err
+	})
+	if err == nil {
+		var usage *schema.TokenUsage
+		if msg.ResponseMeta != nil {
+			usage = msg.ResponseMeta.Usage
+		}
+		used.recordUsage(ctx, einoMessages, msg.Content, usage)
+	}
+	return msg, used, err
+}
+
+// peekedStream 已预读开头若干块的流
+type peekedStream struct {
+	reader  *schema.StreamReader[*schema.Message]
+	buffer  []*schema.Message
+	pending error // 预读时遇到的结束或错误
+}
+
+// Recv 先返回预读的块，再从底层流读取
+func (p *peekedStream) Recv() (*schema.Message, error) {
+	if len(p.buffer) > 0 {
+		m := p.buffer[0]
+		p.buffer = p.buffer[1:]
+		return m, nil
+	}
+	if p.pending != nil {
+		err := p.pending
+		p.pending = nil
+		return nil, err
+	}
+	return p.reader.Recv()
+}
+
+// Close 关闭底层流
+func (p *peekedStream) Close() {
+	p.reader.Close()
+}
+
+// openStream 打开流式调用并预读到第一块有内容的输出
+// 产生输出前失败时按 generate 的方式重试并切换备用配置；产生输出后的错误交给调用方。
+func (s *AIService) openStream(ctx context.Context, einoMessages []*schema.Message, opts *GenerateOptions) (*peekedStream, *AIService, error) {
+	var stream *peekedStream
+	used, err := s.failover(ctx, func(c *AIService) error {
+		reader, err := c.chatModel.Stream(ctx, einoMessages, c.buildModelOptions(opts)...)
+		if err != nil {
+			return err
+		}
+		p := &peekedStream{reader: reader}
+		for {
+			chunk, err := reader.Recv()
+			if err != nil {
+				if err == io.EOF || err.Error() == "EOF" || err.Error() == "stream finished" {
+					p.pending = err
+					break
+				}
+				reader.Close()
+				return err
+			}
+			if chunk == nil {
+				continue
+			}
+			p.buffer = append(p.buffer, chunk)
+			if chunk.Content != "" || len(chunk.ToolCalls) > 0 {
+				break
+			}
+		}
+		stream = p
+		return nil
+	})
+	return stream, used, err
+}
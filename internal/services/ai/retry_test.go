@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/liusCraft/orion/internal/config"
+)
+
+// fakeModel 按顺序返回预设错误，之后返回 reply
+type fakeModel struct {
+	errs      []error
+	streamErr error // 流式输出第一块内容后的错误
+	reply     string
+	calls     int
+}
+
+func (m *fakeModel) next() error {
+	m.calls++
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (m *fakeModel) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	if err := m.next(); err != nil {
+		return nil, err
+	}
+	return schema.AssistantMessage(m.reply, nil), nil
+}
+
+func (m *fakeModel) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	err := m.next()
+	reader, writer := schema.Pipe[*schema.Message](4)
+	go func() {
+		defer writer.Close()
+		writer.Send(&schema.Message{Role: schema.Assistant}, nil) // 只有角色、没有内容的开头块
+		if err != nil {
+			writer.Send(nil, err)
+			return
+		}
+		writer.Send(schema.AssistantMessage(m.reply, nil), nil)
+		if m.streamErr != nil {
+			writer.Send(nil, m.streamErr)
+		}
+	}()
+	return reader, nil
+}
+
+func (m *fakeModel) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	return m, nil
+}
+
+func fakeService(profile string, m *fakeModel, retries int) *AIService {
+	return &AIService{
+		chatModel: m,
+		config:    &config.LLMConfig{Model: profile + "-model", RetryCount: retries},
+		profile:   profile,
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	cases := map[string]bool{
+		"error, status code: 429, status: 429 Too Many Requests, message: slow down": true,
+		"error, status code: 503, status: 503 Service Unavailable, message: busy":    true,
+		`POST "https://api.anthropic.com/v1/messages": 529 status code 529 {}`:       true,
+		"error, status code: 400, status: 400 Bad Request, message: invalid":         false,
+		`POST "https://api.anthropic.com/v1/messages": 401 Unauthorized {}`:          false,
+		"read tcp: connection reset by peer":                                         true,
+		"json: cannot unmarshal":                                                     false,
+	}
+	for msg, want := range cases {
+		if got := retryable(errors.New(msg)); got != want {
+			t.Errorf("retryable(%q) = %v, want %v", msg, got, want)
+		}
+	}
+	if retryable(context.Canceled) {
+		t.Errorf("cancellation should not be retried")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	base := time.Second
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if d := retryBackoff(base, attempt); d < want/2 || d > want {
+			t.Errorf("attempt %d: backoff %s outside [%s, %s]", attempt, d, want/2, want)
+		}
+	}
+	if d := retryBackoff(base, 20); d > maxRetryBackoff {
+		t.Errorf("backoff should be capped, got %s", d)
+	}
+	if retryBackoff(0, 3) != 0 {
+		t.Errorf("zero base should not wait")
+	}
+}
+
+func TestGenerateRetryAndFallback(t *testing.T) {
+	rateLimited := errors.New("error, status code: 429, status: 429, message: rate limited")
+
+	// 重试后成功，不切换
+	primary := &fakeModel{errs: []error{rateLimited, rateLimited}, reply: "ok"}
+	s := fakeService("main", primary, 3)
+	msg, err := s.GenerateEinoMessage(context.Background(), nil, nil, nil)
+	if err != nil || msg.Content != "ok" || primary.calls != 3 {
+		t.Fatalf("expected success after retries: err=%v calls=%d", err, primary.calls)
+	}
+
+	// 不可重试的错误不重试，直接失败
+	primary = &fakeModel{errs: []error{errors.New("error, status code: 400, status: 400, message: bad")}}
+	s = fakeService("main", primary, 3)
+	if _, err := s.GenerateEinoMessage(context.Background(), nil, nil, nil); err == nil || primary.calls != 1 {
+		t.Fatalf("non-retryable error should fail at once: calls=%d", primary.calls)
+	}
+
+	// 重试用尽后切换备用配置并通知
+	primary = &fakeModel{errs: []error{rateLimited, rateLimited}}
+	backup := &fakeModel{reply: "from backup"}
+	s = fakeService("main", primary, 1)
+	temp := 0.2
+	s.temperature = &temp
+	b := fakeService("backup", backup, 1)
+	s.fallbacks = func() []*AIService { return []*AIService{b} }
+
+	var events []FallbackEvent
+	ctx := WithFallbackObserver(context.Background(), func(ev FallbackEvent) { events = append(events, ev) })
+	resp, err := s.Chat(ctx, []ChatMessage{{Role: "user", Content: "hi"}}, nil)
+	if err != nil || resp.Content != "from backup" {
+		t.Fatalf("fallback should answer: %v", err)
+	}
+	if resp.Metadata["profile"] != "backup" || primary.calls != 2 {
+		t.Errorf("unexpected answer metadata %v or primary calls %d", resp.Metadata, primary.calls)
+	}
+	if len(events) != 1 || events[0].ToProfile != "backup" || events[0].FromModel != "main-model" {
+		t.Errorf("unexpected fallback events: %+v", events)
+	}
+	if b.temperature != nil {
+		t.Errorf("fallback profile must not be modified")
+	}
+}
+
+func TestStreamRetryBeforeOutput(t *testing.T) {
+	overloaded := errors.New("error, status code: 503, status: 503, message: overloaded")
+
+	primary := &fakeModel{errs: []error{overloaded}, reply: "hello"}
+	s := fakeService("main", primary, 2)
+	chunks, err := s.ChatStreamEino(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last StreamChunk
+	for c := range chunks {
+		last = c
+	}
+	if last.Error != nil || last.Content != "hello" || primary.calls != 2 {
+		t.Fatalf("stream should succeed after retry: err=%v content=%q calls=%d", last.Error, last.Content, primary.calls)
+	}
+	if last.Metadata["model"] != "main-model" {
+		t.Errorf("final chunk should carry the answering model")
+	}
+
+	// 已产生输出后的错误不重试，交给调用方
+	primary = &fakeModel{reply: "partial", streamErr: io.ErrUnexpectedEOF}
+	s = fakeService("main", primary, 2)
+	chunks, err = s.ChatStreamEino(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c := range chunks {
+		last = c
+	}
+	if last.Error == nil || last.Content != "partial" || primary.calls != 1 {
+		t.Errorf("errors after output should not be retried: err=%v calls=%d", last.Error, primary.calls)
+	}
+}
@@ -18,8 +18,14 @@ import (
 
 // AIService AI服务接口
 type AIService struct {
-	chatModel model.ToolCallingChatModel
-	config    *config.LLMConfig
+	chatModel   model.ToolCallingChatModel
+	config      *config.LLMConfig
+	profile     string              // 所属模型配置名，见 Registry
+	fallbacks   func() []*AIService // 备用配置（按顺序），由 Registry 解析
+	recorder    UsageRecorder       // 记录每次调用的用量，可为 nil
+	models      *modelCache         // 对话指定其它模型时使用的模型客户端
+	personas    map[string]string   // 预置人设 -> 系统提示词
+	temperature *float64            // 对话级温度覆盖
 }
 
 // ChatMessage 标准化的聊天消息格式
@@ -61,29 +67,38 @@ type GenerateOptions struct {
 }
 
 // NewAIService 创建AI服务实例
-func NewAIService(config *config.LLMConfig) (*AIService, error) {
-	var chatModel model.ToolCallingChatModel
-	var err error
-
-	switch config.Provider {
-	case "claude":
-		chatModel, err = createClaudeModel(config)
-	case "openai":
-		chatModel, err = createOpenAIModel(config)
-	default:
-		return nil, fmt.Errorf("unsupported AI provider: %s", config.Provider)
+// personas 为预置人设（名称 -> 系统提示词），可为 nil。
+func NewAIService(config *config.LLMConfig, personas map[string]string) (*AIService, error) {
+	chatModel, err := createChatModel(config)
+	if err != nil {
+		return nil, err
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to create chat model: %w", err)
+	normalized := make(map[string]string, len(personas))
+	for name, prompt := range personas {
+		normalized[strings.ToLower(name)] = prompt
 	}
+	models := newModelCache()
+	models.models[config.Model] = chatModel
 
 	return &AIService{
 		chatModel: chatModel,
 		config:    config,
+		models:    models,
+		personas:  normalized,
 	}, nil
 }
 
+// Profile 所属模型配置名
+func (s *AIService) Profile() string {
+	return s.profile
+}
+
+// Model 模型名称
+func (s *AIService) Model() string {
+	return s.config.Model
+}
+
 // createClaudeModel 创建Claude模型
 func createClaudeModel(config *config.LLMConfig) (model.ToolCallingChatModel, error) {
 	claudeConfig := &claude.Config{
@@ -96,8 +111,8 @@ func createClaudeModel(config *config.LLMConfig) (model.ToolCallingChatModel, er
 		claudeConfig.BaseURL = &config.BaseURL
 	}
 
-	if config.Temperature > 0 {
-		temp := float32(config.Temperature)
+	if config.Temperature != nil {
+		temp := float32(*config.Temperature)
 		claudeConfig.Temperature = &temp
 	}
 
@@ -131,8 +146,8 @@ func createOpenAIModel(config *config.LLMConfig) (model.ToolCallingChatModel, er
 		openaiConfig.MaxTokens = &config.MaxTokens
 	}
 
-	if config.Temperature > 0 {
-		temp := float32(config.Temperature)
+	if config.Temperature != nil {
+		temp := float32(*config.Temperature)
 		openaiConfig.Temperature = &temp
 	}
 
@@ -154,11 +169,8 @@ func (s *AIService) Chat(ctx context.Context, messages []ChatMessage, opts *Gene
 	// 转换消息格式
 	einoMessages := s.convertToEinoMessages(messages)
 
-	// 构建选项
-	modelOpts := s.buildModelOptions(opts)
-
-	// 调用模型
-	response, err := s.chatModel.Generate(ctx, einoMessages, modelOpts...)
+	// 调用模型（失败时重试并切换备用配置）
+	response, used, err := s.generate(ctx, einoMessages, nil, opts)
 	if err != nil {
 		return nil, fmt.Errorf("chat model generate error: %w", err)
 	}
@@ -178,33 +190,21 @@ func (s *AIService) Chat(ctx context.Context, messages []ChatMessage, opts *Gene
 		TokenCount:   tokenCount,
 		FinishReason: finishReason,
 		Metadata: map[string]interface{}{
-			"model": s.config.Model,
-			"usage": response.ResponseMeta,
+			"model":   used.config.Model,
+			"profile": used.profile,
+			"usage":   response.ResponseMeta,
 		},
 	}, nil
 }
 
 // GenerateMessage 低层封装：返回完整的schema.Message，支持注入Tools
 func (s *AIService) GenerateMessage(ctx context.Context, messages []ChatMessage, tools []*schema.ToolInfo, opts *GenerateOptions) (*schema.Message, error) {
-	einoMessages := s.convertToEinoMessages(messages)
-	modelOpts := s.buildModelOptions(opts)
-	if len(tools) > 0 {
-		modelOpts = append(modelOpts, model.WithTools(tools))
-	}
-	msg, err := s.chatModel.Generate(ctx, einoMessages, modelOpts...)
-	if err != nil {
-		return nil, fmt.Errorf("chat model generate error: %w", err)
-	}
-	return msg, nil
+	return s.GenerateEinoMessage(ctx, s.convertToEinoMessages(messages), tools, opts)
 }
 
 // GenerateEinoMessage 直接使用eino消息，便于携带tool_calls
 func (s *AIService) GenerateEinoMessage(ctx context.Context, einoMessages []*schema.Message, tools []*schema.ToolInfo, opts *GenerateOptions) (*schema.Message, error) {
-	modelOpts := s.buildModelOptions(opts)
-	if len(tools) > 0 {
-		modelOpts = append(modelOpts, model.WithTools(tools))
-	}
-	msg, err := s.chatModel.Generate(ctx, einoMessages, modelOpts...)
+	msg, _, err := s.generate(ctx, einoMessages, tools, opts)
 	if err != nil {
 		return nil, fmt.Errorf("chat model generate error: %w", err)
 	}
@@ -212,44 +212,49 @@ func (s *AIService) GenerateEinoMessage(ctx context.Context, einoMessages []*sch
 }
 
 // ChatStreamEino 使用eino消息进行流式对话
+// 尚未产生输出前的失败会重试并切换备用配置；结束块的 Metadata 带有实际回答的 model 与 profile。
 func (s *AIService) ChatStreamEino(ctx context.Context, einoMessages []*schema.Message, opts *GenerateOptions) (<-chan StreamChunk, error) {
-	modelOpts := s.buildModelOptions(opts)
-	streamReader, err := s.chatModel.Stream(ctx, einoMessages, modelOpts...)
+	streamReader, used, err := s.openStream(ctx, einoMessages, opts)
 	if err != nil {
 		return nil, fmt.Errorf("chat model stream error: %w", err)
 	}
+	answeredBy := map[string]interface{}{"model": used.config.Model, "profile": used.profile}
 	chunkChan := make(chan StreamChunk, 10)
 	go func() {
 		defer close(chunkChan)
 		defer streamReader.Close()
 		fullContent := ""
+		var usage *schema.TokenUsage
+		var finishReason string
+		// 无论正常结束、出错还是取消都记录用量（已输出的部分同样计费）
+		defer func() { used.recordUsage(ctx, einoMessages, fullContent, usage) }()
 		chunkID := fmt.Sprintf("chat-%d", time.Now().UnixNano())
 		for {
 			select {
 			case <-ctx.Done():
-				chunkChan <- StreamChunk{ID: chunkID, Content: fullContent, Finished: true, Error: ctx.Err()}
+				chunkChan <- StreamChunk{ID: chunkID, Content: fullContent, Finished: true, Error: ctx.Err(), Metadata: answeredBy}
 				return
 			default:
 				chunk, err := streamReader.Recv()
 				if err != nil {
 					if err.Error() == "EOF" || err.Error() == "stream finished" {
 						var tokenCount int
-						var finishReason string
-						if chunk != nil && chunk.ResponseMeta != nil {
-							if chunk.ResponseMeta.Usage != nil {
-								tokenCount = chunk.ResponseMeta.Usage.TotalTokens
-							}
-							finishReason = chunk.ResponseMeta.FinishReason
+						if usage != nil {
+							tokenCount = usage.TotalTokens
 						}
-						chunkChan <- StreamChunk{ID: chunkID, Content: fullContent, Finished: true, TokenCount: tokenCount, FinishReason: finishReason}
+						chunkChan <- StreamChunk{ID: chunkID, Content: fullContent, Finished: true, TokenCount: tokenCount, FinishReason: finishReason, Metadata: answeredBy}
 						return
 					}
-					chunkChan <- StreamChunk{ID: chunkID, Content: fullContent, Finished: true, Error: err}
+					chunkChan <- StreamChunk{ID: chunkID, Content: fullContent, Finished: true, Error: err, Metadata: answeredBy}
 					return
 				}
 				if chunk == nil {
 					continue
 				}
+				usage = mergeUsage(usage, chunk)
+				if chunk.ResponseMeta != nil && chunk.ResponseMeta.FinishReason != "" {
+					finishReason = chunk.ResponseMeta.FinishReason
+				}
 				delta := chunk.Content
 				fullContent += delta
 				chunkChan <- StreamChunk{ID: chunkID, Content: fullContent, Delta: delta, Finished: false}
@@ -266,92 +271,7 @@ func (s *AIService) ToEinoMessages(messages []ChatMessage) []*schema.Message {
 
 // ChatStream 流式对话
 func (s *AIService) ChatStream(ctx context.Context, messages []ChatMessage, opts *GenerateOptions) (<-chan StreamChunk, error) {
-	// 转换消息格式
-	einoMessages := s.convertToEinoMessages(messages)
-
-	// 构建选项
-	modelOpts := s.buildModelOptions(opts)
-
-	// 调用流式模型
-	streamReader, err := s.chatModel.Stream(ctx, einoMessages, modelOpts...)
-	if err != nil {
-		return nil, fmt.Errorf("chat model stream error: %w", err)
-	}
-
-	// 创建输出通道
-	chunkChan := make(chan StreamChunk, 10)
-
-	go func() {
-		defer close(chunkChan)
-		defer streamReader.Close()
-
-		fullContent := ""
-		chunkID := fmt.Sprintf("chat-%d", time.Now().UnixNano())
-
-		for {
-			select {
-			case <-ctx.Done():
-				chunkChan <- StreamChunk{
-					ID:       chunkID,
-					Content:  fullContent,
-					Finished: true,
-					Error:    ctx.Err(),
-				}
-				return
-
-			default:
-				chunk, err := streamReader.Recv()
-				if err != nil {
-					if err.Error() == "EOF" || err.Error() == "stream finished" {
-						// 流结束
-						var tokenCount int
-						var finishReason string
-						if chunk != nil && chunk.ResponseMeta != nil {
-							if chunk.ResponseMeta.Usage != nil {
-								tokenCount = chunk.ResponseMeta.Usage.TotalTokens
-							}
-							finishReason = chunk.ResponseMeta.FinishReason
-						}
-
-						chunkChan <- StreamChunk{
-							ID:           chunkID,
-							Content:      fullContent,
-							Finished:     true,
-							TokenCount:   tokenCount,
-							FinishReason: finishReason,
-						}
-						return
-					}
-					// 错误
-					chunkChan <- StreamChunk{
-						ID:       chunkID,
-						Content:  fullContent,
-						Finished: true,
-						Error:    err,
-					}
-					return
-				}
-
-				// 检查chunk是否为nil
-				if chunk == nil {
-					continue
-				}
-
-				// 正常块
-				delta := chunk.Content
-				fullContent += delta
-
-				chunkChan <- StreamChunk{
-					ID:       chunkID,
-					Content:  fullContent,
-					Delta:    delta,
-					Finished: false,
-				}
-			}
-		}
-	}()
-
-	return chunkChan, nil
+	return s.ChatStreamEino(ctx, s.convertToEinoMessages(messages), opts)
 }
 
 // HealthCheck 健康检查
@@ -374,8 +294,9 @@ func (s *AIService) HealthCheck(ctx context.Context) error {
 	return err
 }
 
-// BuildContextMessages 构建包含系统提示词和历史的完整上下文
-func (s *AIService) BuildContextMessages(historyMessages []dbmodels.Message) []ChatMessage {
+// BuildContextMessages 构建包含系统提示词、滚动摘要和历史的完整上下文
+// historyMessages 应为 PlanContext 保留的消息；summary 为其之前对话的摘要（可为 nil）。
+func (s *AIService) BuildContextMessages(historyMessages []dbmodels.Message, summary *ConversationSummary) []ChatMessage {
 	var messages []ChatMessage
 
 	// 添加系统提示词
@@ -386,15 +307,15 @@ func (s *AIService) BuildContextMessages(historyMessages []dbmodels.Message) []C
 		})
 	}
 
-	// 添加历史消息（限制数量）
-	maxHistory := 20 // 限制历史消息数量
-	startIdx := 0
-	if len(historyMessages) > maxHistory {
-		startIdx = len(historyMessages) - maxHistory
+	// 早期对话以摘要形式提供，避免丢失已确认的事实
+	if summary != nil && summary.Text != "" {
+		messages = append(messages, ChatMessage{
+			Role:    "system",
+			Content: "以下是本次对话较早部分的摘要，请作为背景信息：\n" + summary.Text,
+		})
 	}
 
-	for i := startIdx; i < len(historyMessages); i++ {
-		msg := historyMessages[i]
+	for _, msg := range historyMessages {
 		role := msg.SenderType
 		if role == "ai" {
 			role = "assistant" // 统一转换为assistant
@@ -441,13 +362,16 @@ func (s *AIService) convertToEinoMessages(messages []ChatMessage) []*schema.Mess
 func (s *AIService) buildModelOptions(opts *GenerateOptions) []model.Option {
 	var modelOpts []model.Option
 
-	// 使用传入的选项或配置默认值
+	// 使用传入的选项、对话设置或配置默认值；设置为 0 时同样生效
 	temperature := s.config.Temperature
+	if s.temperature != nil {
+		temperature = s.temperature
+	}
 	if opts != nil && opts.Temperature != nil {
-		temperature = *opts.Temperature
+		temperature = opts.Temperature
 	}
-	if temperature > 0 {
-		modelOpts = append(modelOpts, model.WithTemperature(float32(temperature)))
+	if temperature != nil {
+		modelOpts = append(modelOpts, model.WithTemperature(float32(*temperature)))
 	}
 
 	maxTokens := s.config.MaxTokens
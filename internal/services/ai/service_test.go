@@ -25,15 +25,16 @@ func TestService(t *testing.T) {
 	if llmModel == "" {
 		t.Skip("LLM_MODEL not set")
 	}
+	temperature := 0.5
 	cfg := &config.LLMConfig{
 		Provider:    llmProvider,
 		Model:       llmModel,
 		APIKey:      llmApiKey,
 		BaseURL:     llmBaseURL,
-		Temperature: 0.5,
+		Temperature: &temperature,
 		MaxTokens:   2000,
 	}
-	srv, err := NewAIService(cfg)
+	srv, err := NewAIService(cfg, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
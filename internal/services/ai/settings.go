@@ -0,0 +1,197 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/config"
+)
+
+// 对话级设置在 Conversation.Context 中的键
+const (
+	SettingModel        = "model"
+	SettingPersona      = "persona"
+	SettingSystemPrompt = "systemPrompt"
+	SettingTemperature  = "temperature"
+	SettingToolIDs      = "toolIds"
+)
+
+// 系统提示词长度上限（字符）
+const maxSystemPromptRunes = 8000
+
+// ConversationSettings 对话级覆盖设置，保存在 Conversation.Context
+// 未设置的字段沿用全局配置。
+type ConversationSettings struct {
+	Model        string      // 模型名称，须在 ai.llm.allowed_models 中
+	Persona      string      // 预置人设名称（ai.personas），提供系统提示词
+	SystemPrompt string      // 自定义系统提示词，优先于人设
+	Temperature  *float64    // 温度
+	ToolIDs      []uuid.UUID // 可用工具；nil 表示全部启用的工具，空数组表示不使用工具
+}
+
+// SettingsFromContext 解析 Conversation.Context 中的对话设置
+func SettingsFromContext(ctx map[string]interface{}) (ConversationSettings, error) {
+	var s ConversationSettings
+	if v, ok := ctx[SettingModel]; ok && v != nil {
+		str, ok := v.(string)
+		if !ok {
+			return s, fmt.Errorf("%s must be a string", SettingModel)
+		}
+		s.Model = strings.TrimSpace(str)
+	}
+	if v, ok := ctx[SettingPersona]; ok && v != nil {
+		str, ok := v.(string)
+		if !ok {
+			return s, fmt.Errorf("%s must be a string", SettingPersona)
+		}
+		s.Persona = strings.TrimSpace(str)
+	}
+	if v, ok := ctx[SettingSystemPrompt]; ok && v != nil {
+		str, ok := v.(string)
+		if !ok {
+			return s, fmt.Errorf("%s must be a string", SettingSystemPrompt)
+		}
+		if len([]rune(str)) > maxSystemPromptRunes {
+			return s, fmt.Errorf("%s exceeds %d characters", SettingSystemPrompt, maxSystemPromptRunes)
+		}
+		s.SystemPrompt = strings.TrimSpace(str)
+	}
+	if v, ok := ctx[SettingTemperature]; ok && v != nil {
+		var f float64
+		switch n := v.(type) {
+		case float64:
+			f = n
+		case int:
+			f = float64(n)
+		case json.Number:
+			parsed, err := n.Float64()
+			if err != nil {
+				return s, fmt.Errorf("%s must be a number", SettingTemperature)
+			}
+			f = parsed
+		default:
+			return s, fmt.Errorf("%s must be a number", SettingTemperature)
+		}
+		if f < 0 || f > 2 {
+			return s, fmt.Errorf("%s must be between 0 and 2", SettingTemperature)
+		}
+		s.Temperature = &f
+	}
+	if v, ok := ctx[SettingToolIDs]; ok && v != nil {
+		list, ok := v.([]interface{})
+		if !ok {
+			return s, fmt.Errorf("%s must be an array", SettingToolIDs)
+		}
+		s.ToolIDs = make([]uuid.UUID, 0, len(list))
+		for _, item := range list {
+			str, _ := item.(string)
+			id, err := uuid.Parse(str)
+			if err != nil {
+				return s, fmt.Errorf("%s contains invalid id: %v", SettingToolIDs, item)
+			}
+			s.ToolIDs = append(s.ToolIDs, id)
+		}
+	}
+	return s, nil
+}
+
+// ModelAllowed 是否允许对话使用该模型（默认模型始终允许）
+func (s *AIService) ModelAllowed(name string) bool {
+	if name == "" || name == s.config.Model {
+		return true
+	}
+	for _, m := range s.config.AllowedModels {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonaPrompt 预置人设的系统提示词
+func (s *AIService) PersonaPrompt(name string) (string, bool) {
+	prompt, ok := s.personas[strings.ToLower(name)]
+	return prompt, ok
+}
+
+// AllowedModels 对话可选用的其它模型
+func (s *AIService) AllowedModels() []string {
+	out := make([]string, len(s.config.AllowedModels))
+	copy(out, s.config.AllowedModels)
+	return out
+}
+
+// Personas 预置人设名称（按名称排序）
+func (s *AIService) Personas() []string {
+	names := make([]string, 0, len(s.personas))
+	for name := range s.personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithSettings 返回应用了对话设置的服务实例（共享底层连接）
+// 模型不同时按模型名创建并缓存新的模型客户端。
+func (s *AIService) WithSettings(settings ConversationSettings) (*AIService, error) {
+	derived := *s
+	cfg := *s.config
+	derived.config = &cfg
+
+	if settings.Model != "" && settings.Model != s.config.Model {
+		if !s.ModelAllowed(settings.Model) {
+			return nil, fmt.Errorf("model not allowed: %s", settings.Model)
+		}
+		cfg.Model = settings.Model
+		chatModel, err := s.models.get(&cfg)
+		if err != nil {
+			return nil, err
+		}
+		derived.chatModel = chatModel
+	}
+	if settings.Persona != "" {
+		prompt, ok := s.PersonaPrompt(settings.Persona)
+		if !ok {
+			return nil, fmt.Errorf("unknown persona: %s", settings.Persona)
+		}
+		cfg.SystemPrompt = prompt
+	}
+	if settings.SystemPrompt != "" {
+		cfg.SystemPrompt = settings.SystemPrompt
+	}
+	if settings.Temperature != nil {
+		t := *settings.Temperature
+		derived.temperature = &t
+	}
+	return &derived, nil
+}
+
+// modelCache 按模型名缓存模型客户端
+type modelCache struct {
+	mu     sync.Mutex
+	models map[string]model.ToolCallingChatModel
+}
+
+func newModelCache() *modelCache {
+	return &modelCache{models: make(map[string]model.ToolCallingChatModel)}
+}
+
+func (c *modelCache) get(cfg *config.LLMConfig) (model.ToolCallingChatModel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.models[cfg.Model]; ok {
+		return m, nil
+	}
+	m, err := createChatModel(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.models[cfg.Model] = m
+	return m, nil
+}
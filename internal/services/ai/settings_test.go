@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/config"
+)
+
+func TestSettingsFromContext(t *testing.T) {
+	toolID := uuid.New()
+	var ctx map[string]interface{}
+	raw := `{"model":" gpt-4o ","persona":"sre","temperature":0,"toolIds":["` + toolID.String() + `"],"summary":{"text":"x"}}`
+	if err := json.Unmarshal([]byte(raw), &ctx); err != nil {
+		t.Fatal(err)
+	}
+	s, err := SettingsFromContext(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.Model != "gpt-4o" || s.Persona != "sre" {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+	if s.Temperature == nil || *s.Temperature != 0 {
+		t.Errorf("explicit zero temperature should be kept")
+	}
+	if len(s.ToolIDs) != 1 || s.ToolIDs[0] != toolID {
+		t.Errorf("unexpected tool ids: %v", s.ToolIDs)
+	}
+
+	// 空数组表示不使用工具，与未设置区分
+	s, _ = SettingsFromContext(map[string]interface{}{"toolIds": []interface{}{}})
+	if s.ToolIDs == nil || len(s.ToolIDs) != 0 {
+		t.Errorf("empty tool list should be non-nil")
+	}
+	if s, _ = SettingsFromContext(nil); s.ToolIDs != nil || s.Temperature != nil {
+		t.Errorf("missing settings should stay unset")
+	}
+
+	invalid := []map[string]interface{}{
+		{"model": 1},
+		{"temperature": 2.5},
+		{"temperature": "hot"},
+		{"toolIds": "all"},
+		{"toolIds": []interface{}{"not-a-uuid"}},
+		{"systemPrompt": string(make([]rune, maxSystemPromptRunes+1))},
+	}
+	for _, ctx := range invalid {
+		if _, err := SettingsFromContext(ctx); err == nil {
+			t.Errorf("expected error for %v", ctx)
+		}
+	}
+}
+
+func TestWithSettings(t *testing.T) {
+	temperature := 0.7
+	cfg := &config.LLMConfig{
+		Provider:      "openai",
+		Model:         "gpt-4o-mini",
+		APIKey:        "test",
+		BaseURL:       "http://127.0.0.1:1",
+		Temperature:   &temperature,
+		SystemPrompt:  "默认",
+		AllowedModels: []string{"gpt-4o"},
+	}
+	srv, err := NewAIService(cfg, map[string]string{"SRE": "人设"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := srv.WithSettings(ConversationSettings{Model: "other"}); err == nil {
+		t.Errorf("model outside allowed_models should be rejected")
+	}
+	if _, err := srv.WithSettings(ConversationSettings{Persona: "unknown"}); err == nil {
+		t.Errorf("unknown persona should be rejected")
+	}
+
+	temp := 0.0
+	derived, err := srv.WithSettings(ConversationSettings{Model: "gpt-4o", Persona: "sre", Temperature: &temp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derived.SystemPrompt() != "人设" || derived.config.Model != "gpt-4o" {
+		t.Errorf("persona and model should apply: prompt=%q model=%q", derived.SystemPrompt(), derived.config.Model)
+	}
+	if derived.chatModel == srv.chatModel {
+		t.Errorf("a different model should use its own client")
+	}
+	if again, _ := srv.WithSettings(ConversationSettings{Model: "gpt-4o"}); again.chatModel != derived.chatModel {
+		t.Errorf("model clients should be cached")
+	}
+	if srv.SystemPrompt() != "默认" || srv.config.Model != "gpt-4o-mini" || srv.temperature != nil {
+		t.Errorf("base service must not be modified")
+	}
+
+	// 自定义系统提示词优先于人设
+	custom, _ := srv.WithSettings(ConversationSettings{Persona: "sre", SystemPrompt: "自定义"})
+	if custom.SystemPrompt() != "自定义" {
+		t.Errorf("custom system prompt should override persona")
+	}
+}
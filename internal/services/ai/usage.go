@@ -0,0 +1,106 @@
+package ai
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+// 调用用途
+const (
+	PurposeChat     = "chat" // 未指定用途
+	PurposeAnswer   = "answer"
+	PurposePlanning = "planning"
+	PurposeSummary  = "summary"
+	PurposeTitle    = "title"
+)
+
+// UsageScope 模型调用的用量归属
+type UsageScope struct {
+	UserID         *uuid.UUID
+	Department     string
+	ConversationID *uuid.UUID
+	MessageID      *uuid.UUID
+	Purpose        string
+}
+
+// Usage 一次模型调用的用量
+type Usage struct {
+	Scope            UsageScope
+	Profile          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool // 模型未返回用量时按文本估算
+	At               time.Time
+}
+
+// UsageRecorder 记录模型调用用量
+type UsageRecorder interface {
+	RecordUsage(ctx context.Context, usage Usage)
+}
+
+type usageScopeKey struct{}
+
+// WithUsageScope 在 ctx 上登记用量归属
+func WithUsageScope(ctx context.Context, scope UsageScope) context.Context {
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+// WithUsagePurpose 沿用 ctx 上的用量归属，替换调用用途
+func WithUsagePurpose(ctx context.Context, purpose string) context.Context {
+	scope := UsageScopeFrom(ctx)
+	scope.Purpose = purpose
+	return WithUsageScope(ctx, scope)
+}
+
+// UsageScopeFrom ctx 上的用量归属，未登记时用途为 chat
+func UsageScopeFrom(ctx context.Context) UsageScope {
+	scope, _ := ctx.Value(usageScopeKey{}).(UsageScope)
+	if scope.Purpose == "" {
+		scope.Purpose = PurposeChat
+	}
+	return scope
+}
+
+// recordUsage 记录一次调用的用量；usage 为空时按输入与输出文本估算
+func (s *AIService) recordUsage(ctx context.Context, input []*schema.Message, output string, usage *schema.TokenUsage) {
+	if s.recorder == nil {
+		return
+	}
+	u := Usage{
+		Scope:   UsageScopeFrom(ctx),
+		Profile: s.profile,
+		Model:   s.config.Model,
+		At:      time.Now(),
+	}
+	if usage != nil && (usage.PromptTokens > 0 || usage.CompletionTokens > 0) {
+		u.PromptTokens, u.CompletionTokens = usage.PromptTokens, usage.CompletionTokens
+	} else {
+		for _, m := range input {
+			u.PromptTokens += EstimateTokens(m.Content) + messageOverheadTokens
+		}
+		u.CompletionTokens = EstimateTokens(output)
+		u.Estimated = true
+	}
+	// 调用方可能已取消，记录不应随之失败
+	s.recorder.RecordUsage(context.WithoutCancel(ctx), u)
+}
+
+// mergeUsage 合并流式响应各块中的用量
+// OpenAI 兼容接口在最后一块给出完整用量；Claude 在开头给出输入、在结尾给出输出，逐项取最大值即可。
+func mergeUsage(acc *schema.TokenUsage, chunk *schema.Message) *schema.TokenUsage {
+	if chunk == nil || chunk.ResponseMeta == nil || chunk.ResponseMeta.Usage == nil {
+		return acc
+	}
+	u := chunk.ResponseMeta.Usage
+	if acc == nil {
+		acc = &schema.TokenUsage{}
+	}
+	acc.PromptTokens = max(acc.PromptTokens, u.PromptTokens)
+	acc.CompletionTokens = max(acc.CompletionTokens, u.CompletionTokens)
+	acc.TotalTokens = max(acc.TotalTokens, u.TotalTokens, acc.PromptTokens+acc.CompletionTokens)
+	return acc
+}
@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/google/uuid"
+)
+
+type fakeRecorder struct {
+	mu    sync.Mutex
+	usage []Usage
+}
+
+func (r *fakeRecorder) RecordUsage(ctx context.Context, u Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.usage = append(r.usage, u)
+}
+
+func TestRecordUsage(t *testing.T) {
+	rec := &fakeRecorder{}
+	primary := &fakeModel{errs: []error{errors.New("error, status code: 401, status: 401, message: bad key")}}
+	backup := &fakeModel{reply: "回答"}
+	s := fakeService("main", primary, 0)
+	s.recorder = rec
+	b := fakeService("fast", backup, 0)
+	b.recorder = rec
+	s.fallbacks = func() []*AIService { return []*AIService{b} }
+
+	userID := uuid.New()
+	ctx := WithUsageScope(context.Background(), UsageScope{UserID: &userID, Department: "研发", Purpose: PurposeAnswer})
+	if _, _, err := s.generate(WithUsagePurpose(ctx, PurposePlanning), []*schema.Message{schema.UserMessage("你好")}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 只记录成功的调用，归属到实际回答的模型配置；未返回用量时按文本估算
+	if len(rec.usage) != 1 {
+		t.Fatalf("expected one record, got %d", len(rec.usage))
+	}
+	u := rec.usage[0]
+	if u.Profile != "fast" || u.Scope.Purpose != PurposePlanning || u.Scope.Department != "研发" || *u.Scope.UserID != userID {
+		t.Errorf("unexpected usage attribution: %+v", u)
+	}
+	if !u.Estimated || u.PromptTokens == 0 || u.CompletionTokens != EstimateTokens("回答") {
+		t.Errorf("missing usage should be estimated: %+v", u)
+	}
+
+	if got := UsageScopeFrom(context.Background()).Purpose; got != PurposeChat {
+		t.Errorf("unscoped calls should default to chat, got %s", got)
+	}
+}
+
+func TestMergeUsage(t *testing.T) {
+	chunk := func(prompt, completion int) *schema.Message {
+		return &schema.Message{ResponseMeta: &schema.ResponseMeta{Usage: &schema.TokenUsage{PromptTokens: prompt, CompletionTokens: completion}}}
+	}
+	var acc *schema.TokenUsage
+	for _, c := range []*schema.Message{chunk(120, 1), {Content: "x"}, chunk(0, 48)} {
+		acc = mergeUsage(acc, c)
+	}
+	if acc.PromptTokens != 120 || acc.CompletionTokens != 48 || acc.TotalTokens != 168 {
+		t.Errorf("unexpected merged usage: %+v", acc)
+	}
+}
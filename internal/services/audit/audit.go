@@ -0,0 +1,220 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/services/ai"
+)
+
+// 审计动作
+const (
+	ActionCreate      = "create"
+	ActionUpdate      = "update"
+	ActionDelete      = "delete"
+	ActionExecute     = "execute" // 工具执行（手动执行与对话中的调用）
+	ActionLogin       = "login"
+	ActionLoginFailed = "login_failed"
+	ActionLogout      = "logout"
+	ActionExport      = "export" // 导出审计日志
+)
+
+// redacted 敏感字段在审计日志中的替代值
+const redacted = "[REDACTED]"
+
+// Actor 操作者，随请求上下文传递给 GORM 回调
+type Actor struct {
+	UserID    *uuid.UUID
+	IPAddress string
+	UserAgent string
+}
+
+type actorKey struct{}
+
+// WithActor 在上下文中记录操作者，经 db.WithContext 传入的语句据此记录审计日志的操作者
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom 上下文中的操作者，未设置时为零值（系统操作）
+func ActorFrom(ctx context.Context) Actor {
+	if ctx == nil {
+		return Actor{}
+	}
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// ipAddress 审计日志的 IP 字段为 inet 类型，无法解析的地址不记录
+func (a Actor) ipAddress() *string {
+	ip := net.ParseIP(strings.TrimSpace(a.IPAddress))
+	if ip == nil {
+		return nil
+	}
+	s := ip.String()
+	return &s
+}
+
+// Record 写入一条审计日志，用于登录、退出登录等不对应数据变更的操作
+// 未指定 UserID 时使用上下文中的操作者。
+func Record(ctx context.Context, db *gorm.DB, entry models.AuditLog) error {
+	actor := ActorFrom(ctx)
+	if entry.UserID == nil {
+		entry.UserID = actor.UserID
+	}
+	entry.IPAddress = actor.ipAddress()
+	entry.UserAgent = actor.UserAgent
+	return db.WithContext(ctx).Create(&entry).Error
+}
+
+// resource 受审计的表
+type resource struct {
+	Type         string   // 审计日志的资源类型
+	CreateAction string   // 新增记录的审计动作，默认 create
+	Ignore       []string // 不记录变化的列，只有这些列变化时不写审计日志
+	ActorColumn  string   // 上下文中没有操作者时，以该列（用户ID）作为操作者
+	// Redact 隐去敏感字段，row 为完整的一行（新增、删除时即 values）
+	Redact func(row, values map[string]interface{})
+}
+
+// resources 受审计的表，按表名索引
+var resources = map[string]resource{
+	"users": {
+		Type:   "user",
+		Ignore: []string{"last_login_at"},
+		Redact: redactColumns("password_hash", "external_id"),
+	},
+	"api_keys": {
+		Type:   "api_key",
+		Ignore: []string{"last_used_at", "last_used_ip"},
+		Redact: redactColumns("key_hash"),
+	},
+	"roles":            {Type: "role"},
+	"role_assignments": {Type: "role_assignment"},
+	"tools": {
+		Type:   "tool",
+		Redact: redactColumns("auth_config"),
+	},
+	"tool_executions": {
+		Type:         "tool_execution",
+		CreateAction: ActionExecute,
+		ActorColumn:  "user_id",
+		Redact:       redactColumns("output_result"),
+	},
+	"system_configs": {
+		Type:   "system_config",
+		Redact: redactSecretConfig,
+	},
+	"knowledge_categories": {Type: "knowledge_category"},
+	"knowledge_documents": {
+		Type: "document",
+		// 浏览计数与向量化索引状态由系统维护，不属于文档编辑
+		Ignore: []string{"view_count", "like_count", "index_status", "index_error", "indexed_version", "chunk_count", "index_started_at", "indexed_at"},
+	},
+	"usage_quotas": {Type: "usage_quota"},
+}
+
+// ignoredColumns 所有表都不记录变化的列
+var ignoredColumns = []string{"updated_at"}
+
+func (r resource) ignored(column string) bool {
+	for _, c := range ignoredColumns {
+		if c == column {
+			return true
+		}
+	}
+	for _, c := range r.Ignore {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (r resource) createAction() string {
+	if r.CreateAction != "" {
+		return r.CreateAction
+	}
+	return ActionCreate
+}
+
+// diff 更新前后发生变化的列，敏感字段隐去取值；没有变化时返回 nil
+func (r resource) diff(before, after map[string]interface{}) (models.JSONMap, models.JSONMap) {
+	oldValues, newValues := models.JSONMap{}, models.JSONMap{}
+	for column, value := range after {
+		if r.ignored(column) {
+			continue
+		}
+		if old, ok := before[column]; !ok || !jsonEqual(old, value) {
+			oldValues[column] = before[column]
+			newValues[column] = value
+		}
+	}
+	if len(newValues) == 0 {
+		return nil, nil
+	}
+	if r.Redact != nil {
+		r.Redact(before, oldValues)
+		r.Redact(after, newValues)
+	}
+	return oldValues, newValues
+}
+
+// values 新增或删除的一整行，敏感字段隐去取值
+func (r resource) values(row map[string]interface{}) models.JSONMap {
+	values := make(models.JSONMap, len(row))
+	for column, value := range row {
+		values[column] = value
+	}
+	if r.Redact != nil {
+		r.Redact(row, values)
+	}
+	return values
+}
+
+// entry 构造审计日志，操作者取自上下文，没有时按 ActorColumn 取行中的用户
+func (r resource) entry(ctx context.Context, action string, id *uuid.UUID, row map[string]interface{}, oldValues, newValues models.JSONMap) models.AuditLog {
+	actor := ActorFrom(ctx)
+	userID := actor.UserID
+	if userID == nil && r.ActorColumn != "" {
+		if s, ok := row[r.ActorColumn].(string); ok {
+			if uid, err := uuid.Parse(s); err == nil {
+				userID = &uid
+			}
+		}
+	}
+	return models.AuditLog{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: r.Type,
+		ResourceID:   id,
+		OldValues:    oldValues,
+		NewValues:    newValues,
+		IPAddress:    actor.ipAddress(),
+		UserAgent:    actor.UserAgent,
+	}
+}
+
+// redactColumns 隐去指定列的非空取值，保留是否设置、是否变化
+func redactColumns(columns ...string) func(row, values map[string]interface{}) {
+	return func(_, values map[string]interface{}) {
+		for _, c := range columns {
+			if v, ok := values[c]; ok && v != nil && v != "" {
+				values[c] = redacted
+			}
+		}
+	}
+}
+
+// redactSecretConfig 模型配置（含 API Key，无论是否标记加密）与加密的系统配置不记录取值
+func redactSecretConfig(row, values map[string]interface{}) {
+	encrypted, _ := row["is_encrypted"].(bool)
+	if encrypted || row["config_type"] == ai.ProfileConfigType {
+		redactColumns("config_value")(row, values)
+	}
+}
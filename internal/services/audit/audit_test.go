@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm/schema"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/services/ai"
+)
+
+func parseSchema(t *testing.T, model interface{}) *schema.Schema {
+	t.Helper()
+	s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSnapshotAndDiff(t *testing.T) {
+	ctx := context.Background()
+	s := parseSchema(t, &models.Tool{})
+	r := resources[s.Table]
+
+	tool := models.Tool{
+		ID:          uuid.New(),
+		Name:        "restart_service",
+		DisplayName: "重启服务",
+		ToolType:    "api",
+		Config:      models.JSONMap{"url": "https://ops.example.com/restart"},
+		AuthConfig:  models.JSONMap{"token": "secret"},
+		Enabled:     true,
+		UpdatedAt:   time.Now(),
+	}
+	before := snapshot(ctx, s, reflect.ValueOf(tool))
+	if before["id"] != tool.ID.String() || before["enabled"] != true {
+		t.Fatalf("snapshot should be keyed by column with JSON values: %v", before)
+	}
+	if _, ok := before["creator"]; ok {
+		t.Errorf("relations should not be part of the snapshot: %v", before)
+	}
+
+	// 只有更新时间变化时没有需要记录的内容
+	tool.UpdatedAt = tool.UpdatedAt.Add(time.Second)
+	if oldValues, newValues := r.diff(before, snapshot(ctx, s, reflect.ValueOf(tool))); oldValues != nil || newValues != nil {
+		t.Errorf("updated_at alone should not be audited: %v -> %v", oldValues, newValues)
+	}
+
+	tool.Enabled = false
+	tool.AuthConfig = models.JSONMap{"token": "rotated"}
+	oldValues, newValues := r.diff(before, snapshot(ctx, s, reflect.ValueOf(tool)))
+	if len(newValues) != 2 || oldValues["enabled"] != true || newValues["enabled"] != false {
+		t.Errorf("only changed columns should be recorded: %v -> %v", oldValues, newValues)
+	}
+	if oldValues["auth_config"] != redacted || newValues["auth_config"] != redacted {
+		t.Errorf("credentials should be redacted: %v -> %v", oldValues, newValues)
+	}
+
+	// 新增的整行同样隐去凭据
+	if values := r.values(before); values["auth_config"] != redacted || values["name"] != "restart_service" {
+		t.Errorf("unexpected create values: %v", values)
+	}
+}
+
+func TestIgnoredColumns(t *testing.T) {
+	r := resources["users"]
+	before := map[string]interface{}{"status": "active", "last_login_at": nil}
+	after := map[string]interface{}{"status": "active", "last_login_at": "2026-10-17T09:00:00Z"}
+	if _, newValues := r.diff(before, after); newValues != nil {
+		t.Errorf("last login time should not be audited: %v", newValues)
+	}
+
+	doc := resources["knowledge_documents"]
+	before = map[string]interface{}{"content": "v1", "view_count": 1, "index_status": "indexed"}
+	after = map[string]interface{}{"content": "v2", "view_count": 2, "index_status": "pending"}
+	if _, newValues := doc.diff(before, after); len(newValues) != 1 || newValues["content"] != "v2" {
+		t.Errorf("only document edits should be audited: %v", newValues)
+	}
+}
+
+func TestRedactSecretConfig(t *testing.T) {
+	r := resources["system_configs"]
+	plain := map[string]interface{}{"config_key": "site", "config_value": map[string]interface{}{"name": "orion"}, "is_encrypted": false}
+	if values := r.values(plain); values["config_value"] == redacted {
+		t.Errorf("plain config should be recorded: %v", values)
+	}
+	// 模型配置含 API Key，未标记加密也不记录
+	profile := map[string]interface{}{"config_key": "fast", "config_type": ai.ProfileConfigType, "config_value": map[string]interface{}{"api_key": "sk-xxx"}, "is_encrypted": false}
+	if values := r.values(profile); values["config_value"] != redacted {
+		t.Errorf("llm profile should be redacted: %v", values)
+	}
+	before := map[string]interface{}{"config_type": ai.ProfileConfigType, "config_value": map[string]interface{}{"api_key": "sk-old"}, "is_encrypted": false}
+	after := map[string]interface{}{"config_type": ai.ProfileConfigType, "config_value": map[string]interface{}{"api_key": "sk-new"}, "is_encrypted": false}
+	if oldValues, newValues := r.diff(before, after); oldValues["config_value"] != redacted || newValues["config_value"] != redacted {
+		t.Errorf("llm profile changes should be redacted: %v -> %v", oldValues, newValues)
+	}
+}
+
+func TestEntryActor(t *testing.T) {
+	userID, actorID, execID := uuid.New(), uuid.New(), uuid.New()
+	row := map[string]interface{}{"id": execID.String(), "user_id": userID.String()}
+	r := resources["tool_executions"]
+
+	// 对话中的工具调用没有请求上下文，以执行记录的用户为操作者
+	e := r.entry(context.Background(), r.createAction(), &execID, row, nil, r.values(row))
+	if e.Action != ActionExecute || e.ResourceType != "tool_execution" || e.UserID == nil || *e.UserID != userID || e.IPAddress != nil {
+		t.Errorf("unexpected entry without actor: %+v", e)
+	}
+
+	ctx := WithActor(context.Background(), Actor{UserID: &actorID, IPAddress: "10.0.0.8", UserAgent: "curl/8.0"})
+	e = r.entry(ctx, ActionUpdate, &execID, row, nil, nil)
+	if *e.UserID != actorID || e.IPAddress == nil || *e.IPAddress != "10.0.0.8" || e.UserAgent != "curl/8.0" {
+		t.Errorf("actor in context should take precedence: %+v", e)
+	}
+
+	// inet 列无法保存的地址不记录
+	if ip := (Actor{IPAddress: "unknown"}).ipAddress(); ip != nil {
+		t.Errorf("invalid ip should be dropped: %v", *ip)
+	}
+}
+
+func TestEachStruct(t *testing.T) {
+	tools := []models.Tool{{Name: "a"}, {Name: "b"}}
+	var names []string
+	for _, v := range []interface{}{&tools, tools, &tools[0], (*models.Tool)(nil)} {
+		eachStruct(reflect.ValueOf(v), func(rv reflect.Value) {
+			names = append(names, rv.FieldByName("Name").String())
+		})
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "a", "b", "a"}) {
+		t.Errorf("unexpected structs: %v", names)
+	}
+}
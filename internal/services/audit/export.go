@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// 导出格式
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// Filter 审计日志查询条件，零值表示不限
+type Filter struct {
+	UserID       *uuid.UUID // 操作者
+	Actions      []string
+	ResourceType string
+	ResourceID   *uuid.UUID
+	From         *time.Time // 包含
+	To           *time.Time // 不包含
+}
+
+// Apply 把查询条件加到 audit_logs 的查询上
+func (f Filter) Apply(query *gorm.DB) *gorm.DB {
+	if f.UserID != nil {
+		query = query.Where("audit_logs.user_id = ?", *f.UserID)
+	}
+	if len(f.Actions) > 0 {
+		query = query.Where("audit_logs.action IN ?", f.Actions)
+	}
+	if f.ResourceType != "" {
+		query = query.Where("audit_logs.resource_type = ?", f.ResourceType)
+	}
+	if f.ResourceID != nil {
+		query = query.Where("audit_logs.resource_id = ?", *f.ResourceID)
+	}
+	if f.From != nil {
+		query = query.Where("audit_logs.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("audit_logs.created_at < ?", *f.To)
+	}
+	return query
+}
+
+// Entry 审计日志的查询结果，也是导出的格式
+type Entry struct {
+	ID           uuid.UUID      `json:"id"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UserID       *uuid.UUID     `json:"userId"`
+	Username     string         `json:"username"`
+	Action       string         `json:"action"`
+	ResourceType string         `json:"resourceType"`
+	ResourceID   *uuid.UUID     `json:"resourceId"`
+	OldValues    models.JSONMap `json:"oldValues"`
+	NewValues    models.JSONMap `json:"newValues"`
+	IPAddress    *string        `json:"ipAddress"`
+	UserAgent    string         `json:"userAgent"`
+}
+
+// NewEntry 由审计日志构造查询结果，需预加载 User 才有用户名
+func NewEntry(log models.AuditLog) Entry {
+	e := Entry{
+		ID:           log.ID,
+		CreatedAt:    log.CreatedAt,
+		UserID:       log.UserID,
+		Action:       log.Action,
+		ResourceType: log.ResourceType,
+		ResourceID:   log.ResourceID,
+		OldValues:    log.OldValues,
+		NewValues:    log.NewValues,
+		IPAddress:    log.IPAddress,
+		UserAgent:    log.UserAgent,
+	}
+	if log.User != nil {
+		e.Username = log.User.Username
+	}
+	return e
+}
+
+// Exporter 逐条写出审计日志
+type Exporter interface {
+	Write(e Entry) error
+	Flush() error
+}
+
+// NewExporter 按格式创建导出：csv 首行为表头，jsonl 每行一个 JSON 对象
+func NewExporter(w io.Writer, format string) (Exporter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvExporter{w: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		return &jsonlExporter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+var csvHeader = []string{"id", "createdAt", "userId", "username", "action", "resourceType", "resourceId", "oldValues", "newValues", "ipAddress", "userAgent"}
+
+type csvExporter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (x *csvExporter) Write(e Entry) error {
+	if !x.wroteHeader {
+		if err := x.w.Write(csvHeader); err != nil {
+			return err
+		}
+		x.wroteHeader = true
+	}
+	oldValues, err := jsonCell(e.OldValues)
+	if err != nil {
+		return err
+	}
+	newValues, err := jsonCell(e.NewValues)
+	if err != nil {
+		return err
+	}
+	record := []string{
+		e.ID.String(),
+		e.CreatedAt.Format(time.RFC3339Nano),
+		uuidCell(e.UserID),
+		e.Username,
+		e.Action,
+		e.ResourceType,
+		uuidCell(e.ResourceID),
+		oldValues,
+		newValues,
+		stringCell(e.IPAddress),
+		e.UserAgent,
+	}
+	for i := range record {
+		record[i] = csvCell(record[i])
+	}
+	return x.w.Write(record)
+}
+
+// Flush 没有任何记录时也写出表头
+func (x *csvExporter) Flush() error {
+	if !x.wroteHeader {
+		if err := x.w.Write(csvHeader); err != nil {
+			return err
+		}
+		x.wroteHeader = true
+	}
+	x.w.Flush()
+	return x.w.Error()
+}
+
+type jsonlExporter struct {
+	enc *json.Encoder
+}
+
+func (x *jsonlExporter) Write(e Entry) error {
+	return x.enc.Encode(e)
+}
+
+func (x *jsonlExporter) Flush() error {
+	return nil
+}
+
+// csvCell 以 = + - @、制表符或回车开头的内容在表格软件中会被当作公式执行，加单引号前缀
+// 每一列都经过处理，不区分取值是否来自用户输入
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func jsonCell(values models.JSONMap) (string, error) {
+	if values == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(values)
+	return string(data), err
+}
+
+func uuidCell(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func stringCell(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
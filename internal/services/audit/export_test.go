@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	x, err := NewExporter(&buf, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, toolID := uuid.New(), uuid.New()
+	ip := "10.0.0.8"
+	entry := NewEntry(models.AuditLog{
+		ID:           uuid.New(),
+		UserID:       &userID,
+		Action:       ActionUpdate,
+		ResourceType: "tool",
+		ResourceID:   &toolID,
+		OldValues:    models.JSONMap{"enabled": true},
+		NewValues:    models.JSONMap{"enabled": false},
+		IPAddress:    &ip,
+		UserAgent:    "=HYPERLINK(\"https://evil.example.com\")",
+		CreatedAt:    time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC),
+		User:         &models.User{Username: "alice"},
+	})
+	if err := x.Write(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		t.Fatalf("expected header and one row: %v", records)
+	}
+	row := records[1]
+	if row[1] != "2026-10-17T09:00:00Z" || row[2] != userID.String() || row[3] != "alice" || row[6] != toolID.String() || row[9] != ip {
+		t.Errorf("unexpected row: %v", row)
+	}
+	if row[7] != `{"enabled":true}` || row[8] != `{"enabled":false}` {
+		t.Errorf("values should be exported as JSON: %v", row)
+	}
+	// 防止在表格软件中被当作公式执行
+	if !strings.HasPrefix(row[10], "'=") {
+		t.Errorf("formula should be escaped: %q", row[10])
+	}
+}
+
+func TestExportCSVEscapesEveryCell(t *testing.T) {
+	var buf bytes.Buffer
+	x, _ := NewExporter(&buf, FormatCSV)
+	ip := "+10.0.0.8"
+	entry := NewEntry(models.AuditLog{
+		ID:           uuid.New(),
+		Action:       "-2+3",
+		ResourceType: "@SUM(A1:A9)",
+		IPAddress:    &ip,
+		UserAgent:    "\tcmd",
+		User:         &models.User{Username: "=1+1"},
+	})
+	if err := x.Write(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := records[1]
+	for i, want := range map[int]string{3: "'=1+1", 4: "'-2+3", 5: "'@SUM(A1:A9)", 9: "'+10.0.0.8", 10: "'\tcmd"} {
+		if row[i] != want {
+			t.Errorf("column %s should be escaped: got %q, want %q", csvHeader[i], row[i], want)
+		}
+	}
+	for _, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			t.Errorf("cell %q starts with a formula character", cell)
+		}
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	cases := map[string]string{
+		"":           "",
+		"alice":      "alice",
+		"=cmd|' /C'": "'=cmd|' /C'",
+		"+1":         "'+1",
+		"-1":         "'-1",
+		"@A1":        "'@A1",
+		"\t=1":       "'\t=1",
+		"\r=1":       "'\r=1",
+		"a=1":        "a=1",
+		`{"a":"=1"}`: `{"a":"=1"}`,
+	}
+	for in, want := range cases {
+		if got := csvCell(in); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExportCSVHeaderOnly(t *testing.T) {
+	var buf bytes.Buffer
+	x, _ := NewExporter(&buf, FormatCSV)
+	if err := x.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != strings.Join(csvHeader, ",") {
+		t.Errorf("empty export should contain the header: %q", got)
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	var buf bytes.Buffer
+	x, err := NewExporter(&buf, FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{ActionLogin, ActionLogout} {
+		if err := x.Write(NewEntry(models.AuditLog{ID: uuid.New(), Action: action, ResourceType: "user"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := x.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one entry per line: %q", buf.String())
+	}
+	var e Entry
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil || e.Action != ActionLogout || e.UserID != nil {
+		t.Errorf("unexpected entry %+v: %v", e, err)
+	}
+
+	if _, err := NewExporter(&buf, "xlsx"); err == nil {
+		t.Error("unsupported format should be rejected")
+	}
+}
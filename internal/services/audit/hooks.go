@@ -0,0 +1,311 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+const (
+	beforeKey = "audit:before"
+	// maxRows 一条更新、删除语句最多审计的行数，超出的行不记录
+	maxRows = 1000
+)
+
+// Register 注册审计回调：受审计的表（见 resources）经 GORM 新增、更新、删除时自动写入审计日志
+// 更新记录变化前后的取值，删除记录删除前的整行。审计日志与变更在同一事务中写入，写入失败时变更一并回滚。
+// 操作者取自语句上下文（WithActor），未设置时为系统操作；Exec、Raw 执行的 SQL 不经过回调，不会被审计。
+func Register(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register("audit:after_create", afterCreate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("audit:before_update", beforeChange); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("audit:after_update", afterUpdate); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("audit:before_delete", beforeChange); err != nil {
+		return err
+	}
+	return callbacks.Delete().After("gorm:delete").Register("audit:after_delete", afterDelete)
+}
+
+// auditedRow 变更前的一行
+type auditedRow struct {
+	id  uuid.UUID
+	row map[string]interface{}
+}
+
+func resourceOf(db *gorm.DB) (resource, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return resource{}, false
+	}
+	r, ok := resources[db.Statement.Schema.Table]
+	return r, ok
+}
+
+func afterCreate(db *gorm.DB) {
+	// ON CONFLICT DO NOTHING 未插入时不记录
+	r, ok := resourceOf(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	stmt := db.Statement
+
+	var logs []models.AuditLog
+	eachStruct(stmt.ReflectValue, func(rv reflect.Value) {
+		id, ok := primaryKey(stmt.Context, stmt.Schema, rv)
+		if !ok {
+			return
+		}
+		row := snapshot(stmt.Context, stmt.Schema, rv)
+		logs = append(logs, r.entry(stmt.Context, r.createAction(), &id, row, nil, r.values(row)))
+	})
+	write(db, logs)
+}
+
+// beforeChange 读取将被更新或删除的行
+func beforeChange(db *gorm.DB) {
+	r, ok := resourceOf(db)
+	if !ok {
+		return
+	}
+	// Update("col", v)、Updates(map) 只改动不需审计的列（如最近登录时间）时不查询
+	if columns, ok := assignedColumns(db.Statement); ok {
+		skip := true
+		for _, c := range columns {
+			if !r.ignored(c) {
+				skip = false
+				break
+			}
+		}
+		if skip {
+			return
+		}
+	}
+
+	rows, err := loadRows(db, conditions(db.Statement))
+	if err != nil {
+		db.AddError(fmt.Errorf("读取审计数据失败: %w", err))
+		return
+	}
+	if len(rows) > 0 {
+		db.InstanceSet(beforeKey, rows)
+	}
+}
+
+func afterUpdate(db *gorm.DB) {
+	r, ok := resourceOf(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	before := beforeRows(db)
+	if len(before) == 0 {
+		return
+	}
+
+	ids := make([]uuid.UUID, len(before))
+	for i, b := range before {
+		ids[i] = b.id
+	}
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	after, err := loadRows(db, []clause.Expression{clause.IN{
+		Column: clause.Column{Table: clause.CurrentTable, Name: pk},
+		Values: uuidValues(ids),
+	}})
+	if err != nil {
+		db.AddError(fmt.Errorf("读取审计数据失败: %w", err))
+		return
+	}
+	updated := make(map[uuid.UUID]map[string]interface{}, len(after))
+	for _, a := range after {
+		updated[a.id] = a.row
+	}
+
+	var logs []models.AuditLog
+	for _, b := range before {
+		row, ok := updated[b.id]
+		if !ok {
+			continue
+		}
+		oldValues, newValues := r.diff(b.row, row)
+		if newValues == nil {
+			continue
+		}
+		id := b.id
+		logs = append(logs, r.entry(db.Statement.Context, ActionUpdate, &id, row, oldValues, newValues))
+	}
+	write(db, logs)
+}
+
+func afterDelete(db *gorm.DB) {
+	r, ok := resourceOf(db)
+	if !ok || db.RowsAffected == 0 {
+		return
+	}
+	var logs []models.AuditLog
+	for _, b := range beforeRows(db) {
+		id := b.id
+		logs = append(logs, r.entry(db.Statement.Context, ActionDelete, &id, b.row, r.values(b.row), nil))
+	}
+	write(db, logs)
+}
+
+func beforeRows(db *gorm.DB) []auditedRow {
+	v, ok := db.InstanceGet(beforeKey)
+	if !ok {
+		return nil
+	}
+	return v.([]auditedRow)
+}
+
+// write 在变更所在的事务中写入审计日志
+func write(db *gorm.DB, logs []models.AuditLog) {
+	if len(logs) == 0 {
+		return
+	}
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&logs).Error; err != nil {
+		db.AddError(fmt.Errorf("写入审计日志失败: %w", err))
+	}
+}
+
+// conditions 定位被更新、删除的行：语句的 WHERE 条件，加上模型的主键（Model(&user)、Delete(&tool)）
+// 没有任何条件时返回 nil，此时 GORM 会拒绝执行全表更新或删除。
+func conditions(stmt *gorm.Statement) []clause.Expression {
+	var exprs []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			exprs = append(exprs, where.Exprs...)
+		}
+	}
+
+	if stmt.Model != nil && stmt.Schema.PrioritizedPrimaryField != nil {
+		var ids []uuid.UUID
+		eachStruct(reflect.ValueOf(stmt.Model), func(rv reflect.Value) {
+			if id, ok := primaryKey(stmt.Context, stmt.Schema, rv); ok {
+				ids = append(ids, id)
+			}
+		})
+		if len(ids) > 0 {
+			exprs = append(exprs, clause.IN{
+				Column: clause.Column{Table: clause.CurrentTable, Name: stmt.Schema.PrioritizedPrimaryField.DBName},
+				Values: uuidValues(ids),
+			})
+		}
+	}
+	return exprs
+}
+
+// loadRows 在变更所在的事务中读取满足条件的行
+func loadRows(db *gorm.DB, exprs []clause.Expression) ([]auditedRow, error) {
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	s := db.Statement.Schema
+	dest := reflect.New(reflect.SliceOf(s.ModelType))
+	err := db.Session(&gorm.Session{NewDB: true}).
+		Clauses(clause.Where{Exprs: exprs}).
+		Limit(maxRows).
+		Find(dest.Interface()).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []auditedRow
+	eachStruct(dest, func(rv reflect.Value) {
+		if id, ok := primaryKey(db.Statement.Context, s, rv); ok {
+			rows = append(rows, auditedRow{id: id, row: snapshot(db.Statement.Context, s, rv)})
+		}
+	})
+	return rows, nil
+}
+
+// assignedColumns Update、Updates(map) 更新的列；按结构体更新时无法确定，返回 false
+func assignedColumns(stmt *gorm.Statement) ([]string, bool) {
+	values, ok := stmt.Dest.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	columns := make([]string, 0, len(values))
+	for k := range values {
+		if f := stmt.Schema.LookUpField(k); f != nil {
+			columns = append(columns, f.DBName)
+		} else {
+			columns = append(columns, k)
+		}
+	}
+	return columns, true
+}
+
+// snapshot 一行的全部列，按列名索引，取值转换为 JSON 中的形式
+func snapshot(ctx context.Context, s *schema.Schema, rv reflect.Value) map[string]interface{} {
+	row := make(map[string]interface{}, len(s.DBNames))
+	for _, name := range s.DBNames {
+		value, _ := s.FieldsByDBName[name].ValueOf(ctx, rv)
+		row[name] = value
+	}
+
+	data, err := json.Marshal(row)
+	if err != nil {
+		return row
+	}
+	normalized := make(map[string]interface{}, len(row))
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return row
+	}
+	return normalized
+}
+
+// primaryKey 行的主键，未设置时返回 false
+func primaryKey(ctx context.Context, s *schema.Schema, rv reflect.Value) (uuid.UUID, bool) {
+	if s.PrioritizedPrimaryField == nil {
+		return uuid.Nil, false
+	}
+	value, zero := s.PrioritizedPrimaryField.ValueOf(ctx, rv)
+	id, ok := value.(uuid.UUID)
+	return id, ok && !zero && id != uuid.Nil
+}
+
+// eachStruct 遍历结构体或结构体切片（含指针）中的每个结构体
+func eachStruct(rv reflect.Value, fn func(reflect.Value)) {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		fn(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			eachStruct(rv.Index(i), fn)
+		}
+	}
+}
+
+func uuidValues(ids []uuid.UUID) []interface{} {
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	return values
+}
+
+// jsonEqual 比较两个 JSON 取值
+func jsonEqual(a, b interface{}) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/jwt"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrInvalidScope   = errors.New("invalid scope")
+)
+
+// API Key 的权限范围，JWT 登录会话不受限制
+const (
+	ScopeChat           = "chat"            // 对话、模型列表与个人用量
+	ScopeKnowledgeRead  = "knowledge:read"  // 知识库检索
+	ScopeKnowledgeWrite = "knowledge:write" // 知识分类与文档的增删改
+	ScopeToolsRead      = "tools:read"      // 查看工具与执行记录
+	ScopeToolsExecute   = "tools:execute"   // 测试与执行工具
+	ScopeToolsWrite     = "tools:write"     // 工具的增删改与导入
+)
+
+// Scopes 全部可用的权限范围
+var Scopes = []string{
+	ScopeChat,
+	ScopeKnowledgeRead,
+	ScopeKnowledgeWrite,
+	ScopeToolsRead,
+	ScopeToolsExecute,
+	ScopeToolsWrite,
+}
+
+// APIKeyPrefix API Key 明文的固定前缀，用于与 JWT 区分
+const APIKeyPrefix = "orn_"
+
+const (
+	apiKeyCacheTTL   = 10 * time.Second // 校验结果的缓存时长，与会话一致
+	lastUsedInterval = time.Minute      // 最近使用时间的写入间隔，避免每个请求都写库
+)
+
+// Identity API Key 所代表的身份，角色与部门以所属用户当前信息为准
+type Identity struct {
+	KeyID      uuid.UUID
+	UserID     uuid.UUID
+	Username   string
+	Role       string
+	Department string
+	Scopes     []string
+}
+
+type cachedKey struct {
+	identity  Identity
+	expiresAt *time.Time
+	until     time.Time
+}
+
+// APIKeys API Key 的签发、校验与撤销
+type APIKeys struct {
+	db     *gorm.DB
+	lookup func(ctx context.Context, keyHash string) (models.APIKey, error)
+	touch  func(ctx context.Context, keyID uuid.UUID, ip string, at time.Time) error
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedKey // 密钥摘要 -> 校验结果
+}
+
+// NewAPIKeys 创建 API Key 管理
+func NewAPIKeys(db *gorm.DB) *APIKeys {
+	k := &APIKeys{db: db, now: time.Now, cache: make(map[string]cachedKey)}
+	k.lookup = func(ctx context.Context, keyHash string) (models.APIKey, error) {
+		var key models.APIKey
+		err := db.WithContext(ctx).Joins("User").Where("key_hash = ?", keyHash).First(&key).Error
+		return key, err
+	}
+	k.touch = func(ctx context.Context, keyID uuid.UUID, ip string, at time.Time) error {
+		return db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", keyID).
+			Updates(map[string]interface{}{"last_used_at": at, "last_used_ip": ip}).Error
+	}
+	return k
+}
+
+// IsAPIKey 凭据是否为 API Key（而不是 JWT）
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidateScopes 校验并规范化权限范围：去重、排序，至少一项
+func ValidateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !slices.Contains(normalized, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized, nil
+}
+
+// Create 为用户签发 API Key，返回记录与明文；明文只在此时可见
+func (k *APIKeys) Create(ctx context.Context, userID, createdBy uuid.UUID, name string, scopes []string, expiresAt *time.Time) (models.APIKey, string, error) {
+	scopes, err := ValidateScopes(scopes)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return models.APIKey{}, "", fmt.Errorf("generate api key: %w", err)
+	}
+	plaintext := APIKeyPrefix + hex.EncodeToString(secret)
+
+	key := models.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plaintext[:len(APIKeyPrefix)+8],
+		KeyHash:   jwt.HashToken(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedBy: createdBy,
+		CreatedAt: k.now(),
+	}
+	if err := k.db.WithContext(ctx).Omit("User").Create(&key).Error; err != nil {
+		return models.APIKey{}, "", fmt.Errorf("create api key: %w", err)
+	}
+	return key, plaintext, nil
+}
+
+// Authenticate 校验 API Key 并返回其身份：已撤销、已过期或所属用户已停用的密钥无效
+func (k *APIKeys) Authenticate(ctx context.Context, plaintext, ip string) (*Identity, error) {
+	if !IsAPIKey(plaintext) {
+		return nil, ErrInvalidAPIKey
+	}
+	keyHash := jwt.HashToken(plaintext)
+	now := k.now()
+
+	k.mu.Lock()
+	cached, ok := k.cache[keyHash]
+	k.mu.Unlock()
+	if ok && now.Before(cached.until) && (cached.expiresAt == nil || now.Before(*cached.expiresAt)) {
+		identity := cached.identity
+		return &identity, nil
+	}
+
+	key, err := k.lookup(ctx, keyHash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case key.RevokedAt != nil:
+		err = fmt.Errorf("%w: revoked", ErrInvalidAPIKey)
+	case key.ExpiresAt != nil && !now.Before(*key.ExpiresAt):
+		err = fmt.Errorf("%w: expired", ErrInvalidAPIKey)
+	case key.User.Status != "active":
+		err = fmt.Errorf("%w: %w", ErrInvalidAPIKey, ErrUserInactive)
+	}
+	if err != nil {
+		k.forget(func(c cachedKey) bool { return c.identity.KeyID == key.ID })
+		return nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedInterval {
+		if err := k.touch(ctx, key.ID, ip, now); err != nil {
+			return nil, fmt.Errorf("update api key usage: %w", err)
+		}
+	}
+
+	identity := Identity{
+		KeyID:      key.ID,
+		UserID:     key.UserID,
+		Username:   key.User.Username,
+		Role:       key.User.Role,
+		Department: key.User.Department,
+		Scopes:     key.Scopes,
+	}
+	k.mu.Lock()
+	if len(k.cache) > 10000 {
+		for h, c := range k.cache {
+			if !now.Before(c.until) {
+				delete(k.cache, h)
+			}
+		}
+	}
+	k.cache[keyHash] = cachedKey{identity: identity, expiresAt: key.ExpiresAt, until: now.Add(apiKeyCacheTTL)}
+	k.mu.Unlock()
+	return &identity, nil
+}
+
+// List 用户的 API Key（含已撤销、已过期的），最近创建的在前
+func (k *APIKeys) List(ctx context.Context, userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := k.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke 撤销一个 API Key；owner 不为 uuid.Nil 时只能撤销该用户自己的密钥
+func (k *APIKeys) Revoke(ctx context.Context, keyID, owner uuid.UUID) error {
+	query := k.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ? AND revoked_at IS NULL", keyID)
+	if owner != uuid.Nil {
+		query = query.Where("user_id = ?", owner)
+	}
+	result := query.Update("revoked_at", k.now())
+	if result.Error != nil {
+		return result.Error
+	}
+	k.forget(func(c cachedKey) bool { return c.identity.KeyID == keyID })
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// ForgetUser 清除用户全部密钥在本实例的校验缓存，使停用用户、修改角色等立即生效
+func (k *APIKeys) ForgetUser(userID uuid.UUID) {
+	k.forget(func(c cachedKey) bool { return c.identity.UserID == userID })
+}
+
+func (k *APIKeys) forget(match func(cachedKey) bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for h, c := range k.cache {
+		if match(c) {
+			delete(k.cache, h)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/jwt"
+)
+
+func TestValidateScopes(t *testing.T) {
+	scopes, err := ValidateScopes([]string{ScopeToolsExecute, ScopeChat, ScopeChat})
+	if err != nil || !slices.Equal(scopes, []string{ScopeChat, ScopeToolsExecute}) {
+		t.Errorf("scopes should be deduplicated and sorted: %v, %v", scopes, err)
+	}
+	if _, err := ValidateScopes(nil); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("empty scopes should be rejected: %v", err)
+	}
+	if _, err := ValidateScopes([]string{ScopeChat, "admin"}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("unknown scope should be rejected: %v", err)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	now := time.Now()
+	user := models.User{ID: uuid.New(), Username: "ci-bot", Role: "user", Department: "运维", Status: "active"}
+	plaintext := APIKeyPrefix + "0123456789abcdef0123456789abcdef0123456789abcdef"
+	key := models.APIKey{ID: uuid.New(), UserID: user.ID, KeyHash: jwt.HashToken(plaintext), Scopes: []string{ScopeChat}, User: user}
+	lookups, touches := 0, 0
+
+	k := &APIKeys{now: func() time.Time { return now }, cache: make(map[string]cachedKey)}
+	k.lookup = func(ctx context.Context, keyHash string) (models.APIKey, error) {
+		lookups++
+		if keyHash != key.KeyHash {
+			return models.APIKey{}, gorm.ErrRecordNotFound
+		}
+		return key, nil
+	}
+	k.touch = func(ctx context.Context, keyID uuid.UUID, ip string, at time.Time) error {
+		touches++
+		key.LastUsedAt = &at
+		return nil
+	}
+	ctx := context.Background()
+
+	identity, err := k.Authenticate(ctx, plaintext, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("active key should be valid: %v", err)
+	}
+	if identity.UserID != user.ID || identity.Role != "user" || !slices.Equal(identity.Scopes, []string{ScopeChat}) {
+		t.Errorf("identity should come from the key and its owner: %+v", identity)
+	}
+	if touches != 1 {
+		t.Errorf("first use should be recorded, touches=%d", touches)
+	}
+
+	// 缓存时长内不再查库
+	k.Authenticate(ctx, plaintext, "10.0.0.1")
+	if lookups != 1 {
+		t.Errorf("valid key should be cached, lookups=%d", lookups)
+	}
+
+	// 最近使用时间按间隔写入
+	now = now.Add(apiKeyCacheTTL)
+	k.Authenticate(ctx, plaintext, "10.0.0.1")
+	if lookups != 2 || touches != 1 {
+		t.Errorf("last used should be throttled, lookups=%d touches=%d", lookups, touches)
+	}
+	now = now.Add(lastUsedInterval)
+	k.Authenticate(ctx, plaintext, "10.0.0.1")
+	if touches != 2 {
+		t.Errorf("last used should be refreshed after the interval, touches=%d", touches)
+	}
+
+	// 所属用户停用后立即失效（本实例清除缓存）
+	key.User.Status = "inactive"
+	k.ForgetUser(user.ID)
+	if _, err := k.Authenticate(ctx, plaintext, ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("key of an inactive user should be rejected: %v", err)
+	}
+	key.User.Status = "active"
+
+	// 过期时间早于缓存过期时也立即失效
+	expiresAt := now.Add(time.Second)
+	key.ExpiresAt = &expiresAt
+	if _, err := k.Authenticate(ctx, plaintext, ""); err != nil {
+		t.Fatalf("unexpired key should be valid: %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := k.Authenticate(ctx, plaintext, ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expired key should be rejected: %v", err)
+	}
+	key.ExpiresAt = nil
+
+	revokedAt := now
+	key.RevokedAt = &revokedAt
+	if _, err := k.Authenticate(ctx, plaintext, ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("revoked key should be rejected: %v", err)
+	}
+
+	if _, err := k.Authenticate(ctx, APIKeyPrefix+"unknown", ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("unknown key should be rejected: %v", err)
+	}
+	if _, err := k.Authenticate(ctx, "eyJhbGciOiJIUzI1NiJ9", ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("non api key should be rejected: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+var ErrInvalidPermission = errors.New("invalid permission")
+
+// 权限名称，角色中可以使用 "*"（全部权限）或以 ".*"、":*" 结尾的通配符（如 tools.*、tools.execute:*）
+const (
+	PermUsersManage            = "users.manage"              // 用户、服务账号与其 API Key
+	PermRolesManage            = "roles.manage"              // 角色与角色分配
+	PermSystemConfig           = "system.config"             // 系统配置与模型配置重载
+	PermUsageManage            = "usage.manage"              // 用量报表与 token 配额
+	PermStatsRead              = "stats.read"                // 系统统计
+	PermAuditRead              = "audit.read"                // 查询与导出审计日志
+	PermKnowledgeWrite         = "knowledge.write"           // 知识分类与文档的增删改、重建索引
+	PermToolsManage            = "tools.manage"              // 工具的增删改、启停与连接测试
+	PermToolsScript            = "tools.script"              // 配置脚本工具（在服务端执行代码）
+	PermToolsImport            = "tools.import"              // 从 OpenAPI 文档导入工具
+	PermToolsExecute           = "tools.execute"             // 执行工具，按工具授权：tools.execute:<工具ID>
+	PermToolsExecutionsReadAll = "tools.executions.read_all" // 查看所有用户的工具执行记录
+	PermConversationsReadAll   = "conversations.read_all"    // 查看所有用户的对话与消息
+)
+
+// PermissionInfo 可分配的权限，供角色编辑界面展示
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// PermissionCatalog 全部可分配的权限
+var PermissionCatalog = []PermissionInfo{
+	{PermUsersManage, "管理用户、服务账号与 API Key"},
+	{PermRolesManage, "管理角色与角色分配"},
+	{PermSystemConfig, "管理系统配置，重新加载模型配置"},
+	{PermUsageManage, "查看用量报表，管理 token 配额"},
+	{PermStatsRead, "查看系统统计"},
+	{PermAuditRead, "查询与导出审计日志"},
+	{PermKnowledgeWrite, "新增、修改、删除知识分类与文档"},
+	{PermToolsManage, "新增、修改、删除、启停与测试工具"},
+	{PermToolsScript, "配置脚本工具"},
+	{PermToolsImport, "从 OpenAPI 文档导入工具"},
+	{PermToolsExecute + ":*", "执行全部工具；tools.execute:<工具ID> 只授权单个工具"},
+	{PermToolsExecutionsReadAll, "查看所有用户的工具执行记录"},
+	{PermConversationsReadAll, "查看所有用户的对话与消息"},
+}
+
+// 内置角色，对应用户的基础角色
+const (
+	RoleAdmin  = "admin"
+	RoleUser   = "user"
+	RoleViewer = "viewer"
+)
+
+// 角色分配的对象类型
+const (
+	SubjectUser       = "user"
+	SubjectDepartment = "department"
+)
+
+// 有效权限的缓存时长：本实例内修改角色立即生效，其它实例上最多延迟这么久
+const permissionCacheTTL = 10 * time.Second
+
+// BuiltInRoles 内置角色及其初始权限；启动时补齐缺失的，已存在的保留管理员的修改
+func BuiltInRoles() []models.Role {
+	return []models.Role{
+		{Name: RoleAdmin, Description: "管理员，拥有全部权限", Permissions: []string{"*"}},
+		{Name: RoleUser, Description: "普通用户：维护知识库与工具，执行全部工具", Permissions: []string{
+			PermKnowledgeWrite, PermToolsManage, PermToolsExecute + ":*",
+		}},
+		{Name: RoleViewer, Description: "只读用户：对话、检索知识库与执行工具", Permissions: []string{
+			PermToolsExecute + ":*",
+		}},
+	}
+}
+
+// ToolExecutePermission 执行指定工具所需的权限
+func ToolExecutePermission(toolID uuid.UUID) string {
+	return PermToolsExecute + ":" + toolID.String()
+}
+
+// MatchPermission 权限模式是否覆盖权限：相同、"*"，或以 "*" 结尾时按前缀匹配
+func MatchPermission(pattern, perm string) bool {
+	if pattern == "*" || pattern == perm {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	return ok && strings.HasPrefix(perm, prefix)
+}
+
+// ValidatePermissions 校验并规范化角色的权限：去重、排序
+func ValidatePermissions(perms []string) ([]string, error) {
+	normalized := make([]string, 0, len(perms))
+	for _, perm := range perms {
+		perm = strings.TrimSpace(perm)
+		if !validPermission(perm) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPermission, perm)
+		}
+		if !slices.Contains(normalized, perm) {
+			normalized = append(normalized, perm)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized, nil
+}
+
+func validPermission(perm string) bool {
+	if perm == "*" {
+		return true
+	}
+	if id, ok := strings.CutPrefix(perm, PermToolsExecute+":"); ok {
+		if id == "*" {
+			return true
+		}
+		parsed, err := uuid.Parse(id)
+		return err == nil && parsed.String() == id
+	}
+	if prefix, ok := strings.CutSuffix(perm, ".*"); ok {
+		for _, p := range PermissionCatalog {
+			if strings.HasPrefix(p.Name, prefix+".") {
+				return true
+			}
+		}
+		return false
+	}
+	return perm != PermToolsExecute && slices.ContainsFunc(PermissionCatalog, func(p PermissionInfo) bool {
+		return p.Name == perm
+	})
+}
+
+// Grants 用户的有效授权：基础角色与分配给本人、所在部门的角色
+type Grants struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"` // 去重排序，可能包含通配符
+}
+
+// Has 是否具备权限；传入通配符时判断是否覆盖其全部权限，用于限制只能授出自己具备的权限
+func (g *Grants) Has(perm string) bool {
+	for _, pattern := range g.Permissions {
+		if MatchPermission(pattern, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantsOf 合并角色的权限
+func grantsOf(roles []models.Role) Grants {
+	g := Grants{Roles: []string{}, Permissions: []string{}}
+	for _, role := range roles {
+		g.Roles = append(g.Roles, role.Name)
+		for _, perm := range role.Permissions {
+			if !slices.Contains(g.Permissions, perm) {
+				g.Permissions = append(g.Permissions, perm)
+			}
+		}
+	}
+	slices.Sort(g.Roles)
+	slices.Sort(g.Permissions)
+	return g
+}
+
+type cachedGrants struct {
+	grants Grants
+	until  time.Time
+}
+
+// Permissions 解析用户的有效权限
+type Permissions struct {
+	db    *gorm.DB
+	roles func(ctx context.Context, userID uuid.UUID) ([]models.Role, error)
+	now   func() time.Time
+
+	mu    sync.Mutex
+	cache map[uuid.UUID]cachedGrants
+}
+
+// NewPermissions 创建权限解析
+func NewPermissions(db *gorm.DB) *Permissions {
+	p := &Permissions{db: db, now: time.Now, cache: make(map[uuid.UUID]cachedGrants)}
+	p.roles = func(ctx context.Context, userID uuid.UUID) ([]models.Role, error) {
+		var user models.User
+		err := db.WithContext(ctx).Select("id", "role", "department").Where("id = ?", userID).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		assigned := db.Model(&models.RoleAssignment{}).Select("role_id").
+			Where("subject_type = ? AND subject = ?", SubjectUser, userID.String())
+		if user.Department != "" {
+			assigned = assigned.Or("subject_type = ? AND subject = ?", SubjectDepartment, user.Department)
+		}
+		var roles []models.Role
+		err = db.WithContext(ctx).Where("name = ?", user.Role).Or("id IN (?)", assigned).Find(&roles).Error
+		return roles, err
+	}
+	return p
+}
+
+// EnsureBuiltInRoles 补齐缺失的内置角色
+func (p *Permissions) EnsureBuiltInRoles(ctx context.Context) error {
+	for _, role := range BuiltInRoles() {
+		role.ID = uuid.New()
+		role.BuiltIn = true
+		if err := p.db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoNothing: true,
+		}).Create(&role).Error; err != nil {
+			return fmt.Errorf("create built-in role %s: %w", role.Name, err)
+		}
+	}
+	return nil
+}
+
+// Resolve 用户的有效授权；用户不存在时没有任何权限
+func (p *Permissions) Resolve(ctx context.Context, userID uuid.UUID) (*Grants, error) {
+	now := p.now()
+	p.mu.Lock()
+	cached, ok := p.cache[userID]
+	p.mu.Unlock()
+	if ok && now.Before(cached.until) {
+		grants := cached.grants
+		return &grants, nil
+	}
+
+	roles, err := p.roles(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("load roles: %w", err)
+	}
+	grants := grantsOf(roles)
+
+	p.mu.Lock()
+	if len(p.cache) > 10000 {
+		for id, c := range p.cache {
+			if !now.Before(c.until) {
+				delete(p.cache, id)
+			}
+		}
+	}
+	p.cache[userID] = cachedGrants{grants: grants, until: now.Add(permissionCacheTTL)}
+	p.mu.Unlock()
+	return &grants, nil
+}
+
+// ForgetUser 清除用户有效权限在本实例的缓存，修改其角色或部门后调用
+func (p *Permissions) ForgetUser(userID uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cache, userID)
+}
+
+// ForgetAll 清除本实例的全部缓存，修改角色或角色分配后调用
+func (p *Permissions) ForgetAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	clear(p.cache)
+}
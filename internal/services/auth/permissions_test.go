@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestMatchPermission(t *testing.T) {
+	toolID := uuid.New()
+	cases := []struct {
+		pattern, perm string
+		want          bool
+	}{
+		{"*", PermUsersManage, true},
+		{PermKnowledgeWrite, PermKnowledgeWrite, true},
+		{PermKnowledgeWrite, PermToolsManage, false},
+		{"tools.*", PermToolsManage, true},
+		{"tools.*", ToolExecutePermission(toolID), true},
+		{"tools.*", PermKnowledgeWrite, false},
+		{"tools.execute:*", ToolExecutePermission(toolID), true},
+		{"tools.execute:*", PermToolsExecutionsReadAll, false},
+		{ToolExecutePermission(toolID), ToolExecutePermission(uuid.New()), false},
+		// 通配符按字面判断覆盖关系，用于限制只能授出自己具备的权限
+		{"tools.*", "tools.execute:*", true},
+		{"tools.execute:*", "tools.*", false},
+		{"tools.*", "*", false},
+	}
+	for _, c := range cases {
+		if got := MatchPermission(c.pattern, c.perm); got != c.want {
+			t.Errorf("MatchPermission(%q, %q) = %v, want %v", c.pattern, c.perm, got, c.want)
+		}
+	}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	toolID := uuid.New()
+	perms, err := ValidatePermissions([]string{PermToolsManage, " knowledge.write", PermToolsManage, ToolExecutePermission(toolID), "tools.*", "*"})
+	if err != nil || !slices.Equal(perms, []string{"*", PermKnowledgeWrite, "tools.*", ToolExecutePermission(toolID), PermToolsManage}) {
+		t.Errorf("permissions should be trimmed, deduplicated and sorted: %v, %v", perms, err)
+	}
+	if perms, err := ValidatePermissions(nil); err != nil || len(perms) != 0 {
+		t.Errorf("a role may have no permissions: %v, %v", perms, err)
+	}
+	for _, perm := range []string{"admin", "tools.execute", "tools.execute:not-a-uuid", "tools.execute:{" + toolID.String() + "}", "billing.*", "tools.execute.*", ""} {
+		if _, err := ValidatePermissions([]string{perm}); !errors.Is(err, ErrInvalidPermission) {
+			t.Errorf("%q should be rejected: %v", perm, err)
+		}
+	}
+	for _, role := range BuiltInRoles() {
+		if _, err := ValidatePermissions(role.Permissions); err != nil {
+			t.Errorf("built-in role %s has invalid permissions: %v", role.Name, err)
+		}
+	}
+}
+
+func TestResolvePermissions(t *testing.T) {
+	now := time.Now()
+	userID := uuid.New()
+	roles := []models.Role{
+		{Name: "user", Permissions: []string{PermKnowledgeWrite, "tools.execute:*"}},
+		{Name: "sre", Permissions: []string{PermToolsManage, PermKnowledgeWrite}},
+	}
+	loads := 0
+
+	p := &Permissions{now: func() time.Time { return now }, cache: make(map[uuid.UUID]cachedGrants)}
+	p.roles = func(ctx context.Context, id uuid.UUID) ([]models.Role, error) {
+		loads++
+		if id != userID {
+			return nil, nil
+		}
+		return roles, nil
+	}
+	ctx := context.Background()
+
+	grants, err := p.Resolve(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(grants.Roles, []string{"sre", "user"}) ||
+		!slices.Equal(grants.Permissions, []string{PermKnowledgeWrite, "tools.execute:*", PermToolsManage}) {
+		t.Errorf("permissions of all roles should be merged: %+v", grants)
+	}
+	if !grants.Has(ToolExecutePermission(uuid.New())) || grants.Has(PermUsersManage) {
+		t.Errorf("unexpected permission check result: %+v", grants)
+	}
+
+	// 缓存时长内不再查库，修改角色后清除本实例缓存立即生效
+	p.Resolve(ctx, userID)
+	if loads != 1 {
+		t.Errorf("grants should be cached, loads=%d", loads)
+	}
+	roles = roles[:1]
+	p.ForgetUser(userID)
+	if grants, _ := p.Resolve(ctx, userID); grants.Has(PermToolsManage) || loads != 2 {
+		t.Errorf("forgotten grants should be reloaded, loads=%d: %+v", loads, grants)
+	}
+	now = now.Add(permissionCacheTTL)
+	p.Resolve(ctx, userID)
+	if loads != 3 {
+		t.Errorf("cached grants should expire, loads=%d", loads)
+	}
+
+	// 不存在的用户没有任何权限
+	if grants, err := p.Resolve(ctx, uuid.New()); err != nil || len(grants.Permissions) != 0 || grants.Has(PermKnowledgeWrite) {
+		t.Errorf("unknown user should have no permissions: %+v, %v", grants, err)
+	}
+}
@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/jwt"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrSessionInactive     = errors.New("session revoked or expired")
+	ErrTokenReused         = errors.New("refresh token reused, session revoked")
+	ErrUserInactive        = errors.New("user is not active")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// 会话撤销原因
+const (
+	ReasonLogout       = "logout"
+	ReasonRevoked      = "revoked"
+	ReasonTokenReuse   = "token_reuse"
+	ReasonUserDisabled = "user_disabled"
+)
+
+// 会话有效性的缓存时长：本实例内撤销立即生效，其它实例上最多延迟这么久
+const validCacheTTL = 10 * time.Second
+
+// Client 登录或刷新时的客户端信息
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// Sessions 登录会话：签发、轮换与撤销令牌，校验访问令牌所属会话是否有效
+type Sessions struct {
+	db     *gorm.DB
+	lookup func(ctx context.Context, sessionID uuid.UUID) (models.UserSession, error)
+	now    func() time.Time
+
+	mu    sync.Mutex
+	valid map[uuid.UUID]time.Time // 会话ID -> 有效性缓存的过期时间
+}
+
+// NewSessions 创建会话管理
+func NewSessions(db *gorm.DB) *Sessions {
+	s := &Sessions{db: db, now: time.Now, valid: make(map[uuid.UUID]time.Time)}
+	s.lookup = func(ctx context.Context, sessionID uuid.UUID) (models.UserSession, error) {
+		var session models.UserSession
+		err := db.WithContext(ctx).Select("id", "user_id", "expires_at", "revoked_at").
+			Where("id = ?", sessionID).First(&session).Error
+		return session, err
+	}
+	return s
+}
+
+// Start 为用户创建会话并签发令牌
+func (s *Sessions) Start(ctx context.Context, user models.User, client Client) (*jwt.TokenPair, error) {
+	sessionID := uuid.New()
+	pair, err := jwt.GenerateTokenPair(user.ID, user.Username, user.Role, user.Department, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	session := models.UserSession{
+		ID:         sessionID,
+		UserID:     user.ID,
+		TokenHash:  jwt.HashToken(pair.RefreshToken),
+		DeviceInfo: deviceInfo(client),
+		IPAddress:  client.IP,
+		ExpiresAt:  pair.RefreshExpiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(&session).Error; err != nil {
+		return nil, fmt.Errorf("create session: %w", err)
+	}
+	return pair, nil
+}
+
+// Refresh 用刷新令牌换取新的令牌对，旧的刷新令牌随即失效
+// 已轮换掉的刷新令牌被再次使用时说明令牌可能已泄露，撤销整个会话并返回 ErrTokenReused。
+func (s *Sessions) Refresh(ctx context.Context, refreshToken string, client Client) (*jwt.TokenPair, error) {
+	claims, err := jwt.ValidateToken(refreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRefreshToken, err)
+	}
+	if claims.TokenType != "refresh" || claims.SessionID == uuid.Nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var pair *jwt.TokenPair
+	var denied error // 需要在提交撤销后返回的错误
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session models.UserSession
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", claims.SessionID, claims.UserID).First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			denied = ErrInvalidRefreshToken
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil || !s.now().Before(session.ExpiresAt) {
+			denied = ErrSessionInactive
+			return nil
+		}
+		if session.TokenHash != jwt.HashToken(refreshToken) {
+			denied = ErrTokenReused
+			_, err := revoke(tx.Where("id = ?", session.ID), ReasonTokenReuse)
+			return err
+		}
+
+		// 角色、部门等以用户当前信息为准
+		var user models.User
+		if err := tx.Where("id = ?", claims.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		if user.Status != "active" {
+			denied = ErrUserInactive
+			_, err := revoke(tx.Where("id = ?", session.ID), ReasonUserDisabled)
+			return err
+		}
+
+		pair, err = jwt.GenerateTokenPair(user.ID, user.Username, user.Role, user.Department, session.ID)
+		if err != nil {
+			return err
+		}
+		now := s.now()
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"token_hash":   jwt.HashToken(pair.RefreshToken),
+			"expires_at":   pair.RefreshExpiresAt,
+			"last_used_at": now,
+			"ip_address":   client.IP,
+			"device_info":  deviceInfo(client),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if denied != nil {
+		s.forget(claims.SessionID)
+		return nil, denied
+	}
+	return pair, nil
+}
+
+// Validate 访问令牌所属的会话是否仍有效（未撤销且未过期）
+func (s *Sessions) Validate(ctx context.Context, userID, sessionID uuid.UUID) error {
+	if sessionID == uuid.Nil {
+		return ErrSessionInactive
+	}
+	now := s.now()
+	s.mu.Lock()
+	until, ok := s.valid[sessionID]
+	s.mu.Unlock()
+	if ok && now.Before(until) {
+		return nil
+	}
+
+	session, err := s.lookup(ctx, sessionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSessionInactive
+	}
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID || session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+		s.forget(sessionID)
+		return ErrSessionInactive
+	}
+
+	s.mu.Lock()
+	if len(s.valid) > 10000 {
+		for id, t := range s.valid {
+			if !now.Before(t) {
+				delete(s.valid, id)
+			}
+		}
+	}
+	s.valid[sessionID] = now.Add(validCacheTTL)
+	s.mu.Unlock()
+	return nil
+}
+
+// List 用户的有效会话，最近使用的在前
+func (s *Sessions) List(ctx context.Context, userID uuid.UUID) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, s.now()).
+		Order("COALESCE(last_used_at, created_at) DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke 撤销用户的一个会话
+func (s *Sessions) Revoke(ctx context.Context, userID, sessionID uuid.UUID, reason string) error {
+	n, err := revoke(s.db.WithContext(ctx).Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID), reason)
+	if err != nil {
+		return err
+	}
+	s.forget(sessionID)
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll 撤销用户除 keep 以外的全部会话（keep 为 uuid.Nil 时全部撤销），返回撤销的数量
+func (s *Sessions) RevokeAll(ctx context.Context, userID, keep uuid.UUID, reason string) (int64, error) {
+	var ids []uuid.UUID
+	db := s.db.WithContext(ctx)
+	if err := db.Model(&models.UserSession{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keep).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	if _, err := revoke(db.Where("id IN ? AND revoked_at IS NULL", ids), reason); err != nil {
+		return 0, err
+	}
+	s.forget(ids...)
+	return int64(len(ids)), nil
+}
+
+// forget 清除本实例的有效性缓存，使撤销立即生效
+func (s *Sessions) forget(ids ...uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.valid, id)
+	}
+}
+
+// revoke 将查询到的会话标记为已撤销，返回撤销的数量
+func revoke(query *gorm.DB, reason string) (int64, error) {
+	result := query.Model(&models.UserSession{}).Updates(map[string]interface{}{
+		"revoked_at":     time.Now(),
+		"revoked_reason": reason,
+	})
+	return result.RowsAffected, result.Error
+}
+
+func deviceInfo(client Client) models.JSONMap {
+	return models.JSONMap{"user_agent": client.UserAgent}
+}
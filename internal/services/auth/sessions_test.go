@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestValidateSession(t *testing.T) {
+	now := time.Now()
+	userID := uuid.New()
+	stored := map[uuid.UUID]models.UserSession{}
+	lookups := 0
+
+	s := &Sessions{now: func() time.Time { return now }, valid: make(map[uuid.UUID]time.Time)}
+	s.lookup = func(ctx context.Context, id uuid.UUID) (models.UserSession, error) {
+		lookups++
+		session, ok := stored[id]
+		if !ok {
+			return session, gorm.ErrRecordNotFound
+		}
+		return session, nil
+	}
+	ctx := context.Background()
+
+	active := models.UserSession{ID: uuid.New(), UserID: userID, ExpiresAt: now.Add(time.Hour)}
+	stored[active.ID] = active
+	if err := s.Validate(ctx, userID, active.ID); err != nil {
+		t.Fatalf("active session should be valid: %v", err)
+	}
+	// 有效结果在缓存时长内复用
+	s.Validate(ctx, userID, active.ID)
+	if lookups != 1 {
+		t.Errorf("valid session should be cached, lookups=%d", lookups)
+	}
+
+	// 其它实例上的撤销在缓存过期后生效
+	revokedAt := now
+	active.RevokedAt = &revokedAt
+	stored[active.ID] = active
+	now = now.Add(validCacheTTL)
+	if err := s.Validate(ctx, userID, active.ID); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("revoked session should be rejected: %v", err)
+	}
+
+	// 本实例的撤销立即生效
+	other := models.UserSession{ID: uuid.New(), UserID: userID, ExpiresAt: now.Add(time.Hour)}
+	stored[other.ID] = other
+	s.Validate(ctx, userID, other.ID)
+	other.RevokedAt = &revokedAt
+	stored[other.ID] = other
+	s.forget(other.ID)
+	if err := s.Validate(ctx, userID, other.ID); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("forgotten session should be looked up again: %v", err)
+	}
+
+	expired := models.UserSession{ID: uuid.New(), UserID: userID, ExpiresAt: now.Add(-time.Second)}
+	stored[expired.ID] = expired
+	if err := s.Validate(ctx, userID, expired.ID); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("expired session should be rejected: %v", err)
+	}
+	if err := s.Validate(ctx, uuid.New(), other.ID); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("session of another user should be rejected: %v", err)
+	}
+	if err := s.Validate(ctx, userID, uuid.New()); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("unknown session should be rejected: %v", err)
+	}
+	if err := s.Validate(ctx, userID, uuid.Nil); !errors.Is(err, ErrSessionInactive) {
+		t.Errorf("tokens without a session should be rejected: %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/jwt"
+	"github.com/liusCraft/orion/internal/pkg/oidc"
+)
+
+var (
+	ErrSSONotProvisioned = errors.New("user is not provisioned for single sign-on")
+	ErrSSOEmailConflict  = errors.New("email is already used by another account")
+)
+
+// 发起登录到回调完成的最长时间
+const loginStateTTL = 10 * time.Minute
+
+var validRoles = []string{"admin", "user", "viewer"}
+
+// SSO OpenID Connect 单点登录：发起登录、完成回调，并按 ID Token 即时创建或更新用户
+type SSO struct {
+	db       *gorm.DB
+	cfg      config.OIDCConfig
+	provider *oidc.Provider
+}
+
+// NewSSO 创建单点登录；IdP 的发现文档在首次登录时获取
+func NewSSO(db *gorm.DB, cfg config.OIDCConfig) (*SSO, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc issuer, client_id and redirect_url are required")
+	}
+	return &SSO{db: db, cfg: cfg, provider: oidc.New(cfg)}, nil
+}
+
+// PasswordLoginAllowed 用户能否使用本地密码登录：强制单点登录时只有管理员可以（IdP 故障时应急）
+func PasswordLoginAllowed(cfg config.OIDCConfig, role string) bool {
+	return !cfg.Enabled || !cfg.DisablePasswordLogin || role == "admin"
+}
+
+// Begin 生成登录状态（state、nonce 与 PKCE code_verifier）与授权端点地址
+func (s *SSO) Begin(ctx context.Context, redirect string) (string, oidc.LoginState, error) {
+	var st oidc.LoginState
+	for _, v := range []*string{&st.State, &st.Nonce, &st.Verifier} {
+		r, err := oidc.RandomString()
+		if err != nil {
+			return "", st, err
+		}
+		*v = r
+	}
+	st.Redirect = redirect
+	st.Expires = time.Now().Add(loginStateTTL).Unix()
+
+	authURL, err := s.provider.AuthCodeURL(ctx, st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		return "", st, err
+	}
+	return authURL, st, nil
+}
+
+// Complete 用授权码换取并校验 ID Token，返回对应的本地用户
+func (s *SSO) Complete(ctx context.Context, code string, st oidc.LoginState) (models.User, error) {
+	token, err := s.provider.Exchange(ctx, code, st.Verifier)
+	if err != nil {
+		return models.User{}, err
+	}
+	id, err := s.provider.Verify(ctx, token.IDToken, st.Nonce)
+	if err != nil {
+		return models.User{}, err
+	}
+	return s.Provision(ctx, id)
+}
+
+// Profile 从 ID Token 映射出的用户信息
+type Profile struct {
+	Username    string
+	Email       string
+	DisplayName string
+	Role        string // 为空表示不由 IdP 管理角色
+	Department  string // 为空表示不修改
+}
+
+// MapClaims 按配置把 ID Token 的声明与组映射为用户信息
+// 任一组映射指定了 role 时由 IdP 管理角色，没有匹配的组时为 default_role；都没有指定 role 时保留管理员设置的角色。
+func MapClaims(cfg config.OIDCConfig, id *oidc.IDToken) Profile {
+	p := Profile{
+		Username:    claimString(id, cfg.UsernameClaim),
+		Email:       id.Email,
+		DisplayName: truncate(id.Name, 100),
+		Department:  truncate(claimString(id, cfg.DepartmentClaim), 50),
+	}
+	if p.Username == "" {
+		p.Username, _, _ = strings.Cut(id.Email, "@")
+	}
+	if p.Username == "" {
+		p.Username = id.Subject
+	}
+	p.Username = truncate(p.Username, 50)
+
+	groups := claimStrings(id, cfg.GroupsClaim)
+	roleManaged, roleMatched, departmentMatched := false, false, false
+	for _, m := range cfg.GroupMappings {
+		if m.Role != "" {
+			roleManaged = true
+		}
+		if !containsFold(groups, m.Group) {
+			continue
+		}
+		if m.Role != "" && !roleMatched && containsFold(validRoles, m.Role) {
+			p.Role, roleMatched = strings.ToLower(m.Role), true
+		}
+		if m.Department != "" && !departmentMatched {
+			p.Department, departmentMatched = truncate(m.Department, 50), true
+		}
+	}
+	if roleManaged && !roleMatched {
+		p.Role = defaultRole(cfg)
+	}
+	return p
+}
+
+// Provision 查找或即时创建 ID Token 对应的用户，并同步角色、部门与显示名
+// 先按 issuer|sub 查找，再按已验证的邮箱关联已有的本地账号；都没有时按配置自动创建。
+func (s *SSO) Provision(ctx context.Context, id *oidc.IDToken) (models.User, error) {
+	externalID := strings.TrimSuffix(s.cfg.Issuer, "/") + "|" + id.Subject
+	profile := MapClaims(s.cfg, id)
+
+	var user models.User
+	var denied error // 需要在提交后返回的错误
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{}
+		err := tx.Where("external_id = ?", externalID).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) && profile.Email != "" && id.EmailVerified {
+			err = tx.Where("LOWER(email) = LOWER(?) AND account_type = ?", profile.Email, "human").First(&user).Error
+			if err == nil {
+				updates["external_id"] = externalID
+			}
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if !s.cfg.AutoProvision {
+				denied = ErrSSONotProvisioned
+				return nil
+			}
+			user, err = s.create(tx, externalID, profile)
+			if errors.Is(err, ErrSSOEmailConflict) {
+				denied = err
+				return nil
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if user.Status != "active" {
+			denied = ErrUserInactive
+			return nil
+		}
+		if profile.Role != "" && profile.Role != user.Role {
+			updates["role"] = profile.Role
+		}
+		if profile.Department != "" && profile.Department != user.Department {
+			updates["department"] = profile.Department
+		}
+		if profile.DisplayName != "" && profile.DisplayName != user.DisplayName {
+			updates["display_name"] = profile.DisplayName
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		updates["updated_at"] = time.Now()
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", user.ID).First(&user).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	if denied != nil {
+		return models.User{}, denied
+	}
+	return user, nil
+}
+
+func (s *SSO) create(tx *gorm.DB, externalID string, profile Profile) (models.User, error) {
+	email := profile.Email
+	if email == "" {
+		email = profile.Username + "@sso.invalid"
+	}
+	var count int64
+	if err := tx.Model(&models.User{}).Where("LOWER(email) = LOWER(?)", email).Count(&count).Error; err != nil {
+		return models.User{}, err
+	}
+	if count > 0 {
+		// 邮箱未经 IdP 验证，或属于服务账号，不能关联
+		return models.User{}, ErrSSOEmailConflict
+	}
+
+	// 用户名已被占用时加上由身份标识派生的后缀，同一身份每次得到相同的用户名
+	username := profile.Username
+	if err := tx.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return models.User{}, err
+	}
+	if count > 0 {
+		suffix := "-" + jwt.HashToken(externalID)[:6]
+		username = truncate(username, 50-len(suffix)) + suffix
+	}
+
+	role := profile.Role
+	if role == "" {
+		role = defaultRole(s.cfg)
+	}
+	user := models.User{
+		ID:           uuid.New(),
+		Username:     username,
+		Email:        email,
+		DisplayName:  profile.DisplayName,
+		Role:         role,
+		Department:   profile.Department,
+		Status:       "active",
+		AccountType:  "human",
+		AuthProvider: "oidc",
+		ExternalID:   &externalID,
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return models.User{}, fmt.Errorf("create sso user: %w", err)
+	}
+	return user, nil
+}
+
+func defaultRole(cfg config.OIDCConfig) string {
+	if containsFold(validRoles, cfg.DefaultRole) {
+		return strings.ToLower(cfg.DefaultRole)
+	}
+	return "user"
+}
+
+// claimString 字符串声明；未配置或不是字符串时为空
+func claimString(id *oidc.IDToken, name string) string {
+	if name == "" {
+		return ""
+	}
+	v, _ := id.Claims[name].(string)
+	return strings.TrimSpace(v)
+}
+
+// claimStrings 字符串数组声明，也接受单个字符串
+func claimStrings(id *oidc.IDToken, name string) []string {
+	if name == "" {
+		return nil
+	}
+	switch v := id.Claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsFold(values []string, target string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate 按字符截断，数据库列按字符计长
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/pkg/oidc"
+)
+
+func TestMapClaims(t *testing.T) {
+	cfg := config.OIDCConfig{
+		Enabled:         true,
+		UsernameClaim:   "preferred_username",
+		GroupsClaim:     "groups",
+		DepartmentClaim: "department",
+		DefaultRole:     "viewer",
+		GroupMappings: []config.OIDCGroupMapping{
+			{Group: "orion-admins", Role: "admin"},
+			{Group: "sre", Role: "user", Department: "运维"},
+			{Group: "dev", Role: "user", Department: "研发"},
+		},
+	}
+	id := func(claims jwt.MapClaims) *oidc.IDToken {
+		return &oidc.IDToken{Subject: "u-1", Email: "alice@example.com", Name: "Alice", Claims: claims}
+	}
+
+	// 第一个匹配的映射生效，组名不区分大小写
+	p := MapClaims(cfg, id(jwt.MapClaims{
+		"preferred_username": "alice",
+		"groups":             []interface{}{"Dev", "SRE"},
+		"department":         "TS",
+	}))
+	if p.Username != "alice" || p.Email != "alice@example.com" || p.DisplayName != "Alice" || p.Role != "user" || p.Department != "运维" {
+		t.Errorf("unexpected profile: %+v", p)
+	}
+
+	// 没有匹配的组时：角色由 IdP 管理则取默认角色，部门取声明
+	p = MapClaims(cfg, id(jwt.MapClaims{"groups": "marketing", "department": "TS"}))
+	if p.Username != "alice" || p.Role != "viewer" || p.Department != "TS" {
+		t.Errorf("unmatched groups should fall back to defaults: %+v", p)
+	}
+
+	// 组映射都没有指定角色时不修改角色
+	deptOnly := cfg
+	deptOnly.GroupMappings = []config.OIDCGroupMapping{{Group: "sre", Department: "运维"}}
+	p = MapClaims(deptOnly, id(jwt.MapClaims{"groups": []interface{}{"sre"}}))
+	if p.Role != "" || p.Department != "运维" {
+		t.Errorf("roles should not be managed without role mappings: %+v", p)
+	}
+
+	// 用户名依次回退到邮箱前缀与 sub
+	p = MapClaims(cfg, &oidc.IDToken{Subject: "u-1", Claims: jwt.MapClaims{}})
+	if p.Username != "u-1" {
+		t.Errorf("username should fall back to sub: %+v", p)
+	}
+}
+
+func TestPasswordLoginAllowed(t *testing.T) {
+	cfg := config.OIDCConfig{Enabled: true, DisablePasswordLogin: true}
+	if PasswordLoginAllowed(cfg, "user") || !PasswordLoginAllowed(cfg, "admin") {
+		t.Errorf("only admins may use passwords when sso is mandatory")
+	}
+	cfg.Enabled = false
+	if !PasswordLoginAllowed(cfg, "user") {
+		t.Errorf("password login should be allowed without sso")
+	}
+}
@@ -0,0 +1,245 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/pkg/logger"
+)
+
+// CancelChannel 跨实例广播取消请求的 Postgres NOTIFY 通道
+const CancelChannel = "orion_generation_cancel"
+
+// CancelAckChannel 持有生成的实例中止生成后回复确认的通道
+const CancelAckChannel = "orion_generation_cancel_ack"
+
+// cancelAckTimeout 等待其它实例确认取消的最长时间，超时视为没有实例持有该生成
+const cancelAckTimeout = 2 * time.Second
+
+// 监听连接的重连退避区间
+const (
+	listenerRetryMin = time.Second
+	listenerRetryMax = time.Minute
+)
+
+// 生成中止原因（作为 context 的取消原因）
+var (
+	ErrGenerationCancelled  = errors.New("generation cancelled by user")
+	ErrGenerationSuperseded = errors.New("superseded by new stream")
+)
+
+// GenerationRegistry 按 AI 消息 ID 登记进行中的生成
+// 每个生成持有一个可取消的 context：模型流、工具调用与审批等待都派生自它。
+// 取消请求落在其它实例时，通过 Postgres LISTEN/NOTIFY 广播到持有该生成的实例。
+type GenerationRegistry struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*generation
+
+	listener *pq.Listener
+	stop     chan struct{}
+	done     chan struct{}
+
+	ackMu   sync.Mutex
+	waiters map[uuid.UUID][]chan struct{} // 等待取消确认的请求
+}
+
+type generation struct {
+	cancel context.CancelCauseFunc
+}
+
+// NewGenerationRegistry 创建生成登记表；db 为 nil 时仅支持本实例内取消
+func NewGenerationRegistry(db *gorm.DB) *GenerationRegistry {
+	return &GenerationRegistry{db: db, running: make(map[uuid.UUID]*generation), waiters: make(map[uuid.UUID][]chan struct{})}
+}
+
+// Register 登记一次生成，返回派生的 context 与释放函数
+// 生成结束（无论成功与否）后必须调用释放函数。
+func (r *GenerationRegistry) Register(parent context.Context, messageID uuid.UUID) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	g := &generation{cancel: cancel}
+	r.mu.Lock()
+	if prev, ok := r.running[messageID]; ok {
+		prev.cancel(context.Canceled)
+	}
+	r.running[messageID] = g
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		// 仅删除自己登记的条目（同一消息可能已被重新登记）
+		if cur, ok := r.running[messageID]; ok && cur == g {
+			delete(r.running, messageID)
+		}
+		r.mu.Unlock()
+		cancel(context.Canceled)
+	}
+}
+
+// Cancel 取消指定消息的生成，返回是否有实例持有并中止了该生成
+// 本实例持有该生成时直接取消，否则通过 NOTIFY 通知其它实例并等待确认；
+// 未监听（单实例）或短时间内没有实例确认时返回 false，由调用方自行结束消息。
+func (r *GenerationRegistry) Cancel(ctx context.Context, messageID uuid.UUID) (bool, error) {
+	if r.abort(messageID, ErrGenerationCancelled) {
+		return true, nil
+	}
+	if r.db == nil || r.listener == nil {
+		return false, nil
+	}
+
+	ack := make(chan struct{}, 1)
+	r.ackMu.Lock()
+	r.waiters[messageID] = append(r.waiters[messageID], ack)
+	r.ackMu.Unlock()
+	defer r.removeWaiter(messageID, ack)
+
+	if err := r.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", CancelChannel, messageID.String()).Error; err != nil {
+		return false, err
+	}
+	timer := time.NewTimer(cancelAckTimeout)
+	defer timer.Stop()
+	select {
+	case <-ack:
+		return true, nil
+	case <-timer.C:
+		return false, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Supersede 中止本实例内被新生成替代的生成（不广播），返回是否找到
+func (r *GenerationRegistry) Supersede(messageID uuid.UUID) bool {
+	return r.abort(messageID, ErrGenerationSuperseded)
+}
+
+// Running 本实例是否持有该消息的生成
+func (r *GenerationRegistry) Running(messageID uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.running[messageID]
+	return ok
+}
+
+// Cancelled 判断 context 是否因用户取消而结束
+func Cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrGenerationCancelled)
+}
+
+// Listen 开始监听其它实例广播的取消请求，dsn 为 lib/pq 连接串
+func (r *GenerationRegistry) Listen(dsn string) error {
+	listener := pq.NewListener(dsn, listenerRetryMin, listenerRetryMax, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("生成取消监听连接异常: %v", err)
+		}
+	})
+	for _, channel := range []string{CancelChannel, CancelAckChannel} {
+		if err := listener.Listen(channel); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	r.listener = listener
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.loop()
+	return nil
+}
+
+// Close 停止监听并取消本实例所有进行中的生成
+func (r *GenerationRegistry) Close() {
+	if r.listener != nil {
+		close(r.stop)
+		<-r.done
+		r.listener.Close()
+		r.listener = nil
+	}
+	r.mu.Lock()
+	for id, g := range r.running {
+		g.cancel(context.Canceled)
+		delete(r.running, id)
+	}
+	r.mu.Unlock()
+}
+
+func (r *GenerationRegistry) loop() {
+	defer close(r.done)
+	// 连接空闲时定期 Ping，及时发现断线
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case n := <-r.listener.Notify:
+			// 重连后 n 为 nil，期间的通知可能丢失，取消方等不到确认时自行结束消息
+			if n == nil {
+				continue
+			}
+			id, err := uuid.Parse(n.Extra)
+			if err != nil {
+				continue
+			}
+			if n.Channel == CancelAckChannel {
+				r.acknowledged(id)
+			} else if r.abort(id, ErrGenerationCancelled) {
+				go r.acknowledge(id)
+			}
+		case <-ping.C:
+			go func() { _ = r.listener.Ping() }()
+		}
+	}
+}
+
+// acknowledge 回复取消确认
+func (r *GenerationRegistry) acknowledge(messageID uuid.UUID) {
+	if err := r.db.Exec("SELECT pg_notify(?, ?)", CancelAckChannel, messageID.String()).Error; err != nil {
+		logger.Warn("回复生成取消确认失败 message=%s: %v", messageID, err)
+	}
+}
+
+// acknowledged 唤醒等待该消息取消确认的请求
+func (r *GenerationRegistry) acknowledged(messageID uuid.UUID) {
+	r.ackMu.Lock()
+	defer r.ackMu.Unlock()
+	for _, ch := range r.waiters[messageID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *GenerationRegistry) removeWaiter(messageID uuid.UUID, ack chan struct{}) {
+	r.ackMu.Lock()
+	defer r.ackMu.Unlock()
+	waiters := r.waiters[messageID]
+	for i, ch := range waiters {
+		if ch == ack {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(r.waiters, messageID)
+	} else {
+		r.waiters[messageID] = waiters
+	}
+}
+
+func (r *GenerationRegistry) abort(messageID uuid.UUID, cause error) bool {
+	r.mu.Lock()
+	g, ok := r.running[messageID]
+	r.mu.Unlock()
+	if ok {
+		g.cancel(cause)
+	}
+	return ok
+}
@@ -0,0 +1,59 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGenerationRegistryCancel(t *testing.T) {
+	r := NewGenerationRegistry(nil)
+	id := uuid.New()
+	ctx, release := r.Register(context.Background(), id)
+	if !r.Running(id) {
+		t.Fatal("registered generation should be running")
+	}
+
+	if owned, err := r.Cancel(context.Background(), id); err != nil || !owned {
+		t.Fatalf("cancel failed: owned=%v err=%v", owned, err)
+	}
+	<-ctx.Done()
+	if !Cancelled(ctx) {
+		t.Errorf("cause should be user cancellation, got %v", context.Cause(ctx))
+	}
+
+	release()
+	if r.Running(id) {
+		t.Error("released generation should be removed")
+	}
+}
+
+func TestGenerationRegistryRelease(t *testing.T) {
+	r := NewGenerationRegistry(nil)
+	id := uuid.New()
+	first, releaseFirst := r.Register(context.Background(), id)
+	second, releaseSecond := r.Register(context.Background(), id)
+	defer releaseSecond()
+
+	if first.Err() == nil {
+		t.Error("re-registering should cancel the previous generation")
+	}
+	if Cancelled(first) {
+		t.Error("superseded generation should not count as user cancellation")
+	}
+
+	// 旧生成释放时不应移除新登记的条目
+	releaseFirst()
+	if !r.Running(id) || second.Err() != nil {
+		t.Error("releasing a superseded generation should keep the current one")
+	}
+}
+
+func TestGenerationRegistryCancelWithoutOwner(t *testing.T) {
+	r := NewGenerationRegistry(nil)
+	// 没有实例持有该生成时由调用方自行结束消息
+	if owned, err := r.Cancel(context.Background(), uuid.New()); err != nil || owned {
+		t.Errorf("unowned generation should not be reported as cancelled: owned=%v err=%v", owned, err)
+	}
+}
@@ -0,0 +1,171 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 默认参数
+const (
+	defaultStreamGrace     = 5 * time.Minute
+	defaultStreamMaxEvents = 10000
+)
+
+// Event 缓冲的 SSE 事件，Seq 在同一次生成内单调递增（从 1 开始）
+type Event struct {
+	Seq  int64
+	Type string
+	Data []byte
+}
+
+// Stream 一次生成的事件缓冲
+// 生成任务写入事件，任意数量的连接按序号读取：断线重连时从 Last-Event-ID 之后补发，再跟随实时事件。
+type Stream struct {
+	MessageID uuid.UUID
+
+	mu        sync.Mutex
+	events    []Event
+	next      int64
+	dropped   int64 // 超出缓冲上限后丢弃的最早事件数
+	maxEvents int
+	closed    bool
+	closedAt  time.Time
+	wake      chan struct{} // 有新事件或流结束时关闭并替换
+}
+
+func newStream(messageID uuid.UUID, maxEvents int) *Stream {
+	return &Stream{MessageID: messageID, next: 1, maxEvents: maxEvents, wake: make(chan struct{})}
+}
+
+// Publish 追加事件并唤醒等待中的读取方，返回事件序号；流结束后忽略
+func (s *Stream) Publish(eventType string, data []byte) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0
+	}
+	seq := s.next
+	s.next++
+	s.events = append(s.events, Event{Seq: seq, Type: eventType, Data: data})
+	if s.maxEvents > 0 && len(s.events) > s.maxEvents {
+		n := len(s.events) - s.maxEvents
+		s.events = append([]Event(nil), s.events[n:]...)
+		s.dropped += int64(n)
+	}
+	close(s.wake)
+	s.wake = make(chan struct{})
+	return seq
+}
+
+// Close 标记生成结束，读取方读完剩余事件后退出
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.closedAt = time.Now()
+	close(s.wake)
+}
+
+// Next 返回序号 after 之后的事件
+// 没有新事件时返回等待通道（有新事件或流结束时关闭）；流已结束且事件已读完时 done 为 true。
+// 请求的事件已被丢弃（超出缓冲上限）时 gap 为 true，从仍保留的最早事件开始返回。
+func (s *Stream) Next(after int64) (events []Event, wait <-chan struct{}, done bool, gap bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := s.dropped + 1
+	if after+1 < first {
+		gap = true
+		after = first - 1
+	}
+	if idx := int(after - s.dropped); idx < len(s.events) {
+		events = append([]Event(nil), s.events[idx:]...)
+	}
+	return events, s.wake, s.closed && len(events) == 0, gap
+}
+
+// EventID 事件的 SSE id："消息ID:序号"
+func (s *Stream) EventID(seq int64) string {
+	return fmt.Sprintf("%s:%d", s.MessageID, seq)
+}
+
+// ParseEventID 解析 Last-Event-ID
+func ParseEventID(id string) (uuid.UUID, int64, bool) {
+	msg, seqStr, ok := strings.Cut(strings.TrimSpace(id), ":")
+	if !ok {
+		return uuid.Nil, 0, false
+	}
+	messageID, err := uuid.Parse(msg)
+	if err != nil {
+		return uuid.Nil, 0, false
+	}
+	seq, err := strconv.ParseInt(seqStr, 10, 64)
+	if err != nil || seq < 0 {
+		return uuid.Nil, 0, false
+	}
+	return messageID, seq, true
+}
+
+// StreamHub 按对话维护当前生成的事件缓冲
+// 每个对话同一时刻只有一个生成；结束的流保留 grace 时长供断线客户端补发。
+type StreamHub struct {
+	grace     time.Duration
+	maxEvents int
+
+	mu      sync.Mutex
+	streams map[uuid.UUID]*Stream
+}
+
+// NewStreamHub 创建事件缓冲中心，grace 为生成结束后缓冲的保留时长，maxEvents 为单个流的缓冲上限
+func NewStreamHub(grace time.Duration, maxEvents int) *StreamHub {
+	if grace <= 0 {
+		grace = defaultStreamGrace
+	}
+	if maxEvents <= 0 {
+		maxEvents = defaultStreamMaxEvents
+	}
+	return &StreamHub{grace: grace, maxEvents: maxEvents, streams: make(map[uuid.UUID]*Stream)}
+}
+
+// Open 为对话的新生成创建流，替换（并结束）之前的流
+func (h *StreamHub) Open(conversationID, messageID uuid.UUID) *Stream {
+	s := newStream(messageID, h.maxEvents)
+	h.mu.Lock()
+	h.sweepLocked()
+	prev := h.streams[conversationID]
+	h.streams[conversationID] = s
+	h.mu.Unlock()
+	if prev != nil {
+		prev.Close()
+	}
+	return s
+}
+
+// Get 返回对话当前（或保留期内）的流
+func (h *StreamHub) Get(conversationID uuid.UUID) (*Stream, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sweepLocked()
+	s, ok := h.streams[conversationID]
+	return s, ok
+}
+
+// sweepLocked 清理超过保留期的已结束流
+func (h *StreamHub) sweepLocked() {
+	now := time.Now()
+	for id, s := range h.streams {
+		s.mu.Lock()
+		expired := s.closed && now.Sub(s.closedAt) > h.grace
+		s.mu.Unlock()
+		if expired {
+			delete(h.streams, id)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestStreamReplay(t *testing.T) {
+	hub := NewStreamHub(time.Minute, 0)
+	conversationID, messageID := uuid.New(), uuid.New()
+	s := hub.Open(conversationID, messageID)
+	for _, typ := range []string{"message_start", "content_delta", "content_delta"} {
+		s.Publish(typ, []byte(`{}`))
+	}
+
+	events, wait, done, _ := s.Next(1)
+	if len(events) != 2 || events[0].Seq != 2 || events[1].Seq != 3 || done {
+		t.Fatalf("unexpected replay: %+v done=%v", events, done)
+	}
+
+	// 无新事件时等待通道在发布后关闭
+	events, wait, _, _ = s.Next(3)
+	if len(events) != 0 {
+		t.Fatalf("no events expected, got %+v", events)
+	}
+	s.Publish("message_complete", []byte(`{}`))
+	select {
+	case <-wait:
+	default:
+		t.Fatal("publish should wake readers")
+	}
+
+	s.Close()
+	if _, _, done, _ := s.Next(3); done {
+		t.Error("pending events should be delivered before done")
+	}
+	if _, _, done, _ := s.Next(4); !done {
+		t.Error("closed stream should report done once drained")
+	}
+	if got, ok := hub.Get(conversationID); !ok || got != s {
+		t.Error("finished stream should be kept during the grace period")
+	}
+}
+
+func TestStreamGap(t *testing.T) {
+	s := newStream(uuid.New(), 2)
+	for i := 0; i < 5; i++ {
+		s.Publish("content_delta", nil)
+	}
+	events, _, _, gap := s.Next(1)
+	if !gap || len(events) != 2 || events[0].Seq != 4 {
+		t.Errorf("dropped events should be reported as a gap: %+v gap=%v", events, gap)
+	}
+}
+
+func TestParseEventID(t *testing.T) {
+	s := newStream(uuid.New(), 0)
+	id, seq, ok := ParseEventID(s.EventID(42))
+	if !ok || id != s.MessageID || seq != 42 {
+		t.Errorf("round trip failed: %v %d %v", id, seq, ok)
+	}
+	if _, _, ok := ParseEventID("42"); ok {
+		t.Error("id without message should be rejected")
+	}
+}
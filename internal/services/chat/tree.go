@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// MessageTree 对话消息树
+// 消息通过 ParentMessageID 组成树：编辑用户消息、重新生成回答都会在同一父节点下产生兄弟节点，
+// Conversation.ActiveMessageID 指向当前分支的叶子。
+type MessageTree struct {
+	byID     map[uuid.UUID]*models.Message
+	children map[uuid.UUID][]*models.Message // 父节点 -> 子节点（按创建时间），根节点挂在 uuid.Nil 下
+}
+
+// NewMessageTree 由对话的全部消息构建消息树
+func NewMessageTree(messages []models.Message) *MessageTree {
+	t := &MessageTree{
+		byID:     make(map[uuid.UUID]*models.Message, len(messages)),
+		children: make(map[uuid.UUID][]*models.Message),
+	}
+	for i := range messages {
+		t.byID[messages[i].ID] = &messages[i]
+	}
+	for i := range messages {
+		m := &messages[i]
+		parent := uuid.Nil
+		if m.ParentMessageID != nil {
+			if _, ok := t.byID[*m.ParentMessageID]; ok {
+				parent = *m.ParentMessageID
+			}
+		}
+		t.children[parent] = append(t.children[parent], m)
+	}
+	for _, list := range t.children {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	}
+	return t
+}
+
+// Get 按 ID 查找消息
+func (t *MessageTree) Get(id uuid.UUID) (*models.Message, bool) {
+	m, ok := t.byID[id]
+	return m, ok
+}
+
+// Messages 全部消息（按创建时间）
+func (t *MessageTree) Messages() []models.Message {
+	out := make([]models.Message, 0, len(t.byID))
+	for _, m := range t.byID {
+		out = append(out, *m)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Path 从根节点到 leafID 的路径（含 leafID），leafID 不存在时返回空
+func (t *MessageTree) Path(leafID uuid.UUID) []models.Message {
+	var path []models.Message
+	visited := make(map[uuid.UUID]bool)
+	for id := leafID; ; {
+		m, ok := t.byID[id]
+		if !ok || visited[id] {
+			break
+		}
+		visited[id] = true
+		path = append(path, *m)
+		if m.ParentMessageID == nil {
+			break
+		}
+		id = *m.ParentMessageID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Siblings 与 id 同一父节点的全部消息（含自身，按创建时间）
+func (t *MessageTree) Siblings(id uuid.UUID) []models.Message {
+	m, ok := t.byID[id]
+	if !ok {
+		return nil
+	}
+	parent := uuid.Nil
+	if m.ParentMessageID != nil {
+		if _, ok := t.byID[*m.ParentMessageID]; ok {
+			parent = *m.ParentMessageID
+		}
+	}
+	list := t.children[parent]
+	out := make([]models.Message, 0, len(list))
+	for _, s := range list {
+		out = append(out, *s)
+	}
+	return out
+}
+
+// Leaf 沿最新的子节点向下，返回以 id 为根的子树中当前分支的叶子
+// 用于切换分支：选中某个节点后，从它继续到该分支最近的回答。
+func (t *MessageTree) Leaf(id uuid.UUID) uuid.UUID {
+	visited := make(map[uuid.UUID]bool)
+	for !visited[id] {
+		visited[id] = true
+		list := t.children[id]
+		if len(list) == 0 {
+			break
+		}
+		id = list[len(list)-1].ID
+	}
+	return id
+}
@@ -0,0 +1,61 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestMessageTree(t *testing.T) {
+	base := time.Now()
+	msg := func(parent *models.Message, sender string, offset int) models.Message {
+		m := models.Message{ID: uuid.New(), SenderType: sender, CreatedAt: base.Add(time.Duration(offset) * time.Second)}
+		if parent != nil {
+			m.ParentMessageID = &parent.ID
+		}
+		return m
+	}
+	// u1 → a1 → u2 → a2
+	//            ↘ u2'(编辑) → a2'
+	//    ↘ a1'(重新生成)
+	u1 := msg(nil, "user", 0)
+	a1 := msg(&u1, "ai", 1)
+	u2 := msg(&a1, "user", 2)
+	a2 := msg(&u2, "ai", 3)
+	a1b := msg(&u1, "ai", 4)
+	u2b := msg(&a1, "user", 5)
+	a2b := msg(&u2b, "ai", 6)
+	tree := NewMessageTree([]models.Message{a2b, u1, a1, u2, a2, a1b, u2b})
+
+	path := tree.Path(a2.ID)
+	want := []uuid.UUID{u1.ID, a1.ID, u2.ID, a2.ID}
+	if len(path) != len(want) {
+		t.Fatalf("unexpected path length: %d", len(path))
+	}
+	for i, m := range path {
+		if m.ID != want[i] {
+			t.Errorf("path[%d] = %s, want %s", i, m.ID, want[i])
+		}
+	}
+
+	siblings := tree.Siblings(u2.ID)
+	if len(siblings) != 2 || siblings[0].ID != u2.ID || siblings[1].ID != u2b.ID {
+		t.Errorf("unexpected siblings: %+v", siblings)
+	}
+	if roots := tree.Siblings(u1.ID); len(roots) != 1 {
+		t.Errorf("root should have no siblings: %d", len(roots))
+	}
+
+	if leaf := tree.Leaf(a1.ID); leaf != a2b.ID {
+		t.Errorf("leaf should follow the newest branch, got %s", leaf)
+	}
+	if leaf := tree.Leaf(u2.ID); leaf != a2.ID {
+		t.Errorf("leaf of u2 should be a2, got %s", leaf)
+	}
+	if path := tree.Path(uuid.New()); len(path) != 0 {
+		t.Errorf("unknown leaf should yield an empty path")
+	}
+}
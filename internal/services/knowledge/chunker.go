@@ -0,0 +1,77 @@
+package knowledge
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitText 将文本按字符数切分为带重叠的分块
+// size 为每块最大字符数（按rune计），overlap 为相邻分块的重叠字符数。
+// 切分时优先在段落、换行、句末标点、空白处断开，避免把句子截成两半。
+func SplitText(text string, size, overlap int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if size <= 0 {
+		size = 1000
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	runes := []rune(text)
+	var chunks []string
+	start := 0
+	for start < len(runes) {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else if cut := findBreak(runes, start+size/2, end); cut > 0 {
+			end = cut
+		}
+
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end >= len(runes) {
+			break
+		}
+
+		// 下一块从 end-overlap 开始，并保证前进
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// breakRules 断点优先级：空行 > 换行 > 句末标点 > 空白
+var breakRules = []func(runes []rune, i int) bool{
+	func(r []rune, i int) bool { return r[i] == '\n' && i > 0 && r[i-1] == '\n' },
+	func(r []rune, i int) bool { return r[i] == '\n' },
+	func(r []rune, i int) bool {
+		if strings.ContainsRune("。！？；!?;", r[i]) {
+			return true
+		}
+		return r[i] == '.' && i+1 < len(r) && unicode.IsSpace(r[i+1])
+	},
+	func(r []rune, i int) bool { return unicode.IsSpace(r[i]) },
+}
+
+// findBreak 在 [lo, hi) 区间内从后向前寻找断点，返回断点之后的位置；找不到返回 -1
+func findBreak(runes []rune, lo, hi int) int {
+	if lo < 0 {
+		lo = 0
+	}
+	for _, rule := range breakRules {
+		for i := hi - 1; i >= lo; i-- {
+			if rule(runes, i) {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,45 @@
+package knowledge
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	if chunks := SplitText("   ", 100, 10); len(chunks) != 0 {
+		t.Fatalf("blank text should produce no chunks, got %d", len(chunks))
+	}
+
+	short := "CDN回源失败排查手册"
+	if chunks := SplitText(short, 100, 10); len(chunks) != 1 || chunks[0] != short {
+		t.Fatalf("short text should be a single chunk, got %q", chunks)
+	}
+
+	para := strings.Repeat("节点健康检查失败时先确认回源地址。", 10)
+	text := para + "\n\n" + para + "\n\n" + para
+	chunks := SplitText(text, 200, 20)
+	if len(chunks) < 2 {
+		t.Fatalf("expected multiple chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := utf8.RuneCountInString(chunk); n > 200 {
+			t.Errorf("chunk %d exceeds size: %d runes", i, n)
+		}
+		if !strings.HasSuffix(chunk, "。") {
+			t.Errorf("chunk %d should end at a sentence boundary: %q", i, chunk)
+		}
+	}
+}
+
+func TestSplitTextProgress(t *testing.T) {
+	// 无任何断点的长文本也必须能切完
+	text := strings.Repeat("a", 1050)
+	chunks := SplitText(text, 100, 99)
+	if len(chunks) == 0 {
+		t.Fatal("expected chunks")
+	}
+	if last := chunks[len(chunks)-1]; !strings.HasSuffix(text, last) {
+		t.Fatalf("last chunk should cover the tail of the text")
+	}
+}
@@ -0,0 +1,296 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pgvector/pgvector-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	"github.com/liusCraft/orion/internal/services/ai"
+)
+
+// 文档向量化状态
+const (
+	IndexStatusPending  = "pending"
+	IndexStatusIndexing = "indexing"
+	IndexStatusIndexed  = "indexed"
+	IndexStatusFailed   = "failed"
+	IndexStatusSkipped  = "skipped" // 非发布状态的文档不进入索引
+)
+
+// indexingStaleAfter 处于 indexing 状态超过该时长视为worker异常退出，允许重新领取
+const indexingStaleAfter = 10 * time.Minute
+
+// Indexer 知识文档后台向量化 worker
+// 文档变更时通过 Enqueue 投递；同时定期扫描 pending 文档作为兜底（服务重启、队列溢出、多副本）。
+type Indexer struct {
+	db       *gorm.DB
+	embedder ai.Embedder
+	cfg      config.EmbeddingConfig
+
+	queue    chan uuid.UUID
+	inflight sync.Map // documentID -> struct{}，避免同一文档在本进程内并发处理
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewIndexer 创建向量化 worker
+func NewIndexer(db *gorm.DB, embedder ai.Embedder, cfg config.EmbeddingConfig) *Indexer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 10
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = 30
+	}
+	return &Indexer{
+		db:       db,
+		embedder: embedder,
+		cfg:      cfg,
+		queue:    make(chan uuid.UUID, 256),
+	}
+}
+
+// Start 启动 worker 与定期扫描
+func (ix *Indexer) Start(ctx context.Context) {
+	ctx, ix.cancel = context.WithCancel(ctx)
+	for i := 0; i < ix.cfg.Workers; i++ {
+		ix.wg.Add(1)
+		go ix.worker(ctx)
+	}
+	ix.wg.Add(1)
+	go ix.sweeper(ctx)
+}
+
+// Stop 停止 worker 并等待当前任务结束
+func (ix *Indexer) Stop() {
+	if ix == nil || ix.cancel == nil {
+		return
+	}
+	ix.cancel()
+	ix.wg.Wait()
+}
+
+// Enqueue 将文档标记为待向量化并投递到队列
+// 队列已满时仅标记状态，由定期扫描补偿。
+func (ix *Indexer) Enqueue(documentID uuid.UUID) {
+	if ix == nil {
+		return
+	}
+	if err := ix.db.Model(&models.KnowledgeDocument{}).Where("id = ?", documentID).
+		UpdateColumns(map[string]interface{}{
+			"index_status": IndexStatusPending,
+			"index_error":  "",
+		}).Error; err != nil {
+		logger.Warn("标记文档待向量化失败 document=%s: %v", documentID, err)
+	}
+	select {
+	case ix.queue <- documentID:
+	default:
+	}
+}
+
+func (ix *Indexer) worker(ctx context.Context) {
+	defer ix.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-ix.queue:
+			if err := ix.process(ctx, id); err != nil {
+				logger.Warn("文档向量化失败 document=%s: %v", id, err)
+			}
+		}
+	}
+}
+
+func (ix *Indexer) sweeper(ctx context.Context) {
+	defer ix.wg.Done()
+	ticker := time.NewTicker(time.Duration(ix.cfg.SweepInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		ix.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep 扫描待处理与卡住的文档并投递
+func (ix *Indexer) sweep(ctx context.Context) {
+	var ids []uuid.UUID
+	if err := ix.db.WithContext(ctx).Model(&models.KnowledgeDocument{}).
+		Where("index_status = ? OR (index_status = ? AND index_started_at < ?)",
+			IndexStatusPending, IndexStatusIndexing, time.Now().Add(-indexingStaleAfter)).
+		Order("updated_at ASC").
+		Limit(cap(ix.queue)/2).
+		Pluck("id", &ids).Error; err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("扫描待向量化文档失败: %v", err)
+		}
+		return
+	}
+	for _, id := range ids {
+		select {
+		case ix.queue <- id:
+		case <-ctx.Done():
+			return
+		default:
+			return
+		}
+	}
+}
+
+// claim 领取文档：仅当文档处于 pending 或 indexing 已超时时成功，避免多个worker/副本重复处理
+func (ix *Indexer) claim(ctx context.Context, documentID uuid.UUID) (bool, error) {
+	now := time.Now()
+	res := ix.db.WithContext(ctx).Model(&models.KnowledgeDocument{}).
+		Where("id = ? AND (index_status = ? OR (index_status = ? AND index_started_at < ?))",
+			documentID, IndexStatusPending, IndexStatusIndexing, now.Add(-indexingStaleAfter)).
+		UpdateColumns(map[string]interface{}{
+			"index_status":     IndexStatusIndexing,
+			"index_started_at": now,
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// process 对单个文档执行分块、向量化与写入
+func (ix *Indexer) process(ctx context.Context, documentID uuid.UUID) error {
+	// 正在处理中的文档保持 pending，由下一轮扫描重新处理
+	if _, busy := ix.inflight.LoadOrStore(documentID, struct{}{}); busy {
+		return nil
+	}
+	defer ix.inflight.Delete(documentID)
+
+	ok, err := ix.claim(ctx, documentID)
+	if err != nil || !ok {
+		return err
+	}
+
+	var doc models.KnowledgeDocument
+	if err := ix.db.WithContext(ctx).Where("id = ?", documentID).First(&doc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return ix.fail(documentID, err)
+	}
+
+	// 非发布状态：清理已有分块
+	if doc.Status != "published" {
+		if err := ix.db.WithContext(ctx).Where("document_id = ?", doc.ID).Delete(&models.KnowledgeEmbedding{}).Error; err != nil {
+			return ix.fail(doc.ID, err)
+		}
+		return ix.finish(doc, IndexStatusSkipped, 0)
+	}
+
+	chunks := SplitText(doc.Title+"\n\n"+doc.Content, ix.cfg.ChunkSize, ix.cfg.ChunkOverlap)
+
+	// 已有分块：内容未变化的分块无需重新向量化
+	var existing []models.KnowledgeEmbedding
+	if err := ix.db.WithContext(ctx).Select("chunk_index", "chunk_content").
+		Where("document_id = ?", doc.ID).Find(&existing).Error; err != nil {
+		return ix.fail(doc.ID, err)
+	}
+	existingContent := make(map[int]string, len(existing))
+	for _, e := range existing {
+		existingContent[e.ChunkIndex] = e.ChunkContent
+	}
+	var changed []int
+	for i, chunk := range chunks {
+		if content, ok := existingContent[i]; !ok || content != chunk {
+			changed = append(changed, i)
+		}
+	}
+
+	for startIdx := 0; startIdx < len(changed); startIdx += ix.cfg.BatchSize {
+		endIdx := startIdx + ix.cfg.BatchSize
+		if endIdx > len(changed) {
+			endIdx = len(changed)
+		}
+		batch := changed[startIdx:endIdx]
+		texts := make([]string, len(batch))
+		for j, idx := range batch {
+			texts[j] = chunks[idx]
+		}
+		vectors, err := ix.embedder.EmbedStrings(ctx, texts)
+		if err != nil {
+			return ix.fail(doc.ID, err)
+		}
+		if len(vectors) != len(batch) {
+			return ix.fail(doc.ID, fmt.Errorf("embedding count mismatch: want %d, got %d", len(batch), len(vectors)))
+		}
+
+		now := time.Now()
+		rows := make([]models.KnowledgeEmbedding, len(batch))
+		for j, idx := range batch {
+			rows[j] = models.KnowledgeEmbedding{
+				ID:           uuid.New(),
+				DocumentID:   doc.ID,
+				ChunkIndex:   idx,
+				ChunkContent: chunks[idx],
+				Embedding:    pgvector.NewVector(vectors[j]),
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+		}
+		if err := ix.db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "document_id"}, {Name: "chunk_index"}},
+			DoUpdates: clause.AssignmentColumns([]string{"chunk_content", "chunk_summary", "embedding", "token_count", "updated_at"}),
+		}).Create(&rows).Error; err != nil {
+			return ix.fail(doc.ID, err)
+		}
+	}
+
+	// 删除多余的旧分块
+	if err := ix.db.WithContext(ctx).Where("document_id = ? AND chunk_index >= ?", doc.ID, len(chunks)).
+		Delete(&models.KnowledgeEmbedding{}).Error; err != nil {
+		return ix.fail(doc.ID, err)
+	}
+
+	return ix.finish(doc, IndexStatusIndexed, len(chunks))
+}
+
+// finish 写入完成状态；若处理期间文档再次被投递（状态已被改回 pending），保持 pending 以便重新处理
+// 状态字段均使用 UpdateColumns，避免刷新文档的 updated_at
+func (ix *Indexer) finish(doc models.KnowledgeDocument, status string, chunkCount int) error {
+	now := time.Now()
+	return ix.db.Model(&models.KnowledgeDocument{}).
+		Where("id = ? AND index_status = ?", doc.ID, IndexStatusIndexing).
+		UpdateColumns(map[string]interface{}{
+			"index_status":    status,
+			"index_error":     "",
+			"indexed_version": doc.Version,
+			"chunk_count":     chunkCount,
+			"indexed_at":      now,
+		}).Error
+}
+
+// fail 记录失败原因；服务停止导致的中断退回 pending，重启后继续处理
+func (ix *Indexer) fail(documentID uuid.UUID, cause error) error {
+	status := IndexStatusFailed
+	if errors.Is(cause, context.Canceled) {
+		status = IndexStatusPending
+	}
+	if err := ix.db.Model(&models.KnowledgeDocument{}).
+		Where("id = ? AND index_status = ?", documentID, IndexStatusIndexing).
+		UpdateColumns(map[string]interface{}{
+			"index_status": status,
+			"index_error":  cause.Error(),
+		}).Error; err != nil {
+		logger.Warn("更新文档向量化状态失败 document=%s: %v", documentID, err)
+	}
+	return cause
+}
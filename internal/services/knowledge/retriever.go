@@ -0,0 +1,110 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pgvector/pgvector-go"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/config"
+	"github.com/liusCraft/orion/internal/services/ai"
+)
+
+// RetrievedChunk 检索命中的文档分块
+type RetrievedChunk struct {
+	DocumentID    uuid.UUID `json:"documentId"`
+	DocumentTitle string    `json:"documentTitle"`
+	ChunkIndex    int       `json:"chunkIndex"`
+	Content       string    `json:"content"`
+	Score         float64   `json:"score"`
+}
+
+// RetrievedDocument 命中分块按文档聚合，用于向前端展示引用来源
+type RetrievedDocument struct {
+	DocumentID uuid.UUID `json:"documentId"`
+	Title      string    `json:"title"`
+	Score      float64   `json:"score"` // 该文档命中分块的最高分
+	Chunks     []int     `json:"chunks"`
+}
+
+// Retriever 基于向量相似度的知识库检索
+type Retriever struct {
+	db       *gorm.DB
+	embedder ai.Embedder
+	cfg      config.RAGConfig
+}
+
+// NewRetriever 创建知识库检索器
+func NewRetriever(db *gorm.DB, embedder ai.Embedder, cfg config.RAGConfig) *Retriever {
+	if cfg.TopK <= 0 {
+		cfg.TopK = 5
+	}
+	return &Retriever{db: db, embedder: embedder, cfg: cfg}
+}
+
+// Retrieve 检索与问题最相关的已发布文档分块，按相似度降序返回
+// score 为余弦相似度（1 - 余弦距离），低于 ScoreThreshold 的分块会被过滤。
+func (r *Retriever) Retrieve(ctx context.Context, query string) ([]RetrievedChunk, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+	vectors, err := r.embedder.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("embed query failed: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedding count mismatch: want 1, got %d", len(vectors))
+	}
+	vec := pgvector.NewVector(vectors[0])
+
+	var chunks []RetrievedChunk
+	if err := r.db.WithContext(ctx).Raw(`
+		SELECT e.document_id, d.title AS document_title, e.chunk_index, e.chunk_content AS content,
+			1 - (e.embedding <=> ?) AS score
+		FROM knowledge_embeddings e
+		JOIN knowledge_documents d ON d.id = e.document_id
+		WHERE d.status = 'published' AND 1 - (e.embedding <=> ?) >= ?
+		ORDER BY e.embedding <=> ?
+		LIMIT ?`, vec, vec, r.cfg.ScoreThreshold, vec, r.cfg.TopK).
+		Scan(&chunks).Error; err != nil {
+		return nil, fmt.Errorf("search embeddings failed: %w", err)
+	}
+	return chunks, nil
+}
+
+// GroupByDocument 按文档聚合分块，保持首次命中的顺序
+func GroupByDocument(chunks []RetrievedChunk) []RetrievedDocument {
+	var docs []RetrievedDocument
+	index := make(map[uuid.UUID]int)
+	for _, c := range chunks {
+		i, ok := index[c.DocumentID]
+		if !ok {
+			index[c.DocumentID] = len(docs)
+			docs = append(docs, RetrievedDocument{DocumentID: c.DocumentID, Title: c.DocumentTitle, Score: c.Score})
+			i = len(docs) - 1
+		}
+		if c.Score > docs[i].Score {
+			docs[i].Score = c.Score
+		}
+		docs[i].Chunks = append(docs[i].Chunks, c.ChunkIndex)
+	}
+	return docs
+}
+
+// BuildGroundingPrompt 将检索结果组织为系统提示，要求模型优先依据知识库作答
+// start 为首个分块的引用编号，与回答中的 [n] 标记对应
+func BuildGroundingPrompt(chunks []RetrievedChunk, start int) string {
+	var b strings.Builder
+	b.WriteString("以下是从内部知识库检索到的参考资料，请优先依据这些资料回答用户问题：\n")
+	b.WriteString("- 资料与问题无关时忽略即可，不要强行引用；\n")
+	b.WriteString("- 资料未覆盖的内容请明确说明，不要编造。\n")
+	b.WriteString("每份资料前的 [编号] 即引用编号。\n")
+	for i, c := range chunks {
+		fmt.Fprintf(&b, "\n[%d] 《%s》\n%s\n", start+i, c.DocumentTitle, c.Content)
+	}
+	return b.String()
+}
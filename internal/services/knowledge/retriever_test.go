@@ -0,0 +1,27 @@
+package knowledge
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGroupByDocument(t *testing.T) {
+	docA, docB := uuid.New(), uuid.New()
+	chunks := []RetrievedChunk{
+		{DocumentID: docA, DocumentTitle: "回源排查", ChunkIndex: 2, Score: 0.91},
+		{DocumentID: docB, DocumentTitle: "缓存刷新", ChunkIndex: 0, Score: 0.85},
+		{DocumentID: docA, DocumentTitle: "回源排查", ChunkIndex: 5, Score: 0.80},
+	}
+
+	docs := GroupByDocument(chunks)
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(docs))
+	}
+	if docs[0].DocumentID != docA || docs[1].DocumentID != docB {
+		t.Fatalf("documents should keep retrieval order: %+v", docs)
+	}
+	if docs[0].Score != 0.91 || len(docs[0].Chunks) != 2 || docs[0].Chunks[1] != 5 {
+		t.Fatalf("unexpected aggregation for first document: %+v", docs[0])
+	}
+}
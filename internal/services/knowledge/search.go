@@ -0,0 +1,254 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/pgvector/pgvector-go"
+)
+
+// SearchOptions 混合检索参数
+type SearchOptions struct {
+	Query      string
+	Categories []string
+	Tags       []string
+	Limit      int // 返回的文档数
+}
+
+// ChunkMatch 命中的分块
+type ChunkMatch struct {
+	ChunkIndex  int     `json:"chunkIndex"`
+	Content     string  `json:"content"`
+	Snippet     string  `json:"snippet"` // 关键词以 <mark></mark> 标记的片段
+	Score       float64 `json:"score"`
+	VectorScore float64 `json:"vectorScore"`
+	TextScore   float64 `json:"textScore"`
+}
+
+// SearchResult 按文档聚合的检索结果
+type SearchResult struct {
+	DocumentID uuid.UUID    `json:"documentId"`
+	Score      float64      `json:"score"` // 文档内最高分块得分
+	Chunks     []ChunkMatch `json:"chunks"`
+}
+
+// maxChunksPerDocument 每个文档最多返回的命中分块数
+const maxChunksPerDocument = 3
+
+type scoredChunk struct {
+	DocumentID   uuid.UUID
+	ChunkIndex   int
+	ChunkContent string
+	VectorScore  float64
+	TextRank     float64
+	TextContains bool
+}
+
+// Search 混合检索：向量相似度与全文检索加权合并，按文档聚合后返回
+// 候选集为向量最相近的分块与全文命中的分块的并集，再统一计算两路得分。
+func (r *Retriever) Search(ctx context.Context, opts SearchOptions) ([]SearchResult, error) {
+	query := strings.TrimSpace(opts.Query)
+	if query == "" {
+		return nil, nil
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	vectors, err := r.embedder.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("embed query failed: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedding count mismatch: want 1, got %d", len(vectors))
+	}
+	vec := pgvector.NewVector(vectors[0])
+	like := "%" + escapeLike(query) + "%"
+	candidateLimit := opts.Limit * 5
+
+	// 文档过滤条件（两路候选共用）
+	filter := "d.status = 'published'"
+	var filterArgs []interface{}
+	if len(opts.Categories) > 0 {
+		filter += " AND d.category_id IN ?"
+		filterArgs = append(filterArgs, opts.Categories)
+	}
+	for _, tag := range opts.Tags {
+		filter += " AND ? = ANY(d.tags)"
+		filterArgs = append(filterArgs, tag)
+	}
+
+	sql := `
+		WITH candidates AS (
+			(SELECT e.id FROM knowledge_embeddings e JOIN knowledge_documents d ON d.id = e.document_id
+			WHERE ` + filter + `
+			ORDER BY e.embedding <=> ? LIMIT ?)
+			UNION
+			(SELECT e.id FROM knowledge_embeddings e JOIN knowledge_documents d ON d.id = e.document_id
+			WHERE ` + filter + ` AND (to_tsvector('simple', e.chunk_content) @@ plainto_tsquery('simple', ?) OR e.chunk_content ILIKE ?)
+			LIMIT ?)
+		)
+		SELECT e.document_id, e.chunk_index, e.chunk_content,
+			1 - (e.embedding <=> ?) AS vector_score,
+			ts_rank_cd(to_tsvector('simple', e.chunk_content), plainto_tsquery('simple', ?), 32) AS text_rank,
+			e.chunk_content ILIKE ? AS text_contains
+		FROM candidates c JOIN knowledge_embeddings e ON e.id = c.id`
+
+	var args []interface{}
+	args = append(args, filterArgs...)
+	args = append(args, vec, candidateLimit)
+	args = append(args, filterArgs...)
+	args = append(args, query, like, candidateLimit)
+	args = append(args, vec, query, like)
+
+	var rows []scoredChunk
+	if err := r.db.WithContext(ctx).Raw(sql, args...).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("hybrid search failed: %w", err)
+	}
+
+	terms := queryTerms(query)
+	var results []SearchResult
+	index := make(map[uuid.UUID]int)
+	for _, row := range rows {
+		textScore := TextScore(row.TextRank, row.TextContains)
+		score := HybridScore(row.VectorScore, textScore, r.cfg.VectorWeight, r.cfg.TextWeight)
+		if score < r.cfg.ScoreThreshold {
+			continue
+		}
+		match := ChunkMatch{
+			ChunkIndex:  row.ChunkIndex,
+			Content:     row.ChunkContent,
+			Snippet:     Highlight(row.ChunkContent, terms, 80),
+			Score:       score,
+			VectorScore: row.VectorScore,
+			TextScore:   textScore,
+		}
+		i, ok := index[row.DocumentID]
+		if !ok {
+			index[row.DocumentID] = len(results)
+			results = append(results, SearchResult{DocumentID: row.DocumentID})
+			i = len(results) - 1
+		}
+		results[i].Chunks = append(results[i].Chunks, match)
+		if score > results[i].Score {
+			results[i].Score = score
+		}
+	}
+
+	for i := range results {
+		chunks := results[i].Chunks
+		sort.Slice(chunks, func(a, b int) bool { return chunks[a].Score > chunks[b].Score })
+		if len(chunks) > maxChunksPerDocument {
+			results[i].Chunks = chunks[:maxChunksPerDocument]
+		}
+	}
+	sort.Slice(results, func(a, b int) bool { return results[a].Score > results[b].Score })
+	if len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results, nil
+}
+
+// TextScore 全文得分：ts_rank_cd 已归一化到 [0,1)；完整包含查询串时记满分，
+// 用于弥补 simple 分词对中文（无空格）无法按词匹配的问题
+func TextScore(rank float64, contains bool) float64 {
+	if contains {
+		return 1
+	}
+	return rank
+}
+
+// HybridScore 按权重合并向量与全文得分，权重之和不为1时归一化
+func HybridScore(vectorScore, textScore, vectorWeight, textWeight float64) float64 {
+	total := vectorWeight + textWeight
+	if total <= 0 {
+		return vectorScore
+	}
+	return (vectorWeight*vectorScore + textWeight*textScore) / total
+}
+
+// queryTerms 拆分查询词，整串优先，便于高亮时先匹配较长的词
+func queryTerms(query string) []string {
+	terms := []string{query}
+	for _, f := range strings.Fields(query) {
+		if f != query {
+			terms = append(terms, f)
+		}
+	}
+	return terms
+}
+
+// Highlight 截取首个命中词附近的片段，并用 <mark></mark> 标记命中词（不区分大小写）
+// width 为片段的大致字符数；没有命中时返回开头部分
+func Highlight(content string, terms []string, width int) string {
+	first := -1
+	for i := 0; i < len(content) && first < 0; {
+		if matchTerm(content[i:], terms) > 0 {
+			first = i
+		}
+		_, size := utf8.DecodeRuneInString(content[i:])
+		i += size
+	}
+
+	runes := []rune(content)
+	start := 0
+	if first >= 0 {
+		start = utf8.RuneCountInString(content[:first]) - width/2
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+	snippet := string(runes[start:end])
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	b.WriteString(markTerms(snippet, terms))
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return b.String()
+}
+
+// markTerms 逐段扫描并标记命中词；原文做HTML转义，前端可直接渲染标记
+func markTerms(text string, terms []string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if matched := matchTerm(text[i:], terms); matched > 0 {
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(text[i : i+matched]))
+			b.WriteString("</mark>")
+			i += matched
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(html.EscapeString(text[i : i+size]))
+		i += size
+	}
+	return b.String()
+}
+
+// matchTerm 返回 text 开头命中的最长查询词的字节长度，未命中返回0
+func matchTerm(text string, terms []string) int {
+	matched := 0
+	for _, t := range terms {
+		if t != "" && len(t) <= len(text) && len(t) > matched && strings.EqualFold(text[:len(t)], t) {
+			matched = len(t)
+		}
+	}
+	return matched
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
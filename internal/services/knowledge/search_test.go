@@ -0,0 +1,44 @@
+package knowledge
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHybridScore(t *testing.T) {
+	cases := []struct {
+		vector, text, vw, tw, want float64
+	}{
+		{0.8, 1, 0.7, 0.3, 0.86},
+		{0.8, 0, 0.7, 0.3, 0.56},
+		{0.8, 1, 1.4, 0.6, 0.86}, // 权重之和不为1时归一化
+		{0.8, 1, 0, 0, 0.8},
+	}
+	for _, tc := range cases {
+		if got := HybridScore(tc.vector, tc.text, tc.vw, tc.tw); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("HybridScore(%v, %v, %v, %v) = %v, want %v", tc.vector, tc.text, tc.vw, tc.tw, got, tc.want)
+		}
+	}
+	if TextScore(0.2, true) != 1 || TextScore(0.2, false) != 0.2 {
+		t.Error("unexpected text score")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := Highlight("检查 Nginx 回源配置，确认 nginx 的 upstream 正常", []string{"nginx"}, 100)
+	if strings.Count(got, "<mark>") != 2 || !strings.Contains(got, "<mark>Nginx</mark>") {
+		t.Fatalf("case-insensitive terms should all be marked: %s", got)
+	}
+
+	got = Highlight("<b>回源</b> 超时", []string{"回源"}, 100)
+	if got != "&lt;b&gt;<mark>回源</mark>&lt;/b&gt; 超时" {
+		t.Fatalf("content should be escaped: %s", got)
+	}
+
+	long := strings.Repeat("无关内容", 50) + "缓存刷新" + strings.Repeat("无关内容", 50)
+	got = Highlight(long, []string{"缓存刷新"}, 40)
+	if !strings.HasPrefix(got, "...") || !strings.HasSuffix(got, "...") || !strings.Contains(got, "<mark>缓存刷新</mark>") {
+		t.Fatalf("snippet should be centered on the match: %s", got)
+	}
+}
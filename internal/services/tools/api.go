@@ -0,0 +1,480 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	einotool "github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/eino-contrib/jsonschema"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// API 工具鉴权类型（Tool.AuthConfig.type）
+const (
+	APIAuthNone   = "none"
+	APIAuthBearer = "bearer"
+	APIAuthBasic  = "basic"
+	APIAuthAPIKey = "api_key"
+)
+
+// 默认限制
+const (
+	defaultAPITimeout          = 30 * time.Second
+	maxAPITimeout              = 10 * time.Minute // 工具配置的超时也不能超过
+	defaultAPIMaxResponseBytes = 1 << 20
+)
+
+// APIOptions API 工具执行限制
+type APIOptions struct {
+	Timeout          time.Duration // 单次请求超时，Tool.Config.timeout（秒）优先
+	MaxResponseBytes int64         // 响应体上限，超出部分截断
+	Client           *http.Client  // 发起请求的客户端，为空时不允许访问内网
+}
+
+// APIResult API 调用结果
+type APIResult struct {
+	StatusCode  int         `json:"statusCode"`
+	ContentType string      `json:"contentType"`
+	Body        interface{} `json:"body"` // JSON 响应解析为对象，其它为文本
+	Truncated   bool        `json:"truncated"`
+}
+
+// ToMap 转为执行记录使用的结构
+func (r *APIResult) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"statusCode":  r.StatusCode,
+		"contentType": r.ContentType,
+		"body":        r.Body,
+		"truncated":   r.Truncated,
+	}
+}
+
+// placeholder 匹配 {{name}} 模板占位符
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// ExecuteAPI 按工具配置发起 HTTP 请求
+// Tool.Config 字段：
+// - url: string（必填，可含 {{param}}，路径部分按路径转义、查询部分按查询转义）
+// - method: string（必填）
+// - headers: map[string]string（值可含 {{param}}，渲染为空的头被忽略）
+// - query: map[string]string（值可含 {{param}}，渲染为空的参数被忽略）
+// - body: string 或 object（object 中值恰为 "{{param}}" 时保留参数原始类型）
+// - bodyParam: string（直接以该参数作为请求体，优先于 body）
+// - timeout: number(seconds，最长 10 分钟)、maxResponseBytes: number（可选）
+// Tool.AuthConfig 字段：type(bearer|basic|api_key)、token、username、password、key、name（头名/参数名）、in(header|query)
+func ExecuteAPI(ctx context.Context, tool models.Tool, params map[string]interface{}, opts APIOptions) (*APIResult, error) {
+	cfg := map[string]interface{}(tool.Config)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	method, _ := asString(cfg["method"])
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		return nil, errors.New("missing method")
+	}
+	rawURL, _ := asString(cfg["url"])
+	if rawURL == "" {
+		return nil, errors.New("missing url")
+	}
+	target, err := renderURL(rawURL, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// 查询参数
+	if q, ok := cfg["query"].(map[string]interface{}); ok && len(q) > 0 {
+		values := target.Query()
+		for k, v := range q {
+			if s := renderString(fmt.Sprint(v), params); s != "" {
+				values.Set(k, s)
+			}
+		}
+		target.RawQuery = values.Encode()
+	}
+
+	// 请求体
+	var body io.Reader
+	contentType := ""
+	if method != http.MethodGet && method != http.MethodHead {
+		payload, ct, err := renderBody(cfg, params)
+		if err != nil {
+			return nil, err
+		}
+		if payload != nil {
+			body = bytes.NewReader(payload)
+			contentType = ct
+		}
+	}
+
+	timeout := opts.Timeout
+	if t := asInt(cfg["timeout"]); t > 0 {
+		timeout = time.Duration(t) * time.Second
+	}
+	if timeout <= 0 {
+		timeout = defaultAPITimeout
+	}
+	if timeout > maxAPITimeout {
+		timeout = maxAPITimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if h, ok := cfg["headers"].(map[string]interface{}); ok {
+		for k, v := range h {
+			if s := renderString(fmt.Sprint(v), params); s != "" {
+				req.Header.Set(k, s)
+			}
+		}
+	}
+	if err := applyAPIAuth(req, tool.AuthConfig); err != nil {
+		return nil, err
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("api request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	maxBytes := opts.MaxResponseBytes
+	if m := asInt(cfg["maxResponseBytes"]); m > 0 {
+		maxBytes = int64(m)
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultAPIMaxResponseBytes
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read api response failed: %w", err)
+	}
+
+	result := &APIResult{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if int64(len(raw)) > maxBytes {
+		raw = raw[:maxBytes]
+		result.Truncated = true
+	}
+	result.Body = decodeAPIBody(raw, result.ContentType, result.Truncated)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, fmt.Errorf("api response status %d: %s", resp.StatusCode, truncateText(string(raw), 200))
+	}
+	return result, nil
+}
+
+// renderURL 渲染URL模板：'?' 之前的占位符按路径转义，之后按查询转义；URL中引用的参数必须提供
+func renderURL(tmpl string, params map[string]interface{}) (*url.URL, error) {
+	for _, m := range placeholder.FindAllStringSubmatch(tmpl, -1) {
+		if v, ok := params[m[1]]; !ok || v == nil {
+			return nil, fmt.Errorf("missing parameter: %s", m[1])
+		}
+	}
+	path, query, hasQuery := strings.Cut(tmpl, "?")
+	rendered := placeholder.ReplaceAllStringFunc(path, func(s string) string {
+		return url.PathEscape(paramString(params, placeholder.FindStringSubmatch(s)[1]))
+	})
+	if hasQuery {
+		rendered += "?" + placeholder.ReplaceAllStringFunc(query, func(s string) string {
+			return url.QueryEscape(paramString(params, placeholder.FindStringSubmatch(s)[1]))
+		})
+	}
+	u, err := url.Parse(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	return u, nil
+}
+
+// renderString 替换字符串中的占位符，缺失的参数替换为空
+func renderString(tmpl string, params map[string]interface{}) string {
+	return placeholder.ReplaceAllStringFunc(tmpl, func(s string) string {
+		return paramString(params, placeholder.FindStringSubmatch(s)[1])
+	})
+}
+
+// renderBody 渲染请求体，返回内容与 Content-Type
+func renderBody(cfg map[string]interface{}, params map[string]interface{}) ([]byte, string, error) {
+	if name, _ := asString(cfg["bodyParam"]); name != "" {
+		v, ok := params[name]
+		if !ok || v == nil {
+			return nil, "", nil
+		}
+		if s, ok := v.(string); ok {
+			return []byte(s), "text/plain; charset=utf-8", nil
+		}
+		b, err := json.Marshal(v)
+		return b, "application/json", err
+	}
+
+	switch b := cfg["body"].(type) {
+	case nil:
+		return nil, "", nil
+	case string:
+		if b == "" {
+			return nil, "", nil
+		}
+		rendered := renderString(b, params)
+		ct := "text/plain; charset=utf-8"
+		if json.Valid([]byte(rendered)) {
+			ct = "application/json"
+		}
+		return []byte(rendered), ct, nil
+	default:
+		out, err := json.Marshal(renderValue(b, params))
+		return out, "application/json", err
+	}
+}
+
+// renderValue 递归渲染 JSON 对象中的字符串值
+func renderValue(v interface{}, params map[string]interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		// 整个值就是一个占位符时保留参数原始类型（数字、布尔、对象）
+		if m := placeholder.FindStringSubmatch(t); m != nil && m[0] == strings.TrimSpace(t) {
+			return params[m[1]]
+		}
+		return renderString(t, params)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[k] = renderValue(val, params)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = renderValue(val, params)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func paramString(params map[string]interface{}, name string) string {
+	switch v := params[name].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64, bool, int, int64:
+		return fmt.Sprint(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// applyAPIAuth 按 AuthConfig 设置鉴权信息
+func applyAPIAuth(req *http.Request, auth models.JSONMap) error {
+	if len(auth) == 0 {
+		return nil
+	}
+	authType, _ := asString(auth["type"])
+	switch authType {
+	case "", APIAuthNone:
+		return nil
+	case APIAuthBearer:
+		token, _ := asString(auth["token"])
+		if token == "" {
+			return errors.New("bearer auth requires token")
+		}
+		req.Header.Set("Authorization", maybeBearer(token))
+	case APIAuthBasic:
+		username, _ := asString(auth["username"])
+		password, _ := asString(auth["password"])
+		if username == "" {
+			return errors.New("basic auth requires username")
+		}
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	case APIAuthAPIKey:
+		key, _ := asString(auth["key"])
+		if key == "" {
+			return errors.New("api_key auth requires key")
+		}
+		name, _ := asString(auth["name"])
+		if in, _ := asString(auth["in"]); in == "query" {
+			if name == "" {
+				name = "api_key"
+			}
+			q := req.URL.Query()
+			q.Set(name, key)
+			req.URL.RawQuery = q.Encode()
+		} else {
+			if name == "" {
+				name = "X-API-Key"
+			}
+			req.Header.Set(name, key)
+		}
+	default:
+		return fmt.Errorf("unsupported auth type: %s", authType)
+	}
+	return nil
+}
+
+// decodeAPIBody JSON 响应解析为对象，解析失败或被截断时返回文本
+func decodeAPIBody(raw []byte, contentType string, truncated bool) interface{} {
+	if !truncated && (strings.Contains(contentType, "json") || json.Valid(raw)) {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err == nil {
+			return v
+		}
+	}
+	return string(raw)
+}
+
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// apiTool 将 API 工具适配为 Eino 工具，供对话规划阶段调用
+type apiTool struct {
+	tool models.Tool
+	opts APIOptions
+}
+
+// NewAPITool 创建 API 工具的 Eino 适配
+// 参数定义取 Tool.Config.inputSchema（JSON Schema）；未配置时按模板占位符生成字符串参数，URL 中的占位符为必填。
+func NewAPITool(tool models.Tool, opts APIOptions) einotool.InvokableTool {
+	return &apiTool{tool: tool, opts: opts}
+}
+
+func (t *apiTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	desc := t.tool.Description
+	if desc == "" {
+		desc = t.tool.DisplayName
+	}
+	s, err := apiInputSchema(t.tool)
+	if err != nil {
+		return nil, err
+	}
+	return &schema.ToolInfo{
+		Name:        t.tool.Name,
+		Desc:        desc,
+		ParamsOneOf: schema.NewParamsOneOfByJSONSchema(s),
+	}, nil
+}
+
+func (t *apiTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...einotool.Option) (string, error) {
+	params := map[string]interface{}{}
+	if strings.TrimSpace(argumentsInJSON) != "" {
+		if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+	result, err := ExecuteAPI(ctx, t.tool, params, t.opts)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// apiInputSchema 读取或推导 API 工具的参数 JSON Schema
+func apiInputSchema(tool models.Tool) (*jsonschema.Schema, error) {
+	raw, ok := tool.Config["inputSchema"]
+	if !ok || raw == nil {
+		raw = deriveInputSchema(tool)
+	}
+	return parseInputSchema(raw)
+}
+
+// parseInputSchema 将配置中的 JSON Schema 转为 Eino 使用的结构
+func parseInputSchema(raw interface{}) (*jsonschema.Schema, error) {
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	s := &jsonschema.Schema{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("invalid inputSchema: %w", err)
+	}
+	return s, nil
+}
+
+// deriveInputSchema 按模板占位符生成字符串参数，URL 中的占位符为必填
+func deriveInputSchema(tool models.Tool) map[string]interface{} {
+	names := map[string]bool{}
+	collectPlaceholders(map[string]interface{}(tool.Config), names)
+	if p, _ := asString(tool.Config["bodyParam"]); p != "" {
+		names[p] = true
+	}
+	inURL := map[string]bool{}
+	if u, _ := asString(tool.Config["url"]); u != "" {
+		for _, m := range placeholder.FindAllStringSubmatch(u, -1) {
+			inURL[m[1]] = true
+		}
+	}
+
+	properties := map[string]interface{}{}
+	required := []string{}
+	for n := range names {
+		properties[n] = map[string]interface{}{"type": "string"}
+		if inURL[n] {
+			required = append(required, n)
+		}
+	}
+	sort.Strings(required)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// collectPlaceholders 收集 url/headers/query/body 中引用的参数名
+func collectPlaceholders(v interface{}, names map[string]bool) {
+	switch t := v.(type) {
+	case string:
+		for _, m := range placeholder.FindAllStringSubmatch(t, -1) {
+			names[m[1]] = true
+		}
+	case map[string]interface{}:
+		for k, val := range t {
+			if k == "inputSchema" || k == "mcp_server" || k == "mcp_tools" {
+				continue
+			}
+			collectPlaceholders(val, names)
+		}
+	case []interface{}:
+		for _, val := range t {
+			collectPlaceholders(val, names)
+		}
+	}
+}
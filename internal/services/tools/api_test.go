@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// localOptions 允许访问测试服务器所在的回环地址
+func localOptions(t *testing.T) APIOptions {
+	t.Helper()
+	loopback, err := ParseNetworks([]string{"127.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return APIOptions{Client: NewHTTPClient(time.Minute, loopback)}
+}
+
+func TestExecuteAPI(t *testing.T) {
+	var gotPath, gotQuery, gotAuth, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotQuery = r.URL.RawQuery
+		gotAuth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	tool := models.Tool{
+		Name: "purge",
+		Config: models.JSONMap{
+			"method": "post",
+			"url":    srv.URL + "/domains/{{domain}}/purge",
+			"query":  map[string]interface{}{"region": "{{region}}", "empty": "{{missing}}"},
+			"body":   map[string]interface{}{"urls": "{{urls}}", "note": "by {{user}}"},
+		},
+		AuthConfig: models.JSONMap{"type": "basic", "username": "ops", "password": "secret"},
+	}
+	params := map[string]interface{}{
+		"domain": "a b.com",
+		"region": "cn&us",
+		"urls":   []interface{}{"/x", "/y"},
+		"user":   "alice",
+	}
+	result, err := ExecuteAPI(context.Background(), tool, params, localOptions(t))
+	if err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if gotPath != "/domains/a%20b.com/purge" {
+		t.Errorf("unexpected path: %s", gotPath)
+	}
+	if gotQuery != "region=cn%26us" {
+		t.Errorf("unexpected query: %s", gotQuery)
+	}
+	if !strings.HasPrefix(gotAuth, "Basic ") {
+		t.Errorf("unexpected auth: %s", gotAuth)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(gotBody), &body); err != nil {
+		t.Fatalf("body should be json: %s", gotBody)
+	}
+	if urls, ok := body["urls"].([]interface{}); !ok || len(urls) != 2 || body["note"] != "by alice" {
+		t.Errorf("unexpected body: %s", gotBody)
+	}
+	if m, ok := result.Body.(map[string]interface{}); !ok || m["ok"] != true {
+		t.Errorf("json response should be decoded: %+v", result.Body)
+	}
+
+	if _, err := ExecuteAPI(context.Background(), tool, map[string]interface{}{}, localOptions(t)); err == nil || !strings.Contains(err.Error(), "missing parameter: domain") {
+		t.Errorf("expected missing parameter error, got %v", err)
+	}
+}
+
+func TestExecuteAPIResponseHandling(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_key") != "k" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("denied"))
+			return
+		}
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	tool := models.Tool{
+		Config:     models.JSONMap{"method": "GET", "url": srv.URL},
+		AuthConfig: models.JSONMap{"type": "api_key", "in": "query", "key": "k"},
+	}
+	opts := localOptions(t)
+	opts.MaxResponseBytes = 10
+	result, err := ExecuteAPI(context.Background(), tool, nil, opts)
+	if err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if !result.Truncated || result.Body != strings.Repeat("x", 10) {
+		t.Errorf("response should be truncated text: %+v", result)
+	}
+
+	tool.AuthConfig = nil
+	result, err = ExecuteAPI(context.Background(), tool, nil, localOptions(t))
+	if err == nil || !strings.Contains(err.Error(), "denied") || result == nil || result.StatusCode != http.StatusUnauthorized || result.Body != "denied" {
+		t.Errorf("non-2xx should return result and error: %+v %v", result, err)
+	}
+}
+
+func TestAPIToolInfo(t *testing.T) {
+	tool := models.Tool{
+		Name:        "domain_status",
+		Description: "查询域名状态",
+		Config: models.JSONMap{
+			"method": "GET",
+			"url":    "https://cdn.example.com/domains/{{domain}}",
+			"query":  map[string]interface{}{"region": "{{region}}"},
+		},
+	}
+	info, err := NewAPITool(tool, APIOptions{}).Info(context.Background())
+	if err != nil {
+		t.Fatalf("info failed: %v", err)
+	}
+	s, err := info.ParamsOneOf.ToJSONSchema()
+	if err != nil {
+		t.Fatalf("schema failed: %v", err)
+	}
+	if len(s.Required) != 1 || s.Required[0] != "domain" {
+		t.Errorf("url placeholders should be required: %v", s.Required)
+	}
+	if _, ok := s.Properties.Get("region"); !ok {
+		t.Errorf("query placeholders should be parameters")
+	}
+}
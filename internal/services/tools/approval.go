@@ -0,0 +1,214 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// 审批状态（ToolExecution.ApprovalStatus）
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExpired  = "expired"
+)
+
+// 工具执行状态：等待审批、已拒绝
+const (
+	ExecutionAwaitingApproval = "awaiting_approval"
+	ExecutionRejected         = "rejected"
+)
+
+// 审批等待参数
+const (
+	defaultApprovalTimeout = 10 * time.Minute
+	approvalPollInterval   = 2 * time.Second
+)
+
+// ErrApprovalNotPending 执行记录不在待审批状态（已处理或已过期）
+var ErrApprovalNotPending = errors.New("tool execution is not awaiting approval")
+
+// ApprovalDecision 审批结果
+type ApprovalDecision struct {
+	Status     string     `json:"status"` // approved, rejected, expired
+	ApprovedBy *uuid.UUID `json:"approvedBy,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+}
+
+// Approved 是否批准执行
+func (d ApprovalDecision) Approved() bool {
+	return d.Status == ApprovalApproved
+}
+
+// RequiresApproval 判断工具调用是否需要人工审批
+// Tool.Config.requires_approval 为 true 时整个工具需要审批；
+// 为字符串数组时仅列出的 MCP 子工具需要审批（可写原名或带 "工具名__" 前缀的全名）。
+func RequiresApproval(tool models.Tool, toolName string) bool {
+	switch v := tool.Config["requires_approval"].(type) {
+	case bool:
+		return v
+	case []interface{}:
+		sub := strings.TrimPrefix(toolName, tool.Name+"__")
+		for _, item := range v {
+			if name, ok := item.(string); ok && (name == sub || name == toolName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ApprovalBroker 协调等待审批的工具调用
+// 审批结果以数据库为准：同进程内通过通道即时唤醒，跨实例时依靠轮询发现结果。
+type ApprovalBroker struct {
+	db      *gorm.DB
+	timeout time.Duration
+
+	mu      sync.Mutex
+	waiters map[uuid.UUID]chan ApprovalDecision
+}
+
+// NewApprovalBroker 创建审批协调器，timeout 为等待审批的最长时间
+func NewApprovalBroker(db *gorm.DB, timeout time.Duration) *ApprovalBroker {
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	return &ApprovalBroker{db: db, timeout: timeout, waiters: make(map[uuid.UUID]chan ApprovalDecision)}
+}
+
+// Timeout 等待审批的最长时间
+func (b *ApprovalBroker) Timeout() time.Duration {
+	return b.timeout
+}
+
+// Request 将执行记录标记为等待审批
+func (b *ApprovalBroker) Request(ctx context.Context, executionID uuid.UUID) error {
+	return b.db.WithContext(ctx).Model(&models.ToolExecution{}).Where("id = ?", executionID).
+		Updates(map[string]interface{}{
+			"status":          ExecutionAwaitingApproval,
+			"approval_status": ApprovalPending,
+		}).Error
+}
+
+// Wait 阻塞直到审批完成、超时或 ctx 取消
+// heartbeat 按 heartbeatInterval 周期调用，用于保持 SSE 连接。
+// 超时后记录为 expired 并按拒绝处理；ctx 取消时同样记为 expired 并返回 ctx 错误。
+func (b *ApprovalBroker) Wait(ctx context.Context, executionID uuid.UUID, heartbeatInterval time.Duration, heartbeat func()) (ApprovalDecision, error) {
+	ch := make(chan ApprovalDecision, 1)
+	b.mu.Lock()
+	b.waiters[executionID] = ch
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.waiters, executionID)
+		b.mu.Unlock()
+	}()
+
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = 15 * time.Second
+	}
+	hb := time.NewTicker(heartbeatInterval)
+	defer hb.Stop()
+	poll := time.NewTicker(approvalPollInterval)
+	defer poll.Stop()
+	deadline := time.NewTimer(b.timeout)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case d := <-ch:
+			return d, nil
+		case <-poll.C:
+			if d, ok := b.load(ctx, executionID); ok {
+				return d, nil
+			}
+		case <-hb.C:
+			if heartbeat != nil {
+				heartbeat()
+			}
+		case <-deadline.C:
+			return b.expire(context.Background(), executionID), nil
+		case <-ctx.Done():
+			b.expire(context.Background(), executionID)
+			return ApprovalDecision{Status: ApprovalExpired}, ctx.Err()
+		}
+	}
+}
+
+// Decide 记录审批结果并唤醒等待方；仅待审批的记录可以被处理
+func (b *ApprovalBroker) Decide(ctx context.Context, executionID, userID uuid.UUID, approve bool, comment string) (ApprovalDecision, error) {
+	d := ApprovalDecision{Status: ApprovalRejected, ApprovedBy: &userID, Comment: comment}
+	status := ExecutionRejected
+	if approve {
+		d.Status = ApprovalApproved
+		status = "pending"
+	}
+	now := time.Now()
+	res := b.db.WithContext(ctx).Model(&models.ToolExecution{}).
+		Where("id = ? AND approval_status = ?", executionID, ApprovalPending).
+		Updates(map[string]interface{}{
+			"status":           status,
+			"approval_status":  d.Status,
+			"approved_by":      userID,
+			"approved_at":      now,
+			"approval_comment": comment,
+		})
+	if res.Error != nil {
+		return d, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return d, ErrApprovalNotPending
+	}
+	b.notify(executionID, d)
+	return d, nil
+}
+
+func (b *ApprovalBroker) notify(executionID uuid.UUID, d ApprovalDecision) {
+	b.mu.Lock()
+	ch, ok := b.waiters[executionID]
+	b.mu.Unlock()
+	if ok {
+		select {
+		case ch <- d:
+		default:
+		}
+	}
+}
+
+// load 读取已完成的审批结果（其它实例处理的审批）
+func (b *ApprovalBroker) load(ctx context.Context, executionID uuid.UUID) (ApprovalDecision, bool) {
+	var exec models.ToolExecution
+	if err := b.db.WithContext(ctx).Select("approval_status", "approved_by", "approval_comment").
+		Where("id = ?", executionID).First(&exec).Error; err != nil {
+		return ApprovalDecision{}, false
+	}
+	if exec.ApprovalStatus == ApprovalPending || exec.ApprovalStatus == "" {
+		return ApprovalDecision{}, false
+	}
+	return ApprovalDecision{Status: exec.ApprovalStatus, ApprovedBy: exec.ApprovedBy, Comment: exec.ApprovalComment}, true
+}
+
+// expire 将仍待审批的记录标记为过期；若恰好已被处理则返回实际结果
+func (b *ApprovalBroker) expire(ctx context.Context, executionID uuid.UUID) ApprovalDecision {
+	res := b.db.WithContext(ctx).Model(&models.ToolExecution{}).
+		Where("id = ? AND approval_status = ?", executionID, ApprovalPending).
+		Updates(map[string]interface{}{
+			"status":          ExecutionRejected,
+			"approval_status": ApprovalExpired,
+			"error_message":   "审批超时",
+		})
+	if res.Error == nil && res.RowsAffected == 0 {
+		if d, ok := b.load(ctx, executionID); ok {
+			return d
+		}
+	}
+	return ApprovalDecision{Status: ApprovalExpired}
+}
@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestRequiresApproval(t *testing.T) {
+	tool := models.Tool{Name: "cdn", Config: models.JSONMap{}}
+	if RequiresApproval(tool, "cdn__purge") {
+		t.Error("tools without requires_approval should run directly")
+	}
+
+	tool.Config["requires_approval"] = true
+	if !RequiresApproval(tool, "cdn__query") {
+		t.Error("requires_approval=true should cover every sub-tool")
+	}
+
+	tool.Config["requires_approval"] = []interface{}{"purge", "cdn__restart"}
+	cases := map[string]bool{
+		"cdn__purge":   true,
+		"cdn__restart": true,
+		"cdn__query":   false,
+		"purge":        true,
+	}
+	for name, want := range cases {
+		if got := RequiresApproval(tool, name); got != want {
+			t.Errorf("RequiresApproval(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
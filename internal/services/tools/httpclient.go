@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// httpMaxRedirects 工具请求最多跟随的重定向次数
+const httpMaxRedirects = 5
+
+// ErrAddressNotAllowed 目标地址为回环、内网、链路本地等受限地址，且不在允许的网段中
+var ErrAddressNotAllowed = errors.New("destination address is not allowed")
+
+// defaultHTTPClient 未指定客户端时使用，不允许访问任何内网地址
+var defaultHTTPClient = NewHTTPClient(maxAPITimeout, nil)
+
+// sharedAddressSpace 运营商级 NAT 地址（100.64.0.0/10），同样视为内网
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// NewHTTPClient 创建工具访问外部 HTTP 服务的客户端
+// 建立连接时校验解析后的 IP，重定向与 DNS 重绑定同样受限：默认拒绝回环、内网、链路本地（含云主机元数据地址）、
+// 组播与未指定地址，allowed 中的网段除外。重定向最多跟随 5 次且只能是 http/https；不使用环境变量中的代理。
+// timeout 为单次请求（含读取响应）的总时长上限，<=0 时不限制。
+func NewHTTPClient(timeout time.Duration, allowed []*net.IPNet) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !addressAllowed(ip, allowed) {
+				return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= httpMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", httpMaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported redirect scheme: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// ParseNetworks 解析允许访问的网段，可以是 CIDR 或单个 IP
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network: %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %q", v)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// addressAllowed 公网地址总是允许；受限地址只有位于 allowed 中的网段时允许
+func addressAllowed(ip net.IP, allowed []*net.IPNet) bool {
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	restricted := ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip)
+	return !restricted
+}
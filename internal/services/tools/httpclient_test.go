@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestAddressAllowed(t *testing.T) {
+	allowed, err := ParseNetworks([]string{"10.1.0.0/16", "192.168.1.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"8.8.8.8":          true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"::ffff:127.0.0.1": false,
+		"10.0.0.1":         false,
+		"172.16.5.4":       false,
+		"169.254.169.254":  false, // 云主机元数据
+		"100.64.1.1":       false,
+		"0.0.0.0":          false,
+		"fd00::1":          false,
+		"10.1.2.3":         true,
+		"192.168.1.5":      true,
+		"192.168.1.6":      false,
+	}
+	for ip, want := range cases {
+		if got := addressAllowed(net.ParseIP(ip), allowed); got != want {
+			t.Errorf("addressAllowed(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if _, err := ParseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("invalid cidr should be rejected")
+	}
+	if _, err := ParseNetworks([]string{"intranet"}); err == nil {
+		t.Error("host names should be rejected")
+	}
+}
+
+func TestHTTPClientRestrictions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/ftp":
+			http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	// 默认不允许访问回环地址
+	tool := models.Tool{Config: models.JSONMap{"method": "GET", "url": srv.URL}}
+	if _, err := ExecuteAPI(context.Background(), tool, nil, APIOptions{}); !errors.Is(err, ErrAddressNotAllowed) {
+		t.Errorf("loopback should be blocked by default: %v", err)
+	}
+	if _, err := ExecuteAPI(context.Background(), tool, nil, localOptions(t)); err != nil {
+		t.Errorf("allowed network should be reachable: %v", err)
+	}
+
+	tool.Config["url"] = srv.URL + "/loop"
+	if _, err := ExecuteAPI(context.Background(), tool, nil, localOptions(t)); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("redirects should be limited: %v", err)
+	}
+	tool.Config["url"] = srv.URL + "/ftp"
+	if _, err := ExecuteAPI(context.Background(), tool, nil, localOptions(t)); err == nil || !strings.Contains(err.Error(), "redirect scheme") {
+		t.Errorf("redirect to other schemes should be rejected: %v", err)
+	}
+}
@@ -0,0 +1,444 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// OpenAPI 导入限制
+const (
+	openAPIMaxSpecBytes   = 10 << 20
+	openAPIFetchTimeout   = 30 * time.Second
+	openAPIMaxSchemaDepth = 8
+	openAPIMaxToolName    = 64 // 与模型函数名长度上限一致
+)
+
+// OpenAPIOperation 规范中的一个接口操作
+type OpenAPIOperation struct {
+	Key         string   `json:"key"` // 选择操作时使用：operationId，缺省为 "METHOD /path"
+	OperationID string   `json:"operationId,omitempty"`
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+	ToolName    string   `json:"toolName"` // 生成的工具名（未加前缀）
+
+	pathItem  *openapi3.PathItem
+	operation *openapi3.Operation
+}
+
+// OpenAPISpec 解析后的 OpenAPI 3 文档
+type OpenAPISpec struct {
+	doc       *openapi3.T
+	sourceURL string
+}
+
+// OpenAPIImportOptions 生成工具的选项
+type OpenAPIImportOptions struct {
+	BaseURL    string // 覆盖 servers 中的地址
+	NamePrefix string // 工具名前缀
+}
+
+var (
+	toolNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+	pathParam      = regexp.MustCompile(`\{([^{}]+)\}`)
+)
+
+// ParseOpenAPI 解析并校验 OpenAPI 3 文档（JSON 或 YAML）
+// sourceURL 为文档来源地址，用于解析相对的 servers 地址，可为空。
+func ParseOpenAPI(ctx context.Context, data []byte, sourceURL string) (*OpenAPISpec, error) {
+	loader := openapi3.NewLoader()
+	loader.Context = ctx
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse openapi spec failed: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version: %q", doc.OpenAPI)
+	}
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+	return &OpenAPISpec{doc: doc, sourceURL: sourceURL}, nil
+}
+
+// FetchOpenAPI 下载 OpenAPI 文档
+// client 为空时使用不允许访问内网的默认客户端。
+func FetchOpenAPI(ctx context.Context, client *http.Client, specURL string) ([]byte, error) {
+	u, err := url.Parse(specURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid spec url: %s", specURL)
+	}
+	ctx, cancel := context.WithTimeout(ctx, openAPIFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch spec failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("fetch spec failed: status %d: %s", resp.StatusCode, truncateText(strings.TrimSpace(string(raw)), 200))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, openAPIMaxSpecBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read spec failed: %w", err)
+	}
+	if len(data) > openAPIMaxSpecBytes {
+		return nil, fmt.Errorf("spec exceeds %d bytes", openAPIMaxSpecBytes)
+	}
+	return data, nil
+}
+
+// Title 文档标题
+func (s *OpenAPISpec) Title() string {
+	if s.doc.Info == nil {
+		return ""
+	}
+	return s.doc.Info.Title
+}
+
+// Operations 按路径、方法排序列出全部操作
+func (s *OpenAPISpec) Operations() []OpenAPIOperation {
+	paths := make([]string, 0, len(s.doc.Paths))
+	for p := range s.doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var ops []OpenAPIOperation
+	for _, p := range paths {
+		item := s.doc.Paths[p]
+		methods := make([]string, 0)
+		for m := range item.Operations() {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+		for _, m := range methods {
+			op := item.GetOperation(m)
+			key := op.OperationID
+			if key == "" {
+				key = m + " " + p
+			}
+			ops = append(ops, OpenAPIOperation{
+				Key:         key,
+				OperationID: op.OperationID,
+				Method:      m,
+				Path:        p,
+				Summary:     op.Summary,
+				Description: op.Description,
+				Tags:        op.Tags,
+				Deprecated:  op.Deprecated,
+				ToolName:    operationToolName(op.OperationID, m, p),
+				pathItem:    item,
+				operation:   op,
+			})
+		}
+	}
+	return ops
+}
+
+// BuildTool 为操作生成 api 类型工具（未设置 ID 与创建人）
+// 路径参数渲染到 URL，查询参数与请求头参数写入 query/headers 模板；
+// JSON 请求体作为名为 body 的参数整体传入。
+func (s *OpenAPISpec) BuildTool(op OpenAPIOperation, opts OpenAPIImportOptions) (models.Tool, error) {
+	baseURL, err := s.baseURL(opts.BaseURL)
+	if err != nil {
+		return models.Tool{}, err
+	}
+
+	properties := map[string]interface{}{}
+	var required []string
+	query := map[string]interface{}{}
+	headers := map[string]interface{}{}
+
+	// 操作级参数覆盖路径级同名参数
+	params := map[string]*openapi3.Parameter{}
+	var order []string
+	for _, refs := range []openapi3.Parameters{op.pathItem.Parameters, op.operation.Parameters} {
+		for _, ref := range refs {
+			if ref == nil || ref.Value == nil {
+				continue
+			}
+			p := ref.Value
+			key := p.In + ":" + p.Name
+			if _, ok := params[key]; !ok {
+				order = append(order, key)
+			}
+			params[key] = p
+		}
+	}
+	for _, key := range order {
+		p := params[key]
+		isRequired := p.Required
+		switch p.In {
+		case openapi3.ParameterInPath:
+			isRequired = true
+		case openapi3.ParameterInQuery:
+			query[p.Name] = "{{" + p.Name + "}}"
+		case openapi3.ParameterInHeader:
+			headers[p.Name] = "{{" + p.Name + "}}"
+		default:
+			continue // cookie 参数不支持
+		}
+		prop := schemaJSON(p.Schema, 0)
+		if prop == nil {
+			prop = map[string]interface{}{"type": "string"}
+		}
+		if p.Description != "" {
+			prop["description"] = p.Description
+		}
+		properties[p.Name] = prop
+		if isRequired {
+			required = append(required, p.Name)
+		}
+	}
+
+	cfg := models.JSONMap{
+		"method":  op.Method,
+		"url":     strings.TrimRight(baseURL, "/") + pathParam.ReplaceAllString(op.Path, "{{$1}}"),
+		"openapi": map[string]interface{}{"operation": op.Key, "path": op.Path},
+	}
+	if len(query) > 0 {
+		cfg["query"] = query
+	}
+	if len(headers) > 0 {
+		cfg["headers"] = headers
+	}
+
+	if rb := op.operation.RequestBody; rb != nil && rb.Value != nil {
+		if ct, media := requestMedia(rb.Value.Content); media != nil {
+			name := "body"
+			if _, ok := properties[name]; ok {
+				name = "requestBody"
+			}
+			prop := schemaJSON(media.Schema, 0)
+			if prop == nil {
+				prop = map[string]interface{}{}
+			}
+			if rb.Value.Description != "" {
+				prop["description"] = rb.Value.Description
+			}
+			properties[name] = prop
+			if rb.Value.Required {
+				required = append(required, name)
+			}
+			cfg["bodyParam"] = name
+			if !strings.Contains(ct, "json") {
+				headers["Content-Type"] = ct
+				cfg["headers"] = headers
+			}
+		}
+	}
+
+	sort.Strings(required)
+	inputSchema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		inputSchema["required"] = required
+	}
+	cfg["inputSchema"] = inputSchema
+
+	name := op.ToolName
+	if opts.NamePrefix != "" {
+		name = sanitizeToolName(opts.NamePrefix + name)
+	}
+	displayName := op.Summary
+	if displayName == "" {
+		displayName = op.Key
+	}
+	description := op.Summary
+	if op.Description != "" && op.Description != op.Summary {
+		description = strings.TrimSpace(description + "\n" + op.Description)
+	}
+	if description == "" {
+		description = op.Method + " " + op.Path
+	}
+
+	return models.Tool{
+		Name:        name,
+		DisplayName: truncateRunes(displayName, 100),
+		Description: description,
+		ToolType:    "api",
+		Config:      cfg,
+	}, nil
+}
+
+// baseURL 取覆盖地址或 servers[0]（变量取默认值），相对地址按文档来源解析
+func (s *OpenAPISpec) baseURL(override string) (string, error) {
+	raw := strings.TrimSpace(override)
+	if raw == "" {
+		if len(s.doc.Servers) == 0 || s.doc.Servers[0] == nil {
+			return "", errors.New("spec has no servers, baseUrl is required")
+		}
+		srv := s.doc.Servers[0]
+		raw = srv.URL
+		for name, v := range srv.Variables {
+			if v != nil {
+				raw = strings.ReplaceAll(raw, "{"+name+"}", v.Default)
+			}
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid base url: %w", err)
+	}
+	if !u.IsAbs() && s.sourceURL != "" {
+		if src, err := url.Parse(s.sourceURL); err == nil {
+			u = src.ResolveReference(u)
+		}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("base url must be absolute http(s): %s", raw)
+	}
+	return u.String(), nil
+}
+
+// requestMedia 选择请求体类型：优先 JSON，其次纯文本
+func requestMedia(content openapi3.Content) (string, *openapi3.MediaType) {
+	if m := content.Get("application/json"); m != nil {
+		return "application/json", m
+	}
+	types := make([]string, 0, len(content))
+	for ct := range content {
+		types = append(types, ct)
+	}
+	sort.Strings(types)
+	for _, ct := range types {
+		if strings.HasSuffix(ct, "+json") {
+			return ct, content[ct]
+		}
+	}
+	if m := content.Get("text/plain"); m != nil {
+		return "text/plain", m
+	}
+	return "", nil
+}
+
+// schemaJSON 将 OpenAPI Schema 展开为 JSON Schema（内联 $ref，超出深度的部分省略细节）
+func schemaJSON(ref *openapi3.SchemaRef, depth int) map[string]interface{} {
+	if ref == nil || ref.Value == nil {
+		return nil
+	}
+	s := ref.Value
+	out := map[string]interface{}{}
+	if s.Type != "" {
+		out["type"] = s.Type
+	}
+	if s.Format != "" {
+		out["format"] = s.Format
+	}
+	if s.Description != "" {
+		out["description"] = s.Description
+	} else if s.Title != "" {
+		out["description"] = s.Title
+	}
+	if len(s.Enum) > 0 {
+		out["enum"] = s.Enum
+	}
+	if s.Default != nil {
+		out["default"] = s.Default
+	}
+	if s.Min != nil {
+		out["minimum"] = *s.Min
+	}
+	if s.Max != nil {
+		out["maximum"] = *s.Max
+	}
+	if s.Pattern != "" {
+		out["pattern"] = s.Pattern
+	}
+	if depth >= openAPIMaxSchemaDepth {
+		return out
+	}
+
+	if s.Items != nil {
+		if items := schemaJSON(s.Items, depth+1); items != nil {
+			out["items"] = items
+		}
+	}
+	if len(s.Properties) > 0 {
+		props := map[string]interface{}{}
+		for name, p := range s.Properties {
+			if p != nil && p.Value != nil && p.Value.ReadOnly {
+				continue // 只读字段不出现在请求中
+			}
+			if v := schemaJSON(p, depth+1); v != nil {
+				props[name] = v
+			}
+		}
+		out["properties"] = props
+		var required []string
+		for _, name := range s.Required {
+			if _, ok := props[name]; ok {
+				required = append(required, name)
+			}
+		}
+		if len(required) > 0 {
+			out["required"] = required
+		}
+	}
+	if ap := s.AdditionalProperties.Schema; ap != nil {
+		if v := schemaJSON(ap, depth+1); v != nil {
+			out["additionalProperties"] = v
+		}
+	}
+	for key, refs := range map[string]openapi3.SchemaRefs{"oneOf": s.OneOf, "anyOf": s.AnyOf, "allOf": s.AllOf} {
+		if len(refs) == 0 {
+			continue
+		}
+		var list []interface{}
+		for _, r := range refs {
+			if v := schemaJSON(r, depth+1); v != nil {
+				list = append(list, v)
+			}
+		}
+		out[key] = list
+	}
+	return out
+}
+
+// operationToolName 由 operationId（缺省为方法与路径）生成工具名
+func operationToolName(operationID, method, path string) string {
+	name := operationID
+	if name == "" {
+		name = strings.ToLower(method) + "_" + strings.TrimLeft(pathParam.ReplaceAllString(path, "by_$1"), "/")
+	}
+	return sanitizeToolName(name)
+}
+
+func sanitizeToolName(name string) string {
+	name = strings.Trim(toolNameUnsafe.ReplaceAllString(name, "_"), "_")
+	if len(name) > openAPIMaxToolName {
+		name = name[:openAPIMaxToolName]
+	}
+	return name
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
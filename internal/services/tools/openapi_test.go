@@ -0,0 +1,152 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testOpenAPISpec = `
+openapi: 3.0.3
+info:
+  title: CDN API
+  version: "1.0"
+servers:
+  - url: https://{env}.cdn.example.com/v1
+    variables:
+      env:
+        default: api
+paths:
+  /domains/{domain}:
+    parameters:
+      - name: domain
+        in: path
+        required: true
+        schema: {type: string}
+    get:
+      operationId: getDomain
+      summary: 查询域名
+      parameters:
+        - name: region
+          in: query
+          description: 区域
+          schema: {type: string, enum: [cn, global]}
+      responses:
+        "200": {description: ok}
+  /purge:
+    post:
+      summary: 刷新缓存
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Purge'
+      responses:
+        "200": {description: ok}
+components:
+  schemas:
+    Purge:
+      type: object
+      required: [urls]
+      properties:
+        id: {type: string, readOnly: true}
+        urls:
+          type: array
+          items: {type: string}
+`
+
+func TestOpenAPIBuildTool(t *testing.T) {
+	spec, err := ParseOpenAPI(context.Background(), []byte(testOpenAPISpec), "")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ops := spec.Operations()
+	if len(ops) != 2 || ops[0].Key != "getDomain" || ops[1].Key != "POST /purge" || ops[1].ToolName != "post_purge" {
+		t.Fatalf("unexpected operations: %+v", ops)
+	}
+
+	tool, err := spec.BuildTool(ops[0], OpenAPIImportOptions{NamePrefix: "cdn_"})
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if tool.Name != "cdn_getDomain" || tool.ToolType != "api" || tool.DisplayName != "查询域名" {
+		t.Errorf("unexpected tool: %+v", tool)
+	}
+	if tool.Config["url"] != "https://api.cdn.example.com/v1/domains/{{domain}}" || tool.Config["method"] != "GET" {
+		t.Errorf("unexpected url: %v %v", tool.Config["method"], tool.Config["url"])
+	}
+	if q, _ := tool.Config["query"].(map[string]interface{}); q["region"] != "{{region}}" {
+		t.Errorf("unexpected query: %v", tool.Config["query"])
+	}
+	schema := tool.Config["inputSchema"].(map[string]interface{})
+	if req, _ := schema["required"].([]string); len(req) != 1 || req[0] != "domain" {
+		t.Errorf("path params should be required: %v", schema["required"])
+	}
+
+	tool, err = spec.BuildTool(ops[1], OpenAPIImportOptions{BaseURL: "http://localhost:8080"})
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if tool.Config["url"] != "http://localhost:8080/purge" || tool.Config["bodyParam"] != "body" {
+		t.Errorf("unexpected config: %+v", tool.Config)
+	}
+	b, _ := json.Marshal(tool.Config["inputSchema"])
+	var input struct {
+		Required   []string `json:"required"`
+		Properties struct {
+			Body struct {
+				Required   []string                   `json:"required"`
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"body"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(b, &input); err != nil {
+		t.Fatal(err)
+	}
+	if len(input.Required) != 1 || input.Required[0] != "body" {
+		t.Errorf("request body should be required: %s", b)
+	}
+	if _, ok := input.Properties.Body.Properties["urls"]; !ok || len(input.Properties.Body.Properties) != 1 {
+		t.Errorf("$ref should be inlined without read-only fields: %s", b)
+	}
+
+	// 生成的参数定义可直接用于对话工具
+	if _, err := NewAPITool(tool, APIOptions{}).Info(context.Background()); err != nil {
+		t.Errorf("generated schema should be usable: %v", err)
+	}
+}
+
+func TestFetchOpenAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/spec.yaml":
+			_, _ = w.Write([]byte(testOpenAPISpec))
+		case "/private":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("token required"))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	client := localOptions(t).Client
+
+	if _, err := FetchOpenAPI(context.Background(), nil, srv.URL+"/spec.yaml"); !errors.Is(err, ErrAddressNotAllowed) {
+		t.Errorf("loopback should be blocked by default: %v", err)
+	}
+	data, err := FetchOpenAPI(context.Background(), client, srv.URL+"/spec.yaml")
+	if err != nil || string(data) != testOpenAPISpec {
+		t.Fatalf("unexpected fetch result: %v", err)
+	}
+	if _, err := FetchOpenAPI(context.Background(), client, srv.URL+"/private"); err == nil || !strings.Contains(err.Error(), "status 403: token required") {
+		t.Errorf("error should carry status and body: %v", err)
+	}
+	if data, err := FetchOpenAPI(context.Background(), client, srv.URL+"/empty"); err != nil || len(data) != 0 {
+		t.Errorf("2xx responses should be accepted: %v", err)
+	}
+}
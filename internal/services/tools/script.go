@@ -0,0 +1,302 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	einotool "github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// 脚本语言（Tool.Config.language）
+const (
+	ScriptLanguageShell  = "shell"
+	ScriptLanguageBash   = "bash"
+	ScriptLanguagePython = "python"
+)
+
+// 默认限制
+const (
+	defaultScriptTimeout        = 30 * time.Second
+	defaultScriptCPUSeconds     = 10
+	defaultScriptMemoryMB       = 256
+	defaultScriptMaxOutputBytes = 64 << 10
+	scriptMaxFileBlocks         = 20480 // ulimit -f，512 字节块，即 10MB
+	defaultScriptPath           = "/usr/local/bin:/usr/bin:/bin"
+)
+
+// ScriptOptions 脚本执行限制
+type ScriptOptions struct {
+	Timeout        time.Duration // 墙钟超时，Tool.Config.timeout（秒）不得超过该值
+	CPUSeconds     int           // CPU 时间上限（ulimit -t）
+	MemoryMB       int           // 虚拟内存上限（ulimit -v）
+	MaxOutputBytes int           // stdout/stderr 各自的保留上限
+	EnvAllowlist   []string      // 允许从服务进程继承的环境变量名
+	ShellPath      string        // shell 解释器，默认 /bin/sh
+	BashPath       string        // bash 解释器，默认 bash
+	PythonPath     string        // python 解释器，默认 python3
+}
+
+// ScriptResult 脚本执行结果
+type ScriptResult struct {
+	ExitCode  int    `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated"`
+	TimedOut  bool   `json:"timedOut"`
+}
+
+// ToMap 转为执行记录使用的结构
+func (r *ScriptResult) ToMap() map[string]interface{} {
+	return map[string]interface{}{
+		"exitCode":  r.ExitCode,
+		"stdout":    r.Stdout,
+		"stderr":    r.Stderr,
+		"truncated": r.Truncated,
+		"timedOut":  r.TimedOut,
+	}
+}
+
+// ScriptLanguageSupported 是否支持该脚本语言
+func ScriptLanguageSupported(language string) bool {
+	switch strings.ToLower(language) {
+	case ScriptLanguageShell, "sh", ScriptLanguageBash, ScriptLanguagePython, "python3":
+		return true
+	}
+	return false
+}
+
+// ExecuteScript 在独立子进程中执行脚本工具
+// 脚本写入临时工作目录后由解释器执行：输入参数以 JSON 写入 stdin，
+// 环境变量仅保留白名单与 Tool.Config.env，CPU 时间、内存与文件大小由 ulimit 限制，
+// 超时后结束整个进程组。
+// Tool.Config 字段：script（必填）、language（shell|bash|python）、timeout（秒）、env（map）
+func ExecuteScript(ctx context.Context, tool models.Tool, params map[string]interface{}, opts ScriptOptions) (*ScriptResult, error) {
+	cfg := map[string]interface{}(tool.Config)
+	script, _ := asString(cfg["script"])
+	if strings.TrimSpace(script) == "" {
+		return nil, errors.New("missing script")
+	}
+	language, _ := asString(cfg["language"])
+	interpreter, ext, err := scriptInterpreter(language, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultScriptTimeout
+	}
+	if t := time.Duration(asInt(cfg["timeout"])) * time.Second; t > 0 && t < timeout {
+		timeout = t
+	}
+	cpu := opts.CPUSeconds
+	if cpu <= 0 {
+		cpu = defaultScriptCPUSeconds
+	}
+	mem := opts.MemoryMB
+	if mem <= 0 {
+		mem = defaultScriptMemoryMB
+	}
+	maxOutput := opts.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = defaultScriptMaxOutputBytes
+	}
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	stdin, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("encode params failed: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "orion-script-")
+	if err != nil {
+		return nil, fmt.Errorf("create work dir failed: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	scriptPath := filepath.Join(dir, "script"+ext)
+	if err := os.WriteFile(scriptPath, []byte(script), 0o600); err != nil {
+		return nil, fmt.Errorf("write script failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// 通过 sh 设置资源限制后 exec 解释器，限制只作用于脚本进程
+	limits := fmt.Sprintf("ulimit -t %d && ulimit -v %d && ulimit -f %d && exec \"$@\"", cpu, mem*1024, scriptMaxFileBlocks)
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", limits, "sh", interpreter, scriptPath)
+	cmd.Dir = dir
+	cmd.Env = scriptEnv(dir, cfg["env"], opts.EnvAllowlist)
+	cmd.Stdin = bytes.NewReader(stdin)
+	stdout := &limitedBuffer{limit: maxOutput}
+	stderr := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := configureScriptCmd(cmd); err != nil {
+		return nil, err
+	}
+
+	runErr := cmd.Run()
+	result := &ScriptResult{
+		ExitCode:  -1,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Truncated: stdout.truncated || stderr.truncated,
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	switch {
+	case result.TimedOut:
+		return result, fmt.Errorf("script timed out after %s", timeout)
+	case runErr != nil && cmd.ProcessState == nil:
+		return nil, fmt.Errorf("start script failed: %w", runErr)
+	case ctx.Err() != nil:
+		return result, ctx.Err()
+	case result.ExitCode != 0:
+		return result, fmt.Errorf("script exited with code %d: %s", result.ExitCode, truncateText(strings.TrimSpace(result.Stderr), 200))
+	}
+	return result, nil
+}
+
+// scriptInterpreter 返回解释器路径与脚本文件扩展名
+func scriptInterpreter(language string, opts ScriptOptions) (string, string, error) {
+	pick := func(configured, fallback string) string {
+		if configured != "" {
+			return configured
+		}
+		return fallback
+	}
+	var name, ext string
+	switch strings.ToLower(language) {
+	case ScriptLanguageShell, "sh":
+		name, ext = pick(opts.ShellPath, "/bin/sh"), ".sh"
+	case ScriptLanguageBash:
+		name, ext = pick(opts.BashPath, "bash"), ".sh"
+	case ScriptLanguagePython, "python3":
+		name, ext = pick(opts.PythonPath, "python3"), ".py"
+	default:
+		return "", "", fmt.Errorf("unsupported script language: %s", language)
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", "", fmt.Errorf("interpreter not found: %s", name)
+	}
+	return path, ext, nil
+}
+
+// scriptEnv 构造脚本环境：基础变量 + 白名单继承 + 工具配置的固定值
+func scriptEnv(dir string, toolEnv interface{}, allowlist []string) []string {
+	env := map[string]string{
+		"PATH":   defaultScriptPath,
+		"HOME":   dir,
+		"TMPDIR": dir,
+		"LANG":   "C.UTF-8",
+	}
+	for _, name := range allowlist {
+		if v, ok := os.LookupEnv(name); ok {
+			env[name] = v
+		}
+	}
+	if m, ok := toolEnv.(map[string]interface{}); ok {
+		for k, v := range m {
+			env[k] = fmt.Sprint(v)
+		}
+	}
+	out := make([]string, 0, len(env))
+	for k, v := range env {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// limitedBuffer 只保留前 limit 字节的输出，其余丢弃（不阻塞子进程）
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+			b.truncated = true
+		} else {
+			b.buf.Write(p)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// scriptTool 将脚本工具适配为 Eino 工具，供对话规划阶段调用
+type scriptTool struct {
+	tool models.Tool
+	opts ScriptOptions
+}
+
+// NewScriptTool 创建脚本工具的 Eino 适配
+// 参数定义取 Tool.Config.inputSchema（JSON Schema），未配置时接受任意对象。
+func NewScriptTool(tool models.Tool, opts ScriptOptions) einotool.InvokableTool {
+	return &scriptTool{tool: tool, opts: opts}
+}
+
+func (t *scriptTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	desc := t.tool.Description
+	if desc == "" {
+		desc = t.tool.DisplayName
+	}
+	raw := t.tool.Config["inputSchema"]
+	if raw == nil {
+		raw = map[string]interface{}{"type": "object"}
+	}
+	s, err := parseInputSchema(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &schema.ToolInfo{
+		Name:        t.tool.Name,
+		Desc:        desc,
+		ParamsOneOf: schema.NewParamsOneOfByJSONSchema(s),
+	}, nil
+}
+
+func (t *scriptTool) InvokableRun(ctx context.Context, argumentsInJSON string, _ ...einotool.Option) (string, error) {
+	params := map[string]interface{}{}
+	if strings.TrimSpace(argumentsInJSON) != "" {
+		if err := json.Unmarshal([]byte(argumentsInJSON), &params); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+	result, err := ExecuteScript(ctx, t.tool, params, t.opts)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package tools
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// configureScriptCmd 非 unix 平台无法设置资源限制，不执行脚本
+func configureScriptCmd(cmd *exec.Cmd) error {
+	return errors.New("script tools are only supported on unix platforms")
+}
@@ -0,0 +1,62 @@
+//go:build unix
+
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestExecuteScript(t *testing.T) {
+	t.Setenv("ORION_ALLOWED", "yes")
+	t.Setenv("ORION_SECRET", "leak")
+	tool := models.Tool{Config: models.JSONMap{
+		"language": "shell",
+		"script":   "cat; echo; echo \"|$ORION_ALLOWED|$ORION_SECRET|$TARGET|\"; pwd; echo oops >&2; exit 3",
+		"env":      map[string]interface{}{"TARGET": "cdn"},
+	}}
+	result, err := ExecuteScript(context.Background(), tool, map[string]interface{}{"host": "a.com"}, ScriptOptions{EnvAllowlist: []string{"ORION_ALLOWED"}})
+	if err == nil || !strings.Contains(err.Error(), "exited with code 3") {
+		t.Fatalf("expected exit error, got %v", err)
+	}
+	if result.ExitCode != 3 || strings.TrimSpace(result.Stderr) != "oops" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	if len(lines) != 3 || lines[0] != `{"host":"a.com"}` {
+		t.Fatalf("params should arrive on stdin: %q", result.Stdout)
+	}
+	if lines[1] != "|yes||cdn|" {
+		t.Errorf("only allow-listed env should be inherited: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "orion-script-") {
+		t.Errorf("script should run in a temp dir: %q", lines[2])
+	}
+}
+
+func TestExecuteScriptLimits(t *testing.T) {
+	tool := models.Tool{Config: models.JSONMap{"language": "shell", "script": "sleep 5 & sleep 5"}}
+	start := time.Now()
+	result, err := ExecuteScript(context.Background(), tool, nil, ScriptOptions{Timeout: 200 * time.Millisecond})
+	if err == nil || result == nil || !result.TimedOut {
+		t.Fatalf("expected timeout, got %+v %v", result, err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("timeout should kill the process group, took %s", time.Since(start))
+	}
+
+	tool.Config["script"] = "yes | head -c 1000"
+	result, err = ExecuteScript(context.Background(), tool, nil, ScriptOptions{MaxOutputBytes: 10})
+	if err != nil || !result.Truncated || len(result.Stdout) != 10 {
+		t.Errorf("output should be truncated: %+v %v", result, err)
+	}
+
+	tool.Config["language"] = "ruby"
+	if _, err := ExecuteScript(context.Background(), tool, nil, ScriptOptions{}); err == nil {
+		t.Error("unsupported language should fail")
+	}
+}
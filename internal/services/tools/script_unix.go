@@ -0,0 +1,20 @@
+//go:build unix
+
+package tools
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// configureScriptCmd 脚本进程独立成组，取消时结束整个进程组（包括脚本派生的子进程）
+func configureScriptCmd(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// 孙进程持有输出管道时不无限等待
+	cmd.WaitDelay = time.Second
+	return nil
+}
@@ -0,0 +1,287 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mcpp "github.com/cloudwego/eino-ext/components/tool/mcp"
+	einotool "github.com/cloudwego/eino/components/tool"
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+)
+
+// 重连退避区间
+const (
+	sessionRetryMin = time.Second
+	sessionRetryMax = time.Minute
+)
+
+// SessionManager 按 Tool.ID 维护长连接的 MCP 会话
+// 会话在首次使用时建立并缓存工具清单；连接失败按指数退避重试；
+// 工具配置变更（或调用时发现连接断开）后会话失效，下次使用时重新建立。
+type SessionManager struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*mcpSession
+	closed   bool
+}
+
+type mcpSession struct {
+	mu          sync.Mutex // 串行化连接建立
+	fingerprint string     // 配置指纹，配置变化时重建
+	cli         client.MCPClient
+	closeFn     func() error
+	tools       []einotool.BaseTool
+	failures    int
+	retryAt     time.Time
+	lastErr     error
+}
+
+// NewSessionManager 创建 MCP 会话管理器
+func NewSessionManager() *SessionManager {
+	return &SessionManager{sessions: make(map[uuid.UUID]*mcpSession)}
+}
+
+// Tools 返回工具对应 MCP Server 的工具集合（名称带 "工具名__" 前缀），必要时建立连接
+// ctx 仅用于本次初始化的超时控制，会话本身的生命周期与请求无关。
+func (m *SessionManager) Tools(ctx context.Context, tool models.Tool) ([]einotool.BaseTool, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errors.New("mcp session manager closed")
+	}
+	s, ok := m.sessions[tool.ID]
+	if !ok {
+		s = &mcpSession{}
+		m.sessions[tool.ID] = s
+	}
+	m.mu.Unlock()
+
+	return m.sessionTools(ctx, tool, s)
+}
+
+// sessionTools 在会话 s 上返回工具集合，必要时建立连接
+func (m *SessionManager) sessionTools(ctx context.Context, tool models.Tool, s *mcpSession) ([]einotool.BaseTool, error) {
+	fingerprint := toolFingerprint(tool)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cli != nil && s.fingerprint == fingerprint {
+		return s.tools, nil
+	}
+	if s.fingerprint != fingerprint {
+		// 配置已变化：关闭旧连接并清除退避状态
+		s.reset()
+		s.failures = 0
+		s.retryAt = time.Time{}
+	}
+	if time.Now().Before(s.retryAt) {
+		return nil, fmt.Errorf("mcp server unavailable, retry after %s: %w", time.Until(s.retryAt).Round(time.Second), s.lastErr)
+	}
+
+	if err := m.connect(ctx, tool, s); err != nil {
+		if ctx.Err() != nil {
+			// 请求已取消，不计入失败次数
+			return nil, err
+		}
+		s.failures++
+		s.retryAt = time.Now().Add(retryBackoff(s.failures))
+		s.lastErr = err
+		s.fingerprint = fingerprint
+		logger.Warn("MCP连接失败 tool=%s failures=%d: %v", tool.Name, s.failures, err)
+		return nil, err
+	}
+	// 从取得会话到连接建立期间，会话可能已被 Invalidate 或 Close 移除，之后不会再有人关闭它：
+	// 新建的连接随即关闭，避免泄漏
+	if !m.owns(tool.ID, s) {
+		s.reset()
+		return nil, errors.New("mcp session invalidated during connect")
+	}
+	s.fingerprint = fingerprint
+	s.failures = 0
+	s.retryAt = time.Time{}
+	s.lastErr = nil
+	return s.tools, nil
+}
+
+// connect 建立连接、初始化并缓存工具清单
+func (m *SessionManager) connect(ctx context.Context, tool models.Tool, s *mcpSession) error {
+	cfg := map[string]interface{}(tool.Config)
+	timeout := asInt(cfg["timeout"])
+	if timeout <= 0 {
+		timeout = 15
+	}
+	initCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	// 连接使用独立的后台上下文，避免随请求结束而断开
+	cli, closeFn, err := buildMCPClient(context.Background(), cfg)
+	if err != nil {
+		return err
+	}
+
+	initReq := mcp.InitializeRequest{}
+	initReq.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initReq.Params.ClientInfo = mcp.Implementation{Name: "orion", Version: "1.0.0"}
+	if _, err := cli.Initialize(initCtx, initReq); err != nil {
+		_ = closeFn()
+		return fmt.Errorf("mcp initialize failed: %w", err)
+	}
+
+	var names []string
+	if allowList, _ := asString(cfg["allowTools"]); allowList != "" {
+		for _, n := range strings.Split(allowList, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+	}
+	baseTools, err := mcpp.GetTools(initCtx, &mcpp.Config{Cli: cli, ToolNameList: names})
+	if err != nil {
+		_ = closeFn()
+		return fmt.Errorf("mcp get tools failed: %w", err)
+	}
+
+	tools := make([]einotool.BaseTool, 0, len(baseTools))
+	for _, t := range baseTools {
+		tools = append(tools, &sessionTool{
+			BaseTool: wrapToolNamePrefix(t, tool.Name+"__"),
+			manager:  m,
+			toolID:   tool.ID,
+			cli:      cli,
+		})
+	}
+
+	s.cli = cli
+	s.closeFn = closeFn
+	s.tools = tools
+	return nil
+}
+
+// Invalidate 关闭并移除工具的会话，在工具更新、启停、删除后调用
+func (m *SessionManager) Invalidate(toolID uuid.UUID) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	s, ok := m.sessions[toolID]
+	delete(m.sessions, toolID)
+	m.mu.Unlock()
+	if ok {
+		s.mu.Lock()
+		s.reset()
+		s.mu.Unlock()
+	}
+}
+
+// owns 会话是否仍由管理器持有
+func (m *SessionManager) owns(toolID uuid.UUID, s *mcpSession) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.closed && m.sessions[toolID] == s
+}
+
+// invalidateClient 仅当会话仍使用该连接时失效，避免误关已重建的新连接
+func (m *SessionManager) invalidateClient(toolID uuid.UUID, cli client.MCPClient) {
+	m.mu.Lock()
+	s, ok := m.sessions[toolID]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	if s.cli == cli {
+		s.reset()
+	}
+	s.mu.Unlock()
+}
+
+// Close 关闭全部会话
+func (m *SessionManager) Close() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.closed = true
+	sessions := m.sessions
+	m.sessions = make(map[uuid.UUID]*mcpSession)
+	m.mu.Unlock()
+	for _, s := range sessions {
+		s.mu.Lock()
+		s.reset()
+		s.mu.Unlock()
+	}
+}
+
+// reset 关闭连接并清空缓存的工具，调用方需持有 s.mu
+func (s *mcpSession) reset() {
+	if s.closeFn != nil {
+		_ = s.closeFn()
+	}
+	s.cli = nil
+	s.closeFn = nil
+	s.tools = nil
+}
+
+// sessionTool 包装会话中的工具：调用因连接问题失败时使会话失效，下次使用时重连
+type sessionTool struct {
+	einotool.BaseTool
+	manager *SessionManager
+	toolID  uuid.UUID
+	cli     client.MCPClient
+}
+
+func (t *sessionTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...einotool.Option) (string, error) {
+	inv, ok := t.BaseTool.(einotool.InvokableTool)
+	if !ok {
+		return "", errors.New("tool is not invokable")
+	}
+	out, err := inv.InvokableRun(ctx, argumentsInJSON, opts...)
+	if err != nil && ctx.Err() == nil && !isMCPToolError(err) {
+		t.manager.invalidateClient(t.toolID, t.cli)
+	}
+	return out, err
+}
+
+// isMCPToolError 工具自身返回的业务错误（连接正常），无需重连
+func isMCPToolError(err error) bool {
+	return strings.Contains(err.Error(), "mcp server return error")
+}
+
+// retryBackoff 指数退避：1s, 2s, 4s ... 最长1分钟
+func retryBackoff(failures int) time.Duration {
+	d := sessionRetryMin
+	for i := 1; i < failures && d < sessionRetryMax; i++ {
+		d *= 2
+	}
+	if d > sessionRetryMax {
+		d = sessionRetryMax
+	}
+	return d
+}
+
+// toolFingerprint 工具名与连接配置的指纹
+func toolFingerprint(tool models.Tool) string {
+	cfg := make(map[string]interface{}, len(tool.Config))
+	for k, v := range tool.Config {
+		// 服务端信息与工具清单是拉取结果，审批设置只影响调用流程，均不是连接配置
+		if k == "mcp_server" || k == "mcp_tools" || k == "requires_approval" {
+			continue
+		}
+		cfg[k] = v
+	}
+	b, _ := json.Marshal(cfg)
+	sum := sha256.Sum256(append([]byte(tool.Name+"\n"), b...))
+	return hex.EncodeToString(sum[:])
+}
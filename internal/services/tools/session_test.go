@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		10: time.Minute,
+	}
+	for failures, want := range cases {
+		if got := retryBackoff(failures); got != want {
+			t.Errorf("retryBackoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestToolFingerprint(t *testing.T) {
+	tool := models.Tool{Name: "grafana", Config: models.JSONMap{"protocol": "sse", "endpoint": "http://a"}}
+	base := toolFingerprint(tool)
+
+	tool.Config["mcp_tools"] = []interface{}{"query"}
+	if toolFingerprint(tool) != base {
+		t.Error("fetched metadata should not change the fingerprint")
+	}
+	tool.Config["endpoint"] = "http://b"
+	if toolFingerprint(tool) == base {
+		t.Error("endpoint change should change the fingerprint")
+	}
+}
+
+func TestSessionManagerBackoff(t *testing.T) {
+	logger.Init("test")
+	m := NewSessionManager()
+	defer m.Close()
+
+	tool := models.Tool{ID: uuid.New(), Name: "broken", Config: models.JSONMap{}}
+	if _, err := m.Tools(context.Background(), tool); err == nil || !strings.Contains(err.Error(), "missing protocol") {
+		t.Fatalf("expected connect error, got %v", err)
+	}
+	// 退避期内直接返回，不重复连接
+	if _, err := m.Tools(context.Background(), tool); err == nil || !strings.Contains(err.Error(), "retry after") {
+		t.Fatalf("expected backoff error, got %v", err)
+	}
+	// 配置变化后立即重试
+	tool.Config["protocol"] = "unknown"
+	if _, err := m.Tools(context.Background(), tool); err == nil || !strings.Contains(err.Error(), "unsupported mcp protocol") {
+		t.Fatalf("expected reconnect after config change, got %v", err)
+	}
+	// 失效后立即重试
+	m.Invalidate(tool.ID)
+	if _, err := m.Tools(context.Background(), tool); err == nil || strings.Contains(err.Error(), "retry after") {
+		t.Fatalf("expected reconnect after invalidate, got %v", err)
+	}
+}
+
+func TestSessionRemovedDuringConnect(t *testing.T) {
+	logger.Init("test")
+	srv := server.NewMCPServer("test", "1.0.0")
+	srv.AddTool(mcp.NewTool("ping"), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("pong"), nil
+	})
+	ts := server.NewTestStreamableHTTPServer(srv)
+	defer ts.Close()
+
+	m := NewSessionManager()
+	defer m.Close()
+	tool := models.Tool{ID: uuid.New(), Name: "ops", Config: models.JSONMap{"protocol": MCPProtoHTTPStreamable, "endpoint": ts.URL}}
+	tools, err := m.Tools(context.Background(), tool)
+	if err != nil || len(tools) != 1 {
+		t.Fatalf("expected one tool, got %d: %v", len(tools), err)
+	}
+
+	// 会话已被 Invalidate 移除后才建立连接：不返回工具，连接随即关闭
+	m.Invalidate(tool.ID)
+	removed := &mcpSession{}
+	if _, err := m.sessionTools(context.Background(), tool, removed); err == nil {
+		t.Error("removed session should not return tools")
+	}
+	if removed.cli != nil || removed.closeFn != nil {
+		t.Error("connection of a removed session should be closed")
+	}
+
+	// 管理器关闭后同样不保留连接
+	current := &mcpSession{}
+	m.mu.Lock()
+	m.sessions[tool.ID] = current
+	m.mu.Unlock()
+	m.Close()
+	if _, err := m.sessionTools(context.Background(), tool, current); err == nil || current.cli != nil {
+		t.Errorf("session of a closed manager should not stay connected: %v", err)
+	}
+}
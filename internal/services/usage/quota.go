@@ -0,0 +1,190 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+// 配额范围、周期与超出后的处理
+const (
+	ScopeUser       = "user"
+	ScopeDepartment = "department"
+
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+
+	ActionReject  = "reject"
+	ActionDegrade = "degrade"
+)
+
+// PeriodStart 配额周期的起点（本地时区）
+func PeriodStart(period string, now time.Time) time.Time {
+	y, m, d := now.Date()
+	if period == PeriodMonthly {
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+}
+
+// PeriodEnd 配额周期的终点（下一周期起点）
+func PeriodEnd(period string, now time.Time) time.Time {
+	start := PeriodStart(period, now)
+	if period == PeriodMonthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Status 一项配额及其当前周期内的用量
+type Status struct {
+	Quota   models.UsageQuota
+	Used    int64
+	ResetAt time.Time // 下一周期起点
+}
+
+// Exceeded 是否已用尽配额
+func (s Status) Exceeded() bool {
+	return s.Used >= s.Quota.TokenLimit
+}
+
+// Decision 配额检查结果，Quota 为空表示未超出任何配额
+type Decision struct {
+	Quota   *models.UsageQuota
+	Used    int64
+	ResetAt time.Time
+}
+
+// Rejected 是否应拒绝请求
+func (d Decision) Rejected() bool {
+	return d.Quota != nil && d.Quota.Action != ActionDegrade
+}
+
+// Degraded 是否应改用降级模型配置
+func (d Decision) Degraded() bool {
+	return d.Quota != nil && d.Quota.Action == ActionDegrade
+}
+
+// evaluate 选出已超出的配额：拒绝优先于降级，同类中超出比例最高者优先
+func evaluate(statuses []Status) Decision {
+	var best *Status
+	for i := range statuses {
+		s := &statuses[i]
+		if !s.Exceeded() {
+			continue
+		}
+		if best == nil || severity(s) > severity(best) {
+			best = s
+		}
+	}
+	if best == nil {
+		return Decision{}
+	}
+	q := best.Quota
+	return Decision{Quota: &q, Used: best.Used, ResetAt: best.ResetAt}
+}
+
+// severity 拒绝类配额排在降级之前，再按超出比例排序
+func severity(s *Status) float64 {
+	ratio := float64(s.Used) / float64(max(s.Quota.TokenLimit, 1))
+	if s.Quota.Action != ActionDegrade {
+		return ratio + 1e9
+	}
+	return ratio
+}
+
+// Quotas 配额检查
+type Quotas struct {
+	db *gorm.DB
+}
+
+// NewQuotas 创建配额检查
+func NewQuotas(db *gorm.DB) *Quotas {
+	return &Quotas{db: db}
+}
+
+// Check 检查用户及其部门的已启用配额
+func (q *Quotas) Check(ctx context.Context, userID uuid.UUID, department string) (Decision, error) {
+	statuses, err := q.Statuses(ctx, userID, department)
+	if err != nil {
+		return Decision{}, err
+	}
+	return evaluate(statuses), nil
+}
+
+// Statuses 用户及其部门的已启用配额与周期内用量，用量取 llm_usages 明细
+func (q *Quotas) Statuses(ctx context.Context, userID uuid.UUID, department string) ([]Status, error) {
+	db := q.db.WithContext(ctx)
+	var quotas []models.UsageQuota
+	err := db.Where("enabled = ?", true).
+		Where("(scope = ? AND subject = ?) OR (scope = ? AND subject = ? AND subject <> '')",
+			ScopeUser, userID.String(), ScopeDepartment, department).
+		Order("scope, period").
+		Find(&quotas).Error
+	if err != nil {
+		return nil, fmt.Errorf("load quotas: %w", err)
+	}
+
+	now := time.Now()
+	statuses := make([]Status, 0, len(quotas))
+	for _, quota := range quotas {
+		usage := db.Model(&models.LLMUsage{}).Where("created_at >= ?", PeriodStart(quota.Period, now))
+		if quota.Scope == ScopeDepartment {
+			usage = usage.Where("department = ?", quota.Subject)
+		} else {
+			usage = usage.Where("user_id = ?", userID)
+		}
+		var used int64
+		if err := usage.Select("COALESCE(SUM(total_tokens), 0)").Scan(&used).Error; err != nil {
+			return nil, fmt.Errorf("sum usage: %w", err)
+		}
+		statuses = append(statuses, Status{Quota: quota, Used: used, ResetAt: PeriodEnd(quota.Period, now)})
+	}
+	return statuses, nil
+}
+
+// Used 用户在周期内的 token 用量
+func (q *Quotas) Used(ctx context.Context, userID uuid.UUID, period string) (int64, error) {
+	var used int64
+	err := q.db.WithContext(ctx).Model(&models.LLMUsage{}).
+		Where("user_id = ? AND created_at >= ?", userID, PeriodStart(period, time.Now())).
+		Select("COALESCE(SUM(total_tokens), 0)").Scan(&used).Error
+	return used, err
+}
+
+// ValidateQuota 校验配额参数
+func ValidateQuota(q models.UsageQuota) error {
+	switch q.Scope {
+	case ScopeUser:
+		if _, err := uuid.Parse(q.Subject); err != nil {
+			return fmt.Errorf("subject must be a user id")
+		}
+	case ScopeDepartment:
+		if q.Subject == "" {
+			return fmt.Errorf("subject is required")
+		}
+	default:
+		return fmt.Errorf("unsupported scope: %s", q.Scope)
+	}
+	if q.Period != PeriodDaily && q.Period != PeriodMonthly {
+		return fmt.Errorf("unsupported period: %s", q.Period)
+	}
+	if q.TokenLimit <= 0 {
+		return fmt.Errorf("token_limit must be positive")
+	}
+	switch q.Action {
+	case ActionReject:
+	case ActionDegrade:
+		if q.DegradeProfile == "" {
+			return fmt.Errorf("degrade_profile is required for degrade action")
+		}
+	default:
+		return fmt.Errorf("unsupported action: %s", q.Action)
+	}
+	return nil
+}
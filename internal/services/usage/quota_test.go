@@ -0,0 +1,68 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liusCraft/orion/internal/database/models"
+)
+
+func TestPeriodBounds(t *testing.T) {
+	now := time.Date(2024, 3, 31, 15, 4, 5, 0, time.Local)
+
+	if got := PeriodStart(PeriodDaily, now); !got.Equal(time.Date(2024, 3, 31, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected daily start: %v", got)
+	}
+	if got := PeriodEnd(PeriodDaily, now); !got.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected daily end: %v", got)
+	}
+	if got := PeriodStart(PeriodMonthly, now); !got.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected monthly start: %v", got)
+	}
+	if got := PeriodEnd(PeriodMonthly, now); !got.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected monthly end: %v", got)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	userDaily := models.UsageQuota{Scope: ScopeUser, Period: PeriodDaily, TokenLimit: 1000, Action: ActionDegrade, DegradeProfile: "fast"}
+	deptMonthly := models.UsageQuota{Scope: ScopeDepartment, Period: PeriodMonthly, TokenLimit: 100000, Action: ActionReject}
+
+	resetAt := time.Now().Add(time.Hour)
+
+	if d := evaluate([]Status{{userDaily, 999, resetAt}, {deptMonthly, 5000, resetAt}}); d.Quota != nil {
+		t.Errorf("usage below limits should pass: %+v", d)
+	}
+
+	d := evaluate([]Status{{userDaily, 1000, resetAt}, {deptMonthly, 5000, resetAt}})
+	if !d.Degraded() || d.Used != 1000 || !d.ResetAt.Equal(resetAt) {
+		t.Errorf("exceeded degrade quota should degrade: %+v", d)
+	}
+
+	// 拒绝优先于降级，即使降级配额超出更多
+	d = evaluate([]Status{{userDaily, 5000, resetAt}, {deptMonthly, 100001, resetAt}})
+	if !d.Rejected() || d.Quota.Scope != ScopeDepartment {
+		t.Errorf("reject quota should win: %+v", d)
+	}
+}
+
+func TestValidateQuota(t *testing.T) {
+	valid := models.UsageQuota{Scope: ScopeDepartment, Subject: "研发", Period: PeriodMonthly, TokenLimit: 1, Action: ActionReject}
+	if err := ValidateQuota(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	cases := map[string]func(q *models.UsageQuota){
+		"user subject":    func(q *models.UsageQuota) { q.Scope = ScopeUser },
+		"period":          func(q *models.UsageQuota) { q.Period = "weekly" },
+		"limit":           func(q *models.UsageQuota) { q.TokenLimit = 0 },
+		"degrade profile": func(q *models.UsageQuota) { q.Action = ActionDegrade },
+	}
+	for name, mutate := range cases {
+		q := valid
+		mutate(&q)
+		if err := ValidateQuota(q); err == nil {
+			t.Errorf("%s: invalid quota should be rejected", name)
+		}
+	}
+}
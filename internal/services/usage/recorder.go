@@ -0,0 +1,42 @@
+package usage
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/database/models"
+	"github.com/liusCraft/orion/internal/pkg/logger"
+	"github.com/liusCraft/orion/internal/services/ai"
+)
+
+// Recorder 将每次模型调用的用量写入 llm_usages
+type Recorder struct {
+	db *gorm.DB
+}
+
+// NewRecorder 创建用量记录
+func NewRecorder(db *gorm.DB) *Recorder {
+	return &Recorder{db: db}
+}
+
+// RecordUsage 实现 ai.UsageRecorder；写入失败只记录日志，不影响对话
+func (r *Recorder) RecordUsage(ctx context.Context, u ai.Usage) {
+	row := models.LLMUsage{
+		UserID:           u.Scope.UserID,
+		Department:       u.Scope.Department,
+		ConversationID:   u.Scope.ConversationID,
+		MessageID:        u.Scope.MessageID,
+		Purpose:          u.Scope.Purpose,
+		Profile:          u.Profile,
+		Model:            u.Model,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.PromptTokens + u.CompletionTokens,
+		Estimated:        u.Estimated,
+		CreatedAt:        u.At,
+	}
+	if err := r.db.WithContext(ctx).Create(&row).Error; err != nil {
+		logger.Warn("记录模型用量失败 model=%s purpose=%s: %v", u.Model, u.Scope.Purpose, err)
+	}
+}
@@ -0,0 +1,194 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/liusCraft/orion/internal/pkg/logger"
+)
+
+// usage_statistics 中的模型用量指标
+const (
+	MetricPromptTokens     = "llm_prompt_tokens"
+	MetricCompletionTokens = "llm_completion_tokens"
+	MetricCalls            = "llm_calls"
+)
+
+// 报表的分组维度（usage_statistics.dimensions 中的键）
+var reportDimensions = map[string]string{
+	"department": "department",
+	"user":       "userId",
+	"model":      "model",
+	"profile":    "profile",
+}
+
+// Rollup 定期将 llm_usages 按天、用户、部门与模型汇总到 usage_statistics
+// 每次从上次汇总到的最后一天汇总到今天（至少包含昨天），服务停机期间的日期在重新启动后补齐；
+// 重复执行结果相同，今天的数据在下一次汇总前可能滞后。
+type Rollup struct {
+	db       *gorm.DB
+	interval time.Duration
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewRollup 创建汇总任务，interval 不大于 0 时使用 1 小时
+func NewRollup(db *gorm.DB, interval time.Duration) *Rollup {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &Rollup{db: db, interval: interval}
+}
+
+// Start 启动定期汇总
+func (r *Rollup) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			if err := r.run(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				logger.Warn("汇总模型用量失败: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop 停止定期汇总
+func (r *Rollup) Stop() {
+	if r == nil || r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+}
+
+// run 汇总尚未汇总或可能不完整的日期
+func (r *Rollup) run(ctx context.Context, now time.Time) error {
+	start, err := rollupWatermark(ctx, r.db, now.Location())
+	if err != nil {
+		return err
+	}
+	from, to := pendingRange(start, now)
+	return RollupDays(ctx, r.db, from, to)
+}
+
+// rollupWatermark 汇总的起点：上次汇总到的最后一天（当天可能不完整），尚无汇总结果时为最早的用量记录所在日；
+// 都没有时返回 nil
+func rollupWatermark(ctx context.Context, db *gorm.DB, loc *time.Location) (*time.Time, error) {
+	var last, first sql.NullTime
+	if err := db.WithContext(ctx).Raw("SELECT MAX(date) FROM usage_statistics WHERE metric_type IN (?, ?, ?)",
+		MetricPromptTokens, MetricCompletionTokens, MetricCalls).Scan(&last).Error; err != nil {
+		return nil, fmt.Errorf("load rollup watermark: %w", err)
+	}
+	if last.Valid {
+		// date 列只有日期部分，按本地时区的同一天计
+		y, m, d := last.Time.Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, loc)
+		return &day, nil
+	}
+	if err := db.WithContext(ctx).Raw("SELECT MIN(created_at) FROM llm_usages").Scan(&first).Error; err != nil {
+		return nil, fmt.Errorf("load first llm usage: %w", err)
+	}
+	if first.Valid {
+		day := truncateDay(first.Time.In(loc))
+		return &day, nil
+	}
+	return nil, nil
+}
+
+// pendingRange 本次汇总的范围 [from, to)：从 start 所在日到今天，至少包含昨天与今天
+func pendingRange(start *time.Time, now time.Time) (time.Time, time.Time) {
+	today := truncateDay(now)
+	from := today.AddDate(0, 0, -1)
+	if start != nil && start.Before(from) {
+		from = truncateDay(*start)
+	}
+	return from, today.AddDate(0, 0, 1)
+}
+
+// RollupDays 汇总 [from, to) 内各天的用量，已有的汇总结果被覆盖
+func RollupDays(ctx context.Context, db *gorm.DB, from, to time.Time) error {
+	err := db.WithContext(ctx).Exec(`
+		INSERT INTO usage_statistics (id, date, metric_type, dimension_key, metric_value, dimensions, created_at)
+		SELECT gen_random_uuid(), u.day, m.metric_type,
+			md5(concat_ws('|', u.user_id, u.department, u.profile, u.model)),
+			m.value,
+			jsonb_build_object('userId', u.user_id, 'department', u.department, 'profile', u.profile, 'model', u.model),
+			now()
+		FROM (
+			SELECT date(created_at) AS day, user_id, department, profile, model,
+				SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, COUNT(*) AS calls
+			FROM llm_usages
+			WHERE created_at >= ? AND created_at < ?
+			GROUP BY 1, 2, 3, 4, 5
+		) u
+		CROSS JOIN LATERAL (VALUES (?, u.prompt_tokens), (?, u.completion_tokens), (?, u.calls)) AS m(metric_type, value)
+		ON CONFLICT (date, metric_type, dimension_key)
+		DO UPDATE SET metric_value = EXCLUDED.metric_value, dimensions = EXCLUDED.dimensions`,
+		from, to, MetricPromptTokens, MetricCompletionTokens, MetricCalls).Error
+	if err != nil {
+		return fmt.Errorf("rollup llm usage: %w", err)
+	}
+	return nil
+}
+
+// ReportRow 用量报表的一行
+type ReportRow struct {
+	Key              string `json:"key"` // 分组值：部门、用户ID、模型、配置名或日期
+	PromptTokens     int64  `json:"promptTokens"`
+	CompletionTokens int64  `json:"completionTokens"`
+	TotalTokens      int64  `json:"totalTokens"`
+	Calls            int64  `json:"calls"`
+}
+
+// ValidGroupBy 是否为支持的报表分组维度
+func ValidGroupBy(groupBy string) bool {
+	_, ok := reportDimensions[groupBy]
+	return ok || groupBy == "date"
+}
+
+// Report 按维度汇总 [from, to] 内各天的用量（来自 usage_statistics），按总 token 数降序
+// groupBy 为 department、user、model、profile 或 date。
+func Report(ctx context.Context, db *gorm.DB, from, to time.Time, groupBy string) ([]ReportRow, error) {
+	keyExpr := "to_char(date, 'YYYY-MM-DD')"
+	if groupBy != "date" {
+		dim, ok := reportDimensions[groupBy]
+		if !ok {
+			return nil, fmt.Errorf("unsupported groupBy: %s", groupBy)
+		}
+		keyExpr = fmt.Sprintf("COALESCE(dimensions->>'%s', '')", dim)
+	}
+	var rows []ReportRow
+	err := db.WithContext(ctx).Raw(`
+		SELECT `+keyExpr+` AS key,
+			COALESCE(SUM(metric_value) FILTER (WHERE metric_type = ?), 0) AS prompt_tokens,
+			COALESCE(SUM(metric_value) FILTER (WHERE metric_type = ?), 0) AS completion_tokens,
+			COALESCE(SUM(metric_value) FILTER (WHERE metric_type IN (?, ?)), 0) AS total_tokens,
+			COALESCE(SUM(metric_value) FILTER (WHERE metric_type = ?), 0) AS calls
+		FROM usage_statistics
+		WHERE metric_type IN (?, ?, ?) AND date >= ? AND date <= ?
+		GROUP BY 1
+		ORDER BY total_tokens DESC, key`,
+		MetricPromptTokens, MetricCompletionTokens, MetricPromptTokens, MetricCompletionTokens, MetricCalls,
+		MetricPromptTokens, MetricCompletionTokens, MetricCalls, truncateDay(from), truncateDay(to)).Scan(&rows).Error
+	return rows, err
+}
+
+// truncateDay 当天零点（本地时区）
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
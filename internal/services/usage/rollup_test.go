@@ -0,0 +1,31 @@
+package usage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPendingRange(t *testing.T) {
+	now := time.Date(2024, 3, 31, 15, 4, 5, 0, time.Local)
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.Local) }
+	tomorrow := time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)
+	ptr := func(t time.Time) *time.Time { return &t }
+
+	cases := []struct {
+		name  string
+		start *time.Time
+		from  time.Time
+	}{
+		{"no usage", nil, day(30)},
+		{"up to date", ptr(day(31)), day(30)},
+		// 停机数天后从上次汇总到的那天补齐
+		{"gap", ptr(day(26)), day(26)},
+		{"first run", ptr(time.Date(2024, 3, 20, 9, 30, 0, 0, time.Local)), day(20)},
+	}
+	for _, tc := range cases {
+		from, to := pendingRange(tc.start, now)
+		if !from.Equal(tc.from) || !to.Equal(tomorrow) {
+			t.Errorf("%s: unexpected range [%v, %v)", tc.name, from, to)
+		}
+	}
+}